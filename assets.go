@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gothoom/climg"
+)
+
+// The image browser lists every picture in CL_Images. This file holds the
+// catalog and filtering; the window itself lives in assets_ui.go.
+
+const exportDir = "exports"
+
+// assetEntry summarises one picture for the browser.
+type assetEntry struct {
+	ID     uint32
+	W, H   int
+	Plane  int
+	Frames int
+	Names  []string // items that use this picture
+}
+
+// buildAssetCatalog returns an entry for each picture in c sorted by ID.
+func buildAssetCatalog(c *climg.CLImages) []assetEntry {
+	if c == nil {
+		return nil
+	}
+	names := map[uint32][]string{}
+	for _, id := range c.ItemIDs() {
+		it, ok := c.Item(id)
+		if !ok || it.Name == "" {
+			continue
+		}
+		seen := map[uint32]bool{}
+		for _, pict := range []uint32{id, it.WornPictID, it.RightHandPictID, it.LeftHandPictID} {
+			if pict != 0 && !seen[pict] {
+				seen[pict] = true
+				names[pict] = append(names[pict], it.Name)
+			}
+		}
+	}
+	ids := c.IDs()
+	entries := make([]assetEntry, 0, len(ids))
+	for _, id := range ids {
+		w, h := c.Size(id)
+		n := names[id]
+		sort.Strings(n)
+		entries = append(entries, assetEntry{
+			ID:     id,
+			W:      w,
+			H:      h,
+			Plane:  c.Plane(id),
+			Frames: c.NumFrames(id),
+			Names:  n,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// filterAssets returns the entries matching query. Each space separated term
+// must match: "plane:N" (or "p:N") selects a plane, a number matches IDs that
+// contain it, and anything else matches item names case-insensitively.
+func filterAssets(entries []assetEntry, query string) []assetEntry {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return entries
+	}
+	var out []assetEntry
+	for _, e := range entries {
+		if assetMatches(e, terms) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func assetMatches(e assetEntry, terms []string) bool {
+	for _, t := range terms {
+		if v, ok := strings.CutPrefix(t, "plane:"); ok {
+			t = "p:" + v
+		}
+		if v, ok := strings.CutPrefix(t, "p:"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || e.Plane != n {
+				return false
+			}
+			continue
+		}
+		if _, err := strconv.Atoi(t); err == nil {
+			if !strings.Contains(strconv.FormatUint(uint64(e.ID), 10), t) {
+				return false
+			}
+			continue
+		}
+		found := false
+		for _, n := range e.Names {
+			if strings.Contains(strings.ToLower(n), t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// describe returns a one-line summary of e for labels and bug reports.
+func (e assetEntry) describe() string {
+	s := fmt.Sprintf("Pict %d  %dx%d  plane %d", e.ID, e.W, e.H, e.Plane)
+	if e.Frames > 1 {
+		s += fmt.Sprintf("  %d frames", e.Frames)
+	}
+	if len(e.Names) > 0 {
+		s += "  " + strings.Join(e.Names, ", ")
+	}
+	return s
+}
+
+// spriteFrameRect returns the area of frame within a sheet decoded by
+// GetRGBA, skipping its 1 pixel border. Frames are stacked vertically.
+func spriteFrameRect(sheet image.Rectangle, frames, frame int) image.Rectangle {
+	frames = max(frames, 1)
+	w := sheet.Dx() - 2
+	h := (sheet.Dy() - 2) / frames
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}
+	}
+	r := image.Rect(1, 1+frame*h, 1+w, 1+(frame+1)*h)
+	return r.Add(sheet.Min)
+}
+
+// exportSprite writes the full sheet of picture id, recolored with custom, as
+// a PNG under exportDir and returns its path.
+func exportSprite(id uint32, custom []byte) (string, error) {
+	if clImages == nil {
+		return "", fmt.Errorf("CL_Images not loaded")
+	}
+	img := clImages.GetRGBA(id, custom, false)
+	if img == nil {
+		return "", fmt.Errorf("pict %d not found", id)
+	}
+	b := img.Bounds().Inset(1)
+	return writeExportPNG(fmt.Sprintf("pict-%d.png", id), img.SubImage(b))
+}
+
+func writeExportPNG(name string, img image.Image) (string, error) {
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(exportDir, name)
+	return path, writePNG(path, img)
+}
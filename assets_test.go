@@ -0,0 +1,54 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFilterAssets(t *testing.T) {
+	entries := []assetEntry{
+		{ID: 100, Plane: 0, Names: []string{"Short Sword"}},
+		{ID: 1100, Plane: 2, Names: []string{"Long Sword"}},
+		{ID: 205, Plane: 2},
+	}
+	ids := func(es []assetEntry) []uint32 {
+		var out []uint32
+		for _, e := range es {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+	cases := []struct {
+		query string
+		want  []uint32
+	}{
+		{"", []uint32{100, 1100, 205}},
+		{"100", []uint32{100, 1100}},
+		{"sword", []uint32{100, 1100}},
+		{"LONG", []uint32{1100}},
+		{"plane:2", []uint32{1100, 205}},
+		{"p:2 sword", []uint32{1100}},
+		{"p:x", nil},
+	}
+	for _, c := range cases {
+		got := ids(filterAssets(entries, c.query))
+		if len(got) != len(c.want) {
+			t.Errorf("%q: got %v, want %v", c.query, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%q: got %v, want %v", c.query, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSpriteFrameRectSkipsBorder(t *testing.T) {
+	// A 4x6 picture with 3 frames, decoded with a 1 pixel border.
+	sheet := image.Rect(0, 0, 6, 8)
+	if got, want := spriteFrameRect(sheet, 3, 1), image.Rect(1, 3, 5, 5); got != want {
+		t.Fatalf("frame 1 = %v, want %v", got, want)
+	}
+}
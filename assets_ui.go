@@ -0,0 +1,361 @@
+//go:build !test
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+	"time"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	assetCols        = 6
+	assetRows        = 4
+	assetThumbSize   = 48
+	assetPreviewSize = 160
+	// assetCustomSlots is more than any sprite uses; extra entries are ignored.
+	assetCustomSlots = 32
+)
+
+var (
+	assetWin       *eui.WindowData
+	assetQuery     string
+	assetCatalog   []assetEntry
+	assetFiltered  []assetEntry
+	assetPage      int
+	assetSelected  = -1 // index into assetFiltered
+	assetCountText *eui.ItemData
+	assetInfoText  *eui.ItemData
+	assetThumbs    [assetCols * assetRows]*eui.ItemData
+	assetThumbImgs [assetCols * assetRows]*ebiten.Image
+
+	assetPreviewItem *eui.ItemData
+	assetPreviewImg  *ebiten.Image
+	assetSheet       *ebiten.Image
+	assetSheetKey    string
+	assetLastDraw    time.Time
+	assetAnimStart   = time.Now()
+
+	assetTestColors bool
+	assetTestColor  = 0
+)
+
+func makeAssetBrowserWindow() {
+	if assetWin != nil {
+		return
+	}
+	const width = assetCols * (assetThumbSize + 4)
+	assetWin = eui.NewWindow()
+	assetWin.Title = "Image Browser"
+	assetWin.Closable = true
+	assetWin.Resizable = false
+	assetWin.AutoSize = true
+	assetWin.Movable = true
+	assetWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+
+	filter, filterEvents := eui.NewInput()
+	filter.Label = "Filter"
+	filter.TextPtr = &assetQuery
+	filter.Tooltip = "ID digits, item name, or plane:N"
+	filter.Size = eui.Point{X: width, Y: 24}
+	filterEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventInputChanged {
+			assetQuery = ev.Text
+			applyAssetFilter()
+		}
+	}
+	flow.AddItem(filter)
+
+	nav := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	prev, prevEvents := eui.NewButton()
+	prev.Text = "<"
+	prev.Size = eui.Point{X: 32, Y: 24}
+	prevEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setAssetPage(assetPage - 1)
+		}
+	}
+	nav.AddItem(prev)
+	next, nextEvents := eui.NewButton()
+	next.Text = ">"
+	next.Size = eui.Point{X: 32, Y: 24}
+	nextEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setAssetPage(assetPage + 1)
+		}
+	}
+	nav.AddItem(next)
+	assetCountText, _ = eui.NewText()
+	assetCountText.Size = eui.Point{X: width - 64, Y: 24}
+	assetCountText.FontSize = 10
+	nav.AddItem(assetCountText)
+	flow.AddItem(nav)
+
+	for r := 0; r < assetRows; r++ {
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		for c := 0; c < assetCols; c++ {
+			slot := r*assetCols + c
+			btn, events := eui.NewButton()
+			btn.Size = eui.Point{X: assetThumbSize, Y: assetThumbSize}
+			btn.Margin = 2
+			assetThumbImgs[slot] = ebiten.NewImage(assetThumbSize, assetThumbSize)
+			events.Handle = func(ev eui.UIEvent) {
+				if ev.Type == eui.EventClick {
+					selectAsset(assetPage*len(assetThumbs) + slot)
+				}
+			}
+			assetThumbs[slot] = btn
+			row.AddItem(btn)
+		}
+		flow.AddItem(row)
+	}
+
+	assetPreviewItem, assetPreviewImg = eui.NewImageItem(assetPreviewSize, assetPreviewSize)
+	flow.AddItem(assetPreviewItem)
+
+	assetInfoText, _ = eui.NewText()
+	assetInfoText.Size = eui.Point{X: width, Y: 64}
+	assetInfoText.FontSize = 10
+	flow.AddItem(assetInfoText)
+
+	colorRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	colorCB, colorEvents := eui.NewCheckbox()
+	colorCB.Text = "Test colors"
+	colorCB.Tooltip = "Fill the custom color slots with the chosen palette index"
+	colorCB.Size = eui.Point{X: 110, Y: 24}
+	colorEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			assetTestColors = ev.Checked
+		}
+	}
+	colorRow.AddItem(colorCB)
+	colorSlider, colorSliderEvents := eui.NewSlider()
+	colorSlider.Label = "Index"
+	colorSlider.MinValue = 0
+	colorSlider.MaxValue = 255
+	colorSlider.IntOnly = true
+	colorSlider.Size = eui.Point{X: width - 120, Y: 24}
+	colorSliderEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventSliderChanged {
+			assetTestColor = int(ev.Value)
+		}
+	}
+	colorRow.AddItem(colorSlider)
+	flow.AddItem(colorRow)
+
+	actions := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	exportBtn, exportEvents := eui.NewButton()
+	exportBtn.Text = "Export PNG"
+	exportBtn.Size = eui.Point{X: width / 2, Y: 24}
+	exportBtn.Tooltip = "Save the whole sheet to the exports folder"
+	exportEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type != eui.EventClick {
+			return
+		}
+		e, ok := selectedAsset()
+		if !ok {
+			return
+		}
+		path, err := exportSprite(e.ID, assetCustomColors())
+		if err != nil {
+			logError("export pict %d: %v", e.ID, err)
+			return
+		}
+		consoleMessage("Exported " + path)
+	}
+	actions.AddItem(exportBtn)
+	chatBtn, chatEvents := eui.NewButton()
+	chatBtn.Text = "ID to Chat"
+	chatBtn.Size = eui.Point{X: width / 2, Y: 24}
+	chatBtn.Tooltip = "Type the picture ID into the chat input"
+	chatEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type != eui.EventClick {
+			return
+		}
+		if e, ok := selectedAsset(); ok {
+			inputActive = true
+			inputText = append(inputText, []rune(fmt.Sprintf("%d", e.ID))...)
+			updateConsoleWindow()
+		}
+	}
+	actions.AddItem(chatBtn)
+	flow.AddItem(actions)
+
+	assetWin.AddItem(flow)
+	assetWin.AddWindow(false)
+}
+
+// openAssetBrowser (re)loads the catalog and shows the window near anchor.
+func openAssetBrowser(anchor *eui.ItemData) {
+	makeAssetBrowserWindow()
+	if assetWin.IsOpen() {
+		assetWin.Close()
+		return
+	}
+	assetCatalog = buildAssetCatalog(clImages)
+	applyAssetFilter()
+	assetWin.MarkOpenNear(anchor)
+}
+
+func applyAssetFilter() {
+	assetFiltered = filterAssets(assetCatalog, assetQuery)
+	assetSelected = -1
+	setAssetPage(0)
+	selectAsset(0)
+}
+
+func setAssetPage(page int) {
+	pages := (len(assetFiltered) + len(assetThumbs) - 1) / len(assetThumbs)
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	assetPage = page
+	for slot, btn := range assetThumbs {
+		idx := page*len(assetThumbs) + slot
+		img := assetThumbImgs[slot]
+		img.Clear()
+		if idx >= len(assetFiltered) {
+			btn.Image = nil
+			btn.Text = ""
+			btn.Tooltip = ""
+			btn.Invisible = true
+			btn.Dirty = true
+			continue
+		}
+		e := assetFiltered[idx]
+		drawAssetThumb(img, e)
+		btn.Image = img
+		btn.Tooltip = e.describe()
+		btn.Invisible = false
+		btn.Dirty = true
+	}
+	if assetCountText != nil {
+		assetCountText.Text = fmt.Sprintf("%d of %d pictures, page %d/%d", len(assetFiltered), len(assetCatalog), assetPage+1, max(pages, 1))
+		assetCountText.Dirty = true
+	}
+	if assetWin != nil {
+		assetWin.Refresh()
+	}
+}
+
+// drawAssetThumb fits the first frame of e into dst.
+func drawAssetThumb(dst *ebiten.Image, e assetEntry) {
+	dst.Fill(color.RGBA{0x20, 0x20, 0x20, 0xff})
+	if clImages == nil {
+		return
+	}
+	rgba := clImages.GetRGBA(e.ID, nil, false)
+	if rgba == nil {
+		return
+	}
+	sheet := ebiten.NewImageFromImage(rgba)
+	defer sheet.Deallocate()
+	drawAssetFrame(dst, sheet, e, 0)
+}
+
+// drawAssetFrame draws frame of sheet into dst, scaled to fit and centered.
+func drawAssetFrame(dst, sheet *ebiten.Image, e assetEntry, frame int) {
+	r := spriteFrameRect(sheet.Bounds(), e.Frames, frame)
+	if r.Empty() {
+		return
+	}
+	w, h := r.Dx(), r.Dy()
+	src := sheet.SubImage(r).(*ebiten.Image)
+	dw, dh := dst.Bounds().Dx(), dst.Bounds().Dy()
+	scale := min(float64(dw)/float64(w), float64(dh)/float64(h))
+	if scale >= 1 {
+		scale = float64(int(scale))
+	}
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(dw)-float64(w)*scale)/2, (float64(dh)-float64(h)*scale)/2)
+	dst.DrawImage(src, op)
+}
+
+func selectAsset(idx int) {
+	if idx < 0 || idx >= len(assetFiltered) {
+		assetSelected = -1
+	} else {
+		assetSelected = idx
+	}
+	assetSheetKey = ""
+	if assetInfoText == nil {
+		return
+	}
+	e, ok := selectedAsset()
+	if !ok {
+		assetInfoText.Text = "No picture selected"
+		assetInfoText.Dirty = true
+		return
+	}
+	lines := []string{e.describe()}
+	if clImages != nil {
+		if it, ok := clImages.Item(e.ID); ok {
+			lines = append(lines, fmt.Sprintf("Item %d: %s  slot %d  worn %d  right %d  left %d",
+				e.ID, clImages.ItemName(e.ID), it.Slot, it.WornPictID, it.RightHandPictID, it.LeftHandPictID))
+		}
+	}
+	assetInfoText.Text = strings.Join(lines, "\n")
+	assetInfoText.Dirty = true
+}
+
+func selectedAsset() (assetEntry, bool) {
+	if assetSelected < 0 || assetSelected >= len(assetFiltered) {
+		return assetEntry{}, false
+	}
+	return assetFiltered[assetSelected], true
+}
+
+// assetCustomColors returns the test palette, or nil when disabled.
+func assetCustomColors() []byte {
+	if !assetTestColors {
+		return nil
+	}
+	return bytes.Repeat([]byte{byte(assetTestColor)}, assetCustomSlots)
+}
+
+// updateAssetBrowser animates the preview. It is called from Draw so GPU
+// work stays on the render thread.
+func updateAssetBrowser() {
+	if assetWin == nil || !assetWin.IsOpen() || assetPreviewImg == nil {
+		return
+	}
+	if time.Since(assetLastDraw) < framems*time.Millisecond/2 {
+		return
+	}
+	assetLastDraw = time.Now()
+	assetPreviewImg.Fill(color.RGBA{0x20, 0x20, 0x20, 0xff})
+	defer func() { assetPreviewItem.Dirty = true }()
+	e, ok := selectedAsset()
+	if !ok || clImages == nil {
+		return
+	}
+	custom := assetCustomColors()
+	key := fmt.Sprintf("%d/%v", e.ID, custom)
+	if key != assetSheetKey {
+		if assetSheet != nil {
+			assetSheet.Deallocate()
+			assetSheet = nil
+		}
+		assetSheetKey = key
+		if rgba := clImages.GetRGBA(e.ID, custom, false); rgba != nil {
+			assetSheet = ebiten.NewImageFromImage(rgba)
+		}
+	}
+	if assetSheet == nil {
+		return
+	}
+	counter := int(time.Since(assetAnimStart) / (framems * time.Millisecond))
+	drawAssetFrame(assetPreviewImg, assetSheet, e, clImages.FrameIndex(e.ID, counter))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// The sprite atlas packs decoded sprite sheets into a few large shared
+// textures. Frames handed out by loadImageFrame and loadMobileFrame are
+// sub-images of those pages, so consecutive DrawImage calls in drawScene hit
+// the same texture and batch into one draw call.
+//
+// Ebiten already packs managed images into its own atlas, so the sprite
+// atlas is only used with PotatoComputer, where newImage makes every sheet
+// an unmanaged image with a texture of its own.
+
+const (
+	// atlasPageSize is the largest texture PotatoComputer GPUs support.
+	atlasPageSize = 4096
+	// atlasMaxSprite is the largest sheet dimension packed into the atlas;
+	// bigger sheets keep their own texture. Mobile sheets are 16 frames
+	// plus a 2 pixel border wide, so this takes mobiles up to 64 px.
+	atlasMaxSprite = 16*64 + 2
+	// atlasMaxPages bounds atlas memory (4 pages ≈ 256 MB of RGBA).
+	atlasMaxPages = 4
+	// atlasPad separates neighbouring sheets so filtering never bleeds.
+	atlasPad = 1
+)
+
+type atlasShelf struct {
+	y, h int // vertical extent of the shelf
+	x    int // next free column
+}
+
+type atlasPage struct {
+	// img is created on the first insert so packing needs no GPU.
+	img     *ebiten.Image
+	shelves []atlasShelf
+	nextY   int
+	used    uint64 // atlas tick of the most recent use
+	keys    []sheetKey
+}
+
+type spriteAtlas struct {
+	pages []*atlasPage
+	where map[sheetKey]*atlasPage
+	tick  uint64
+	evict int // number of page evictions, for debug stats
+	// drop forgets everything cached for a sheet on an evicted page.
+	drop func(sheetKey)
+}
+
+// sheetAtlas is guarded by imageMu.
+var sheetAtlas = spriteAtlas{where: make(map[sheetKey]*atlasPage), drop: dropSheetLocked}
+
+// atlasActive reports whether loadSheet should pack sheets into sheetAtlas.
+func atlasActive() bool {
+	return gs.SpriteAtlas && gs.PotatoComputer && !gs.NoCaching
+}
+
+// alloc reserves a w×h rectangle on the page using shelf packing.
+func (p *atlasPage) alloc(w, h int) (image.Rectangle, bool) {
+	w += atlasPad
+	h += atlasPad
+	best := -1
+	for i, s := range p.shelves {
+		if h <= s.h && s.x+w <= atlasPageSize {
+			// Prefer the tightest shelf to limit wasted height.
+			if best < 0 || s.h < p.shelves[best].h {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		if p.nextY+h > atlasPageSize || w > atlasPageSize {
+			return image.Rectangle{}, false
+		}
+		p.shelves = append(p.shelves, atlasShelf{y: p.nextY, h: h})
+		p.nextY += h
+		best = len(p.shelves) - 1
+	}
+	s := &p.shelves[best]
+	r := image.Rect(s.x, s.y, s.x+w-atlasPad, s.y+h-atlasPad)
+	s.x += w
+	return r, true
+}
+
+// insert uploads src into the atlas under key and returns the sub-image. It
+// returns nil when src is too large to share a page. imageMu must be held.
+func (a *spriteAtlas) insert(key sheetKey, src *image.RGBA) *ebiten.Image {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w > atlasMaxSprite || h > atlasMaxSprite {
+		return nil
+	}
+	var page *atlasPage
+	var rect image.Rectangle
+	for _, p := range a.pages {
+		if r, ok := p.alloc(w, h); ok {
+			page, rect = p, r
+			break
+		}
+	}
+	if page == nil {
+		if len(a.pages) < atlasMaxPages {
+			page = &atlasPage{}
+			a.pages = append(a.pages, page)
+		} else {
+			page = a.evictLRU()
+		}
+		var ok bool
+		if rect, ok = page.alloc(w, h); !ok {
+			return nil
+		}
+	}
+	if page.img == nil {
+		page.img = newImage(atlasPageSize, atlasPageSize)
+	}
+	sub := page.img.SubImage(rect).(*ebiten.Image)
+	sub.WritePixels(src.Pix)
+	page.keys = append(page.keys, key)
+	a.where[key] = page
+	a.touchPage(page)
+	return sub
+}
+
+// touch marks the page holding key as recently used. imageMu must be held.
+func (a *spriteAtlas) touch(key sheetKey) {
+	if p := a.where[key]; p != nil {
+		a.touchPage(p)
+	}
+}
+
+func (a *spriteAtlas) touchPage(p *atlasPage) {
+	a.tick++
+	p.used = a.tick
+}
+
+// pageImage returns the texture holding key, or nil if key is not packed.
+// imageMu must be held.
+func (a *spriteAtlas) pageImage(key sheetKey) *ebiten.Image {
+	if p := a.where[key]; p != nil {
+		return p.img
+	}
+	return nil
+}
+
+// evictLRU empties the least recently used page and drops every cached
+// sheet and frame that pointed into it. The page gets a fresh texture on its
+// next insert so any image still held elsewhere (e.g. a window icon) keeps
+// its old pixels until it is released. imageMu must be held.
+func (a *spriteAtlas) evictLRU() *atlasPage {
+	lru := a.pages[0]
+	for _, p := range a.pages[1:] {
+		if p.used < lru.used {
+			lru = p
+		}
+	}
+	for _, k := range lru.keys {
+		delete(a.where, k)
+		a.drop(k)
+	}
+	lru.keys = nil
+	lru.shelves = nil
+	lru.nextY = 0
+	lru.img = nil
+	a.evict++
+	return lru
+}
+
+// dropSheetLocked removes the sheet k and the frames cut from it.
+func dropSheetLocked(k sheetKey) {
+	delete(sheetCache, k)
+	dropSheetFramesLocked(k)
+}
+
+// dropSheetFramesLocked removes frames cut from the sheet identified by k.
+// Override sheets are shared by picture and mobile frames, so both caches are
+// searched for them.
+func dropSheetFramesLocked(k sheetKey) {
+	if k.forceTransparent || k.override != 0 {
+		for mk := range mobileCache {
+			if mk.id == k.id && mk.override == k.override && mk.colorsLen == k.colorsLen && mk.colors == k.colors {
+				delete(mobileCache, mk)
+			}
+		}
+	}
+	if !k.forceTransparent && k.colorsLen == 0 {
+		for ik := range imageCache {
+			if ik.id == k.id && ik.override == k.override {
+				delete(imageCache, ik)
+			}
+		}
+	}
+}
+
+// reset forgets all pages. The textures are left to the garbage collector
+// rather than deallocated, since a frame being drawn may still use them.
+// imageMu must be held.
+func (a *spriteAtlas) reset() {
+	a.pages = nil
+	a.where = make(map[sheetKey]*atlasPage)
+}
+
+// stats reports the number of pages, their total bytes and evictions.
+func (a *spriteAtlas) stats() (pages, bytes, evictions int) {
+	return len(a.pages), len(a.pages) * atlasPageSize * atlasPageSize * 4, a.evict
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestAtlasPageAllocNoOverlap(t *testing.T) {
+	p := &atlasPage{}
+	sizes := [][2]int{{100, 40}, {30, 40}, {200, 10}, {64, 64}, {512, 512}, {10, 8}}
+	var got [][4]int
+	for _, sz := range sizes {
+		r, ok := p.alloc(sz[0], sz[1])
+		if !ok {
+			t.Fatalf("alloc %v failed", sz)
+		}
+		if r.Dx() != sz[0] || r.Dy() != sz[1] {
+			t.Fatalf("alloc %v returned %v", sz, r)
+		}
+		if r.Max.X > atlasPageSize || r.Max.Y > atlasPageSize {
+			t.Fatalf("alloc %v out of page: %v", sz, r)
+		}
+		for _, o := range got {
+			if r.Min.X < o[2] && o[0] < r.Max.X && r.Min.Y < o[3] && o[1] < r.Max.Y {
+				t.Fatalf("alloc %v overlaps %v", r, o)
+			}
+		}
+		got = append(got, [4]int{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y})
+	}
+	// The small sprite should reuse an existing shelf instead of opening one.
+	if len(p.shelves) > 4 {
+		t.Fatalf("too many shelves: %d", len(p.shelves))
+	}
+}
+
+func TestAtlasPageFull(t *testing.T) {
+	p := &atlasPage{}
+	n := 0
+	for {
+		if _, ok := p.alloc(atlasMaxSprite, atlasMaxSprite); !ok {
+			break
+		}
+		n++
+	}
+	// Padding costs one row/column per sprite, so a 4096 page fits 3x3.
+	if n != 9 {
+		t.Fatalf("fit %d max-size sprites, want 9", n)
+	}
+}
+
+func TestAtlasPageMobileSheets(t *testing.T) {
+	// Mobile sheets are 16 frames plus a 2 pixel border wide. Every frame
+	// size up to 64 px must pack; 32 px sheets share a shelf.
+	for _, frame := range []int{32, 48, 64} {
+		p := &atlasPage{}
+		w, h := 16*frame+2, 4*frame+2
+		for i := 0; i < 3; i++ {
+			if _, ok := p.alloc(w, h); !ok {
+				t.Fatalf("%d px mobile sheet %d did not fit", frame, i)
+			}
+		}
+		if frame == 32 && len(p.shelves) != 1 {
+			t.Errorf("32 px mobiles used %d shelves, want 1", len(p.shelves))
+		}
+	}
+	if 16*64+2 > atlasMaxSprite {
+		t.Fatalf("atlasMaxSprite %d rejects 64 px mobile sheets", atlasMaxSprite)
+	}
+}
+
+func TestAtlasActive(t *testing.T) {
+	prev := gs
+	defer func() { gs = prev }()
+	gs.SpriteAtlas, gs.NoCaching = true, false
+	gs.PotatoComputer = false
+	if atlasActive() {
+		t.Error("atlas used for managed images, which Ebiten already packs")
+	}
+	gs.PotatoComputer = true
+	if !atlasActive() {
+		t.Error("atlas not used with PotatoComputer")
+	}
+	gs.NoCaching = true
+	if atlasActive() {
+		t.Error("atlas used with NoCaching")
+	}
+}
+
+func TestAtlasEvictLRU(t *testing.T) {
+	prevSheets, prevImages, prevMobiles := sheetCache, imageCache, mobileCache
+	defer func() { sheetCache, imageCache, mobileCache = prevSheets, prevImages, prevMobiles }()
+
+	pict := sheetKey{id: 10}
+	mob := sheetKey{id: 20, forceTransparent: true}
+	over := sheetKey{id: 40, override: 2}
+	kept := sheetKey{id: 30}
+	old := &atlasPage{used: 5, keys: []sheetKey{pict, mob, over}, shelves: []atlasShelf{{h: 64, x: 64}}, nextY: 64}
+	recent := &atlasPage{used: 9, keys: []sheetKey{kept}}
+	a := spriteAtlas{
+		pages: []*atlasPage{recent, old},
+		where: map[sheetKey]*atlasPage{pict: old, mob: old, over: old, kept: recent},
+		drop:  dropSheetLocked,
+	}
+	sheetCache = map[sheetKey]*ebiten.Image{pict: nil, mob: nil, over: nil, kept: nil}
+	imageCache = map[imageKey]*ebiten.Image{
+		{id: 10}: nil, {id: 10, frame: 1}: nil,
+		{id: 40, override: 2}: nil,
+		{id: 30}:              nil,
+	}
+	tinted := mobileKey{id: 20, state: 3, colorsLen: 1}
+	tinted.colors[0] = 5
+	mobileCache = map[mobileKey]*ebiten.Image{
+		{id: 20, state: 3}:              nil,
+		{id: 40, state: 1, override: 2}: nil,
+		tinted:                          nil,
+	}
+
+	if got := a.evictLRU(); got != old {
+		t.Fatal("evicted the most recently used page")
+	}
+	if a.evict != 1 || len(old.keys) != 0 || len(old.shelves) != 0 || old.nextY != 0 {
+		t.Fatalf("page not emptied: evict=%d keys=%d shelves=%d", a.evict, len(old.keys), len(old.shelves))
+	}
+	if len(a.where) != 1 || a.where[kept] != recent {
+		t.Fatalf("where = %v, want only the kept sheet", a.where)
+	}
+	if _, ok := sheetCache[kept]; !ok || len(sheetCache) != 1 {
+		t.Fatalf("sheetCache has %d entries, want only the kept sheet", len(sheetCache))
+	}
+	if _, ok := imageCache[imageKey{id: 30}]; !ok || len(imageCache) != 1 {
+		t.Fatalf("imageCache = %v, want only picture 30", imageCache)
+	}
+	if _, ok := mobileCache[tinted]; !ok || len(mobileCache) != 1 {
+		t.Fatalf("mobileCache = %v, want only the tinted frame", mobileCache)
+	}
+}
+
+func TestAtlasInsertTooLarge(t *testing.T) {
+	a := spriteAtlas{where: make(map[sheetKey]*atlasPage)}
+	if img := a.insert(sheetKey{id: 1}, image.NewRGBA(image.Rect(0, 0, atlasMaxSprite+1, 8))); img != nil {
+		t.Fatal("oversized sheet packed into the atlas")
+	}
+	if len(a.pages) != 0 {
+		t.Fatalf("oversized sheet opened %d pages", len(a.pages))
+	}
+}
+
+// BenchmarkSpriteAtlas draws a crowd of mobiles from separate unmanaged
+// sheets, as PotatoComputer loads them, with and without the sprite atlas.
+// Each sheet is its own texture without the atlas, so every draw breaks the
+// batch. It needs a GPU:
+//
+//	go test -run '^$' -bench SpriteAtlas -golden
+func BenchmarkSpriteAtlas(b *testing.B) {
+	if !goldenRunning {
+		b.Skip("needs a GPU; run with -golden")
+	}
+	prev := gs
+	defer func() { gs = prev }()
+	gs.PotatoComputer = true
+
+	const sheets, frame = 64, 32
+	srcs := make([]*image.RGBA, sheets)
+	for i := range srcs {
+		src := image.NewRGBA(image.Rect(0, 0, 16*frame+2, 4*frame+2))
+		for j := range src.Pix {
+			src.Pix[j] = uint8(i*4 + j%4)
+		}
+		srcs[i] = src
+	}
+	dst := newImage(1024, 768)
+	defer dst.Deallocate()
+	corner := dst.SubImage(image.Rect(0, 0, 1, 1)).(*ebiten.Image)
+	px := make([]byte, 4)
+
+	run := func(b *testing.B, frames []*ebiten.Image) {
+		op := &ebiten.DrawImageOptions{}
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			dst.Clear()
+			for i := 0; i < 4*sheets; i++ {
+				op.GeoM.Reset()
+				op.GeoM.Translate(float64(i%32*frame), float64(i/32*frame))
+				dst.DrawImage(frames[i%sheets], op)
+			}
+			// Reading a pixel flushes the queued draw calls.
+			corner.ReadPixels(px)
+		}
+	}
+	cut := func(sheet *ebiten.Image) *ebiten.Image {
+		r := sheet.Bounds()
+		return sheet.SubImage(image.Rect(r.Min.X+1, r.Min.Y+1, r.Min.X+1+frame, r.Min.Y+1+frame)).(*ebiten.Image)
+	}
+
+	b.Run("separate", func(b *testing.B) {
+		frames := make([]*ebiten.Image, sheets)
+		for i, src := range srcs {
+			img := newImageFromImage(src)
+			defer img.Deallocate()
+			frames[i] = cut(img)
+		}
+		run(b, frames)
+	})
+	b.Run("atlas", func(b *testing.B) {
+		a := spriteAtlas{where: make(map[sheetKey]*atlasPage)}
+		frames := make([]*ebiten.Image, sheets)
+		for i, src := range srcs {
+			frames[i] = cut(a.insert(sheetKey{id: uint16(i)}, src))
+		}
+		if len(a.pages) != 1 {
+			b.Fatalf("atlas used %d pages, want 1", len(a.pages))
+		}
+		defer a.pages[0].img.Deallocate()
+		run(b, frames)
+	})
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// The auto-mapper stitches the static background pictures of each frame into
+// a world map. pictureShift reports how far the background scrolled since the
+// previous frame; accumulating those offsets gives a stable world coordinate
+// for every picture. When pictureShift fails (teleport, login, large jump) the
+// mapper starts over and tries to recognise an area it has already mapped.
+
+const (
+	autoMapFile     = "GT_AutoMap.json"
+	autoMapTileSize = 256
+	// autoMapMatchMin is the number of agreeing pictures needed to resume a
+	// previously mapped area after a teleport.
+	autoMapMatchMin = 4
+	// autoMapMaxStamps caps the pictures kept per area.
+	autoMapMaxStamps = 200000
+)
+
+// mapStamp is a static picture placed in world coordinates.
+type mapStamp struct {
+	PictID uint16
+	H, V   int32
+	Plane  int16
+}
+
+type mapTile struct {
+	stamps []mapStamp
+	// img is only touched by drawAutoMap, outside autoMapper.mu.
+	img   *ebiten.Image
+	dirty bool
+}
+
+// mapTileDraw is a tile visible in the map view. stamps is a copy of the
+// tile's stamps when its image must be redrawn, or nil when it is current.
+type mapTileDraw struct {
+	t      *mapTile
+	tx, ty int
+	stamps []mapStamp
+}
+
+type mapArea struct {
+	stamps map[mapStamp]struct{}
+	byID   map[uint16][]mapStamp
+	tiles  map[image.Point]*mapTile
+	// unplaced are stamps not yet assigned to tiles; see place.
+	unplaced []mapStamp
+}
+
+type autoMapper struct {
+	mu     sync.Mutex
+	areas  []*mapArea
+	cur    *mapArea
+	offX   int // accumulated background shift since the area origin
+	offY   int
+	dirty  bool // stamps changed since last save
+	update bool // view needs redrawing
+}
+
+var (
+	autoMap         autoMapper
+	lastAutoMapSave = time.Now()
+)
+
+func newMapArea() *mapArea {
+	return &mapArea{
+		stamps: make(map[mapStamp]struct{}),
+		byID:   make(map[uint16][]mapStamp),
+		tiles:  make(map[image.Point]*mapTile),
+	}
+}
+
+// add records s in the area. It reports whether the stamp was new.
+func (a *mapArea) add(s mapStamp) bool {
+	if _, ok := a.stamps[s]; ok {
+		return false
+	}
+	if len(a.stamps) >= autoMapMaxStamps {
+		return false
+	}
+	a.stamps[s] = struct{}{}
+	a.byID[s.PictID] = append(a.byID[s.PictID], s)
+	a.unplaced = append(a.unplaced, s)
+	return true
+}
+
+// place assigns the stamps added since the last call to the tiles they
+// cover and marks those tiles dirty. The tiles depend on the picture sizes,
+// so stamps wait until clImages is loaded.
+func (a *mapArea) place() {
+	if clImages == nil {
+		return
+	}
+	for _, s := range a.unplaced {
+		w, h := clImages.Size(uint32(s.PictID))
+		w, h = max(w, 1), max(h, 1)
+		x0 := floorDiv(int(s.H)-w/2, autoMapTileSize)
+		y0 := floorDiv(int(s.V)-h/2, autoMapTileSize)
+		x1 := floorDiv(int(s.H)+w/2, autoMapTileSize)
+		y1 := floorDiv(int(s.V)+h/2, autoMapTileSize)
+		for ty := y0; ty <= y1; ty++ {
+			for tx := x0; tx <= x1; tx++ {
+				k := image.Point{tx, ty}
+				t := a.tiles[k]
+				if t == nil {
+					t = &mapTile{}
+					a.tiles[k] = t
+				}
+				t.stamps = append(t.stamps, s)
+				t.dirty = true
+			}
+		}
+	}
+	a.unplaced = nil
+}
+
+// match looks for a consistent offset between pics (screen coordinates) and
+// the stamps already recorded in a. It returns the shift to use as the new
+// accumulated offset and the number of agreeing pictures.
+func (a *mapArea) match(pics []framePicture) (int, int, int) {
+	votes := make(map[[2]int]int)
+	for _, p := range pics {
+		for _, s := range a.byID[p.PictID] {
+			votes[[2]int{int(p.H) - int(s.H), int(p.V) - int(s.V)}]++
+		}
+	}
+	best, count := [2]int{}, 0
+	for k, c := range votes {
+		if c > count {
+			best, count = k, c
+		}
+	}
+	return best[0], best[1], count
+}
+
+// updateAutoMap feeds one parsed frame into the mapper. dx, dy and ok are the
+// results of pictureShift; pics are the sorted plane <= 0 pictures.
+// Called from parseDrawState with stateMu held.
+func updateAutoMap(dx, dy int, ok bool, pics ...[]framePicture) {
+	if !gs.AutoMap {
+		return
+	}
+	var static []framePicture
+	for _, list := range pics {
+		for _, p := range list {
+			if p.Moving && !p.Background {
+				continue
+			}
+			static = append(static, p)
+		}
+	}
+
+	m := &autoMap
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !ok {
+		m.cur = nil
+		m.offX, m.offY = 0, 0
+	} else if m.cur != nil {
+		m.offX += dx
+		m.offY += dy
+	}
+	if len(static) == 0 {
+		return
+	}
+	if m.cur == nil {
+		m.cur = m.identifyArea(static)
+	}
+	added := false
+	for _, p := range static {
+		s := mapStamp{
+			PictID: p.PictID,
+			H:      int32(int(p.H) - m.offX),
+			V:      int32(int(p.V) - m.offY),
+			Plane:  int16(p.Plane),
+		}
+		if m.cur.add(s) {
+			added = true
+		}
+	}
+	if added {
+		m.dirty = true
+	}
+	m.update = true
+}
+
+// identifyArea picks the known area that best matches pics, adjusting the
+// offset so new stamps line up, or starts a new area. m.mu must be held.
+func (m *autoMapper) identifyArea(pics []framePicture) *mapArea {
+	var best *mapArea
+	bestCount := 0
+	var bx, by int
+	for _, a := range m.areas {
+		x, y, c := a.match(pics)
+		if c > bestCount {
+			best, bestCount, bx, by = a, c, x, y
+		}
+	}
+	if best != nil && bestCount >= autoMapMatchMin && bestCount*2 >= len(pics) {
+		m.offX, m.offY = bx, by
+		return best
+	}
+	a := newMapArea()
+	m.areas = append(m.areas, a)
+	m.offX, m.offY = 0, 0
+	return a
+}
+
+// autoMapPlayerPos returns the player's world position in the current area.
+func autoMapPlayerPos() (int, int, bool) {
+	autoMap.mu.Lock()
+	defer autoMap.mu.Unlock()
+	if autoMap.cur == nil {
+		return 0, 0, false
+	}
+	return -autoMap.offX, -autoMap.offY, true
+}
+
+// clearAutoMap forgets the current area so it is re-mapped from scratch.
+func clearAutoMap() {
+	m := &autoMap
+	m.mu.Lock()
+	for i, a := range m.areas {
+		if a == m.cur {
+			m.areas = append(m.areas[:i], m.areas[i+1:]...)
+			break
+		}
+	}
+	m.cur = nil
+	m.offX, m.offY = 0, 0
+	m.dirty = true
+	m.update = true
+	m.mu.Unlock()
+}
+
+// drawAutoMap renders the current area centred on the player into dst at the
+// given zoom (screen pixels per world pixel). The visible tiles and the
+// stamps of dirty ones are copied under autoMap.mu; the tiles are redrawn
+// after it is released so loading sprites never stalls updateAutoMap.
+func drawAutoMap(dst *ebiten.Image, zoom float64) {
+	dst.Fill(color.Black)
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	m := &autoMap
+	m.mu.Lock()
+	a := m.cur
+	if a == nil {
+		m.mu.Unlock()
+		return
+	}
+	a.place()
+	px, py := -m.offX, -m.offY
+	// World rect visible in dst.
+	halfW := float64(w) / 2 / zoom
+	halfH := float64(h) / 2 / zoom
+	tx0 := floorDiv(int(math.Floor(float64(px)-halfW)), autoMapTileSize)
+	ty0 := floorDiv(int(math.Floor(float64(py)-halfH)), autoMapTileSize)
+	tx1 := floorDiv(int(math.Ceil(float64(px)+halfW)), autoMapTileSize)
+	ty1 := floorDiv(int(math.Ceil(float64(py)+halfH)), autoMapTileSize)
+	var tiles []mapTileDraw
+	for ty := ty0; ty <= ty1; ty++ {
+		for tx := tx0; tx <= tx1; tx++ {
+			t := a.tiles[image.Point{tx, ty}]
+			if t == nil {
+				continue
+			}
+			d := mapTileDraw{t: t, tx: tx, ty: ty}
+			if t.dirty || t.img == nil {
+				d.stamps = make([]mapStamp, len(t.stamps))
+				copy(d.stamps, t.stamps)
+				t.dirty = false
+			}
+			tiles = append(tiles, d)
+		}
+	}
+	m.mu.Unlock()
+
+	filter := ebiten.FilterNearest
+	if zoom < 1 {
+		filter = ebiten.FilterLinear
+	}
+	for _, d := range tiles {
+		if d.stamps != nil {
+			renderMapTile(d.t, d.stamps, d.tx, d.ty)
+		}
+		op := &ebiten.DrawImageOptions{Filter: filter, DisableMipmaps: true}
+		op.GeoM.Translate(float64(d.tx*autoMapTileSize-px), float64(d.ty*autoMapTileSize-py))
+		op.GeoM.Scale(zoom, zoom)
+		op.GeoM.Translate(float64(w)/2, float64(h)/2)
+		dst.DrawImage(d.t.img, op)
+	}
+	// Player marker
+	cx, cy := float32(w)/2, float32(h)/2
+	vector.DrawFilledCircle(dst, cx, cy, 4, color.RGBA{0xff, 0x20, 0x20, 0xff}, true)
+	vector.StrokeCircle(dst, cx, cy, 5, 1, color.White, true)
+}
+
+// renderMapTile redraws stamps, a copy of the stamps of tile (tx, ty), into
+// the tile's image. autoMap.mu must not be held.
+func renderMapTile(t *mapTile, stamps []mapStamp, tx, ty int) {
+	if t.img == nil {
+		t.img = newImage(autoMapTileSize, autoMapTileSize)
+	}
+	t.img.Clear()
+	sort.SliceStable(stamps, func(i, j int) bool {
+		a, b := stamps[i], stamps[j]
+		if a.Plane != b.Plane {
+			return a.Plane < b.Plane
+		}
+		if a.V != b.V {
+			return a.V < b.V
+		}
+		return a.H < b.H
+	})
+	ox := float64(tx * autoMapTileSize)
+	oy := float64(ty * autoMapTileSize)
+	for _, s := range stamps {
+		img := loadImage(s.PictID)
+		if img == nil {
+			continue
+		}
+		iw, ih := img.Bounds().Dx(), img.Bounds().Dy()
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
+		op.GeoM.Translate(float64(s.H)-float64(iw)/2-ox, float64(s.V)-float64(ih)/2-oy)
+		t.img.DrawImage(img, op)
+	}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+type autoMapFileData struct {
+	Areas [][][4]int32 // per area: [pictID, h, v, plane]
+}
+
+func loadAutoMap() {
+	path := filepath.Join(dataDirPath, autoMapFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var fd autoMapFileData
+	if err := json.Unmarshal(data, &fd); err != nil {
+		logError("load auto map: %v", err)
+		return
+	}
+	m := &autoMap
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.areas = m.areas[:0]
+	m.cur = nil
+	for _, list := range fd.Areas {
+		a := newMapArea()
+		for _, s := range list {
+			a.add(mapStamp{PictID: uint16(s[0]), H: s[1], V: s[2], Plane: int16(s[3])})
+		}
+		if len(a.stamps) > 0 {
+			m.areas = append(m.areas, a)
+		}
+	}
+}
+
+// saveAutoMap writes the map if it changed since it was loaded or saved.
+func saveAutoMap() {
+	m := &autoMap
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return
+	}
+	var fd autoMapFileData
+	for _, a := range m.areas {
+		list := make([][4]int32, 0, len(a.stamps))
+		for s := range a.stamps {
+			list = append(list, [4]int32{int32(s.PictID), s.H, s.V, int32(s.Plane)})
+		}
+		if len(list) > 0 {
+			fd.Areas = append(fd.Areas, list)
+		}
+	}
+	m.dirty = false
+	m.mu.Unlock()
+
+	data, err := json.Marshal(fd)
+	if err != nil {
+		logError("save auto map: %v", err)
+		return
+	}
+	path := filepath.Join(dataDirPath, autoMapFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logError("save auto map: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func resetAutoMapForTest(t *testing.T) {
+	t.Helper()
+	prev := gs.AutoMap
+	gs.AutoMap = true
+	autoMap.mu.Lock()
+	autoMap.areas = nil
+	autoMap.cur = nil
+	autoMap.offX, autoMap.offY = 0, 0
+	autoMap.mu.Unlock()
+	t.Cleanup(func() { gs.AutoMap = prev })
+}
+
+func TestAutoMapAccumulatesShift(t *testing.T) {
+	resetAutoMapForTest(t)
+	frame1 := []framePicture{{PictID: 10, H: 0, V: 0}, {PictID: 11, H: 50, V: 20}}
+	updateAutoMap(0, 0, false, frame1)
+	// Background scrolls left by 8 pixels as the player walks right.
+	frame2 := []framePicture{{PictID: 10, H: -8, V: 0}, {PictID: 11, H: 42, V: 20}, {PictID: 12, H: 100, V: 0}}
+	updateAutoMap(-8, 0, true, frame2)
+
+	x, y, ok := autoMapPlayerPos()
+	if !ok || x != 8 || y != 0 {
+		t.Fatalf("player pos = (%d,%d,%v), want (8,0,true)", x, y, ok)
+	}
+	a := autoMap.cur
+	if len(a.stamps) != 3 {
+		t.Fatalf("stamps = %d, want 3", len(a.stamps))
+	}
+	if _, ok := a.stamps[mapStamp{PictID: 12, H: 108, V: 0}]; !ok {
+		t.Fatalf("new picture not placed in world coordinates: %v", a.stamps)
+	}
+}
+
+func TestAutoMapResumesKnownArea(t *testing.T) {
+	resetAutoMapForTest(t)
+	pics := []framePicture{
+		{PictID: 1, H: 0, V: 0}, {PictID: 2, H: 30, V: 0},
+		{PictID: 3, H: 0, V: 30}, {PictID: 4, H: 30, V: 30},
+	}
+	updateAutoMap(0, 0, false, pics)
+	first := autoMap.cur
+
+	// Teleport elsewhere: unrelated pictures start a new area.
+	updateAutoMap(0, 0, false, []framePicture{{PictID: 99, H: 0, V: 0}})
+	if autoMap.cur == first {
+		t.Fatalf("unrelated frame reused the first area")
+	}
+
+	// Teleport back, viewing the same pictures shifted by (-10, 5).
+	shifted := make([]framePicture, len(pics))
+	for i, p := range pics {
+		p.H -= 10
+		p.V += 5
+		shifted[i] = p
+	}
+	updateAutoMap(0, 0, false, shifted)
+	if autoMap.cur != first {
+		t.Fatalf("known area was not recognised")
+	}
+	if x, y, _ := autoMapPlayerPos(); x != 10 || y != -5 {
+		t.Fatalf("player pos = (%d,%d), want (10,-5)", x, y)
+	}
+	if len(first.stamps) != len(pics) {
+		t.Fatalf("duplicate stamps added: %d", len(first.stamps))
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	cases := []struct{ a, b, want int }{
+		{0, 256, 0}, {255, 256, 0}, {256, 256, 1}, {-1, 256, -1}, {-256, 256, -1}, {-257, 256, -2},
+	}
+	for _, c := range cases {
+		if got := floorDiv(c.a, c.b); got != c.want {
+			t.Errorf("floorDiv(%d,%d) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestAutoMapPlacesStampsOnceImagesLoad(t *testing.T) {
+	resetAutoMapForTest(t)
+	prev := clImages
+	clImages = nil
+	t.Cleanup(func() { clImages = prev })
+
+	// A 4x4 picture straddling the boundary of tiles (0,0) and (1,0).
+	pics := []framePicture{{PictID: customPict, H: autoMapTileSize - 1, V: 8}}
+	updateAutoMap(0, 0, false, pics)
+	a := autoMap.cur
+	a.place()
+	if len(a.tiles) != 0 {
+		t.Fatalf("placed %d tiles without picture sizes", len(a.tiles))
+	}
+
+	clImages = customColorImages(t)
+	a.place()
+	for _, k := range []image.Point{{0, 0}, {1, 0}} {
+		if tile := a.tiles[k]; tile == nil || len(tile.stamps) != 1 || !tile.dirty {
+			t.Errorf("tile %v = %+v", k, tile)
+		}
+	}
+	if len(a.tiles) != 2 {
+		t.Errorf("%d tiles, want 2", len(a.tiles))
+	}
+
+	// Seeing the same pictures again changes nothing to save.
+	autoMap.dirty = false
+	updateAutoMap(0, 0, true, pics)
+	if autoMap.dirty || len(a.unplaced) != 0 {
+		t.Errorf("dirty %v, %d unplaced after a repeated frame", autoMap.dirty, len(a.unplaced))
+	}
+}
@@ -0,0 +1,146 @@
+//go:build !test
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const autoMapViewSize = 320
+
+var (
+	mapWin       *eui.WindowData
+	mapImageItem *eui.ItemData
+	mapImage     *ebiten.Image
+	mapZoomLabel *eui.ItemData
+	lastMapDraw  time.Time
+)
+
+var autoMapZooms = []float64{0.125, 0.25, 0.5, 1, 2, 4}
+
+func makeMapWindow() {
+	if mapWin != nil {
+		return
+	}
+	mapWin = eui.NewWindow()
+	mapWin.Title = "Map"
+	mapWin.Closable = true
+	mapWin.Resizable = false
+	mapWin.AutoSize = true
+	mapWin.Movable = true
+	mapWin.SetZone(eui.HZoneRight, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+
+	mapImageItem, mapImage = eui.NewImageItem(autoMapViewSize, autoMapViewSize)
+	flow.AddItem(mapImageItem)
+
+	row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+
+	zoomOut, zoomOutEvents := eui.NewButton()
+	zoomOut.Text = "-"
+	zoomOut.Size = eui.Point{X: 32, Y: 24}
+	zoomOut.Tooltip = "Zoom out"
+	zoomOutEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setMapZoom(gs.AutoMapZoom - 1)
+		}
+	}
+	row.AddItem(zoomOut)
+
+	zoomIn, zoomInEvents := eui.NewButton()
+	zoomIn.Text = "+"
+	zoomIn.Size = eui.Point{X: 32, Y: 24}
+	zoomIn.Tooltip = "Zoom in"
+	zoomInEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setMapZoom(gs.AutoMapZoom + 1)
+		}
+	}
+	row.AddItem(zoomIn)
+
+	mapZoomLabel, _ = eui.NewText()
+	mapZoomLabel.Size = eui.Point{X: 80, Y: 24}
+	mapZoomLabel.FontSize = 12
+	row.AddItem(mapZoomLabel)
+
+	enableCB, enableEvents := eui.NewCheckbox()
+	enableCB.Text = "Mapping"
+	enableCB.Size = eui.Point{X: 90, Y: 24}
+	enableCB.Checked = gs.AutoMap
+	enableCB.Tooltip = "Record the areas you walk through"
+	enableEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.AutoMap = ev.Checked
+			settingsDirty = true
+		}
+	}
+	row.AddItem(enableCB)
+
+	clearBtn, clearEvents := eui.NewButton()
+	clearBtn.Text = "Forget"
+	clearBtn.Size = eui.Point{X: 64, Y: 24}
+	clearBtn.Tooltip = "Forget the map of the current area"
+	clearEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			clearAutoMap()
+		}
+	}
+	row.AddItem(clearBtn)
+
+	flow.AddItem(row)
+	mapWin.AddItem(flow)
+	mapWin.AddWindow(false)
+	setMapZoom(gs.AutoMapZoom)
+}
+
+func setMapZoom(idx int) {
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(autoMapZooms) {
+		idx = len(autoMapZooms) - 1
+	}
+	if idx != gs.AutoMapZoom {
+		gs.AutoMapZoom = idx
+		settingsDirty = true
+	}
+	if mapZoomLabel != nil {
+		mapZoomLabel.Text = fmt.Sprintf("Zoom %gx", autoMapZooms[idx])
+		mapZoomLabel.Dirty = true
+	}
+	autoMap.mu.Lock()
+	autoMap.update = true
+	autoMap.mu.Unlock()
+}
+
+// updateMapWindow redraws the map view when the mapper has new data. It is
+// called from Draw so GPU work stays on the render thread.
+func updateMapWindow() {
+	if mapWin == nil || !mapWin.IsOpen() || mapImage == nil {
+		return
+	}
+	if time.Since(lastMapDraw) < 100*time.Millisecond {
+		return
+	}
+	autoMap.mu.Lock()
+	need := autoMap.update
+	autoMap.update = false
+	autoMap.mu.Unlock()
+	if !need {
+		return
+	}
+	lastMapDraw = time.Now()
+	idx := gs.AutoMapZoom
+	if idx < 0 || idx >= len(autoMapZooms) {
+		idx = 3
+	}
+	drawAutoMap(mapImage, autoMapZooms[idx])
+	mapImageItem.Dirty = true
+	mapWin.Refresh()
+}
@@ -3,6 +3,9 @@ package main
 import "time"
 
 func runBackgroundTasks() {
+	go watchSpriteOverrides()
+	go watchSoundOverrides()
+
 	go func() {
 		for {
 			time.Sleep(time.Second)
@@ -50,6 +53,21 @@ func runBackgroundTasks() {
 				lastPlayersSave = time.Now()
 			}
 
+			if time.Since(lastAutoMapSave) >= 30*time.Second {
+				saveAutoMap()
+				lastAutoMapSave = time.Now()
+			}
+
+			if time.Since(lastHUDSave) >= 5*time.Second {
+				hudMu.Lock()
+				dirty := hudDirty
+				hudMu.Unlock()
+				if dirty {
+					saveHUD()
+				}
+				lastHUDSave = time.Now()
+			}
+
 			// Ensure the movie controller window repaints at least once per second
 			// while open, even without other UI events.
 			if movieWin != nil && movieWin.IsOpen() {
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"image"
 	"image/color"
 	"math"
+	"sort"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	text "github.com/hajimehoshi/ebiten/v2/text/v2"
@@ -87,25 +89,59 @@ func bubbleColors(typ int) (border, bg, text color.Color) {
 		bg = color.NRGBA{0xff, 0xff, 0xff, alpha}
 		text = color.Black
 	}
+	if sceneCBMode() != cbNone {
+		if c, ok := border.(color.NRGBA); ok {
+			border = cbSceneNRGBA(c)
+		}
+		if c, ok := bg.(color.NRGBA); ok {
+			bg = cbSceneNRGBA(c)
+		}
+	}
 	return
 }
 
-// drawBubble renders a text bubble anchored so that (x, y) corresponds to the
-// bottom-center point of the balloon tail. If the bubble would extend past the
-// screen edges it is clamped while leaving the tail anchored at (x, y). If far
-// is true the tail is omitted and (x, y) represents the bottom-center of the
-// bubble itself. The tail can also be skipped explicitly via noArrow. The typ
-// parameter is currently unused but retained for future compatibility with the
-// original bubble images. The colors of the border, background, and text can be
-// customized via borderCol, bgCol, and textCol respectively.
-func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, noArrow bool, borderCol, bgCol, textCol color.Color) {
-	if txt == "" {
-		return
+// bubbleBox is a measured bubble ready for layout. Coordinates are relative
+// to the game area; (TailX, TailY) is where the tail points at the speaker.
+type bubbleBox struct {
+	Left, Top    int
+	W, H         int
+	TailX, TailY int
+	Far          bool
+
+	txt        string
+	lines      []string
+	lineHeight int
+	typ        int
+	noArrow    bool
+	alpha      float32 // fade applied to all colors
+}
+
+func (b *bubbleBox) rect() image.Rectangle {
+	return image.Rect(b.Left, b.Top, b.Left+b.W, b.Top+b.H)
+}
+
+// clamp keeps the bubble inside a sw×sh area.
+func (b *bubbleBox) clamp(sw, sh int) {
+	if b.Left+b.W > sw {
+		b.Left = sw - b.W
+	}
+	if b.Left < 0 {
+		b.Left = 0
+	}
+	if b.Top+b.H > sh {
+		b.Top = sh - b.H
+	}
+	if b.Top < 0 {
+		b.Top = 0
 	}
-	tailX, tailY := x, y
-	ox, oy := 0, 0
+}
+
+// measureBubble wraps txt and places its bubble anchored so that (x, y)
+// corresponds to the bottom-center point of the balloon tail, or of the
+// bubble itself when far is true. x and y are screen coordinates.
+func measureBubble(txt string, x, y int, typ int, far bool, noArrow bool) bubbleBox {
 	if !gs.AnyGameWindowSize {
-		ox, oy = gameContentOrigin()
+		ox, oy := gameContentOrigin()
 		x -= ox
 		y -= oy
 	}
@@ -114,7 +150,6 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	sh := int(float64(gameAreaSizeY) * gs.GameScale)
 	pad := int((4 + 2) * gs.GameScale)
 	tailHeight := int(10 * gs.GameScale)
-	tailHalf := int(6 * gs.GameScale)
 
 	maxLineWidth := sw/4 - 2*pad
 	width, lines := wrapText(txt, bubbleFont, float64(maxLineWidth))
@@ -123,19 +158,131 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	width += 2 * pad
 	height := lineHeight*len(lines) + 2*pad
 
-	left, top, right, bottom := adjustBubbleRect(x, y, width, height, tailHeight, sw, sh, far)
+	left, top, _, _ := adjustBubbleRect(x, y, width, height, tailHeight, sw, sh, far)
+	return bubbleBox{
+		Left: left, Top: top, W: width, H: height,
+		TailX: x, TailY: y, Far: far,
+		txt: txt, lines: lines, lineHeight: lineHeight, typ: typ, noArrow: noArrow,
+		alpha: 1,
+	}
+}
+
+// layoutBubbles moves bubbles so they no longer overlap. Bubbles whose
+// speakers are lower on screen are placed first; each later bubble is nudged
+// sideways if that clears it, otherwise it is stacked above (or, at the top
+// edge, below) the bubble it collides with. Every bubble stays inside the
+// sw×sh area, which keeps far bubbles clamped to the edges. Tails are not
+// moved, so they keep pointing at their speakers.
+func layoutBubbles(boxes []bubbleBox, sw, sh, gap int) {
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return boxes[order[i]].TailY > boxes[order[j]].TailY
+	})
+
+	var placed []image.Rectangle
+	collides := func(r image.Rectangle) (image.Rectangle, bool) {
+		for _, p := range placed {
+			if r.Overlaps(p.Inset(-gap)) {
+				return p, true
+			}
+		}
+		return image.Rectangle{}, false
+	}
+	for _, i := range order {
+		b := &boxes[i]
+		b.clamp(sw, sh)
+		for tries := 0; tries <= len(placed); tries++ {
+			hit, ok := collides(b.rect())
+			if !ok {
+				break
+			}
+			if b.shiftAside(hit, sw, sh, gap, collides) {
+				break
+			}
+			top := b.Top
+			b.Top = hit.Min.Y - gap - b.H
+			if b.Top < 0 {
+				b.Top = hit.Max.Y + gap
+			}
+			b.clamp(sw, sh)
+			if b.Top == top {
+				break // nowhere left to go
+			}
+		}
+		placed = append(placed, b.rect())
+	}
+}
+
+// shiftAside tries to clear hit by moving the bubble horizontally by at most
+// half its width. It reports whether the new position is free.
+func (b *bubbleBox) shiftAside(hit image.Rectangle, sw, sh, gap int, collides func(image.Rectangle) (image.Rectangle, bool)) bool {
+	maxShift := b.W / 2
+	left := b.Left
+	for _, nl := range []int{hit.Min.X - gap - b.W, hit.Max.X + gap} {
+		if d := nl - left; d > maxShift || -d > maxShift {
+			continue
+		}
+		b.Left = nl
+		b.clamp(sw, sh)
+		if b.Left == nl {
+			if _, ok := collides(b.rect()); !ok {
+				return true
+			}
+		}
+		b.Left = left
+	}
+	return false
+}
+
+// drawBubbleBox renders a bubble measured by measureBubble, possibly moved
+// by layoutBubbles. The tail runs from the edge facing the speaker to
+// (TailX, TailY).
+func drawBubbleBox(screen *ebiten.Image, b *bubbleBox, borderCol, bgCol, textCol color.Color) {
+	if b.txt == "" || b.alpha <= 0 {
+		return
+	}
+	fade := b.alpha
+	far, noArrow := b.Far, b.noArrow
+	left, top := b.Left, b.Top
+	tailX, tailY := b.TailX, b.TailY
 	if !gs.AnyGameWindowSize {
+		ox, oy := gameContentOrigin()
 		left += ox
-		right += ox
 		top += oy
-		bottom += oy
+		tailX += ox
+		tailY += oy
 	}
-	baseX := left + width/2
-
-	bgR, bgG, bgB, bgA := bgCol.RGBA()
+	width, height := b.W, b.H
+	right, bottom := left+width, top+height
+	pad := int((4 + 2) * gs.GameScale)
+	tailHalf := int(6 * gs.GameScale)
+	lines, lineHeight := b.lines, b.lineHeight
 
 	radius := float32(4 * gs.GameScale)
 
+	// Attach the tail below the bubble unless layout pushed the bubble under
+	// its speaker, and slide its base towards the speaker.
+	edge := bottom
+	if tailY < top {
+		edge = top
+	}
+	baseX := tailX
+	if lo := left + int(radius) + tailHalf; baseX < lo {
+		baseX = lo
+	}
+	if hi := right - int(radius) - tailHalf; baseX > hi {
+		baseX = hi
+	}
+	if right-left < 2*(int(radius)+tailHalf) {
+		baseX = left + width/2
+	}
+	hasTail := !far && !noArrow
+
+	bgR, bgG, bgB, bgA := bgCol.RGBA()
+
 	var body vector.Path
 	body.MoveTo(float32(left)+radius, float32(top))
 	body.LineTo(float32(right)-radius, float32(top))
@@ -149,10 +296,10 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	body.Close()
 
 	var tail vector.Path
-	if !far && !noArrow {
-		tail.MoveTo(float32(baseX-tailHalf), float32(bottom))
+	if hasTail {
+		tail.MoveTo(float32(baseX-tailHalf), float32(edge))
 		tail.LineTo(float32(tailX), float32(tailY))
-		tail.LineTo(float32(baseX+tailHalf), float32(bottom))
+		tail.LineTo(float32(baseX+tailHalf), float32(edge))
 		tail.Close()
 	}
 
@@ -160,23 +307,23 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	for i := range vs {
 		vs[i].SrcX = 0
 		vs[i].SrcY = 0
-		vs[i].ColorR = float32(bgR) / 0xffff
-		vs[i].ColorG = float32(bgG) / 0xffff
-		vs[i].ColorB = float32(bgB) / 0xffff
-		vs[i].ColorA = float32(bgA) / 0xffff
+		vs[i].ColorR = float32(bgR) / 0xffff * fade
+		vs[i].ColorG = float32(bgG) / 0xffff * fade
+		vs[i].ColorB = float32(bgB) / 0xffff * fade
+		vs[i].ColorA = float32(bgA) / 0xffff * fade
 	}
 	op := &ebiten.DrawTrianglesOptions{ColorScaleMode: ebiten.ColorScaleModePremultipliedAlpha}
 	screen.DrawTriangles(vs, is, whiteImage, op)
 
-	if !far && !noArrow {
+	if hasTail {
 		vs, is = tail.AppendVerticesAndIndicesForFilling(vs[:0], is[:0])
 		for i := range vs {
 			vs[i].SrcX = 0
 			vs[i].SrcY = 0
-			vs[i].ColorR = float32(bgR) / 0xffff
-			vs[i].ColorG = float32(bgG) / 0xffff
-			vs[i].ColorB = float32(bgB) / 0xffff
-			vs[i].ColorA = float32(bgA) / 0xffff
+			vs[i].ColorR = float32(bgR) / 0xffff * fade
+			vs[i].ColorG = float32(bgG) / 0xffff * fade
+			vs[i].ColorB = float32(bgB) / 0xffff * fade
+			vs[i].ColorA = float32(bgA) / 0xffff * fade
 		}
 		screen.DrawTriangles(vs, is, whiteImage, op)
 	}
@@ -184,11 +331,16 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	bdR, bdG, bdB, bdA := borderCol.RGBA()
 	var outline vector.Path
 	outline.MoveTo(float32(left)+radius, float32(top))
+	if hasTail && edge == top {
+		outline.LineTo(float32(baseX-tailHalf), float32(top))
+		outline.LineTo(float32(tailX), float32(tailY))
+		outline.LineTo(float32(baseX+tailHalf), float32(top))
+	}
 	outline.LineTo(float32(right)-radius, float32(top))
 	outline.Arc(float32(right)-radius, float32(top)+radius, radius, -math.Pi/2, 0, vector.Clockwise)
 	outline.LineTo(float32(right), float32(bottom)-radius)
 	outline.Arc(float32(right)-radius, float32(bottom)-radius, radius, 0, math.Pi/2, vector.Clockwise)
-	if !far && !noArrow {
+	if hasTail && edge == bottom {
 		outline.LineTo(float32(baseX+tailHalf), float32(bottom))
 		outline.LineTo(float32(tailX), float32(tailY))
 		outline.LineTo(float32(baseX-tailHalf), float32(bottom))
@@ -203,10 +355,10 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 	for i := range vs {
 		vs[i].SrcX = 0
 		vs[i].SrcY = 0
-		vs[i].ColorR = float32(bdR) / 0xffff
-		vs[i].ColorG = float32(bdG) / 0xffff
-		vs[i].ColorB = float32(bdB) / 0xffff
-		vs[i].ColorA = float32(bdA) / 0xffff
+		vs[i].ColorR = float32(bdR) / 0xffff * fade
+		vs[i].ColorG = float32(bdG) / 0xffff * fade
+		vs[i].ColorB = float32(bdB) / 0xffff * fade
+		vs[i].ColorA = float32(bdA) / 0xffff * fade
 	}
 	screen.DrawTriangles(vs, is, whiteImage, op)
 
@@ -216,6 +368,7 @@ func drawBubble(screen *ebiten.Image, txt string, x, y int, typ int, far bool, n
 		op := &text.DrawOptions{}
 		op.GeoM.Translate(float64(textLeft), float64(textTop+i*lineHeight))
 		op.ColorScale.ScaleWithColor(textCol)
+		op.ColorScale.ScaleAlpha(fade)
 		text.Draw(screen, line, bubbleFont, op)
 	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayoutBubblesResolvesOverlap(t *testing.T) {
+	boxes := []bubbleBox{
+		{Left: 100, Top: 200, W: 80, H: 30, TailX: 140, TailY: 240},
+		{Left: 105, Top: 205, W: 80, H: 30, TailX: 145, TailY: 245},
+		{Left: 110, Top: 195, W: 80, H: 30, TailX: 150, TailY: 235},
+	}
+	layoutBubbles(boxes, 547, 540, 2)
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if boxes[i].rect().Overlaps(boxes[j].rect()) {
+				t.Fatalf("bubbles %d and %d overlap: %v %v", i, j, boxes[i].rect(), boxes[j].rect())
+			}
+		}
+	}
+	// The lowest speaker keeps its bubble where it was.
+	if boxes[1].Left != 105 || boxes[1].Top != 205 {
+		t.Fatalf("lowest bubble moved to %v", boxes[1].rect())
+	}
+	if boxes[0].TailX != 140 || boxes[0].TailY != 240 {
+		t.Fatalf("tail moved to (%d,%d)", boxes[0].TailX, boxes[0].TailY)
+	}
+}
+
+func TestLayoutBubblesKeepsFarOnScreen(t *testing.T) {
+	boxes := []bubbleBox{
+		{Left: 0, Top: 0, W: 120, H: 40, TailX: 60, TailY: 40, Far: true},
+		{Left: 0, Top: 0, W: 120, H: 40, TailX: 60, TailY: 40, Far: true},
+	}
+	layoutBubbles(boxes, 547, 540, 2)
+	for i, b := range boxes {
+		r := b.rect()
+		if r.Min.X < 0 || r.Min.Y < 0 || r.Max.X > 547 || r.Max.Y > 540 {
+			t.Fatalf("bubble %d off screen: %v", i, r)
+		}
+	}
+	if boxes[0].rect().Overlaps(boxes[1].rect()) {
+		t.Fatalf("far bubbles overlap: %v %v", boxes[0].rect(), boxes[1].rect())
+	}
+}
+
+func TestBubbleLifeScalesWithLength(t *testing.T) {
+	old := gs.BubbleReadingSpeed
+	gs.BubbleReadingSpeed = 120
+	defer func() { gs.BubbleReadingSpeed = old }()
+
+	if got := bubbleLife("hi"); got != bubbleMinLife {
+		t.Errorf("short life = %v, want %v", got, bubbleMinLife)
+	}
+	// 20 words at 120 wpm is 10s of reading on top of the base life.
+	long := strings.TrimSpace(strings.Repeat("word ", 20))
+	if got, want := bubbleLife(long), bubbleBaseLife+10*time.Second; got != want {
+		t.Errorf("long life = %v, want %v", got, want)
+	}
+	if got := bubbleLife(strings.Repeat("word ", 1000)); got != bubbleMaxLife {
+		t.Errorf("huge life = %v, want %v", got, bubbleMaxLife)
+	}
+}
+
+func TestBubbleAlphaFades(t *testing.T) {
+	b := bubble{Created: time.Second, Life: 5 * time.Second}
+	if a := bubbleAlpha(b, 2*time.Second); a != 1 {
+		t.Errorf("alpha mid-life = %v, want 1", a)
+	}
+	if a := bubbleAlpha(b, 6*time.Second-bubbleFadeTime/2); a < 0.49 || a > 0.51 {
+		t.Errorf("alpha mid-fade = %v, want 0.5", a)
+	}
+	if a := bubbleAlpha(b, 7*time.Second); a != 0 {
+		t.Errorf("alpha after expiry = %v, want 0", a)
+	}
+}
+
+func TestBubbleExpired(t *testing.T) {
+	b := bubble{Created: time.Second, Life: 5 * time.Second}
+	if bubbleExpired(b, 5*time.Second) {
+		t.Error("bubble expired before its life ended")
+	}
+	if !bubbleExpired(b, 6*time.Second) {
+		t.Error("bubble kept after its life ended")
+	}
+}
+
+func TestLimitBubblesPerSpeaker(t *testing.T) {
+	in := []bubble{
+		{Index: 1, Text: "a"},
+		{Index: 2, Text: "b"},
+		{Index: 1, Text: "c"},
+		{Index: 1, Text: "d"},
+	}
+	got := limitBubblesPerSpeaker(in, 2)
+	var texts []string
+	for _, b := range got {
+		texts = append(texts, b.Text)
+	}
+	if strings.Join(texts, "") != "bcd" {
+		t.Fatalf("kept %v, want [b c d]", texts)
+	}
+}
@@ -16,6 +16,8 @@ func clearCaches() {
 	mobileCache = make(map[mobileKey]*ebiten.Image)
 	mobileBlendCache = make(map[mobileBlendKey]*ebiten.Image)
 	pictBlendCache = make(map[pictBlendKey]*ebiten.Image)
+	sheetAtlas.reset()
+	resetPalettesLocked()
 	imageMu.Unlock()
 
 	pixelCountMu.Lock()
@@ -27,9 +29,7 @@ func clearCaches() {
 	pixelDataList.Init()
 	pixelDataMu.Unlock()
 
-	soundMu.Lock()
-	pcmCache = make(map[uint16][]byte)
-	soundMu.Unlock()
+	clearSoundCache()
 
 	if clImages != nil {
 		clImages.ClearCache()
@@ -39,6 +39,13 @@ func clearCaches() {
 	}
 }
 
+// clearSoundCache drops decoded sounds so they are resampled again.
+func clearSoundCache() {
+	soundMu.Lock()
+	pcmCache = make(map[uint16][]byte)
+	soundMu.Unlock()
+}
+
 var assetsPrecached = false
 
 func precacheAssets() {
@@ -21,6 +21,7 @@ func chatMessage(msg string) {
 		chatMsgs = chatMsgs[len(chatMsgs)-maxChatMessages:]
 	}
 	chatMsgMu.Unlock()
+	chatLog.write(msg)
 
 	updateChatWindow()
 }
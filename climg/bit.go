@@ -56,3 +56,22 @@ func (r *BitReader) ReadBits(nbits int) (byte, error) {
 	tmp := byte(result)
 	return tmp, nil
 }
+
+// bitWriter packs bits most significant first, the order BitReader reads
+// them in.
+type bitWriter struct {
+	buf []byte
+	n   uint8 // bits used in the last byte of buf, 0 when it is full
+}
+
+func (w *bitWriter) WriteBits(v, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		if w.n == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> w.n
+		}
+		w.n = (w.n + 1) % 8
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
+	"image/color"
 	"io"
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/text/encoding/charmap"
 )
 
 type dataLocation struct {
@@ -32,6 +35,9 @@ type dataLocation struct {
 
 	numAnims       int16
 	animFrameTable [16]int16
+	// animStored is the animation table as stored, which may run past
+	// numAnims, so a rewritten record matches the original.
+	animStored []int16
 }
 
 type CLImages struct {
@@ -42,6 +48,7 @@ type CLImages struct {
 	lights           map[uint32]*dataLocation
 	items            map[uint32]*ClientItem
 	cache            map[string]*ebiten.Image
+	overrides        atomic.Pointer[Overrides]
 	mu               sync.Mutex
 	Denoise          bool
 	DenoiseSharpness float64
@@ -288,6 +295,7 @@ func Load(path string) (*CLImages, error) {
 			if int16(i) < ref.numAnims {
 				ref.animFrameTable[i] = v
 			}
+			ref.animStored = append(ref.animStored, v)
 			remaining -= 2
 		}
 
@@ -360,10 +368,12 @@ func Load(path string) (*CLImages, error) {
 			n = 256
 		}
 		nameBytes = nameBytes[:n]
+		nameBuf := nameBytes
 		if i := bytes.IndexByte(nameBytes, 0); i >= 0 {
 			nameBytes = nameBytes[:i]
 		}
-		name := string(nameBytes)
+		// Names are Mac OS Roman.
+		name, _ := charmap.Macintosh.NewDecoder().String(string(nameBytes))
 		imgs.items[id] = &ClientItem{
 			Flags:           flags,
 			Slot:            int(slot),
@@ -371,6 +381,7 @@ func Load(path string) (*CLImages, error) {
 			LeftHandPictID:  uint32(left),
 			WornPictID:      uint32(worn),
 			Name:            name,
+			nameBuf:         nameBuf,
 		}
 	}
 
@@ -400,6 +411,9 @@ type ClientItem struct {
 	WornPictID      uint32
 	Name            string
 	_loc            *dataLocation // internal: original location
+	// nameBuf is the name field as stored, including whatever followed
+	// the terminator, so PutItem can rebuild the record exactly.
+	nameBuf []byte
 }
 
 // Item returns the CL_Images metadata for an item id, if present.
@@ -410,6 +424,17 @@ func (c *CLImages) Item(id uint32) (ClientItem, bool) {
 	return ClientItem{}, false
 }
 
+// ItemIDs returns all item identifiers present in the archive.
+func (c *CLImages) ItemIDs() []uint32 {
+	ids := make([]uint32, 0, len(c.items))
+	for id, it := range c.items {
+		if it != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // ItemName returns the public name for an item id, or empty if unknown.
 func (c *CLImages) ItemName(id uint32) string {
 	if it, ok := c.items[id]; ok && it != nil {
@@ -483,6 +508,9 @@ func alphaTransparentForFlags(flags uint32) (uint8, bool) {
 // way, even when the transparency flag wasn't set.
 func (c *CLImages) Get(id uint32, custom []byte, forceTransparent bool) *ebiten.Image {
 	key := fmt.Sprintf("%d-%x-%t", id, custom, forceTransparent)
+	if rev := c.OverrideRevision(id); rev != 0 {
+		key = fmt.Sprintf("%d-o%d", id, rev)
+	}
 	c.mu.Lock()
 	if img, ok := c.cache[key]; ok {
 		c.mu.Unlock()
@@ -490,101 +518,93 @@ func (c *CLImages) Get(id uint32, custom []byte, forceTransparent bool) *ebiten.
 	}
 	c.mu.Unlock()
 
-	ref := c.idrefs[id]
-	if ref == nil {
-		return nil
-	}
-	imgLoc := c.images[ref.imageID]
-	colLoc := c.colors[ref.colorID]
-	if imgLoc == nil || colLoc == nil {
+	img := c.GetRGBA(id, custom, forceTransparent)
+	if img == nil {
 		return nil
 	}
+	eimg := newImageFromImage(img)
+	c.mu.Lock()
+	c.cache[key] = eimg
+	c.mu.Unlock()
+	return eimg
+}
 
-	r := bytes.NewReader(c.data)
-	if _, err := r.Seek(int64(imgLoc.offset), io.SeekStart); err != nil {
-		log.Printf("seek image %d: %v", id, err)
+// GetRGBA decodes the picture ID into a premultiplied RGBA image with a 1
+// pixel transparent border, exactly as Get would upload it. The result is
+// not cached; callers that pack images themselves use this to avoid a
+// throwaway GPU texture. Overridden pictures come from their PNG and ignore
+// custom and forceTransparent.
+func (c *CLImages) GetRGBA(id uint32, custom []byte, forceTransparent bool) *image.RGBA {
+	if e := c.override(id); e != nil {
+		img, err := e.decode(e.frames(c.numFrames(id)))
+		if err == nil {
+			return img
+		}
+		log.Printf("override %d: %v", id, err)
+	}
+	ix := c.GetIndexed(id)
+	if ix == nil {
 		return nil
 	}
+	pal := c.Palette(ix, custom, forceTransparent)
+	width, height := ix.Width, ix.Height
+	// Add a 1 pixel transparent border around the decoded image.
+	img := image.NewRGBA(image.Rect(0, 0, width+2, height+2))
+	pix := img.Pix
+	stride := img.Stride
+	for i, v := range ix.Pix {
+		p := pal[v]
+		off := (i/width+1)*stride + (i%width+1)*4
+		pix[off+0] = p.R
+		pix[off+1] = p.G
+		pix[off+2] = p.B
+		pix[off+3] = p.A
+	}
 
-	var h, w uint16
-	var pad uint32
-	var v, b byte
-	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
-		log.Printf("read h for %d: %v", id, err)
-		return nil
+	if c.Denoise {
+		denoiseImage(img, c.DenoiseSharpness, c.DenoisePercent)
 	}
-	if err := binary.Read(r, binary.BigEndian, &w); err != nil {
-		log.Printf("read w for %d: %v", id, err)
+	return img
+}
+
+// Indexed is a decoded picture that keeps each pixel's color table index
+// rather than its final color. Combined with Palette it reproduces GetRGBA,
+// which lets renderers recolor a sprite without decoding it again.
+type Indexed struct {
+	Width, Height int
+	// Pix holds Width*Height color table indexes, without a border.
+	Pix []byte
+
+	ref     *dataLocation
+	col     []uint16
+	mapping []byte
+}
+
+// GetIndexed decodes the picture ID into color table indexes. The custom
+// color row, if any, is stripped from Pix. The result is not cached.
+func (c *CLImages) GetIndexed(id uint32) *Indexed {
+	ref := c.idrefs[id]
+	if ref == nil {
 		return nil
 	}
-	if err := binary.Read(r, binary.BigEndian, &pad); err != nil {
-		log.Printf("read pad for %d: %v", id, err)
+	imgLoc := c.images[ref.imageID]
+	colLoc := c.colors[ref.colorID]
+	if imgLoc == nil || colLoc == nil {
 		return nil
 	}
-	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
-		log.Printf("read v for %d: %v", id, err)
+
+	if int(imgLoc.offset) > len(c.data) {
+		log.Printf("image %d out of range", id)
 		return nil
 	}
-	if err := binary.Read(r, binary.BigEndian, &b); err != nil {
-		log.Printf("read b for %d: %v", id, err)
+	bits, err := DecodeBits(c.data[imgLoc.offset:])
+	if err != nil {
+		log.Printf("decode image %d: %v", id, err)
 		return nil
 	}
+	width, height, data := bits.Width, bits.Height, bits.Pix
 
-	width := int(w)
-	height := int(h)
-	valueW := int(v)
-	blockLenW := int(b)
-	pixelCount := width * height
-	br := New(r)
-	data := make([]byte, pixelCount)
-	pixPos := 0
-	for pixPos < pixelCount {
-		t, err := br.ReadBit()
-		if err != nil {
-			log.Printf("read bit for %d: %v", id, err)
-			return nil
-		}
-		s, err := br.ReadInt(blockLenW)
-		if err != nil {
-			log.Printf("read int for %d: %v", id, err)
-			return nil
-		}
-		s++
-		if t {
-			for i := 0; i < s; i++ {
-				val, err := br.ReadBits(valueW)
-				if err != nil {
-					log.Printf("read bits for %d: %v", id, err)
-					return nil
-				}
-				if pixPos < pixelCount {
-					data[pixPos] = val
-					pixPos++
-				} else {
-					break
-				}
-			}
-		} else {
-			val, err := br.ReadBits(valueW)
-			if err != nil {
-				log.Printf("read bits for %d: %v", id, err)
-				return nil
-			}
-			for i := 0; i < s; i++ {
-				if pixPos < pixelCount {
-					data[pixPos] = val
-					pixPos++
-				} else {
-					break
-				}
-			}
-		}
-	}
-
-	// prepare color table and handle custom palette row if present
-	pal := palette // from palette.go
-	col := append([]uint16(nil), colLoc.colorBytes...)
-
+	// strip the custom palette row if present
 	var mapping []byte
 	if ref.flags&pictDefCustomColors != 0 {
 		if len(data) >= width {
@@ -592,59 +612,91 @@ func (c *CLImages) Get(id uint32, custom []byte, forceTransparent bool) *ebiten.
 			data = data[width:]
 			height--
 		}
-		if len(custom) > 0 {
-			applyCustomPalette(col, mapping, custom)
-		}
 	}
-	pixelCount = len(data)
-	// Add a 1 pixel transparent border around the decoded image.
-	img := image.NewRGBA(image.Rect(0, 0, width+2, height+2))
+	return &Indexed{
+		Width:   width,
+		Height:  height,
+		Pix:     data,
+		ref:     ref,
+		col:     colLoc.colorBytes,
+		mapping: mapping,
+	}
+}
+
+// Palette returns the premultiplied color for each of the 256 possible
+// indexes in ix, after applying the optional custom colors. If
+// forceTransparent is true, the entry for palette index 0 is fully
+// transparent regardless of the sprite's pictDef flags.
+func (c *CLImages) Palette(ix *Indexed, custom []byte, forceTransparent bool) [256]color.RGBA {
+	out, zero := c.OpaquePalette(ix, custom)
 
 	// Determine alpha level and transparency handling based on
 	// sprite definition flags. Some assets (like mobiles) rely on
 	// index 0 being transparent even without the explicit flag, so
 	// allow callers to force this behavior.
-	alpha, transparent := alphaTransparentForFlags(ref.flags)
+	alpha, transparent := alphaTransparentForFlags(ix.ref.flags)
 	if forceTransparent {
 		transparent = true
 	}
-
-	pix := img.Pix
-	stride := img.Stride
-	for i := 0; i < pixelCount; i++ {
-		idx := col[data[i]]
-		r := uint8(pal[idx*3])
-		g := uint8(pal[idx*3+1])
-		b := uint8(pal[idx*3+2])
+	for i, clr := range out {
+		if clr.A == 0 {
+			// No color table entry; leave fully transparent.
+			continue
+		}
 		a := alpha
-		if idx == 0 && transparent {
+		if zero[i] && transparent {
 			a = 0
 		}
 		// Ebiten expects premultiplied alpha values.
-		r = uint8(int(r) * int(a) / 255)
-		g = uint8(int(g) * int(a) / 255)
-		b = uint8(int(b) * int(a) / 255)
-		off := (i/width+1)*stride + (i%width+1)*4
-		pix[off+0] = r
-		pix[off+1] = g
-		pix[off+2] = b
-		pix[off+3] = a
+		out[i] = color.RGBA{
+			R: uint8(int(clr.R) * int(a) / 255),
+			G: uint8(int(clr.G) * int(a) / 255),
+			B: uint8(int(clr.B) * int(a) / 255),
+			A: a,
+		}
 	}
+	return out
+}
 
-	if c.Denoise {
-		denoiseImage(img, c.DenoiseSharpness, c.DenoisePercent)
+// OpaquePalette returns the fully opaque color for each index in ix, after
+// applying the optional custom colors, ignoring the sprite's blend and
+// transparency flags. zero reports which entries map to color table index 0,
+// the one drawn transparent by Palette.
+func (c *CLImages) OpaquePalette(ix *Indexed, custom []byte) (out [256]color.RGBA, zero [256]bool) {
+	pal := palette // from palette.go
+	col := append([]uint16(nil), ix.col...)
+	if ix.ref.flags&pictDefCustomColors != 0 && len(custom) > 0 {
+		applyCustomPalette(col, ix.mapping, custom)
 	}
-
-	eimg := newImageFromImage(img)
-	c.mu.Lock()
-	c.cache[key] = eimg
-	c.mu.Unlock()
-	return eimg
+	for i, idx := range col {
+		if i >= len(out) {
+			break
+		}
+		if int(idx)*3+2 >= len(pal) {
+			continue
+		}
+		out[i] = color.RGBA{
+			R: uint8(pal[idx*3]),
+			G: uint8(pal[idx*3+1]),
+			B: uint8(pal[idx*3+2]),
+			A: 0xff,
+		}
+		zero[i] = idx == 0
+	}
+	return out, zero
 }
 
 // NumFrames returns the number of animation frames for the given image ID.
 // If unknown, it returns 1.
 func (c *CLImages) NumFrames(id uint32) int {
+	if e := c.override(id); e != nil {
+		return e.frames(c.numFrames(id))
+	}
+	return c.numFrames(id)
+}
+
+// numFrames returns the frame count stored in the archive.
+func (c *CLImages) numFrames(id uint32) int {
 	if ref := c.idrefs[id]; ref != nil && ref.numFrames > 0 {
 		return int(ref.numFrames)
 	}
@@ -668,6 +720,13 @@ func (c *CLImages) FrameIndex(id uint32, counter int) int {
 		return 0
 	}
 	ref := c.idrefs[id]
+	if e := c.override(id); e != nil {
+		if n := e.frames(c.numFrames(id)); ref == nil || n != int(ref.numFrames) {
+			// The archive's animation table does not fit a different
+			// frame count, so step through the frames in order.
+			return counter % n
+		}
+	}
 	if ref == nil || ref.numFrames <= 1 {
 		return 0
 	}
@@ -683,8 +742,15 @@ func (c *CLImages) FrameIndex(id uint32, counter int) int {
 }
 
 // Size returns the width and height of the image with the given ID.
-// If the image is missing, zeros are returned.
+// If the image is missing, zeros are returned. Overridden pictures report
+// their size in game pixels, after repacking and dividing by their scale.
 func (c *CLImages) Size(id uint32) (int, int) {
+	if e := c.override(id); e != nil {
+		n := e.frames(c.numFrames(id))
+		fw, fh := e.frameSize(n)
+		s := e.manifest.Scale
+		return int(float64(fw) / s), int(float64(fh*n) / s)
+	}
 	ref := c.idrefs[id]
 	if ref == nil {
 		return 0, 0
@@ -82,13 +82,15 @@ func colourDist(a, b color.RGBA) int {
 	return dr*dr + dg*dg + db*db
 }
 
-// mixColour blends two colours together by the provided percentage.
+// mixColour blends two colours together by the provided percentage. Alpha
+// is rounded: truncating 255*(1-p) + 255*p gives 254 for some p, which left
+// denoised pixels of opaque sprites slightly translucent.
 func mixColour(a, b color.RGBA, p float64) color.RGBA {
 	inv := 1 - p
 	return color.RGBA{
 		R: uint8(float64(a.R)*inv + float64(b.R)*p),
 		G: uint8(float64(a.G)*inv + float64(b.G)*p),
 		B: uint8(float64(a.B)*inv + float64(b.B)*p),
-		A: uint8(float64(a.A)*inv + float64(b.A)*p),
+		A: uint8(math.Round(float64(a.A)*inv + float64(b.A)*p)),
 	}
 }
@@ -0,0 +1,45 @@
+package climg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMixColourKeepsOpaqueAlpha(t *testing.T) {
+	a := color.RGBA{0x80, 0x40, 0x20, 0xff}
+	b := color.RGBA{0x84, 0x44, 0x24, 0xff}
+	// For this blend the old truncating mix made two opaque colours 254.
+	const p = 0.00014
+	if old := uint8(float64(a.A)*(1-p) + float64(b.A)*p); old != 0xfe {
+		t.Fatalf("truncated alpha = %#x, want 0xfe", old)
+	}
+	if got := mixColour(a, b, p); got.A != 0xff {
+		t.Fatalf("mixColour alpha = %#x, want 0xff", got.A)
+	}
+	half := color.RGBA{0x40, 0x20, 0x10, 0x7f}
+	if got := mixColour(half, a, 0.5); got.A != 0xbf {
+		t.Fatalf("mixColour alpha of a translucent colour = %#x, want 0xbf", got.A)
+	}
+}
+
+func TestDenoiseImageKeepsOpaqueAlpha(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetRGBA(x, y, color.RGBA{byte(0x60 + x), byte(0x50 + y), 0x40, 0xff})
+		}
+	}
+	for _, sharpness := range []float64{1, 4, 10} {
+		for _, percent := range []float64{0.1, 0.2, 0.5} {
+			out := image.NewRGBA(img.Rect)
+			copy(out.Pix, img.Pix)
+			denoiseImage(out, sharpness, percent)
+			for i := 3; i < len(out.Pix); i += 4 {
+				if out.Pix[i] != 0xff {
+					t.Fatalf("sharpness %v percent %v: pixel %d alpha %#x", sharpness, percent, i/4, out.Pix[i])
+				}
+			}
+		}
+	}
+}
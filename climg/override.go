@@ -0,0 +1,274 @@
+package climg
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Overrides is a directory of replacement artwork. A file named <id>.png
+// replaces picture id wherever CLImages returns pixels. An optional <id>.json
+// manifest next to it describes the frame layout:
+//
+//	{"frames": 4, "columns": 2, "scale": 2}
+//
+// frames is the number of animation frames (default: the original count),
+// columns is how many frames sit side by side in the PNG (default 1, a
+// vertical strip like CL_Images uses) and scale is how many PNG pixels make
+// up one game pixel (default 1), which lets HD artwork keep the original
+// on-screen size. Frames are repacked into a vertical strip when loaded.
+type Overrides struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[uint32]*override
+	// failed remembers files that did not load so they are only retried
+	// once they change on disk.
+	failed map[uint32]*override
+	rev    uint32
+}
+
+type override struct {
+	path     string
+	mod      time.Time
+	size     int64
+	manifest overrideManifest
+	manMod   time.Time
+	w, h     int // PNG size
+	rev      uint32
+}
+
+type overrideManifest struct {
+	Frames  int     `json:"frames"`
+	Columns int     `json:"columns"`
+	Scale   float64 `json:"scale"`
+}
+
+// NewOverrides scans dir for replacement pictures. A missing directory is not
+// an error; it simply holds no overrides until files appear. The returned set
+// is usable even when some pictures fail to load.
+func NewOverrides(dir string) (*Overrides, error) {
+	o := &Overrides{dir: dir, entries: map[uint32]*override{}, failed: map[uint32]*override{}}
+	_, err := o.Reload()
+	return o, err
+}
+
+// Dir returns the directory being scanned.
+func (o *Overrides) Dir() string { return o.dir }
+
+// Reload rescans the directory and reports whether any override was added,
+// changed or removed. Pictures that fail to load are skipped and returned
+// as the error.
+func (o *Overrides) Reload() (bool, error) {
+	found := map[uint32]*override{}
+	var firstErr error
+	files, err := os.ReadDir(o.dir)
+	if err != nil && !os.IsNotExist(err) {
+		firstErr = err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.EqualFold(filepath.Ext(name), ".png") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, filepath.Ext(name)), 10, 32)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		e := &override{path: filepath.Join(o.dir, name), mod: info.ModTime(), size: info.Size()}
+		if mi, err := os.Stat(filepath.Join(o.dir, fmt.Sprintf("%d.json", id))); err == nil {
+			e.manMod = mi.ModTime()
+		}
+		found[uint32(id)] = e
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changed := false
+	for id := range o.entries {
+		if found[id] == nil {
+			changed = true
+		}
+	}
+	failed := map[uint32]*override{}
+	for id, e := range found {
+		if old, ok := o.entries[id]; ok && old.same(e) {
+			found[id] = old
+			continue
+		}
+		if old, ok := o.failed[id]; ok && old.same(e) {
+			failed[id] = old
+			delete(found, id)
+			continue
+		}
+		if err := e.load(id, o.dir); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed[id] = e
+			delete(found, id)
+			if o.entries[id] != nil {
+				changed = true
+			}
+			continue
+		}
+		changed = true
+		o.rev++
+		e.rev = o.rev
+	}
+	o.entries = found
+	o.failed = failed
+	return changed, firstErr
+}
+
+// same reports whether e and n were read from the same files.
+func (e *override) same(n *override) bool {
+	return e.mod.Equal(n.mod) && e.size == n.size && e.manMod.Equal(n.manMod)
+}
+
+// load reads the manifest and PNG header for e.
+func (e *override) load(id uint32, dir string) error {
+	if !e.manMod.IsZero() {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", id)))
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &e.manifest); err != nil {
+			return fmt.Errorf("override %d manifest: %w", id, err)
+		}
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		return fmt.Errorf("override %d: %w", id, err)
+	}
+	e.w, e.h = cfg.Width, cfg.Height
+	if e.manifest.Columns <= 0 {
+		e.manifest.Columns = 1
+	}
+	if e.manifest.Scale <= 0 {
+		e.manifest.Scale = 1
+	}
+	return nil
+}
+
+func (o *Overrides) get(id uint32) *override {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.entries[id]
+}
+
+// IDs returns the picture IDs that currently have an override.
+func (o *Overrides) IDs() []uint32 {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ids := make([]uint32, 0, len(o.entries))
+	for id := range o.entries {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// frames returns the number of frames in e, falling back to orig when the
+// manifest does not say.
+func (e *override) frames(orig int) int {
+	if e.manifest.Frames > 0 {
+		return e.manifest.Frames
+	}
+	return max(orig, 1)
+}
+
+// frameSize returns the size in PNG pixels of one frame of e.
+func (e *override) frameSize(frames int) (int, int) {
+	cols := min(e.manifest.Columns, frames)
+	rows := (frames + cols - 1) / cols
+	return e.w / cols, e.h / rows
+}
+
+// decode loads the PNG of e and repacks its frames into a premultiplied
+// vertical strip with the same 1 pixel border GetRGBA adds.
+func (e *override) decode(frames int) (*image.RGBA, error) {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return repackFrames(src, frames, e.manifest.Columns), nil
+}
+
+// repackFrames copies frames laid out in columns across src into a single
+// column with a transparent 1 pixel border around it.
+func repackFrames(src image.Image, frames, columns int) *image.RGBA {
+	frames = max(frames, 1)
+	cols := max(min(columns, frames), 1)
+	rows := (frames + cols - 1) / cols
+	b := src.Bounds()
+	fw, fh := b.Dx()/cols, b.Dy()/rows
+	dst := image.NewRGBA(image.Rect(0, 0, fw+2, fh*frames+2))
+	for i := 0; i < frames; i++ {
+		sp := b.Min.Add(image.Pt(i%cols*fw, i/cols*fh))
+		r := image.Rect(1, 1+i*fh, 1+fw, 1+(i+1)*fh)
+		draw.Draw(dst, r, src, sp, draw.Src)
+	}
+	return dst
+}
+
+// SetOverrides installs o as the source of replacement artwork. Passing nil
+// removes all overrides. Cached images are dropped.
+func (c *CLImages) SetOverrides(o *Overrides) {
+	c.overrides.Store(o)
+	c.ClearCache()
+}
+
+// Overrides returns the installed override set, or nil.
+func (c *CLImages) Overrides() *Overrides {
+	return c.overrides.Load()
+}
+
+func (c *CLImages) override(id uint32) *override {
+	return c.Overrides().get(id)
+}
+
+// OverrideRevision returns a number that changes every time the override for
+// id is loaded, or 0 if id is not overridden. Callers include it in cache
+// keys so stale artwork is never served after a reload.
+func (c *CLImages) OverrideRevision(id uint32) uint32 {
+	if e := c.override(id); e != nil {
+		return e.rev
+	}
+	return 0
+}
+
+// Scale returns how many image pixels make up one game pixel for id. It is 1
+// unless an override says otherwise.
+func (c *CLImages) Scale(id uint32) float64 {
+	if e := c.override(id); e != nil {
+		return e.manifest.Scale
+	}
+	return 1
+}
@@ -0,0 +1,366 @@
+package climg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"gothoom/keyfile"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// PictDef is the picture definition (IDREF) record that ties an image's
+// bits, colors and lighting together. Checksum is filled in by the Writer
+// unless Flags turns checksums off.
+type PictDef struct {
+	Version      uint32
+	ImageID      uint32
+	ColorID      uint32
+	Checksum     uint32
+	Flags        uint32
+	UnusedFlags  uint32
+	UnusedFlags2 uint32
+	LightingID   int32
+	Plane        int16
+	NumFrames    uint16
+	AnimFrames   []int16 // at most 16 entries
+
+	animStored []int16 // the table as loaded; see dataLocation
+}
+
+// PictDefVersion is the record version the original tools write.
+const PictDefVersion = 0x100
+
+// PictDef returns the definition of picture id as loaded.
+func (c *CLImages) PictDef(id uint32) (PictDef, bool) {
+	ref := c.idrefs[id]
+	if ref == nil {
+		return PictDef{}, false
+	}
+	n := max(0, min(int(ref.numAnims), len(ref.animFrameTable)))
+	return PictDef{
+		Version:      ref.version,
+		ImageID:      ref.imageID,
+		ColorID:      ref.colorID,
+		Checksum:     ref.checksum,
+		Flags:        ref.flags,
+		UnusedFlags:  ref.unusedFlags,
+		UnusedFlags2: ref.unusedFlags2,
+		LightingID:   ref.lightingID,
+		Plane:        ref.plane,
+		NumFrames:    ref.numFrames,
+		AnimFrames:   append([]int16(nil), ref.animFrameTable[:n]...),
+		animStored:   ref.animStored,
+	}, true
+}
+
+// Writer builds a CL_Images keyfile. Start from an empty file with
+// NewWriter or from a loaded archive with (*CLImages).Writer.
+type Writer struct {
+	kf *keyfile.File
+}
+
+// NewWriter returns a Writer for an empty CL_Images file.
+func NewWriter() *Writer {
+	return &Writer{kf: keyfile.New()}
+}
+
+// Writer returns a Writer holding every record of c. Written unmodified it
+// reproduces the file c was loaded from byte for byte.
+func (c *CLImages) Writer() (*Writer, error) {
+	kf, err := keyfile.Parse(c.data)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{kf: kf}, nil
+}
+
+// Keyfile exposes the underlying keyfile for records the Writer has no
+// helper for.
+func (w *Writer) Keyfile() *keyfile.File { return w.kf }
+
+// PutImage stores the encoded bits record id, as read by GetIndexed.
+func (w *Writer) PutImage(id uint32, bits []byte) { w.kf.Put(TYPE_IMAGE, id, bits) }
+
+// PutBits encodes b with EncodeBits and stores it as image record id.
+func (w *Writer) PutBits(id uint32, b Bits) error {
+	rec, err := EncodeBits(b)
+	if err != nil {
+		return fmt.Errorf("climg: image %d: %w", id, err)
+	}
+	w.PutImage(id, rec)
+	return nil
+}
+
+// PutColors stores the color table record id: one palette index per color.
+func (w *Writer) PutColors(id uint32, colors []byte) { w.kf.Put(TYPE_COLOR, id, colors) }
+
+// PutLight stores the lighting record id.
+func (w *Writer) PutLight(id uint32, light []byte) { w.kf.Put(TYPE_LIGHT, id, light) }
+
+// PutPictDef stores the definition of picture id. The image, color and
+// (if set) lighting records it names must already be present; they are
+// needed for the checksum, which replaces d.Checksum. A definition whose
+// flags turn checksums off keeps d.Checksum as given.
+func (w *Writer) PutPictDef(id uint32, d PictDef) error {
+	if len(d.AnimFrames) > 16 {
+		return fmt.Errorf("climg: pict %d has %d animation frames, max 16", id, len(d.AnimFrames))
+	}
+	bits, ok := w.kf.Get(TYPE_IMAGE, d.ImageID)
+	if !ok {
+		return fmt.Errorf("climg: pict %d: image %d missing", id, d.ImageID)
+	}
+	colors, ok := w.kf.Get(TYPE_COLOR, d.ColorID)
+	if !ok {
+		return fmt.Errorf("climg: pict %d: colors %d missing", id, d.ColorID)
+	}
+	var light []byte
+	if d.LightingID != 0 {
+		if light, ok = w.kf.Get(TYPE_LIGHT, uint32(d.LightingID)); !ok {
+			return fmt.Errorf("climg: pict %d: lighting %d missing", id, d.LightingID)
+		}
+	}
+	ref := &dataLocation{
+		id:           id,
+		version:      d.Version,
+		imageID:      d.ImageID,
+		colorID:      d.ColorID,
+		flags:        d.Flags,
+		unusedFlags:  d.UnusedFlags,
+		unusedFlags2: d.UnusedFlags2,
+		lightingID:   d.LightingID,
+		plane:        d.Plane,
+		numFrames:    d.NumFrames,
+		numAnims:     int16(len(d.AnimFrames)),
+	}
+	copy(ref.animFrameTable[:], d.AnimFrames)
+	if d.Flags&pictDefFlagNoChecksum == 0 {
+		d.Checksum = calculateChecksum(bits, colors, light, ref)
+	}
+	w.kf.Put(TYPE_IDREF, id, encodePictDef(d))
+	return nil
+}
+
+// encodePictDef lays d out like the original PictDef struct, trimmed after
+// the used part of the animation table. A loaded record that stored more of
+// the table keeps those entries.
+func encodePictDef(d PictDef) []byte {
+	table := d.AnimFrames
+	if len(d.animStored) > len(table) {
+		table = append(append([]int16(nil), table...), d.animStored[len(table):]...)
+	}
+	buf := make([]byte, 38+2*len(table))
+	be := binary.BigEndian
+	be.PutUint32(buf[0:], d.Version)
+	be.PutUint32(buf[4:], d.ImageID)
+	be.PutUint32(buf[8:], d.ColorID)
+	be.PutUint32(buf[12:], d.Checksum)
+	be.PutUint32(buf[16:], d.Flags)
+	be.PutUint32(buf[20:], d.UnusedFlags)
+	be.PutUint32(buf[24:], d.UnusedFlags2)
+	be.PutUint32(buf[28:], uint32(d.LightingID))
+	be.PutUint16(buf[32:], uint16(d.Plane))
+	be.PutUint16(buf[34:], d.NumFrames)
+	be.PutUint16(buf[36:], uint16(len(d.AnimFrames)))
+	for i, f := range table {
+		be.PutUint16(buf[38+2*i:], uint16(f))
+	}
+	return buf
+}
+
+// PutItem stores the client item record id. The name is written as Mac OS
+// Roman; an item read with (*CLImages).Item keeps the rest of its stored
+// name field.
+func (w *Writer) PutItem(id uint32, it ClientItem) {
+	name := make([]byte, 0, len(it.Name))
+	for _, r := range it.Name {
+		b, ok := charmap.Macintosh.EncodeRune(r)
+		if !ok {
+			b = '?'
+		}
+		name = append(name, b)
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	buf := make([]byte, 20, 20+len(name)+1)
+	be := binary.BigEndian
+	be.PutUint32(buf[0:], it.Flags)
+	be.PutUint32(buf[4:], uint32(int32(it.Slot)))
+	be.PutUint32(buf[8:], it.RightHandPictID)
+	be.PutUint32(buf[12:], it.LeftHandPictID)
+	be.PutUint32(buf[16:], it.WornPictID)
+	field := append(name, 0)
+	if len(it.nameBuf) > len(field) {
+		field = append(field, it.nameBuf[len(field):]...)
+	}
+	buf = append(buf, field...)
+	w.kf.Put(TYPE_CLIENT_ITEM, id, buf)
+}
+
+// Bits is a decoded image record: Width*Height color table indexes, row by
+// row, and the field widths they were packed with.
+type Bits struct {
+	Width, Height int
+	Reserved      uint32 // header word after the size, kept as read
+	ValueBits     int    // bits per color table index, 1-8
+	RunBits       int    // bits per run length, 1-16
+	Pix           []byte
+}
+
+// ImageBits decodes image record id.
+func (c *CLImages) ImageBits(id uint32) (Bits, error) {
+	rec, ok := c.record(c.images[id])
+	if !ok {
+		return Bits{}, fmt.Errorf("climg: image %d missing", id)
+	}
+	return DecodeBits(rec)
+}
+
+// Colors returns color record id: one palette index per color.
+func (c *CLImages) Colors(id uint32) ([]byte, bool) {
+	loc := c.colors[id]
+	if loc == nil {
+		return nil, false
+	}
+	out := make([]byte, len(loc.colorBytes))
+	for i, v := range loc.colorBytes {
+		out[i] = byte(v)
+	}
+	return out, true
+}
+
+// Light returns lighting record id as stored; the client does not
+// interpret it.
+func (c *CLImages) Light(id uint32) ([]byte, bool) {
+	rec, ok := c.record(c.lights[id])
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), rec...), true
+}
+
+// record returns the data of the record at loc, or false when loc is nil or
+// runs past the end of the file.
+func (c *CLImages) record(loc *dataLocation) ([]byte, bool) {
+	if loc == nil || uint64(loc.offset)+uint64(loc.size) > uint64(len(c.data)) {
+		return nil, false
+	}
+	return c.data[loc.offset : loc.offset+loc.size], true
+}
+
+// DecodeBits unpacks an image record. After a 10 byte header (height,
+// width, a reserved word, ValueBits and RunBits) come runs, each a flag bit,
+// a RunBits length minus one and either one value to repeat (flag clear) or
+// that many values (flag set). Bytes after the last pixel are ignored.
+func DecodeBits(rec []byte) (Bits, error) {
+	if len(rec) < 10 {
+		return Bits{}, errors.New("climg: short image header")
+	}
+	be := binary.BigEndian
+	b := Bits{
+		Height:    int(be.Uint16(rec[0:])),
+		Width:     int(be.Uint16(rec[2:])),
+		Reserved:  be.Uint32(rec[4:]),
+		ValueBits: int(rec[8]),
+		RunBits:   int(rec[9]),
+	}
+	n := b.Width * b.Height
+	b.Pix = make([]byte, n)
+	br := New(bytes.NewReader(rec[10:]))
+	for pos := 0; pos < n; {
+		literal, err := br.ReadBit()
+		if err != nil {
+			return Bits{}, fmt.Errorf("climg: image bits: %w", err)
+		}
+		run, err := br.ReadInt(b.RunBits)
+		if err != nil {
+			return Bits{}, fmt.Errorf("climg: image bits: %w", err)
+		}
+		run++
+		if literal {
+			for i := 0; i < run && pos < n; i++ {
+				v, err := br.ReadBits(b.ValueBits)
+				if err != nil {
+					return Bits{}, fmt.Errorf("climg: image bits: %w", err)
+				}
+				b.Pix[pos] = v
+				pos++
+			}
+			continue
+		}
+		v, err := br.ReadBits(b.ValueBits)
+		if err != nil {
+			return Bits{}, fmt.Errorf("climg: image bits: %w", err)
+		}
+		for i := 0; i < run && pos < n; i++ {
+			b.Pix[pos] = v
+			pos++
+		}
+	}
+	return b, nil
+}
+
+// EncodeBits packs b into an image record as DecodeBits reads it. Two or
+// more equal indexes in a row become a repeat run; everything else goes
+// into literal runs, which stop where a repeat starts. Runs are at most
+// 1<<RunBits long.
+func EncodeBits(b Bits) ([]byte, error) {
+	switch {
+	case b.Width < 0 || b.Height < 0 || b.Width > 0xffff || b.Height > 0xffff:
+		return nil, fmt.Errorf("climg: image size %dx%d out of range", b.Width, b.Height)
+	case len(b.Pix) != b.Width*b.Height:
+		return nil, fmt.Errorf("climg: %d pixels for a %dx%d image", len(b.Pix), b.Width, b.Height)
+	case b.ValueBits < 1 || b.ValueBits > 8:
+		return nil, fmt.Errorf("climg: %d bits per value, want 1-8", b.ValueBits)
+	case b.RunBits < 1 || b.RunBits > 16:
+		return nil, fmt.Errorf("climg: %d bits per run, want 1-16", b.RunBits)
+	}
+	for _, v := range b.Pix {
+		if int(v)>>b.ValueBits != 0 {
+			return nil, fmt.Errorf("climg: index %d does not fit %d bits", v, b.ValueBits)
+		}
+	}
+	hdr := make([]byte, 10)
+	be := binary.BigEndian
+	be.PutUint16(hdr[0:], uint16(b.Height))
+	be.PutUint16(hdr[2:], uint16(b.Width))
+	be.PutUint32(hdr[4:], b.Reserved)
+	hdr[8] = byte(b.ValueBits)
+	hdr[9] = byte(b.RunBits)
+	bw := bitWriter{buf: hdr}
+	maxRun := 1 << b.RunBits
+	pix := b.Pix
+	for i := 0; i < len(pix); {
+		run := 1
+		for i+run < len(pix) && run < maxRun && pix[i+run] == pix[i] {
+			run++
+		}
+		if run >= 2 {
+			bw.WriteBits(0, 1)
+			bw.WriteBits(run-1, b.RunBits)
+			bw.WriteBits(int(pix[i]), b.ValueBits)
+			i += run
+			continue
+		}
+		j := i + 1
+		for j < len(pix) && j-i < maxRun && (j+1 == len(pix) || pix[j+1] != pix[j]) {
+			j++
+		}
+		bw.WriteBits(1, 1)
+		bw.WriteBits(j-i-1, b.RunBits)
+		for _, v := range pix[i:j] {
+			bw.WriteBits(int(v), b.ValueBits)
+		}
+		i = j
+	}
+	return bw.buf, nil
+}
+
+// Bytes encodes the keyfile.
+func (w *Writer) Bytes() []byte { return w.kf.Bytes() }
+
+// WriteFile encodes the keyfile to path.
+func (w *Writer) WriteFile(path string) error { return w.kf.WriteFile(path) }
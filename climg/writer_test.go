@@ -0,0 +1,53 @@
+package climg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeBitsRoundTrip(t *testing.T) {
+	b := Bits{Width: 20, Height: 3, Reserved: 0x00010002, ValueBits: 3, RunBits: 2}
+	for i := 0; i < b.Width*b.Height; i++ {
+		switch {
+		case i < 9: // longer than one run
+			b.Pix = append(b.Pix, 5)
+		case i%7 == 0:
+			b.Pix = append(b.Pix, 1, 1)
+			i++
+		default:
+			b.Pix = append(b.Pix, byte(i%8))
+		}
+	}
+	rec, err := EncodeBits(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBits(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != b.Width || got.Height != b.Height || got.Reserved != b.Reserved ||
+		got.ValueBits != b.ValueBits || got.RunBits != b.RunBits || !bytes.Equal(got.Pix, b.Pix) {
+		t.Fatalf("DecodeBits(EncodeBits(b)) = %+v, want %+v", got, b)
+	}
+	again, err := EncodeBits(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, rec) {
+		t.Errorf("re-encoded % x, want % x", again, rec)
+	}
+}
+
+func TestEncodeBitsRejects(t *testing.T) {
+	for name, b := range map[string]Bits{
+		"pixels":    {Width: 2, Height: 2, ValueBits: 8, RunBits: 4, Pix: []byte{1, 2, 3}},
+		"valueBits": {Width: 1, Height: 1, ValueBits: 9, RunBits: 4, Pix: []byte{1}},
+		"runBits":   {Width: 1, Height: 1, ValueBits: 8, RunBits: 0, Pix: []byte{1}},
+		"index":     {Width: 1, Height: 1, ValueBits: 2, RunBits: 4, Pix: []byte{4}},
+	} {
+		if _, err := EncodeBits(b); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package clsnd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"gothoom/keyfile"
+)
+
+// Writer builds a CL_Sounds keyfile. Start from an empty file with
+// NewWriter or from a loaded archive with (*CLSounds).Writer.
+type Writer struct {
+	kf *keyfile.File
+}
+
+// NewWriter returns a Writer for an empty CL_Sounds file.
+func NewWriter() *Writer {
+	return &Writer{kf: keyfile.New()}
+}
+
+// Writer returns a Writer holding every record of c. Written unmodified it
+// reproduces the file c was loaded from byte for byte.
+func (c *CLSounds) Writer() (*Writer, error) {
+	kf, err := keyfile.Parse(c.data)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{kf: kf}, nil
+}
+
+// Keyfile exposes the underlying keyfile.
+func (w *Writer) Keyfile() *keyfile.File { return w.kf }
+
+// PutResource stores a complete 'snd ' resource as sound id.
+func (w *Writer) PutResource(id uint32, res []byte) { w.kf.Put(typeSound, id, res) }
+
+// PutSound encodes s as an uncompressed 'snd ' resource and stores it as
+// sound id. Data is laid out as Get returns it: unsigned 8-bit or big
+// endian 16-bit samples, channels interleaved.
+func (w *Writer) PutSound(id uint32, s *Sound) error {
+	res, err := EncodeSound(s)
+	if err != nil {
+		return fmt.Errorf("clsnd: sound %d: %w", id, err)
+	}
+	w.PutResource(id, res)
+	return nil
+}
+
+// Delete removes sound id and reports whether it existed.
+func (w *Writer) Delete(id uint32) bool { return w.kf.Delete(typeSound, id) }
+
+// Bytes encodes the keyfile.
+func (w *Writer) Bytes() []byte { return w.kf.Bytes() }
+
+// WriteFile encodes the keyfile to path.
+func (w *Writer) WriteFile(path string) error { return w.kf.WriteFile(path) }
+
+// EncodeSound builds a format 1 'snd ' resource holding s. Mono 8-bit sounds
+// use a standard header like most of CL_Sounds; anything else uses an
+// extended header.
+func EncodeSound(s *Sound) ([]byte, error) {
+	if s.Bits != 8 && s.Bits != 16 {
+		return nil, fmt.Errorf("unsupported bits %d", s.Bits)
+	}
+	if s.Channels == 0 || s.SampleRate == 0 || s.SampleRate > 0xffff {
+		return nil, fmt.Errorf("unsupported format %d ch %d Hz", s.Channels, s.SampleRate)
+	}
+	frameBytes := int(s.Channels) * int(s.Bits/8)
+	if len(s.Data)%frameBytes != 0 {
+		return nil, fmt.Errorf("data length %d is not a whole number of frames", len(s.Data))
+	}
+	const hdr = 20
+	be := binary.BigEndian
+	// Format 1, one sampledSynth modifier, one bufferCmd pointing at the
+	// header that follows.
+	res := make([]byte, hdr, hdr+64+len(s.Data))
+	be.PutUint16(res[0:], 1)
+	be.PutUint16(res[2:], 1)
+	be.PutUint16(res[4:], 5)
+	be.PutUint32(res[6:], 0x80)
+	be.PutUint16(res[10:], 1)
+	be.PutUint16(res[12:], dataOffsetFlag|bufferCmd)
+	be.PutUint32(res[16:], hdr)
+
+	rate := s.SampleRate << 16
+	if s.Bits == 8 && s.Channels == 1 {
+		h := make([]byte, 22)
+		be.PutUint32(h[4:], uint32(len(s.Data)))
+		be.PutUint32(h[8:], rate)
+		h[20] = 0    // stdSH
+		h[21] = 0x3c // middle C
+		return append(append(res, h...), s.Data...), nil
+	}
+	h := make([]byte, 64)
+	be.PutUint32(h[4:], s.Channels)
+	be.PutUint32(h[8:], rate)
+	h[20] = 0xff // extSH
+	h[21] = 0x3c
+	be.PutUint32(h[22:], uint32(len(s.Data)/frameBytes))
+	putExtended(h[26:36], s.SampleRate)
+	be.PutUint16(h[48:], s.Bits)
+	return append(append(res, h...), s.Data...), nil
+}
+
+// putExtended writes v as an 80-bit IEEE extended float, the AIFF sample
+// rate format.
+func putExtended(b []byte, v uint32) {
+	if v == 0 {
+		return
+	}
+	exp := 31 - bits.LeadingZeros32(v)
+	binary.BigEndian.PutUint16(b[0:], uint16(16383+exp))
+	binary.BigEndian.PutUint64(b[2:], uint64(v)<<(63-exp))
+}
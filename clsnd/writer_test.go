@@ -0,0 +1,72 @@
+package clsnd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeSoundRoundTrip(t *testing.T) {
+	for _, s := range []*Sound{
+		{Data: []byte{0x80, 0xff, 0x00, 0x7f}, SampleRate: 22050, Channels: 1, Bits: 8},
+		{Data: []byte{0x12, 0x34, 0xfe, 0xdc, 0x00, 0x01, 0x80, 0x00}, SampleRate: 44100, Channels: 2, Bits: 16},
+		{Data: []byte{0x10, 0x20, 0x30, 0x40}, SampleRate: 11025, Channels: 2, Bits: 8},
+	} {
+		res, err := EncodeSound(s)
+		if err != nil {
+			t.Fatalf("EncodeSound(%d ch %d-bit): %v", s.Channels, s.Bits, err)
+		}
+		hdr, ok := soundHeaderOffset(res)
+		if !ok {
+			t.Fatalf("%d ch %d-bit: no sound header", s.Channels, s.Bits)
+		}
+		got, err := decodeHeader(res, hdr, 0)
+		if err != nil {
+			t.Fatalf("%d ch %d-bit: decode: %v", s.Channels, s.Bits, err)
+		}
+		if !bytes.Equal(got.Data, s.Data) || got.SampleRate != s.SampleRate || got.Channels != s.Channels || got.Bits != s.Bits {
+			t.Errorf("round trip = %+v, want %+v", got, s)
+		}
+	}
+	if _, err := EncodeSound(&Sound{Data: []byte{1, 2, 3}, SampleRate: 22050, Channels: 1, Bits: 16}); err == nil {
+		t.Error("partial frame accepted")
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	w := NewWriter()
+	want := &Sound{Data: []byte{1, 2, 3, 4, 5}, SampleRate: 22050, Channels: 1, Bits: 8}
+	if err := w.PutSound(7, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.PutSound(3, &Sound{Data: []byte{0, 1}, SampleRate: 8000, Channels: 1, Bits: 16}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "CL_Sounds")
+	if err := w.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got, err := c.Get(7)
+	if err != nil || got == nil {
+		t.Fatalf("Get(7) = %v, %v", got, err)
+	}
+	if !bytes.Equal(got.Data, want.Data) || got.SampleRate != want.SampleRate {
+		t.Errorf("Get(7) = %+v, want %+v", got, want)
+	}
+
+	// Rewriting the loaded file unchanged reproduces it.
+	w2, err := c.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w2.Bytes(), c.data) {
+		t.Error("unmodified rewrite differs from the loaded file")
+	}
+	if !w2.Delete(3) || w2.Delete(3) {
+		t.Error("Delete did not report existence correctly")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Colorblind modes remap the hue-coded UI colors (name tags, bubbles and
+// status bars) so they stay distinguishable. Remapping uses daltonization:
+// the color is run through a simulation of the deficiency, and the lost
+// difference is shifted into channels the viewer can still see. The same
+// transform is available as a shader for the whole scene.
+
+const (
+	cbNone         = ""
+	cbProtanopia   = "protanopia"
+	cbDeuteranopia = "deuteranopia"
+	cbTritanopia   = "tritanopia"
+)
+
+// colorblindModes lists the selectable modes in menu order.
+var colorblindModes = []struct {
+	name  string
+	label string
+}{
+	{cbNone, "Off"},
+	{cbProtanopia, "Protanopia (red-blind)"},
+	{cbDeuteranopia, "Deuteranopia (green-blind)"},
+	{cbTritanopia, "Tritanopia (blue-blind)"},
+}
+
+// cbSimulation returns the rows of the LMS matrix that simulates mode.
+func cbSimulation(mode string) ([3][3]float64, bool) {
+	switch mode {
+	case cbProtanopia:
+		return [3][3]float64{{0, 2.02344, -2.52581}, {0, 1, 0}, {0, 0, 1}}, true
+	case cbDeuteranopia:
+		return [3][3]float64{{1, 0, 0}, {0.494207, 0, 1.24827}, {0, 0, 1}}, true
+	case cbTritanopia:
+		return [3][3]float64{{1, 0, 0}, {0, 1, 0}, {-0.395913, 0.801109, 0}}, true
+	}
+	return [3][3]float64{}, false
+}
+
+var (
+	rgbToLMS = [3][3]float64{
+		{17.8824, 43.5161, 4.11935},
+		{3.45565, 27.1554, 3.86714},
+		{0.0299566, 0.184309, 1.46709},
+	}
+	lmsToRGB = [3][3]float64{
+		{0.0809444479, -0.130504409, 0.116721066},
+		{-0.0102485335, 0.0540193266, -0.113614708},
+		{-0.000365296938, -0.00412161469, 0.693511405},
+	}
+)
+
+func mulMat3(m [3][3]float64, v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// daltonize returns r, g, b (0..255, not premultiplied) corrected for mode.
+func daltonize(mode string, r, g, b uint8) (uint8, uint8, uint8) {
+	sim, ok := cbSimulation(mode)
+	if !ok {
+		return r, g, b
+	}
+	orig := [3]float64{float64(r), float64(g), float64(b)}
+	seen := mulMat3(lmsToRGB, mulMat3(sim, mulMat3(rgbToLMS, orig)))
+	er := orig[0] - seen[0]
+	eg := orig[1] - seen[1]
+	eb := orig[2] - seen[2]
+	out := [3]float64{orig[0], orig[1] + 0.7*er + eg, orig[2] + 0.7*er + eb}
+	var res [3]uint8
+	for i, v := range out {
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		res[i] = uint8(v + 0.5)
+	}
+	return res[0], res[1], res[2]
+}
+
+// cbRGBA remaps an opaque or straight-alpha UI color for the current mode.
+func cbRGBA(c color.RGBA) color.RGBA {
+	if gs.ColorblindMode == cbNone {
+		return c
+	}
+	c.R, c.G, c.B = daltonize(gs.ColorblindMode, c.R, c.G, c.B)
+	return c
+}
+
+// cbNRGBA is cbRGBA for non-premultiplied colors.
+func cbNRGBA(c color.NRGBA) color.NRGBA {
+	if gs.ColorblindMode == cbNone {
+		return c
+	}
+	c.R, c.G, c.B = daltonize(gs.ColorblindMode, c.R, c.G, c.B)
+	return c
+}
+
+// sceneCBMode returns the colorblind mode for colors drawn into the game
+// world. With DaltonizeScene on the finished world is corrected as a whole,
+// so those colors are left alone rather than corrected twice.
+func sceneCBMode() string {
+	if gs.DaltonizeScene {
+		return cbNone
+	}
+	return gs.ColorblindMode
+}
+
+// cbSceneRGBA is cbRGBA for colors drawn into the game world.
+func cbSceneRGBA(c color.RGBA) color.RGBA {
+	if sceneCBMode() == cbNone {
+		return c
+	}
+	return cbRGBA(c)
+}
+
+// cbSceneNRGBA is cbNRGBA for colors drawn into the game world.
+func cbSceneNRGBA(c color.NRGBA) color.NRGBA {
+	if sceneCBMode() == cbNone {
+		return c
+	}
+	return cbNRGBA(c)
+}
+
+// statusBarColors returns the health, balance and spirit bar colors. The
+// colorblind palettes come from the Okabe-Ito set so the three bars differ in
+// both hue and brightness.
+func statusBarColors() (hp, bal, sp color.RGBA) {
+	switch gs.ColorblindMode {
+	case cbProtanopia, cbDeuteranopia:
+		return color.RGBA{0x56, 0xb4, 0xe9, 0xff}, color.RGBA{0xf0, 0xe4, 0x42, 0xff}, color.RGBA{0xd5, 0x5e, 0x00, 0xff}
+	case cbTritanopia:
+		return color.RGBA{0x00, 0x9e, 0x73, 0xff}, color.RGBA{0xf0, 0xf0, 0xf0, 0xff}, color.RGBA{0xd5, 0x5e, 0x00, 0xff}
+	}
+	return color.RGBA{0x00, 0xff, 0, 0xff}, color.RGBA{0x00, 0x00, 0xff, 0xff}, color.RGBA{0xff, 0x00, 0x00, 0xff}
+}
+
+const daltonizeShaderSrc = `//kage:unit pixels
+
+package main
+
+var SimL vec3
+var SimM vec3
+var SimS vec3
+
+func Fragment(dstPos vec4, srcPos vec2, color vec4) vec4 {
+	c := imageSrc0At(srcPos)
+	if c.a == 0 {
+		return c
+	}
+	rgb := c.rgb / c.a * 255
+	lms := vec3(
+		dot(rgb, vec3(17.8824, 43.5161, 4.11935)),
+		dot(rgb, vec3(3.45565, 27.1554, 3.86714)),
+		dot(rgb, vec3(0.0299566, 0.184309, 1.46709)),
+	)
+	sim := vec3(dot(lms, SimL), dot(lms, SimM), dot(lms, SimS))
+	seen := vec3(
+		dot(sim, vec3(0.0809444479, -0.130504409, 0.116721066)),
+		dot(sim, vec3(-0.0102485335, 0.0540193266, -0.113614708)),
+		dot(sim, vec3(-0.000365296938, -0.00412161469, 0.693511405)),
+	)
+	e := rgb - seen
+	res := rgb + vec3(0, 0.7*e.r+e.g, 0.7*e.r+e.b)
+	return vec4(clamp(res/255, 0, 1)*c.a, c.a)
+}
+`
+
+var (
+	daltonizeShader     *ebiten.Shader
+	daltonizeShaderOnce sync.Once
+	daltonizeScratch    *ebiten.Image
+)
+
+// daltonizeImage applies the current colorblind mode to every pixel of img.
+func daltonizeImage(img *ebiten.Image) {
+	sim, ok := cbSimulation(gs.ColorblindMode)
+	if !ok {
+		return
+	}
+	daltonizeShaderOnce.Do(func() {
+		s, err := ebiten.NewShader([]byte(daltonizeShaderSrc))
+		if err != nil {
+			logError("daltonize shader: %v", err)
+			return
+		}
+		daltonizeShader = s
+	})
+	if daltonizeShader == nil {
+		return
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if daltonizeScratch == nil || daltonizeScratch.Bounds().Dx() != w || daltonizeScratch.Bounds().Dy() != h {
+		daltonizeScratch = ebiten.NewImageWithOptions(image.Rect(0, 0, w, h), &ebiten.NewImageOptions{Unmanaged: true})
+	}
+	cp := &ebiten.DrawImageOptions{Blend: ebiten.BlendCopy}
+	cp.GeoM.Translate(-float64(img.Bounds().Min.X), -float64(img.Bounds().Min.Y))
+	daltonizeScratch.DrawImage(img, cp)
+
+	row := func(r [3]float64) []float32 {
+		return []float32{float32(r[0]), float32(r[1]), float32(r[2])}
+	}
+	op := &ebiten.DrawRectShaderOptions{
+		Uniforms: map[string]any{
+			"SimL": row(sim[0]),
+			"SimM": row(sim[1]),
+			"SimS": row(sim[2]),
+		},
+		Blend: ebiten.BlendCopy,
+	}
+	op.GeoM.Translate(float64(img.Bounds().Min.X), float64(img.Bounds().Min.Y))
+	op.Images[0] = daltonizeScratch
+	img.DrawRectShader(w, h, daltonizeShader, op)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestDaltonizeKeepsGreys(t *testing.T) {
+	for _, m := range colorblindModes {
+		for _, v := range []uint8{0, 0x80, 0xff} {
+			r, g, b := daltonize(m.name, v, v, v)
+			if absDiff8(r, v) > 2 || absDiff8(g, v) > 2 || absDiff8(b, v) > 2 {
+				t.Errorf("%s: grey %d became %d,%d,%d", m.label, v, r, g, b)
+			}
+		}
+	}
+}
+
+func TestDaltonizeSeparatesRedGreen(t *testing.T) {
+	// Pure red and green look alike to protanopes; after correction their
+	// blue channels should differ noticeably.
+	_, _, rb := daltonize(cbProtanopia, 0xff, 0x00, 0x00)
+	_, _, gb := daltonize(cbProtanopia, 0x00, 0xff, 0x00)
+	if absDiff8(rb, gb) < 64 {
+		t.Fatalf("red and green blue channels too close: %d vs %d", rb, gb)
+	}
+}
+
+func TestSceneColorsNotCorrectedTwice(t *testing.T) {
+	saved := gs
+	defer func() { gs = saved }()
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	gs.ColorblindMode = cbProtanopia
+	gs.DaltonizeScene = false
+	if cbSceneRGBA(red) != cbRGBA(red) || cbSceneRGBA(red) == red {
+		t.Error("scene color not remapped without scene daltonization")
+	}
+	gs.DaltonizeScene = true
+	if got := cbSceneRGBA(red); got != red {
+		t.Errorf("scene color remapped before scene daltonization: %v", got)
+	}
+	if _, bg, _ := mobileNameColors(0x10); bg != nameBackColors[1] {
+		t.Errorf("name tag background remapped: %v", bg)
+	}
+	if cbRGBA(red) == red {
+		t.Error("UI color not remapped")
+	}
+}
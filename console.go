@@ -22,6 +22,7 @@ func consoleMessage(msg string) {
 		messages = messages[len(messages)-maxMessages:]
 	}
 	messageMu.Unlock()
+	consoleLog.write(msg)
 
 	updateConsoleWindow()
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"strings"
+
+	"golang.org/x/text/encoding/charmap"
 )
 
 type thinkTarget int
@@ -82,7 +84,19 @@ var languageYellVerb = []string{
 	"yelps",           // Lepori
 }
 
-func decodeMacRoman(b []byte) string { return string(b) }
+// decodeMacRoman converts Mac OS Roman text from the server to UTF-8.
+func decodeMacRoman(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+	for _, c := range b {
+		if c < 0x80 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteRune(charmap.Macintosh.DecodeByte(c))
+	}
+	return sb.String()
+}
 
 func decodeBEPP(data []byte) string {
 	if len(data) < 3 || data[0] != 0xC2 {
@@ -149,7 +163,7 @@ func stripBEPPTags(b []byte) []byte {
 			}
 			break
 		}
-		if c >= 0x80 || c < 0x20 {
+		if c < 0x20 || c == 0x7f {
 			i++
 			continue
 		}
@@ -241,7 +255,7 @@ func decodeBubble(data []byte) (verb, text, name, lang string, code uint8, targe
 		if s == "" {
 			continue
 		}
-		if parseNightCommand(s) {
+		if parseNightCommand(s) || handleMusicCommand(s) {
 			continue
 		}
 		if text == "" {
@@ -345,6 +359,10 @@ func handleInfoText(data []byte) {
 			}
 			continue
 		}
+		if bytes.HasPrefix(line, []byte("/music")) {
+			handleMusicCommand(decodeMacRoman(line))
+			continue
+		}
 		if _, txt, _, _, _, _ := decodeBubble(line); txt != "" {
 			chatMessage(txt)
 			if gs.MessagesToConsole {
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMacRomanRoundTrip(t *testing.T) {
+	for c := 0; c < 256; c++ {
+		b := []byte{byte(c)}
+		if got := encodeMacRoman(decodeMacRoman(b)); !bytes.Equal(got, b) {
+			t.Errorf("byte %#x round trips to %#x", c, got)
+		}
+	}
+	if got := decodeMacRoman([]byte{'C', 'a', 'f', 0x8e, ' ', 0xd2, 'h', 'i', 0xd3}); got != "Café “hi”" {
+		t.Errorf("decode = %q", got)
+	}
+	if got := encodeMacRoman("naïve ©"); !bytes.Equal(got, []byte{'n', 'a', 0x95, 'v', 'e', ' ', 0xa9}) {
+		t.Errorf("encode = %#v", got)
+	}
+	if got := encodeMacRoman("snow ☃"); string(got) != "snow ?" {
+		t.Errorf("unsupported rune encoded as %q", got)
+	}
+}
+
+func TestDecodeBubbleMacRoman(t *testing.T) {
+	data := append([]byte{0, kBubbleNormal}, "\xc2pnJos\x8e\xc2pn likes cr\x8fme br\x9el\x8ee"...)
+	verb, text, _, _, _, _ := decodeBubble(data)
+	if verb != "says" || text != "José likes crème brûlée" {
+		t.Errorf("decodeBubble = %q, %q", verb, text)
+	}
+}
@@ -56,6 +56,7 @@ type nameTagKey struct {
 	Colors  uint8
 	Opacity uint8
 	FontGen uint32
+	CBMode  string
 }
 
 const poseDead = 32
@@ -489,9 +490,11 @@ func handleDrawState(m []byte) {
 	if drawStateEncrypted {
 		simpleEncrypt(data)
 	}
+	t := profStart()
 	if err := parseDrawState(data); err != nil {
 		logDebugPacket(fmt.Sprintf("parseDrawState error: %v", err), data)
 	}
+	profParseDone(t)
 }
 
 // handleInvCmdFull resets and rebuilds the inventory from a full list command.
@@ -699,7 +702,7 @@ func parseDrawState(data []byte) error {
 		d.PictID = binary.BigEndian.Uint16(data[p+2:])
 		p += 4
 		if idx := bytes.IndexByte(data[p:], 0); idx >= 0 {
-			d.Name = string(data[p : p+idx])
+			d.Name = decodeMacRoman(data[p : p+idx])
 			p += idx + 1
 			if d.Name == playerName {
 				playerIndex = d.Index
@@ -1049,6 +1052,7 @@ func parseDrawState(data []byte) error {
 				Colors:  m.Colors,
 				Opacity: uint8(gs.NameBgOpacity*255 + 0.5),
 				FontGen: fontGen,
+				CBMode:  sceneCBMode(),
 			}
 			if prev, ok := state.mobiles[m.Index]; ok && prev.nameTag != nil && prev.nameTagKey == key {
 				m.nameTag = prev.nameTag
@@ -1067,6 +1071,7 @@ func parseDrawState(data []byte) error {
 	}
 	// Prepare render caches now that state has been updated.
 	prepareRenderCacheLocked()
+	updateAutoMap(dx, dy, ok, state.picsNeg, state.picsZero)
 	ack := state.ackCmd
 	light := state.lightingFlags
 	stateMu.Unlock()
@@ -1168,7 +1173,7 @@ func parseDrawState(data []byte) error {
 				stateMu.Unlock()
 			}
 			if gs.SpeechBubbles && txt != "" && !blockBubbles {
-				b := bubble{Index: idx, Text: txt, Type: typ, CreatedFrame: frameCounter}
+				b := bubble{Index: idx, Text: txt, Type: typ, Created: bubbleClock(), Life: bubbleLife(txt)}
 				switch typ & kBubbleTypeMask {
 				case kBubbleRealAction, kBubblePlayerAction, kBubbleNarrate:
 					b.NoArrow = true
@@ -1252,6 +1257,10 @@ func parseDrawState(data []byte) error {
 			if gs.MessagesToConsole {
 				consoleMessage(msg)
 			}
+			speakBubble(typ, verb, target, name, txt, msg)
+			if verb == "thinks" && target != thinkNone && name != playerName {
+				playCategorySound(soundAlert, thinkToSound)
+			}
 		}
 		stateData = stateData[p+end+1:]
 	}
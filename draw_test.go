@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPictureShift(t *testing.T) {
+	saved := gs
+	gs.NoCaching = false
+	pixelCountMu.Lock()
+	pixelCountCache[goldenPictGround] = 48 * 32
+	pixelCountCache[goldenPictAnim] = 64
+	pixelCountMu.Unlock()
+	t.Cleanup(func() {
+		gs = saved
+		pixelCountMu.Lock()
+		delete(pixelCountCache, goldenPictGround)
+		delete(pixelCountCache, goldenPictAnim)
+		pixelCountMu.Unlock()
+	})
+
+	prev := []framePicture{
+		{PictID: goldenPictGround, H: -40, V: -20},
+		{PictID: goldenPictGround, H: 8, V: -20},
+		{PictID: goldenPictAnim, H: 30, V: 40},
+	}
+	cur := []framePicture{
+		{PictID: goldenPictAnim, H: 30, V: 40},
+		{PictID: goldenPictGround, H: -34, V: -24},
+		{PictID: goldenPictGround, H: 14, V: -24},
+	}
+	dx, dy, idxs, ok := pictureShift(prev, cur)
+	slices.Sort(idxs)
+	if !ok || dx != 6 || dy != -4 || !slices.Equal(idxs, []int{1, 2}) {
+		t.Errorf("pictureShift = %d, %d, %v, %v; want 6, -4, [1 2], true", dx, dy, idxs, ok)
+	}
+
+	// The small picture staying put cannot outvote the background.
+	if dx, dy, _, ok := pictureShift(prev[2:], cur[:1]); !ok || dx != 0 || dy != 0 {
+		t.Errorf("still picture: %d, %d, %v", dx, dy, ok)
+	}
+
+	// Two equal backgrounds moving apart leave no majority.
+	split := []framePicture{
+		{PictID: goldenPictGround, H: -40, V: -10},
+		{PictID: goldenPictGround, H: 30, V: -20},
+	}
+	if _, _, _, ok := pictureShift(prev[:2], split); ok {
+		t.Error("no majority accepted")
+	}
+
+	// Jumps larger than maxInterpPixels are scene changes, not pans.
+	far := []framePicture{
+		{PictID: goldenPictGround, H: -40, V: -20 + maxInterpPixels + 1},
+		{PictID: goldenPictGround, H: 8, V: -20 + maxInterpPixels + 1},
+	}
+	if _, _, _, ok := pictureShift(prev[:2], far); ok {
+		t.Error("large jump accepted as a shift")
+	}
+
+	if _, _, _, ok := pictureShift(nil, cur); ok {
+		t.Error("shift found without a previous frame")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gothoom/climg"
+	"gothoom/clsnd"
+)
+
+// runExtract implements "gothoom extract", which dumps CL_Images and
+// CL_Sounds to PNG, WAV and JSON without opening a window. It returns the
+// process exit code.
+func runExtract(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	dataDir := fs.String("data", dataDirPath, "directory holding CL_Images and CL_Sounds")
+	outDir := fs.String("out", "extracted", "output directory")
+	frames := fs.Bool("frames", true, "also write each animation frame as its own PNG")
+	force := fs.Bool("force-transparent", false, "treat color 0 as transparent in every image, as mobiles are drawn")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gothoom extract [flags] images|sounds|items|all ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	what := fs.Args()
+	if len(what) == 0 {
+		fs.Usage()
+		return 2
+	}
+	want := map[string]bool{}
+	for _, w := range what {
+		switch w {
+		case "all":
+			want["images"], want["sounds"], want["items"] = true, true, true
+		case "images", "sounds", "items":
+			want[w] = true
+		default:
+			fmt.Fprintf(os.Stderr, "extract: unknown target %q\n", w)
+			fs.Usage()
+			return 2
+		}
+	}
+
+	var imgs *climg.CLImages
+	if want["images"] || want["items"] {
+		var err error
+		imgs, err = climg.Load(filepath.Join(*dataDir, CL_ImagesFile))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "extract: %v\n", err)
+			return 1
+		}
+	}
+	status := 0
+	if want["images"] {
+		n, err := extractImages(imgs, filepath.Join(*outDir, "images"), *frames, *force)
+		fmt.Printf("images: wrote %d pictures\n", n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "extract images: %v\n", err)
+			status = 1
+		}
+	}
+	if want["items"] {
+		n, err := extractItems(imgs, filepath.Join(*outDir, "items.json"))
+		fmt.Printf("items: wrote %d records\n", n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "extract items: %v\n", err)
+			status = 1
+		}
+	}
+	if want["sounds"] {
+		snds, err := clsnd.Load(filepath.Join(*dataDir, CL_SoundsFile))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "extract: %v\n", err)
+			return 1
+		}
+		n, err := extractSounds(snds, filepath.Join(*outDir, "sounds"))
+		fmt.Printf("sounds: wrote %d sounds\n", n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "extract sounds: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// extractedImage is one entry of images/index.json.
+type extractedImage struct {
+	ID     uint32 `json:"id"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Plane  int    `json:"plane"`
+	Frames int    `json:"frames"`
+}
+
+// extractImages writes every picture to dir. Sheets go to sheets/ with the
+// game's transparency and to sheets-opaque/ without it; animated pictures
+// are also split into frames/ and frames-opaque/. Errors on individual
+// pictures are reported and skipped.
+func extractImages(c *climg.CLImages, dir string, frames, force bool) (int, error) {
+	sub := []string{"sheets", "sheets-opaque"}
+	if frames {
+		sub = append(sub, "frames", "frames-opaque")
+	}
+	for _, s := range sub {
+		if err := os.MkdirAll(filepath.Join(dir, s), 0755); err != nil {
+			return 0, err
+		}
+	}
+	ids := c.IDs()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var index []extractedImage
+	var firstErr error
+	for _, id := range ids {
+		ix := c.GetIndexed(id)
+		if ix == nil {
+			continue
+		}
+		pal := c.Palette(ix, nil, force)
+		opaque, _ := c.OpaquePalette(ix, nil)
+		n := c.NumFrames(id)
+		sheets := []struct {
+			sub string
+			img *image.RGBA
+		}{
+			{"sheets", paletteImage(ix, &pal)},
+			{"sheets-opaque", paletteImage(ix, &opaque)},
+		}
+		for i, s := range sheets {
+			name := fmt.Sprintf("%d.png", id)
+			if err := writePNG(filepath.Join(dir, s.sub, name), s.img); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if !frames || n <= 1 {
+				continue
+			}
+			fsub := sub[2+i]
+			h := ix.Height / n
+			for f := 0; f < n && h > 0; f++ {
+				r := image.Rect(0, f*h, ix.Width, (f+1)*h)
+				name := fmt.Sprintf("%d-%d.png", id, f)
+				if err := writePNG(filepath.Join(dir, fsub, name), s.img.SubImage(r)); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		index = append(index, extractedImage{ID: id, Width: ix.Width, Height: ix.Height, Plane: c.Plane(id), Frames: n})
+	}
+	if err := writeJSON(filepath.Join(dir, "index.json"), index); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return len(index), firstErr
+}
+
+// paletteImage maps the indexes of ix through pal. It has no border, unlike
+// GetRGBA.
+func paletteImage(ix *climg.Indexed, pal *[256]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ix.Width, ix.Height))
+	for i, v := range ix.Pix {
+		p := pal[v]
+		img.Pix[i*4+0] = p.R
+		img.Pix[i*4+1] = p.G
+		img.Pix[i*4+2] = p.B
+		img.Pix[i*4+3] = p.A
+	}
+	return img
+}
+
+// extractedItem is one record of items.json.
+type extractedItem struct {
+	ID              uint32 `json:"id"`
+	Name            string `json:"name"`
+	Flags           uint32 `json:"flags"`
+	Slot            int    `json:"slot"`
+	WornPictID      uint32 `json:"wornPict,omitempty"`
+	RightHandPictID uint32 `json:"rightHandPict,omitempty"`
+	LeftHandPictID  uint32 `json:"leftHandPict,omitempty"`
+}
+
+func extractItems(c *climg.CLImages, path string) (int, error) {
+	ids := c.ItemIDs()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	items := make([]extractedItem, 0, len(ids))
+	for _, id := range ids {
+		it, ok := c.Item(id)
+		if !ok {
+			continue
+		}
+		items = append(items, extractedItem{
+			ID:              id,
+			Name:            it.Name,
+			Flags:           it.Flags,
+			Slot:            it.Slot,
+			WornPictID:      it.WornPictID,
+			RightHandPictID: it.RightHandPictID,
+			LeftHandPictID:  it.LeftHandPictID,
+		})
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	return len(items), writeJSON(path, items)
+}
+
+func extractSounds(c *clsnd.CLSounds, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	ids := c.IDs()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	count := 0
+	var firstErr error
+	for _, id := range ids {
+		s, err := c.Get(id)
+		if s == nil {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "sound %d: %v\n", id, err)
+			}
+			continue
+		}
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d.wav", id)))
+		if err == nil {
+			err = writeWAV(f, s)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		count++
+		// Decoded PCM is cached by CLSounds; drop it as we go.
+		c.ClearCache()
+	}
+	return count, firstErr
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+
+	"gothoom/climg"
+)
+
+func TestPaletteImage(t *testing.T) {
+	ix := &climg.Indexed{Width: 2, Height: 1, Pix: []byte{0, 3}}
+	var pal [256]color.RGBA
+	pal[3] = color.RGBA{10, 20, 30, 255}
+	img := paletteImage(ix, &pal)
+	if img.Bounds().Dx() != 2 || img.Bounds().Dy() != 1 {
+		t.Fatalf("bounds = %v, want 2x1 without border", img.Bounds())
+	}
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("(0,0) = %v, want transparent", got)
+	}
+	if got := img.RGBAAt(1, 0); got != pal[3] {
+		t.Errorf("(1,0) = %v, want %v", got, pal[3])
+	}
+}
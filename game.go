@@ -45,6 +45,10 @@ var gameImageItem *eui.ItemData
 var gameImage *ebiten.Image
 var inAspectResize bool
 
+// gameImageInset is the margin between the game window's content area and
+// gameImageItem on every side.
+const gameImageInset = 2
+
 // gameWindowBG picks a background color for the game window content area.
 // Prefers the game window's theme BGColor when opaque, otherwise falls
 // back to any other window's BGColor, and finally to black.
@@ -73,9 +77,9 @@ func updateGameImageSize() {
 	// Inner content size (exclude titlebar and inside padding)
 	cw := int(float64(int(size.X)&^1) - pad)
 	ch := int(float64(int(size.Y)&^1) - pad - title)
-	// Leave a 2px margin on all sides for window edges
-	w := cw - 4
-	h := ch - 4
+	// Leave a margin on all sides for window edges
+	w := cw - 2*gameImageInset
+	h := ch - 2*gameImageInset
 	if w <= 0 || h <= 0 {
 		return
 	}
@@ -83,7 +87,7 @@ func updateGameImageSize() {
 		it, img := eui.NewImageItem(w, h)
 		gameImageItem = it
 		gameImage = img
-		gameImageItem.Position = eui.Point{X: 2, Y: 2}
+		gameImageItem.Position = eui.Point{X: gameImageInset, Y: gameImageInset}
 		gameWin.AddItem(gameImageItem)
 		return
 	}
@@ -97,7 +101,7 @@ func updateGameImageSize() {
 		gameImage = ebiten.NewImage(w, h)
 		gameImageItem.Image = gameImage
 		gameImageItem.Size = eui.Point{X: float32(w), Y: float32(h)}
-		gameImageItem.Position = eui.Point{X: 2, Y: 2}
+		gameImageItem.Position = eui.Point{X: gameImageInset, Y: gameImageInset}
 		if gameWin != nil {
 			gameWin.Dirty = true
 		}
@@ -280,19 +284,96 @@ func prepareRenderCacheLocked() {
 	}
 }
 
-// bubble stores temporary chat bubble information. Bubbles expire after a
-// fixed number of game update frames from when they were created — no FPS
-// correction or wall-clock timing is applied to keep playback simple.
-const bubbleLifeFrames = (1000 / framems) * 4 // ~4s
-
+// bubble stores temporary chat bubble information. Lifetimes depend on the
+// length of the text and the reading speed setting, and are measured with
+// bubbleClock so they follow wall time live and movie time during playback.
 type bubble struct {
-	Index        uint8
-	H, V         int16
-	Far          bool
-	NoArrow      bool
-	Text         string
-	Type         int
-	CreatedFrame int
+	Index   uint8
+	H, V    int16
+	Far     bool
+	NoArrow bool
+	Text    string
+	Type    int
+	Created time.Duration // bubbleClock when the bubble appeared
+	Life    time.Duration // how long the bubble stays, from bubbleLife
+}
+
+const (
+	bubbleBaseLife = 2 * time.Second
+	bubbleMinLife  = 4 * time.Second
+	bubbleMaxLife  = 30 * time.Second
+	bubbleFadeTime = 500 * time.Millisecond
+)
+
+var bubbleEpoch = time.Now()
+
+// bubbleClock returns the time used for bubble lifetimes. Movies use the
+// playback position, so pausing freezes bubbles and fast-forward shortens
+// them along with everything else.
+func bubbleClock() time.Duration {
+	if clmov != "" {
+		return time.Duration(frameCounter) * framems * time.Millisecond
+	}
+	return time.Since(bubbleEpoch)
+}
+
+// bubbleLife returns how long txt stays on screen at the user's reading speed.
+func bubbleLife(txt string) time.Duration {
+	wpm := gs.BubbleReadingSpeed
+	if wpm <= 0 {
+		wpm = gsdef.BubbleReadingSpeed
+	}
+	words := len(strings.Fields(txt))
+	life := bubbleBaseLife + time.Duration(words)*time.Minute/time.Duration(wpm)
+	if life < bubbleMinLife {
+		life = bubbleMinLife
+	}
+	if life > bubbleMaxLife {
+		life = bubbleMaxLife
+	}
+	return life
+}
+
+// bubbleAlpha returns the opacity of b at time now, fading out over the last
+// bubbleFadeTime of its life.
+func bubbleAlpha(b bubble, now time.Duration) float32 {
+	left := b.Created + b.Life - now
+	if left >= bubbleFadeTime {
+		return 1
+	}
+	if left <= 0 {
+		return 0
+	}
+	return float32(left) / float32(bubbleFadeTime)
+}
+
+// bubbleExpired reports whether b has outlived its life at time now.
+func bubbleExpired(b bubble, now time.Duration) bool {
+	return now-b.Created >= b.Life
+}
+
+// limitBubblesPerSpeaker keeps only the newest max bubbles of each speaker,
+// preserving order.
+func limitBubblesPerSpeaker(bubbles []bubble, max int) []bubble {
+	if max < 1 {
+		max = 1
+	}
+	keep := make([]bool, len(bubbles))
+	count := make(map[uint8]int)
+	for i := len(bubbles) - 1; i >= 0; i-- {
+		idx := bubbles[i].Index
+		if count[idx] < max {
+			count[idx]++
+			keep[i] = true
+		}
+	}
+	out := bubbles[:0]
+	for i, b := range bubbles {
+		if keep[i] {
+			out = append(out, b)
+		}
+	}
+	return out
 }
 
 // drawSnapshot is a read-only copy of the current draw state.
@@ -366,10 +447,10 @@ func captureDrawSnapshot() drawSnapshot {
 		snap.mobiles = append(snap.mobiles, m)
 	}
 	if len(state.bubbles) > 0 {
-		curFrame := frameCounter
+		now := bubbleClock()
 		kept := state.bubbles[:0]
 		for _, b := range state.bubbles {
-			if (curFrame - b.CreatedFrame) < bubbleLifeFrames {
+			if !bubbleExpired(b, now) {
 				if !b.Far {
 					if m, ok := state.mobiles[b.Index]; ok {
 						b.H, b.V = m.H, m.V
@@ -378,17 +459,7 @@ func captureDrawSnapshot() drawSnapshot {
 				kept = append(kept, b)
 			}
 		}
-		last := make(map[uint8]int)
-		for i, b := range kept {
-			last[b.Index] = i
-		}
-		dedup := kept[:0]
-		for i, b := range kept {
-			if last[b.Index] == i {
-				dedup = append(dedup, b)
-			}
-		}
-		state.bubbles = dedup
+		state.bubbles = limitBubblesPerSpeaker(kept, gs.BubblesPerSpeaker)
 		snap.bubbles = append([]bubble(nil), state.bubbles...)
 	}
 	if gs.MotionSmoothing || gs.BlendMobiles {
@@ -511,6 +582,7 @@ func (g *Game) Update() error {
 		initGame()
 		runBackgroundTasks()
 	})
+	checkSpriteOverrides()
 
 	/* Console input */
 	changedInput := false
@@ -558,7 +630,9 @@ func (g *Game) Update() error {
 			txt := strings.TrimSpace(string(inputText))
 			if txt != "" {
 				if strings.HasPrefix(txt, "/play ") {
-					playTuneSimple(strings.TrimSpace(txt[len("/play "):]))
+					playLocalTune(strings.TrimSpace(txt[len("/play "):]))
+				} else if txt == "/screenshot" {
+					requestScreenshot()
 				} else {
 					pendingCommand = txt
 					//consoleMessage("> " + txt)
@@ -592,6 +666,10 @@ func (g *Game) Update() error {
 		}
 	}
 
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		requestScreenshot()
+	}
+
 	/* WASD / ARROWS */
 
 	var keyWalk bool
@@ -748,9 +826,10 @@ func worldDrawInfo() (int, int, float64) {
 	pad := float64(2 * gameWin.Padding)
 	cw := int(float64(int(size.X)&^1) - pad) // content width
 	ch := int(float64(int(size.Y)&^1) - pad) // content height
-	// Leave a 2px margin on all sides (matches gameImageItem.Position and sizing).
-	bufW := cw - 4
-	bufH := ch - 4
+	// Leave the gameImageInset margin on all sides (matches
+	// gameImageItem.Position and sizing).
+	bufW := cw - 2*gameImageInset
+	bufH := ch - 2*gameImageInset
 	if bufW <= 0 || bufH <= 0 {
 		if gs.GameScale <= 0 {
 			return gx, gy, 1.0
@@ -834,6 +913,9 @@ func worldDrawInfo() (int, int, float64) {
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
+	profBeginFrame()
+	defer profEndFrame()
+
 	// Ensure the game image item/buffer exists and matches window content.
 	updateGameImageSize()
 	if gameImage == nil {
@@ -902,6 +984,9 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		finalFilter = ebiten.FilterNearest
 	}
 
+	// Consume any pending screenshot request for this frame.
+	shot := screenshotRequested.Swap(false)
+
 	// Prepare variable-sized offscreen target (supersampled in any-size)
 	offW := worldW * offIntScale
 	offH := worldH * offIntScale
@@ -909,22 +994,35 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	worldRT.Clear()
 
 	// Render splash or live frame into worldRT using offscreen integer scale
+	var hover []string
 	if clmov == "" && tcpConn == nil && pcapPath == "" {
 		prev := gs.GameScale
 		gs.GameScale = float64(offIntScale)
 		drawSplash(worldRT, 0, 0)
 		gs.GameScale = prev
+		if shot && gs.ScreenshotHideUI {
+			captureScreenshot(worldRT, worldRT.Bounds())
+			shot = false
+		}
 	} else {
+		t := profStart()
 		snap := captureDrawSnapshot()
+		profEnd(profSnapshot, t)
 		alpha, mobileFade, pictFade := computeInterpolation(snap.prevTime, snap.curTime, gs.MobileBlendAmount, gs.BlendAmount)
-		prev := gs.GameScale
-		gs.GameScale = float64(offIntScale)
-		drawScene(worldRT, 0, 0, snap, alpha, mobileFade, pictFade)
-		if gs.nightEffect {
-			drawNightOverlay(worldRT, 0, 0)
-		}
-		drawStatusBars(worldRT, 0, 0, snap, alpha)
-		gs.GameScale = prev
+		renderWorld(worldRT, snap, offIntScale, alpha, mobileFade, pictFade)
+		withGameScale(offIntScale, func() {
+			if gs.DaltonizeScene {
+				daltonizeImage(worldRT)
+			}
+			if shot && gs.ScreenshotHideUI {
+				// Scene-only capture: skip status bars and all eui windows.
+				captureScreenshot(worldRT, worldRT.Bounds())
+				shot = false
+			}
+			drawStatusBars(worldRT, 0, 0, snap, alpha)
+		})
+		updateStatusBarsWindow(snap, alpha)
+		hover = hoverInfo(snap)
 	}
 
 	// Composite worldRT into the gameImage buffer: scale/center
@@ -948,11 +1046,25 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	op.GeoM.Translate(tx, ty)
 	gameImage.DrawImage(worldRT, op)
 
+	updateMapWindow()
+	updateAssetBrowser()
+	updateSoundBrowser()
+
 	// Finally, draw UI (which includes the game window image)
+	t := profStart()
 	eui.Draw(screen)
+	profEnd(profUI, t)
+	drawHoverTooltip(screen, hover)
+	drawProfilerOverlay(screen)
 	if gs.ShowFPS {
 		drawServerFPS(screen, screen.Bounds().Dx()-40, 4, serverFPS)
 	}
+	if shot {
+		// Capture the game window area as shown, including any overlapping windows.
+		gx, gy := gameWindowOrigin()
+		x0, y0 := gx+gameImageInset, gy+gameImageInset
+		captureScreenshot(screen, image.Rect(x0, y0, x0+bufW, y0+bufH))
+	}
 }
 
 // drawScene renders all world objects for the current frame.
@@ -967,9 +1079,13 @@ func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float6
 	live := snap.liveMobs
 	dead := snap.deadMobs
 
+	t := profStart()
 	for _, p := range negPics {
 		drawPicture(screen, ox, oy, p, alpha, pictFade, snap.mobiles, snap.prevMobiles, snap.picShiftX, snap.picShiftY)
 	}
+	profEnd(profPicsNeg, t)
+
+	t = profStart()
 
 	if gs.hideMobiles {
 		for _, p := range zeroPics {
@@ -1004,11 +1120,18 @@ func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float6
 		}
 	}
 
+	profEnd(profPlaneZero, t)
+
+	t = profStart()
 	for _, p := range posPics {
 		drawPicture(screen, ox, oy, p, alpha, pictFade, snap.mobiles, snap.prevMobiles, snap.picShiftX, snap.picShiftY)
 	}
+	profEnd(profPicsPos, t)
 
-	if gs.SpeechBubbles {
+	if gs.SpeechBubbles && drawLayers&layerLabels != 0 {
+		t = profStart()
+		now := bubbleClock()
+		boxes := make([]bubbleBox, 0, len(snap.bubbles))
 		for _, b := range snap.bubbles {
 			hpos := float64(b.H)
 			vpos := float64(b.V)
@@ -1049,9 +1172,21 @@ func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float6
 			}
 			x += ox
 			y += oy
-			borderCol, bgCol, textCol := bubbleColors(b.Type)
-			drawBubble(screen, b.Text, x, y, b.Type, b.Far, b.NoArrow, borderCol, bgCol, textCol)
+			if b.Text == "" {
+				continue
+			}
+			box := measureBubble(b.Text, x, y, b.Type, b.Far, b.NoArrow)
+			box.alpha = bubbleAlpha(b, now)
+			boxes = append(boxes, box)
+		}
+		sw := int(float64(gameAreaSizeX) * gs.GameScale)
+		sh := int(float64(gameAreaSizeY) * gs.GameScale)
+		layoutBubbles(boxes, sw, sh, int(2*gs.GameScale))
+		for i := range boxes {
+			borderCol, bgCol, textCol := bubbleColors(boxes[i].typ)
+			drawBubbleBox(screen, &boxes[i], borderCol, bgCol, textCol)
 		}
+		profEnd(profBubbles, t)
 	}
 }
 
@@ -1078,6 +1213,10 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 	plane := 0
 	var d frameDescriptor
 	var colors []byte
+	// With paletted set, img and prevImg are the frames of pf and prevPF,
+	// drawn through the palette shader.
+	var pf, prevPF paletteFrame
+	paletted := false
 	var state uint8
 	if desc, ok := descMap[m.Index]; ok {
 		d = desc
@@ -1088,7 +1227,14 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 		}
 		playersMu.RUnlock()
 		state = m.State
-		img = loadMobileFrame(d.PictID, state, colors)
+		if usePaletteShader(colors) {
+			pf, paletted = loadMobilePaletteFrame(d.PictID, state, colors)
+		}
+		if paletted {
+			img = pf.img
+		} else {
+			img = loadMobileFrame(d.PictID, state, colors)
+		}
 		plane = d.Plane
 	}
 	var prevImg *ebiten.Image
@@ -1107,25 +1253,41 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 				prevColors = append([]byte(nil), p.Colors...)
 			}
 			playersMu.RUnlock()
-			prevImg = loadMobileFrame(pd.PictID, pm.State, prevColors)
 			prevPict = pd.PictID
 			prevState = pm.State
+			if paletted {
+				// The shader blends frames of the same size only; others
+				// go through recolored frames.
+				var ok bool
+				prevPF, ok = loadMobilePaletteFrame(prevPict, prevState, prevColors)
+				if ok && prevPF.img.Bounds().Dx() == pf.img.Bounds().Dx() {
+					prevImg = prevPF.img
+				} else {
+					paletted = false
+					img = loadMobileFrame(d.PictID, state, colors)
+				}
+			}
+			if !paletted {
+				prevImg = loadMobileFrame(prevPict, prevState, prevColors)
+			}
 		}
 	}
 	if img != nil {
 		size := img.Bounds().Dx()
 		blend := gs.BlendMobiles && prevImg != nil && fade > 0 && fade < 1
 		var src *ebiten.Image
+		var palPrev *paletteFrame
+		mix := float32(1)
+		if gs.BlendMobiles {
+			steps := gs.MobileBlendFrames
+			mix = float32(mobileBlendStep(fade, steps)) / float32(steps)
+		}
 		drawSize := size
-		if blend {
+		if blend && paletted {
+			src, palPrev = img, &prevPF
+		} else if blend {
 			steps := gs.MobileBlendFrames
-			idx := int(fade * float32(steps))
-			if idx <= 0 {
-				idx = 1
-			}
-			if idx >= steps {
-				idx = steps - 1
-			}
+			idx := mobileBlendStep(fade, steps)
 			prevKey := makeMobileKey(prevPict, prevState, prevColors)
 			curKey := makeMobileKey(d.PictID, state, colors)
 			if b := mobileBlendFrame(prevKey, curKey, prevImg, img, idx, steps); b != nil {
@@ -1144,7 +1306,11 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 		} else {
 			src = img
 		}
-		scale := gs.GameScale
+		ss := spriteScale(d.PictID)
+		if src == prevImg {
+			ss = spriteScale(prevPict)
+		}
+		scale := gs.GameScale / ss
 		scaled := float64(roundToInt(float64(drawSize) * scale))
 		scale = scaled / float64(drawSize)
 		// No per-frame bounds check (culled earlier).
@@ -1153,12 +1319,24 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 		tx := float64(x) - scaled/2
 		ty := float64(y) - scaled/2
 		op.GeoM.Translate(tx, ty)
-		screen.DrawImage(src, op)
+		if drawLayers&layerSprites != 0 {
+			switch {
+			case paletted && src == img:
+				drawPaletted(screen, pf, palPrev, mix, op.GeoM)
+			case paletted && src == prevImg:
+				drawPaletted(screen, prevPF, nil, mix, op.GeoM)
+			default:
+				screen.DrawImage(src, op)
+			}
+		}
+		if drawLayers&layerLabels == 0 {
+			return
+		}
 		if d, ok := descMap[m.Index]; ok {
 			alpha := uint8(gs.NameBgOpacity * 255)
 			if d.Name != "" {
 				// Prefer cached name tag if parameters match current settings.
-				if m.nameTag != nil && m.nameTagKey.FontGen == fontGen && m.nameTagKey.Opacity == alpha && m.nameTagKey.Text == d.Name && m.nameTagKey.Colors == m.Colors {
+				if m.nameTag != nil && m.nameTagKey.FontGen == fontGen && m.nameTagKey.Opacity == alpha && m.nameTagKey.Text == d.Name && m.nameTagKey.Colors == m.Colors && m.nameTagKey.CBMode == sceneCBMode() {
 					top := y + int(20*gs.GameScale)
 					left := x - m.nameTagW/2
 					op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
@@ -1190,7 +1368,7 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 					if back >= len(nameBackColors) {
 						back = 0
 					}
-					barClr := nameBackColors[back]
+					barClr := cbSceneRGBA(nameBackColors[back])
 					barClr.A = alpha
 					top := y + int(float64(size)*gs.GameScale/2+2*gs.GameScale)
 					left := x - int(6*gs.GameScale)
@@ -1213,8 +1391,10 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 		}
 	} else {
 		// Fallback marker when image missing; no per-frame bounds check.
-		vector.DrawFilledRect(screen, float32(float64(x)-3*gs.GameScale), float32(float64(y)-3*gs.GameScale), float32(6*gs.GameScale), float32(6*gs.GameScale), color.RGBA{0xff, 0, 0, 0xff}, false)
-		if gs.imgPlanesDebug {
+		if drawLayers&layerSprites != 0 {
+			vector.DrawFilledRect(screen, float32(float64(x)-3*gs.GameScale), float32(float64(y)-3*gs.GameScale), float32(6*gs.GameScale), float32(6*gs.GameScale), color.RGBA{0xff, 0, 0, 0xff}, false)
+		}
+		if gs.imgPlanesDebug && drawLayers&layerLabels != 0 {
 			metrics := mainFont.Metrics()
 			lbl := fmt.Sprintf("%dm", plane)
 			xPos := x - int(3*gs.GameScale)
@@ -1231,6 +1411,9 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 	if gs.hideMoving && p.Moving {
 		return
 	}
+	if drawLayers&layerSprites == 0 && !gs.pictIDDebug && !gs.imgPlanesDebug {
+		return
+	}
 	offX := float64(int(p.PrevH)-int(p.H)) * (1 - alpha)
 	offY := float64(int(p.PrevV)-int(p.V)) * (1 - alpha)
 	if p.Moving && !gs.smoothMoving {
@@ -1313,7 +1496,7 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 		if src != nil {
 			drawW, drawH = src.Bounds().Dx(), src.Bounds().Dy()
 		}
-		sx, sy := scaleForFiltering(gs.GameScale, drawW, drawH)
+		sx, sy := scaleForFiltering(gs.GameScale/spriteScale(p.PictID), drawW, drawH)
 		scaledW := float64(roundToInt(float64(drawW) * sx))
 		scaledH := float64(roundToInt(float64(drawH) * sy))
 		sx = scaledW / float64(drawW)
@@ -1329,7 +1512,12 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 		} else if src == img && gs.smoothingDebug && p.Moving {
 			op.ColorScale.Scale(1, 0, 0, 1)
 		}
-		screen.DrawImage(src, op)
+		if drawLayers&layerSprites != 0 {
+			screen.DrawImage(src, op)
+		}
+		if drawLayers&layerLabels == 0 {
+			return
+		}
 
 		if gs.pictIDDebug {
 			metrics := mainFont.Metrics()
@@ -1360,7 +1548,12 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 		if gs.pictAgainDebug && p.Again {
 			clr = color.RGBA{0, 0, 0xff, 0xff}
 		}
-		vector.DrawFilledRect(screen, float32(float64(x)-2*gs.GameScale), float32(float64(y)-2*gs.GameScale), float32(4*gs.GameScale), float32(4*gs.GameScale), clr, false)
+		if drawLayers&layerSprites != 0 {
+			vector.DrawFilledRect(screen, float32(float64(x)-2*gs.GameScale), float32(float64(y)-2*gs.GameScale), float32(4*gs.GameScale), float32(4*gs.GameScale), clr, false)
+		}
+		if drawLayers&layerLabels == 0 {
+			return
+		}
 		if gs.pictIDDebug {
 			metrics := mainFont.Metrics()
 			lbl := fmt.Sprintf("%d", p.PictID)
@@ -1452,52 +1645,6 @@ func drawGameCurtain(screen *ebiten.Image, ox, oy int) {
 	}
 }
 
-// drawStatusBars renders health, balance and spirit bars.
-func drawStatusBars(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float64) {
-	drawRect := func(x, y, w, h int, clr color.RGBA) {
-		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
-		op.GeoM.Scale(float64(w), float64(h))
-		op.GeoM.Translate(float64(ox+x), float64(oy+y))
-		op.ColorScale.ScaleWithColor(clr)
-		screen.DrawImage(whiteImage, op)
-	}
-	barWidth := int(110 * gs.GameScale)
-	barHeight := int(8 * gs.GameScale)
-	fieldWidth := int(float64(gameAreaSizeX) * gs.GameScale)
-	slot := (fieldWidth - 3*barWidth) / 6
-	barY := int(float64(gameAreaSizeY)*gs.GameScale-20*gs.GameScale) - barHeight
-	screenH := screen.Bounds().Dy()
-	minY := -oy
-	maxY := screenH - oy - barHeight
-	if barY < minY {
-		barY = minY
-	} else if barY > maxY {
-		barY = maxY
-	}
-	x := slot
-	step := barWidth + 2*slot
-	drawBar := func(x int, cur, max int, clr color.RGBA) {
-		frameClr := color.RGBA{0xff, 0xff, 0xff, 0xff}
-		vector.StrokeRect(screen, float32(float64(ox+x)-gs.GameScale), float32(float64(oy+barY)-gs.GameScale), float32(barWidth)+float32(2*gs.GameScale), float32(barHeight)+float32(2*gs.GameScale), 1, frameClr, false)
-		if max > 0 && cur > 0 {
-			w := barWidth * cur / max
-			fillClr := color.RGBA{clr.R, clr.G, clr.B, 128}
-			drawRect(x, barY, w, barHeight, fillClr)
-		}
-	}
-	hp := lerpBar(snap.prevHP, snap.hp, alpha)
-	hpMax := lerpBar(snap.prevHPMax, snap.hpMax, alpha)
-	drawBar(x, hp, hpMax, color.RGBA{0x00, 0xff, 0, 0xff})
-	x += step
-	bal := lerpBar(snap.prevBalance, snap.balance, alpha)
-	balMax := lerpBar(snap.prevBalanceMax, snap.balanceMax, alpha)
-	drawBar(x, bal, balMax, color.RGBA{0x00, 0x00, 0xff, 0xff})
-	x += step
-	sp := lerpBar(snap.prevSP, snap.sp, alpha)
-	spMax := lerpBar(snap.prevSPMax, snap.spMax, alpha)
-	drawBar(x, sp, spMax, color.RGBA{0xff, 0x00, 0x00, 0xff})
-}
-
 func drawServerFPS(screen *ebiten.Image, ox, oy int, fps float64) {
 	if fps <= 0 {
 		return
@@ -1640,6 +1787,8 @@ func runGame(ctx context.Context) {
 	}
 	syncWindowSettings()
 	saveSettings()
+	saveAutoMap()
+	saveHUD()
 }
 
 func initGame() {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Hovering over the game view shows a tooltip describing the mobile under the
+// cursor. While picture debugging is enabled it also lists the pictures there.
+
+// maxHoverPictures caps the picture lines in the tooltip.
+const maxHoverPictures = 8
+
+// hitMobile returns the topmost mobile whose sprite covers world point
+// (wx, wy). size reports the sprite edge length for a picture ID.
+func hitMobile(mobs []frameMobile, descs map[uint8]frameDescriptor, wx, wy float64, size func(uint16) int) (frameMobile, bool) {
+	// Later mobiles are drawn on top, so search from the end.
+	for i := len(mobs) - 1; i >= 0; i-- {
+		m := mobs[i]
+		d, ok := descs[m.Index]
+		if !ok {
+			continue
+		}
+		half := float64(size(d.PictID)) / 2
+		if half <= 0 {
+			continue
+		}
+		if math.Abs(wx-float64(m.H)) < half && math.Abs(wy-float64(m.V)) < half {
+			return m, true
+		}
+	}
+	return frameMobile{}, false
+}
+
+// hitPictures returns the pictures covering world point (wx, wy), topmost
+// first. layers are given in draw order.
+func hitPictures(layers [][]framePicture, wx, wy float64, size func(uint16) (int, int), limit int) []framePicture {
+	var hits []framePicture
+	for l := len(layers) - 1; l >= 0; l-- {
+		pics := layers[l]
+		for i := len(pics) - 1; i >= 0; i-- {
+			p := pics[i]
+			w, h := size(p.PictID)
+			if w <= 0 || h <= 0 {
+				continue
+			}
+			if math.Abs(wx-float64(p.H)) < float64(w)/2 && math.Abs(wy-float64(p.V)) < float64(h)/2 {
+				hits = append(hits, p)
+				if len(hits) >= limit {
+					return hits
+				}
+			}
+		}
+	}
+	return hits
+}
+
+// hoverLines describes what lies under world point (wx, wy) in snap.
+func hoverLines(snap drawSnapshot, wx, wy float64, showPics bool) []string {
+	var lines []string
+	if !gs.hideMobiles {
+		if m, ok := hitMobile(snap.liveMobs, snap.descriptors, wx, wy, mobileSize); ok {
+			d := snap.descriptors[m.Index]
+			name := d.Name
+			if name == "" {
+				name = fmt.Sprintf("Mobile %d", m.Index)
+			}
+			lines = append(lines, name)
+			if d.Name != "" {
+				playersMu.RLock()
+				if p, ok := players[d.Name]; ok {
+					if info := strings.TrimSpace(p.Race + " " + p.Class); info != "" {
+						lines = append(lines, info)
+					}
+				}
+				playersMu.RUnlock()
+			}
+			pose := fmt.Sprintf("Pose: %d", m.State)
+			if m.State == poseDead {
+				pose += " (dead)"
+			}
+			lines = append(lines, pose)
+			if showPics {
+				lines = append(lines, fmt.Sprintf("Sprite: %d", d.PictID))
+			}
+		}
+	}
+	if showPics && clImages != nil {
+		size := func(id uint16) (int, int) { return clImages.Size(uint32(id)) }
+		layers := [][]framePicture{snap.picsNeg, snap.picsZero, snap.picsPos}
+		for _, p := range hitPictures(layers, wx, wy, size, maxHoverPictures) {
+			lines = append(lines, fmt.Sprintf("Pict %d (plane %d) at %d,%d", p.PictID, p.Plane, p.H, p.V))
+		}
+	}
+	return lines
+}
+
+// hoverInfo returns the tooltip lines for the current cursor position, or
+// nil when the cursor is not over the game view.
+func hoverInfo(snap drawSnapshot) []string {
+	showPics := gs.pictIDDebug || doDebug
+	if !gs.HoverInfo && !showPics {
+		return nil
+	}
+	mx, my := ebiten.CursorPosition()
+	if pointInUI(mx, my) {
+		return nil
+	}
+	ox, oy, scale := worldDrawInfo()
+	wx := float64(mx-ox) / scale
+	wy := float64(my-oy) / scale
+	if wx < 0 || wy < 0 || wx >= gameAreaSizeX || wy >= gameAreaSizeY {
+		return nil
+	}
+	return hoverLines(snap, wx-float64(fieldCenterX), wy-float64(fieldCenterY), showPics)
+}
+
+// drawHoverTooltip draws lines in a box next to the cursor, kept on screen.
+func drawHoverTooltip(screen *ebiten.Image, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	mx, my := ebiten.CursorPosition()
+	metrics := mainFont.Metrics()
+	lineH := math.Ceil(metrics.HAscent + metrics.HDescent + metrics.HLineGap)
+	var w float64
+	for _, l := range lines {
+		if lw, _ := text.Measure(l, mainFont, 0); lw > w {
+			w = lw
+		}
+	}
+	const pad = 4
+	bw := math.Ceil(w) + 2*pad
+	bh := lineH*float64(len(lines)) + 2*pad
+	x := float64(mx) + 16
+	y := float64(my) + 16
+	sw, sh := float64(screen.Bounds().Dx()), float64(screen.Bounds().Dy())
+	if x+bw > sw {
+		x = float64(mx) - bw - 4
+	}
+	if y+bh > sh {
+		y = float64(my) - bh - 4
+	}
+	x = math.Max(0, x)
+	y = math.Max(0, y)
+
+	vector.DrawFilledRect(screen, float32(x), float32(y), float32(bw), float32(bh), color.RGBA{0, 0, 0, 200}, false)
+	vector.StrokeRect(screen, float32(x), float32(y), float32(bw), float32(bh), 1, color.White, false)
+	for i, l := range lines {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(x+pad, y+pad+float64(i)*lineH)
+		op.ColorScale.ScaleWithColor(color.White)
+		text.Draw(screen, l, mainFont, op)
+	}
+}
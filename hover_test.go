@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestHitMobileTopmost(t *testing.T) {
+	descs := map[uint8]frameDescriptor{
+		1: {Index: 1, PictID: 10},
+		2: {Index: 2, PictID: 20},
+	}
+	mobs := []frameMobile{{Index: 1, H: 0, V: 0}, {Index: 2, H: 5, V: 5}}
+	size := func(id uint16) int { return 20 }
+
+	m, ok := hitMobile(mobs, descs, 3, 3, size)
+	if !ok || m.Index != 2 {
+		t.Fatalf("hit = %v %v, want mobile 2", m.Index, ok)
+	}
+	m, ok = hitMobile(mobs, descs, -8, -8, size)
+	if !ok || m.Index != 1 {
+		t.Fatalf("hit = %v %v, want mobile 1", m.Index, ok)
+	}
+	if _, ok := hitMobile(mobs, descs, 40, 40, size); ok {
+		t.Fatal("unexpected hit far from any mobile")
+	}
+}
+
+func TestHitPicturesOrder(t *testing.T) {
+	neg := []framePicture{{PictID: 1, H: 0, V: 0}}
+	pos := []framePicture{{PictID: 2, H: 0, V: 0}, {PictID: 3, H: 100, V: 0}}
+	size := func(id uint16) (int, int) { return 10, 10 }
+
+	hits := hitPictures([][]framePicture{neg, nil, pos}, 1, 1, size, 8)
+	if len(hits) != 2 || hits[0].PictID != 2 || hits[1].PictID != 1 {
+		t.Fatalf("hits = %+v, want pictures 2 then 1", hits)
+	}
+	if hits := hitPictures([][]framePicture{neg, nil, pos}, 1, 1, size, 1); len(hits) != 1 {
+		t.Fatalf("limit not applied: %+v", hits)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// The HUD draws the health, balance and spirit bars. Each character can have
+// its own layout; characters without one use the layout saved under the
+// empty name, which is also what gets edited while logged out.
+
+const (
+	hudFile = "GT_HUD.json"
+	// hudFlashDuration is how long a bar flashes after its value changes.
+	hudFlashDuration = 400 * time.Millisecond
+)
+
+const (
+	hudHealth = iota
+	hudBalance
+	hudSpirit
+	hudBarCount
+)
+
+var hudBarNames = [hudBarCount]string{"Health", "Balance", "Spirit"}
+
+// hudBar places one status bar. Coordinates are in unscaled world pixels.
+type hudBar struct {
+	X, Y     float64
+	W, H     float64
+	Vertical bool // fill bottom to top
+	Hidden   bool
+}
+
+type hudLayout struct {
+	Bars     [hudBarCount]hudBar
+	Numbers  bool // draw cur/max readouts
+	Flash    bool // flash a bar when its value changes
+	Detached bool // draw in the Status Bars window instead of the game view
+}
+
+type hudFlash struct {
+	last int
+	seen bool
+	up   bool
+	at   time.Time
+}
+
+var (
+	hudMu       sync.Mutex
+	hudLayouts  = map[string]hudLayout{}
+	hudDirty    bool
+	lastHUDSave = time.Now()
+	hudFlashes  [hudBarCount]hudFlash
+)
+
+// defaultHUDLayout matches the classic bar placement along the bottom of the
+// game view.
+func defaultHUDLayout() hudLayout {
+	const w, h = 110, 8
+	slot := (gameAreaSizeX - 3*w) / 6
+	var l hudLayout
+	for i := range l.Bars {
+		l.Bars[i] = hudBar{
+			X: float64(slot + i*(w+2*slot)),
+			Y: float64(gameAreaSizeY - 20 - h),
+			W: w,
+			H: h,
+		}
+	}
+	return l
+}
+
+// currentHUD returns the layout for the logged in character.
+func currentHUD() hudLayout {
+	hudMu.Lock()
+	defer hudMu.Unlock()
+	if l, ok := hudLayouts[playerName]; ok {
+		return l
+	}
+	if l, ok := hudLayouts[""]; ok {
+		return l
+	}
+	return defaultHUDLayout()
+}
+
+// setCurrentHUD stores l as the layout for the logged in character.
+func setCurrentHUD(l hudLayout) {
+	hudMu.Lock()
+	hudLayouts[playerName] = l
+	hudDirty = true
+	hudMu.Unlock()
+}
+
+// resetCurrentHUD drops the character's layout so the default applies again.
+func resetCurrentHUD() {
+	hudMu.Lock()
+	delete(hudLayouts, playerName)
+	hudDirty = true
+	hudMu.Unlock()
+}
+
+func loadHUD() {
+	data, err := os.ReadFile(filepath.Join(dataDirPath, hudFile))
+	if err != nil {
+		return
+	}
+	layouts := map[string]hudLayout{}
+	if err := json.Unmarshal(data, &layouts); err != nil {
+		logError("load hud: %v", err)
+		return
+	}
+	hudMu.Lock()
+	hudLayouts = layouts
+	hudMu.Unlock()
+}
+
+func saveHUD() {
+	hudMu.Lock()
+	data, err := json.MarshalIndent(hudLayouts, "", "  ")
+	hudDirty = false
+	hudMu.Unlock()
+	if err != nil {
+		logError("save hud: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dataDirPath, hudFile), data, 0644); err != nil {
+		logError("save hud: %v", err)
+	}
+}
+
+// drawStatusBars renders health, balance and spirit bars.
+func drawStatusBars(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float64) {
+	l := currentHUD()
+	if l.Detached && barsWin != nil && barsWin.IsOpen() {
+		return
+	}
+	drawHUDBars(screen, ox, oy, l, snap, alpha, true)
+}
+
+// drawHUDBars draws the bars of l at gs.GameScale with (ox, oy) as the world
+// origin. When clampY is set, bars are kept inside screen vertically.
+func drawHUDBars(screen *ebiten.Image, ox, oy int, l hudLayout, snap drawSnapshot, alpha float64, clampY bool) {
+	drawRect := func(x, y, w, h int, clr color.RGBA) {
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
+		op.GeoM.Scale(float64(w), float64(h))
+		op.GeoM.Translate(float64(ox+x), float64(oy+y))
+		op.ColorScale.ScaleWithColor(clr)
+		screen.DrawImage(whiteImage, op)
+	}
+	hpClr, balClr, spClr := statusBarColors()
+	values := [hudBarCount]struct {
+		cur, max, raw int
+		clr           color.RGBA
+	}{
+		{lerpBar(snap.prevHP, snap.hp, alpha), lerpBar(snap.prevHPMax, snap.hpMax, alpha), snap.hp, hpClr},
+		{lerpBar(snap.prevBalance, snap.balance, alpha), lerpBar(snap.prevBalanceMax, snap.balanceMax, alpha), snap.balance, balClr},
+		{lerpBar(snap.prevSP, snap.sp, alpha), lerpBar(snap.prevSPMax, snap.spMax, alpha), snap.sp, spClr},
+	}
+	now := time.Now()
+	for i, b := range l.Bars {
+		v := values[i]
+		f := &hudFlashes[i]
+		if f.seen && v.raw != f.last {
+			f.up = v.raw > f.last
+			f.at = now
+		}
+		f.last, f.seen = v.raw, true
+		if b.Hidden {
+			continue
+		}
+
+		x := int(b.X * gs.GameScale)
+		y := int(b.Y * gs.GameScale)
+		w := int(b.W * gs.GameScale)
+		h := int(b.H * gs.GameScale)
+		if clampY {
+			minY := -oy
+			maxY := screen.Bounds().Dy() - oy - h
+			if y < minY {
+				y = minY
+			} else if y > maxY {
+				y = maxY
+			}
+		}
+		frameClr := color.RGBA{0xff, 0xff, 0xff, 0xff}
+		vector.StrokeRect(screen, float32(float64(ox+x)-gs.GameScale), float32(float64(oy+y)-gs.GameScale), float32(w)+float32(2*gs.GameScale), float32(h)+float32(2*gs.GameScale), 1, frameClr, false)
+		if v.max > 0 && v.cur > 0 {
+			fillClr := color.RGBA{v.clr.R, v.clr.G, v.clr.B, 128}
+			if b.Vertical {
+				fh := h * v.cur / v.max
+				drawRect(x, y+h-fh, w, fh, fillClr)
+			} else {
+				drawRect(x, y, w*v.cur/v.max, h, fillClr)
+			}
+		}
+		if l.Flash && !f.at.IsZero() {
+			if t := now.Sub(f.at); t < hudFlashDuration {
+				a := 1 - float64(t)/float64(hudFlashDuration)
+				c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+				if !f.up {
+					c = cbRGBA(color.RGBA{0xff, 0x40, 0x40, 0xff})
+				}
+				c = color.RGBA{uint8(float64(c.R) * a * 0.6), uint8(float64(c.G) * a * 0.6), uint8(float64(c.B) * a * 0.6), uint8(255 * a * 0.6)}
+				drawRect(x, y, w, h, c)
+			}
+		}
+		if l.Numbers && v.max > 0 {
+			msg := fmt.Sprintf("%d/%d", v.cur, v.max)
+			tw, th := text.Measure(msg, mainFont, 0)
+			tx := float64(ox+x) + (float64(w)-tw)/2
+			ty := float64(oy+y) + (float64(h)-th)/2
+			for _, d := range [][2]float64{{1, 1}, {-1, 1}, {1, -1}, {-1, -1}} {
+				op := &text.DrawOptions{}
+				op.GeoM.Translate(tx+d[0], ty+d[1])
+				op.ColorScale.ScaleWithColor(color.Black)
+				text.Draw(screen, msg, mainFont, op)
+			}
+			op := &text.DrawOptions{}
+			op.GeoM.Translate(tx, ty)
+			text.Draw(screen, msg, mainFont, op)
+		}
+	}
+}
+
+// hudBounds returns the area covered by the visible bars of l in world
+// pixels, including the one pixel frame.
+func hudBounds(l hudLayout) image.Rectangle {
+	var r image.Rectangle
+	for _, b := range l.Bars {
+		if b.Hidden {
+			continue
+		}
+		br := image.Rect(
+			int(math.Floor(b.X))-1, int(math.Floor(b.Y))-1,
+			int(math.Ceil(b.X+b.W))+1, int(math.Ceil(b.Y+b.H))+1,
+		)
+		r = r.Union(br)
+	}
+	return r
+}
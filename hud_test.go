@@ -0,0 +1,32 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestDefaultHUDLayoutMatchesClassicBars(t *testing.T) {
+	l := defaultHUDLayout()
+	// The classic bars were 110x8, spaced evenly 20 pixels above the bottom.
+	wantX := []float64{36, 218, 400}
+	for i, b := range l.Bars {
+		if b.X != wantX[i] || b.Y != 512 || b.W != 110 || b.H != 8 {
+			t.Errorf("%s bar = %+v", hudBarNames[i], b)
+		}
+		if b.Vertical || b.Hidden {
+			t.Errorf("%s bar not a visible horizontal bar", hudBarNames[i])
+		}
+	}
+}
+
+func TestHUDBoundsSkipsHidden(t *testing.T) {
+	var l hudLayout
+	l.Bars[hudHealth] = hudBar{X: 10, Y: 20, W: 30, H: 5}
+	l.Bars[hudBalance] = hudBar{X: 100, Y: 0, W: 10, H: 100, Hidden: true}
+	l.Bars[hudSpirit] = hudBar{X: 50, Y: 30, W: 10, H: 4}
+	got := hudBounds(l)
+	want := image.Rect(9, 19, 61, 35)
+	if got != want {
+		t.Fatalf("bounds = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+//go:build !test
+
+package main
+
+import (
+	"fmt"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// hudWindowScale is the zoom used for bars in the detached Status Bars window.
+const hudWindowScale = 2
+
+var (
+	hudEditWin    *eui.WindowData
+	hudEditBar    int
+	hudEditLabel  *eui.ItemData
+	hudEditFields struct {
+		x, y, w, h       *eui.ItemData
+		vertical, hidden *eui.ItemData
+		numbers, flash   *eui.ItemData
+		detached         *eui.ItemData
+	}
+
+	barsWin       *eui.WindowData
+	barsImageItem *eui.ItemData
+	barsImage     *ebiten.Image
+)
+
+func makeHUDEditorWindow() {
+	if hudEditWin != nil {
+		return
+	}
+	var width float32 = 250
+	hudEditWin = eui.NewWindow()
+	hudEditWin.Title = "HUD Layout"
+	hudEditWin.Closable = true
+	hudEditWin.Resizable = false
+	hudEditWin.AutoSize = true
+	hudEditWin.Movable = true
+	hudEditWin.SetZone(eui.HZoneCenterLeft, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+
+	hudEditLabel, _ = eui.NewText()
+	hudEditLabel.Size = eui.Point{X: width, Y: 24}
+	hudEditLabel.FontSize = 12
+	flow.AddItem(hudEditLabel)
+
+	barDD, barEvents := eui.NewDropdown()
+	barDD.Label = "Bar"
+	barDD.Options = hudBarNames[:]
+	barDD.Size = eui.Point{X: width, Y: 24}
+	barEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			hudEditBar = ev.Index
+			refreshHUDEditor()
+		}
+	}
+	flow.AddItem(barDD)
+
+	// editBar applies fn to the selected bar of the current layout.
+	editBar := func(fn func(b *hudBar)) {
+		l := currentHUD()
+		fn(&l.Bars[hudEditBar])
+		setCurrentHUD(l)
+	}
+	editLayout := func(fn func(l *hudLayout)) {
+		l := currentHUD()
+		fn(&l)
+		setCurrentHUD(l)
+	}
+
+	slider := func(label string, min, max float32, set func(b *hudBar, v float64)) *eui.ItemData {
+		s, events := eui.NewSlider()
+		s.Label = label
+		s.MinValue = min
+		s.MaxValue = max
+		s.IntOnly = true
+		s.Size = eui.Point{X: width - 10, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventSliderChanged {
+				editBar(func(b *hudBar) { set(b, float64(ev.Value)) })
+			}
+		}
+		flow.AddItem(s)
+		return s
+	}
+	hudEditFields.x = slider("X", 0, gameAreaSizeX, func(b *hudBar, v float64) { b.X = v })
+	hudEditFields.y = slider("Y", 0, gameAreaSizeY, func(b *hudBar, v float64) { b.Y = v })
+	hudEditFields.w = slider("Width", 4, gameAreaSizeX, func(b *hudBar, v float64) { b.W = v })
+	hudEditFields.h = slider("Height", 2, 200, func(b *hudBar, v float64) { b.H = v })
+
+	checkbox := func(label, tip string, set func(v bool)) *eui.ItemData {
+		cb, events := eui.NewCheckbox()
+		cb.Text = label
+		cb.Tooltip = tip
+		cb.Size = eui.Point{X: width, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventCheckboxChanged {
+				set(ev.Checked)
+			}
+		}
+		flow.AddItem(cb)
+		return cb
+	}
+	hudEditFields.vertical = checkbox("Vertical", "Fill the bar from bottom to top", func(v bool) {
+		editBar(func(b *hudBar) { b.Vertical = v })
+	})
+	hudEditFields.hidden = checkbox("Hidden", "Do not draw this bar", func(v bool) {
+		editBar(func(b *hudBar) { b.Hidden = v })
+	})
+	hudEditFields.numbers = checkbox("Show numbers", "Draw current/maximum values on the bars", func(v bool) {
+		editLayout(func(l *hudLayout) { l.Numbers = v })
+	})
+	hudEditFields.flash = checkbox("Flash on change", "Briefly highlight a bar when its value changes", func(v bool) {
+		editLayout(func(l *hudLayout) { l.Flash = v })
+	})
+	hudEditFields.detached = checkbox("Detach to window", "Show the bars in their own window instead of over the game", func(v bool) {
+		editLayout(func(l *hudLayout) { l.Detached = v })
+		if v {
+			barsWin.MarkOpenNear(hudEditFields.detached)
+		} else {
+			barsWin.Close()
+		}
+	})
+
+	resetBtn, resetEvents := eui.NewButton()
+	resetBtn.Text = "Reset to default"
+	resetBtn.Size = eui.Point{X: width, Y: 24}
+	resetEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			resetCurrentHUD()
+			refreshHUDEditor()
+		}
+	}
+	flow.AddItem(resetBtn)
+
+	hudEditWin.AddItem(flow)
+	hudEditWin.AddWindow(false)
+	makeStatusBarsWindow()
+	refreshHUDEditor()
+}
+
+// refreshHUDEditor copies the current layout into the editor controls.
+func refreshHUDEditor() {
+	if hudEditWin == nil {
+		return
+	}
+	l := currentHUD()
+	b := l.Bars[hudEditBar]
+	name := playerName
+	if name == "" {
+		name = "default"
+	}
+	hudEditLabel.Text = fmt.Sprintf("Layout for %s", name)
+	hudEditFields.x.Value = float32(b.X)
+	hudEditFields.y.Value = float32(b.Y)
+	hudEditFields.w.Value = float32(b.W)
+	hudEditFields.h.Value = float32(b.H)
+	hudEditFields.vertical.Checked = b.Vertical
+	hudEditFields.hidden.Checked = b.Hidden
+	hudEditFields.numbers.Checked = l.Numbers
+	hudEditFields.flash.Checked = l.Flash
+	hudEditFields.detached.Checked = l.Detached
+	for _, it := range []*eui.ItemData{hudEditLabel, hudEditFields.x, hudEditFields.y, hudEditFields.w, hudEditFields.h,
+		hudEditFields.vertical, hudEditFields.hidden, hudEditFields.numbers, hudEditFields.flash, hudEditFields.detached} {
+		it.Dirty = true
+	}
+	hudEditWin.Refresh()
+}
+
+func makeStatusBarsWindow() {
+	if barsWin != nil {
+		return
+	}
+	barsWin = eui.NewWindow()
+	barsWin.Title = "Status Bars"
+	barsWin.Closable = true
+	barsWin.Resizable = false
+	barsWin.AutoSize = true
+	barsWin.Movable = true
+	barsWin.SetZone(eui.HZoneCenter, eui.VZoneBottom)
+	barsImageItem, barsImage = eui.NewImageItem(1, 1)
+	barsWin.AddItem(barsImageItem)
+	barsWin.AddWindow(false)
+	if currentHUD().Detached {
+		barsWin.MarkOpen()
+	}
+}
+
+// updateStatusBarsWindow redraws the detached bars. It is called from Draw
+// with the same snapshot used for the game view.
+func updateStatusBarsWindow(snap drawSnapshot, alpha float64) {
+	if barsWin == nil || !barsWin.IsOpen() {
+		return
+	}
+	l := currentHUD()
+	if !l.Detached {
+		return
+	}
+	r := hudBounds(l)
+	if r.Empty() {
+		return
+	}
+	// Leave room for the frame and numeric readouts.
+	w := (r.Dx() + 4) * hudWindowScale
+	h := (r.Dy() + 4) * hudWindowScale
+	if barsImage == nil || barsImage.Bounds().Dx() != w || barsImage.Bounds().Dy() != h {
+		barsImage = ebiten.NewImage(w, h)
+		barsImageItem.Image = barsImage
+		barsImageItem.Size = eui.Point{X: float32(w), Y: float32(h)}
+		barsWin.Refresh()
+	}
+	barsImage.Clear()
+	ox := (2 - r.Min.X) * hudWindowScale
+	oy := (2 - r.Min.Y) * hudWindowScale
+	withGameScale(hudWindowScale, func() {
+		drawHUDBars(barsImage, ox, oy, l, snap, alpha, false)
+	})
+	barsImageItem.Dirty = true
+}
@@ -14,9 +14,13 @@ import (
 // present, nil is cached to avoid repeated lookups.
 const maxColors = 30
 
+// imageKey, sheetKey and mobileKey carry the override revision of their
+// picture (0 when the art comes from CL_Images) so a reloaded override
+// never hits a stale entry.
 type imageKey struct {
-	id    uint16
-	frame uint16
+	id       uint16
+	frame    uint16
+	override uint32
 }
 
 type sheetKey struct {
@@ -24,6 +28,7 @@ type sheetKey struct {
 	forceTransparent bool
 	colorsLen        uint8
 	colors           [maxColors]byte
+	override         uint32
 }
 
 type mobileKey struct {
@@ -31,6 +36,7 @@ type mobileKey struct {
 	state     uint8
 	colorsLen uint8
 	colors    [maxColors]byte
+	override  uint32
 }
 
 type mobileBlendKey struct {
@@ -68,9 +74,30 @@ var (
 	clImages *climg.CLImages
 )
 
+// overrideRev returns the override revision of picture id, or 0.
+func overrideRev(id uint16) uint32 {
+	if clImages == nil {
+		return 0
+	}
+	return clImages.OverrideRevision(uint32(id))
+}
+
+// spriteScale returns how many image pixels make up one game pixel for
+// picture id. It is only above 1 for high resolution overrides.
+func spriteScale(id uint16) float64 {
+	if clImages == nil {
+		return 1
+	}
+	return clImages.Scale(uint32(id))
+}
+
 func makeSheetKey(id uint16, colors []byte, forceTransparent bool) sheetKey {
 	var k sheetKey
 	k.id = id
+	if k.override = overrideRev(id); k.override != 0 {
+		// Override art is true color, so every tint shares one sheet.
+		return k
+	}
 	k.forceTransparent = forceTransparent
 	if len(colors) > 0 {
 		l := len(colors)
@@ -84,13 +111,16 @@ func makeSheetKey(id uint16, colors []byte, forceTransparent bool) sheetKey {
 }
 
 func makeImageKey(id uint16, frame int) imageKey {
-	return imageKey{id: id, frame: uint16(frame)}
+	return imageKey{id: id, frame: uint16(frame), override: overrideRev(id)}
 }
 
 func makeMobileKey(id uint16, state uint8, colors []byte) mobileKey {
 	var k mobileKey
 	k.id = id
 	k.state = state
+	if k.override = overrideRev(id); k.override != 0 {
+		return k
+	}
 	if len(colors) > 0 {
 		l := len(colors)
 		if l > maxColors {
@@ -111,12 +141,32 @@ func loadSheet(id uint16, colors []byte, forceTransparent bool) *ebiten.Image {
 	if !gs.NoCaching {
 		imageMu.Lock()
 		if img, ok := sheetCache[key]; ok {
+			sheetAtlas.touch(key)
 			imageMu.Unlock()
 			return img
 		}
 		imageMu.Unlock()
 	}
 
+	if clImages != nil && atlasActive() {
+		if rgba := clImages.GetRGBA(uint32(id), colors, forceTransparent); rgba != nil {
+			statImageLoaded(id)
+			imageMu.Lock()
+			defer imageMu.Unlock()
+			if img, ok := sheetCache[key]; ok {
+				return img
+			}
+			img := sheetAtlas.insert(key, rgba)
+			if img == nil {
+				img = newImageFromImage(rgba)
+			}
+			sheetCache[key] = img
+			return img
+		}
+		log.Printf("missing image %d", id)
+		return nil
+	}
+
 	if clImages != nil {
 		if img := clImages.Get(uint32(id), colors, forceTransparent); img != nil {
 			statImageLoaded(id)
@@ -149,6 +199,7 @@ func loadImageFrame(id uint16, frame int) *ebiten.Image {
 	if !gs.NoCaching {
 		imageMu.Lock()
 		if img, ok := imageCache[origKey]; ok {
+			sheetAtlas.touch(makeSheetKey(id, nil, false))
 			imageMu.Unlock()
 			return img
 		}
@@ -173,6 +224,8 @@ func loadImageFrame(id uint16, frame int) *ebiten.Image {
 		frames = 1
 	}
 	frame = frame % frames
+	// Sheets packed into the sprite atlas are sub-images with a non-zero origin.
+	origin := sheet.Bounds().Min
 	innerHeight := sheet.Bounds().Dy() - 2
 	innerWidth := sheet.Bounds().Dx() - 2
 	h := innerHeight / frames
@@ -183,7 +236,7 @@ func loadImageFrame(id uint16, frame int) *ebiten.Image {
 			k := makeImageKey(id, f)
 			if _, ok := imageCache[k]; !ok {
 				y := 1 + f*h
-				imageCache[k] = sheet.SubImage(image.Rect(1, y, 1+innerWidth, y+h)).(*ebiten.Image)
+				imageCache[k] = sheet.SubImage(image.Rect(1, y, 1+innerWidth, y+h).Add(origin)).(*ebiten.Image)
 			}
 		}
 		img := imageCache[makeImageKey(id, frame)]
@@ -192,7 +245,7 @@ func loadImageFrame(id uint16, frame int) *ebiten.Image {
 	}
 
 	y0 := frame * h
-	sub := sheet.SubImage(image.Rect(1, 1+y0, 1+innerWidth, 1+y0+h)).(*ebiten.Image)
+	sub := sheet.SubImage(image.Rect(1, 1+y0, 1+innerWidth, 1+y0+h).Add(origin)).(*ebiten.Image)
 
 	if !gs.NoCaching {
 		imageMu.Lock()
@@ -212,6 +265,7 @@ func loadMobileFrame(id uint16, state uint8, colors []byte) *ebiten.Image {
 	if !gs.NoCaching {
 		imageMu.Lock()
 		if img, ok := mobileCache[key]; ok {
+			sheetAtlas.touch(makeSheetKey(id, colors, true))
 			imageMu.Unlock()
 			return img
 		}
@@ -228,6 +282,7 @@ func loadMobileFrame(id uint16, state uint8, colors []byte) *ebiten.Image {
 		return nil
 	}
 
+	origin := sheet.Bounds().Min
 	innerSize := (sheet.Bounds().Dx() - 2) / 16
 	x := 1 + int(state&0x0F)*innerSize
 	y := 1 + int(state>>4)*innerSize
@@ -250,7 +305,7 @@ func loadMobileFrame(id uint16, state uint8, colors []byte) *ebiten.Image {
 					sx := 1 + xx*innerSize
 					sy := 1 + yy*innerSize
 					if sx+innerSize <= sheet.Bounds().Dx()-1 && sy+innerSize <= sheet.Bounds().Dy()-1 {
-						mobileCache[k] = sheet.SubImage(image.Rect(sx, sy, sx+innerSize, sy+innerSize)).(*ebiten.Image)
+						mobileCache[k] = sheet.SubImage(image.Rect(sx, sy, sx+innerSize, sy+innerSize).Add(origin)).(*ebiten.Image)
 					} else {
 						mobileCache[k] = nil
 					}
@@ -262,7 +317,7 @@ func loadMobileFrame(id uint16, state uint8, colors []byte) *ebiten.Image {
 		return img
 	}
 
-	frame := sheet.SubImage(image.Rect(x, y, x+innerSize, y+innerSize)).(*ebiten.Image)
+	frame := sheet.SubImage(image.Rect(x, y, x+innerSize, y+innerSize).Add(origin)).(*ebiten.Image)
 	if !gs.NoCaching {
 		imageMu.Lock()
 		mobileCache[key] = frame
@@ -272,13 +327,26 @@ func loadMobileFrame(id uint16, state uint8, colors []byte) *ebiten.Image {
 }
 
 // mobileSize returns the dimension of a single mobile frame for the given
-// image ID. If the image cannot be loaded, 0 is returned.
+// image ID in game pixels. If the image cannot be loaded, 0 is returned.
 func mobileSize(id uint16) int {
 	sheet := loadSheet(id, nil, true)
 	if sheet == nil {
 		return 0
 	}
-	return (sheet.Bounds().Dx() - 2) / 16
+	return int(float64((sheet.Bounds().Dx()-2)/16) / spriteScale(id))
+}
+
+// mobileBlendStep returns which of the steps blend frames between two
+// mobile frames is shown at fade, never the first or last.
+func mobileBlendStep(fade float32, steps int) int {
+	idx := int(fade * float32(steps))
+	if idx <= 0 {
+		idx = 1
+	}
+	if idx >= steps {
+		idx = steps - 1
+	}
+	return idx
 }
 
 func mobileBlendFrame(from, to mobileKey, prevImg, img *ebiten.Image, step, total int) *ebiten.Image {
@@ -79,7 +79,7 @@ func TestParseInventoryMacRomanName(t *testing.T) {
 		t.Fatalf("unexpected rest %v", rest)
 	}
 	inv := getInventory()
-	if len(inv) != 1 || inv[0].Name != decodeMacRoman(nameBytes) {
+	if len(inv) != 1 || inv[0].Name != decodeMacRoman(nameBytes) || inv[0].Name != "Méme" {
 		t.Fatalf("unexpected inventory %v", inv)
 	}
 	if !inventoryDirty {
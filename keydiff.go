@@ -0,0 +1,560 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gothoom/climg"
+	"gothoom/clsnd"
+	"gothoom/keyfile"
+)
+
+// runKeyDiff implements "gothoom diff", which compares two keyfiles (for
+// example the CL_Images before and after an update) and writes an HTML
+// report with side-by-side pictures. It returns the process exit code.
+func runKeyDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	outDir := fs.String("out", "keydiff", "report directory")
+	images := fs.Bool("images", true, "render changed pictures and sounds into the report")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gothoom diff [flags] OLD NEW")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	oldPath, newPath := fs.Arg(0), fs.Arg(1)
+	oldKF, err := keyfile.ReadFile(oldPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %s: %v\n", oldPath, err)
+		return 1
+	}
+	newKF, err := keyfile.ReadFile(newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %s: %v\n", newPath, err)
+		return 1
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return 1
+	}
+
+	d := &keyDiff{
+		Old:     oldPath,
+		New:     newPath,
+		Created: time.Now().Format(time.RFC1123),
+		Types:   diffRecords(oldKF, newKF),
+	}
+	if hasType(oldKF, newKF, climg.TYPE_IDREF) {
+		oldImgs, err := climg.Load(oldPath)
+		if err == nil {
+			var newImgs *climg.CLImages
+			if newImgs, err = climg.Load(newPath); err == nil {
+				d.Pictures = diffPictures(oldKF, newKF, oldImgs, newImgs)
+				d.Items = diffItems(oldImgs, newImgs)
+				if *images {
+					err = renderPictureDiffs(d.Pictures, oldImgs, newImgs, *outDir)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "diff images: %v\n", err)
+		}
+	}
+	if hasType(oldKF, newKF, soundType) {
+		oldSnds, err := clsnd.Load(oldPath)
+		if err == nil {
+			var newSnds *clsnd.CLSounds
+			if newSnds, err = clsnd.Load(newPath); err == nil {
+				d.Sounds = diffSounds(d.Types, oldSnds, newSnds)
+				if *images {
+					err = writeSoundDiffs(d.Sounds, oldSnds, newSnds, *outDir)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "diff sounds: %v\n", err)
+		}
+	}
+
+	for _, t := range d.Types {
+		fmt.Printf("%s: %d added, %d removed, %d changed\n", t.Name, len(t.Added), len(t.Removed), len(t.Changed))
+	}
+	if d.Pictures != nil || d.Items != nil {
+		fmt.Printf("pictures: %d differ, items: %d differ\n", len(d.Pictures), len(d.Items))
+	}
+	report := filepath.Join(*outDir, "index.html")
+	if err := writeDiffReport(report, d); err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return 1
+	}
+	fmt.Printf("report: %s\n", report)
+	return 0
+}
+
+// soundType is the 'snd ' record type used by CL_Sounds.
+const soundType = 0x736e6420
+
+// keyDiff is everything the report shows.
+type keyDiff struct {
+	Old, New string
+	Created  string
+	Types    []typeDiff
+	Pictures []pictDiff
+	Items    []itemDiff
+	Sounds   []soundDiff
+}
+
+// typeDiff lists the record IDs of one type that differ between two files.
+type typeDiff struct {
+	Type    uint32
+	Name    string
+	Total   int // records of this type in the new file
+	Added   []uint32
+	Removed []uint32
+	Changed []uint32
+}
+
+// diffRecords compares a and b record by record, grouped by type.
+func diffRecords(a, b *keyfile.File) []typeDiff {
+	byType := map[uint32]*typeDiff{}
+	get := func(typ uint32) *typeDiff {
+		t := byType[typ]
+		if t == nil {
+			t = &typeDiff{Type: typ, Name: fourCC(typ)}
+			byType[typ] = t
+		}
+		return t
+	}
+	for _, r := range a.Records() {
+		nd, ok := b.Get(r.Type, r.ID)
+		switch {
+		case !ok:
+			get(r.Type).Removed = append(get(r.Type).Removed, r.ID)
+		case !bytes.Equal(nd, r.Data):
+			get(r.Type).Changed = append(get(r.Type).Changed, r.ID)
+		default:
+			get(r.Type)
+		}
+	}
+	for _, r := range b.Records() {
+		t := get(r.Type)
+		t.Total++
+		if _, ok := a.Get(r.Type, r.ID); !ok {
+			t.Added = append(t.Added, r.ID)
+		}
+	}
+	out := make([]typeDiff, 0, len(byType))
+	for _, t := range byType {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+func hasType(a, b *keyfile.File, typ uint32) bool {
+	return len(a.IDs(typ)) > 0 || len(b.IDs(typ)) > 0
+}
+
+// fourCC renders a record type as its four characters, e.g. "Bit2".
+func fourCC(t uint32) string {
+	b := []byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("0x%08x", t)
+		}
+	}
+	return string(b)
+}
+
+// pictDiff describes one picture that was added, removed or changed.
+// Changes to the shared bits, colors or lighting records show up on every
+// picture that uses them.
+type pictDiff struct {
+	ID      uint32
+	Status  string   // "added", "removed" or "changed"
+	Parts   []string // what changed: "definition", "bits", "colors", "lighting"
+	OldSize string
+	NewSize string
+	Pixels  int    // differing pixels, when both sheets have the same size
+	Image   string // report-relative path of the rendered comparison
+}
+
+func diffPictures(oldKF, newKF *keyfile.File, oldImgs, newImgs *climg.CLImages) []pictDiff {
+	ids := map[uint32]bool{}
+	for _, id := range oldKF.IDs(climg.TYPE_IDREF) {
+		ids[id] = true
+	}
+	for _, id := range newKF.IDs(climg.TYPE_IDREF) {
+		ids[id] = true
+	}
+	size := func(c *climg.CLImages, id uint32) string {
+		w, h := c.Size(id)
+		return fmt.Sprintf("%d×%d, %d frames", w, h, c.NumFrames(id))
+	}
+	var out []pictDiff
+	for id := range ids {
+		od, inOld := oldImgs.PictDef(id)
+		nd, inNew := newImgs.PictDef(id)
+		p := pictDiff{ID: id}
+		switch {
+		case !inOld && !inNew:
+			continue
+		case !inOld:
+			p.Status, p.NewSize = "added", size(newImgs, id)
+		case !inNew:
+			p.Status, p.OldSize = "removed", size(oldImgs, id)
+		default:
+			p.Parts = changedParts(oldKF, newKF, id, od, nd)
+			if len(p.Parts) == 0 {
+				continue
+			}
+			p.Status = "changed"
+			p.OldSize, p.NewSize = size(oldImgs, id), size(newImgs, id)
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// changedParts reports which of the records making up picture id differ.
+func changedParts(oldKF, newKF *keyfile.File, id uint32, od, nd climg.PictDef) []string {
+	same := func(typ, oldID, newID uint32) bool {
+		a, _ := oldKF.Get(typ, oldID)
+		b, _ := newKF.Get(typ, newID)
+		return bytes.Equal(a, b)
+	}
+	var parts []string
+	if !same(climg.TYPE_IDREF, id, id) {
+		parts = append(parts, "definition")
+	}
+	if !same(climg.TYPE_IMAGE, od.ImageID, nd.ImageID) {
+		parts = append(parts, "bits")
+	}
+	if !same(climg.TYPE_COLOR, od.ColorID, nd.ColorID) {
+		parts = append(parts, "colors")
+	}
+	if !same(climg.TYPE_LIGHT, uint32(od.LightingID), uint32(nd.LightingID)) {
+		parts = append(parts, "lighting")
+	}
+	return parts
+}
+
+// renderPictureDiffs writes a comparison PNG for every entry of diffs to
+// outDir/pictures and fills in Image and Pixels.
+func renderPictureDiffs(diffs []pictDiff, oldImgs, newImgs *climg.CLImages, outDir string) error {
+	dir := filepath.Join(outDir, "pictures")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var firstErr error
+	for i := range diffs {
+		p := &diffs[i]
+		var a, b *image.RGBA
+		if p.Status != "added" {
+			a = diffSheet(oldImgs, p.ID)
+		}
+		if p.Status != "removed" {
+			b = diffSheet(newImgs, p.ID)
+		}
+		img, n := sideBySide(a, b)
+		if img == nil {
+			continue
+		}
+		p.Pixels = n
+		name := fmt.Sprintf("%d.png", p.ID)
+		if err := writePNG(filepath.Join(dir, name), img); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		p.Image = "pictures/" + name
+	}
+	return firstErr
+}
+
+// diffSheet returns the whole sheet of picture id as drawn in game, without
+// the border GetRGBA adds.
+func diffSheet(c *climg.CLImages, id uint32) *image.RGBA {
+	ix := c.GetIndexed(id)
+	if ix == nil {
+		return nil
+	}
+	pal := c.Palette(ix, nil, false)
+	return paletteImage(ix, &pal)
+}
+
+const diffGap = 4
+
+var (
+	diffBackground = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	diffMarked     = color.RGBA{0xff, 0x00, 0xff, 0xff}
+)
+
+// sideBySide lays out old and new next to each other on a dark background,
+// followed by a third panel that shows new dimmed with every differing
+// pixel in magenta. Either image may be nil for added or removed pictures,
+// in which case only the other is drawn. It returns the composed image and
+// the number of differing pixels (every pixel when the sizes differ).
+func sideBySide(old, cur *image.RGBA) (*image.RGBA, int) {
+	var panels []*image.RGBA
+	diff := 0
+	switch {
+	case old == nil && cur == nil:
+		return nil, 0
+	case old == nil:
+		panels = []*image.RGBA{cur}
+	case cur == nil:
+		panels = []*image.RGBA{old}
+	default:
+		var mark *image.RGBA
+		mark, diff = markDiff(old, cur)
+		panels = []*image.RGBA{old, cur, mark}
+	}
+	w, h := 0, 0
+	for _, p := range panels {
+		w += p.Bounds().Dx() + diffGap
+		h = max(h, p.Bounds().Dy())
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w+diffGap, h+2*diffGap))
+	draw.Draw(out, out.Bounds(), image.NewUniform(diffBackground), image.Point{}, draw.Src)
+	x := diffGap
+	for _, p := range panels {
+		r := image.Rect(x, diffGap, x+p.Bounds().Dx(), diffGap+p.Bounds().Dy())
+		draw.Draw(out, r, p, p.Bounds().Min, draw.Over)
+		x = r.Max.X + diffGap
+	}
+	return out, diff
+}
+
+// markDiff returns cur dimmed, with the pixels that differ
+// from old in magenta, and how many of them there are.
+func markDiff(old, cur *image.RGBA) (*image.RGBA, int) {
+	b := cur.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, max(b.Dx(), old.Bounds().Dx()), max(b.Dy(), old.Bounds().Dy())))
+	n := 0
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			op := image.Pt(x, y).Add(old.Bounds().Min)
+			np := image.Pt(x, y).Add(b.Min)
+			inOld, inNew := op.In(old.Bounds()), np.In(b)
+			var oc, nc color.RGBA
+			if inOld {
+				oc = old.RGBAAt(op.X, op.Y)
+			}
+			if inNew {
+				nc = cur.RGBAAt(np.X, np.Y)
+			}
+			if inOld != inNew || oc != nc {
+				out.SetRGBA(x, y, diffMarked)
+				n++
+				continue
+			}
+			out.SetRGBA(x, y, color.RGBA{nc.R / 3, nc.G / 3, nc.B / 3, nc.A})
+		}
+	}
+	return out, n
+}
+
+// itemDiff describes one client item record that differs.
+type itemDiff struct {
+	ID      uint32
+	Status  string
+	OldName string
+	NewName string
+}
+
+func diffItems(oldImgs, newImgs *climg.CLImages) []itemDiff {
+	ids := map[uint32]bool{}
+	for _, id := range oldImgs.ItemIDs() {
+		ids[id] = true
+	}
+	for _, id := range newImgs.ItemIDs() {
+		ids[id] = true
+	}
+	var out []itemDiff
+	for id := range ids {
+		a, inOld := oldImgs.Item(id)
+		b, inNew := newImgs.Item(id)
+		d := itemDiff{ID: id, OldName: a.Name, NewName: b.Name}
+		switch {
+		case !inOld:
+			d.Status = "added"
+		case !inNew:
+			d.Status = "removed"
+		case a.Name != b.Name || a.Flags != b.Flags || a.Slot != b.Slot ||
+			a.WornPictID != b.WornPictID || a.RightHandPictID != b.RightHandPictID ||
+			a.LeftHandPictID != b.LeftHandPictID:
+			d.Status = "changed"
+		default:
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// soundDiff describes one sound that was added, removed or changed.
+type soundDiff struct {
+	ID       uint32
+	Status   string
+	OldInfo  string
+	NewInfo  string
+	OldAudio string // report-relative WAV paths
+	NewAudio string
+}
+
+func diffSounds(types []typeDiff, oldSnds, newSnds *clsnd.CLSounds) []soundDiff {
+	var out []soundDiff
+	for _, t := range types {
+		if t.Type != soundType {
+			continue
+		}
+		add := func(ids []uint32, status string) {
+			for _, id := range ids {
+				d := soundDiff{ID: id, Status: status}
+				if status != "added" {
+					d.OldInfo = soundInfo(oldSnds, id)
+				}
+				if status != "removed" {
+					d.NewInfo = soundInfo(newSnds, id)
+				}
+				out = append(out, d)
+			}
+		}
+		add(t.Added, "added")
+		add(t.Removed, "removed")
+		add(t.Changed, "changed")
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func soundInfo(c *clsnd.CLSounds, id uint32) string {
+	s, err := c.Get(id)
+	if s == nil {
+		if err != nil {
+			return err.Error()
+		}
+		return "undecodable"
+	}
+	frame := int(s.Channels) * int(s.Bits/8)
+	if frame == 0 || s.SampleRate == 0 {
+		return "empty"
+	}
+	secs := float64(len(s.Data)/frame) / float64(s.SampleRate)
+	return fmt.Sprintf("%.2fs, %d Hz, %d ch, %d-bit", secs, s.SampleRate, s.Channels, s.Bits)
+}
+
+// writeSoundDiffs writes both versions of every entry of diffs as WAV to
+// outDir/sounds so the report can play them.
+func writeSoundDiffs(diffs []soundDiff, oldSnds, newSnds *clsnd.CLSounds, outDir string) error {
+	dir := filepath.Join(outDir, "sounds")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	write := func(c *clsnd.CLSounds, id uint32, name string) (string, error) {
+		s, _ := c.Get(id)
+		if s == nil {
+			return "", nil
+		}
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		err = writeWAV(f, s)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+		return "sounds/" + name, nil
+	}
+	var firstErr error
+	for i := range diffs {
+		d := &diffs[i]
+		var err error
+		if d.Status != "added" {
+			d.OldAudio, err = write(oldSnds, d.ID, fmt.Sprintf("%d-old.wav", d.ID))
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if d.Status != "removed" {
+			d.NewAudio, err = write(newSnds, d.ID, fmt.Sprintf("%d-new.wav", d.ID))
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	oldSnds.ClearCache()
+	newSnds.ClearCache()
+	return firstErr
+}
+
+var diffReportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Keyfile diff</title>
+<style>
+body{font-family:sans-serif;background:#1e1e1e;color:#ddd;margin:2em}
+table{border-collapse:collapse;margin-bottom:2em}
+td,th{border:1px solid #555;padding:4px 8px;text-align:left;vertical-align:top}
+.added{color:#7c7}.removed{color:#e77}.changed{color:#ec6}
+img{image-rendering:pixelated;max-width:100%}
+.ids{font-family:monospace;max-width:60em;word-wrap:break-word}
+</style></head><body>
+<h1>Keyfile diff</h1>
+<p>Old: <code>{{.Old}}</code><br>New: <code>{{.New}}</code><br>Created {{.Created}}</p>
+
+<h2>Records</h2>
+<table><tr><th>Type</th><th>Total</th><th>Added</th><th>Removed</th><th>Changed</th></tr>
+{{range .Types}}<tr><td>{{.Name}}</td><td>{{.Total}}</td>
+<td class="ids added">{{range .Added}}{{.}} {{end}}</td>
+<td class="ids removed">{{range .Removed}}{{.}} {{end}}</td>
+<td class="ids changed">{{range .Changed}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+
+{{if .Pictures}}<h2>Pictures</h2>
+<p>Changed pictures show old, new, and new with differing pixels in magenta.</p>
+<table><tr><th>ID</th><th>Status</th><th>Old</th><th>New</th><th>Comparison</th></tr>
+{{range .Pictures}}<tr><td>{{.ID}}</td><td class="{{.Status}}">{{.Status}}{{range .Parts}}<br>{{.}}{{end}}{{if .Pixels}}<br>{{.Pixels}} px{{end}}</td>
+<td>{{.OldSize}}</td><td>{{.NewSize}}</td><td>{{with .Image}}<img src="{{.}}" alt="">{{end}}</td></tr>
+{{end}}</table>{{end}}
+
+{{if .Items}}<h2>Items</h2>
+<table><tr><th>ID</th><th>Status</th><th>Old name</th><th>New name</th></tr>
+{{range .Items}}<tr><td>{{.ID}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.OldName}}</td><td>{{.NewName}}</td></tr>
+{{end}}</table>{{end}}
+
+{{if .Sounds}}<h2>Sounds</h2>
+<table><tr><th>ID</th><th>Status</th><th>Old</th><th>New</th></tr>
+{{range .Sounds}}<tr><td>{{.ID}}</td><td class="{{.Status}}">{{.Status}}</td>
+<td>{{.OldInfo}}{{with .OldAudio}}<br><audio controls preload="none" src="{{.}}"></audio>{{end}}</td>
+<td>{{.NewInfo}}{{with .NewAudio}}<br><audio controls preload="none" src="{{.}}"></audio>{{end}}</td></tr>
+{{end}}</table>{{end}}
+</body></html>
+`))
+
+func writeDiffReport(path string, d *keyDiff) error {
+	var buf bytes.Buffer
+	if err := diffReportTmpl.Execute(&buf, d); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
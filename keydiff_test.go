@@ -0,0 +1,123 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gothoom/climg"
+	"gothoom/keyfile"
+)
+
+func TestDiffRecords(t *testing.T) {
+	a, b := keyfile.New(), keyfile.New()
+	a.Put(1, 1, []byte("same"))
+	a.Put(1, 2, []byte("old"))
+	a.Put(1, 3, []byte("gone"))
+	a.Put(2, 1, []byte("x"))
+	b.Put(1, 1, []byte("same"))
+	b.Put(1, 2, []byte("new"))
+	b.Put(1, 4, []byte("fresh"))
+	b.Put(2, 1, []byte("x"))
+
+	got := diffRecords(a, b)
+	if len(got) != 2 {
+		t.Fatalf("got %d types, want 2", len(got))
+	}
+	d := got[0]
+	if d.Type != 1 || d.Total != 3 || !slices.Equal(d.Added, []uint32{4}) ||
+		!slices.Equal(d.Removed, []uint32{3}) || !slices.Equal(d.Changed, []uint32{2}) {
+		t.Errorf("type 1 = %+v", d)
+	}
+	if d := got[1]; d.Added != nil || d.Removed != nil || d.Changed != nil {
+		t.Errorf("type 2 = %+v, want no differences", d)
+	}
+	if n := fourCC(climg.TYPE_IMAGE); n != "Bit2" {
+		t.Errorf("fourCC = %q", n)
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b.SetRGBA(1, 1, color.RGBA{255, 0, 0, 255})
+	img, n := sideBySide(a, b)
+	if n != 1 {
+		t.Errorf("differing pixels = %d, want 1", n)
+	}
+	if w := img.Bounds().Dx(); w != 3*2+4*diffGap {
+		t.Errorf("width = %d", w)
+	}
+	mark := image.Pt(diffGap+2*(2+diffGap)+1, diffGap+1)
+	if got := img.RGBAAt(mark.X, mark.Y); got != diffMarked {
+		t.Errorf("marked pixel = %v", got)
+	}
+	if img, _ := sideBySide(nil, b); img.Bounds().Dx() != 2+2*diffGap {
+		t.Errorf("added picture width = %d", img.Bounds().Dx())
+	}
+	if _, n := sideBySide(a, image.NewRGBA(image.Rect(0, 0, 3, 2))); n != 2 {
+		t.Errorf("resized differing pixels = %d, want 2", n)
+	}
+}
+
+func TestDiffPicturesReport(t *testing.T) {
+	// A 2x1 picture: one literal run of two 2-bit pixels.
+	build := func(bits byte, extra bool) string {
+		w := climg.NewWriter()
+		w.PutImage(20, []byte{0, 1, 0, 2, 0, 0, 0, 0, 2, 1, bits})
+		w.PutColors(30, []byte{0, 1, 2, 3})
+		for _, id := range []uint32{10, 11} {
+			if err := w.PutPictDef(id, climg.PictDef{Version: climg.PictDefVersion, ImageID: 20, ColorID: 30}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if extra {
+			if err := w.PutPictDef(12, climg.PictDef{Version: climg.PictDefVersion, ImageID: 20, ColorID: 30}); err != nil {
+				t.Fatal(err)
+			}
+			w.PutItem(5, climg.ClientItem{Name: "Gem"})
+		}
+		return writeTemp(t, w.Bytes())
+	}
+	oldPath, newPath := build(0xd8, false), build(0xdc, true)
+
+	out := t.TempDir()
+	if code := runKeyDiff([]string{"-out", out, oldPath, newPath}); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	oldKF, _ := keyfile.ReadFile(oldPath)
+	newKF, _ := keyfile.ReadFile(newPath)
+	oldImgs, _ := climg.Load(oldPath)
+	newImgs, _ := climg.Load(newPath)
+	pics := diffPictures(oldKF, newKF, oldImgs, newImgs)
+	var statuses []string
+	for _, p := range pics {
+		statuses = append(statuses, p.Status)
+	}
+	if !slices.Equal(statuses, []string{"changed", "changed", "added"}) {
+		t.Errorf("statuses = %v", statuses)
+	}
+	if len(pics) > 0 && !slices.Equal(pics[0].Parts, []string{"definition", "bits"}) {
+		t.Errorf("parts = %v", pics[0].Parts)
+	}
+	if items := diffItems(oldImgs, newImgs); len(items) != 1 || items[0].Status != "added" || items[0].NewName != "Gem" {
+		t.Errorf("items = %+v", items)
+	}
+
+	html, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Bit2", "pictures/10.png", "pictures/12.png", "Gem"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("report lacks %q", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "pictures", "11.png")); err != nil {
+		t.Error(err)
+	}
+}
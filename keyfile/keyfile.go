@@ -0,0 +1,243 @@
+// Package keyfile reads and writes Delta Tao keyfiles, the container format
+// behind CL_Images and CL_Sounds.
+//
+// A keyfile starts with a 12 byte header, followed by a table of 16 byte
+// entries (offset, size, type, ID) sorted by type and then ID. Record data
+// may sit anywhere after the table. Files parsed with Parse remember where
+// every record and every unused byte was, so writing an unmodified File
+// reproduces the input exactly.
+package keyfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	headerSize = 12
+	entrySize  = 16
+
+	// Version32 marks a keyfile with 32-bit IDs, the only kind in use.
+	Version32 = -1
+	// CurrentVersion2 is the table version written by the original tools.
+	CurrentVersion2 = 2
+)
+
+// Record is one typed, numbered blob in a keyfile.
+type Record struct {
+	Type uint32
+	ID   uint32
+	Data []byte
+
+	// pos is where Data was found by Parse, or 0 for records that were
+	// added or replaced since.
+	pos uint32
+}
+
+// File is a keyfile held in memory.
+type File struct {
+	Version  int16 // Version32 for every current file
+	NotUsed  int32 // header field ignored by readers; -1 when created
+	Version2 int16 // CurrentVersion2
+
+	records []Record
+	// free holds the bytes of the parsed file not covered by the header,
+	// the table or any record.
+	free []span
+	// size is the length of the parsed file.
+	size int
+}
+
+type span struct {
+	off  int
+	data []byte
+}
+
+// New returns an empty keyfile with the header the original tools write.
+func New() *File {
+	return &File{Version: Version32, NotUsed: -1, Version2: CurrentVersion2}
+}
+
+// ReadFile parses the keyfile at path.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a keyfile. Record data is copied, so data may be reused.
+func Parse(data []byte) (*File, error) {
+	if len(data) < headerSize {
+		return nil, errors.New("keyfile: short header")
+	}
+	f := &File{
+		Version:  int16(binary.BigEndian.Uint16(data[0:])),
+		NotUsed:  int32(binary.BigEndian.Uint32(data[6:])),
+		Version2: int16(binary.BigEndian.Uint16(data[10:])),
+		size:     len(data),
+	}
+	if f.Version != Version32 {
+		return nil, fmt.Errorf("keyfile: unsupported version %d", f.Version)
+	}
+	count := binary.BigEndian.Uint32(data[2:])
+	tableEnd := headerSize + int(count)*entrySize
+	if tableEnd > len(data) || tableEnd < headerSize {
+		return nil, errors.New("keyfile: truncated table")
+	}
+	f.records = make([]Record, count)
+	for i := range f.records {
+		e := data[headerSize+i*entrySize:]
+		off := binary.BigEndian.Uint32(e[0:])
+		size := binary.BigEndian.Uint32(e[4:])
+		end := uint64(off) + uint64(size)
+		if end > uint64(len(data)) || int(off) < tableEnd {
+			return nil, fmt.Errorf("keyfile: record %d out of range", i)
+		}
+		f.records[i] = Record{
+			Type: binary.BigEndian.Uint32(e[8:]),
+			ID:   binary.BigEndian.Uint32(e[12:]),
+			Data: append([]byte(nil), data[off:end]...),
+			pos:  off,
+		}
+	}
+	if !sort.SliceIsSorted(f.records, f.less) {
+		// Version 1 tables were not kept sorted; the original library
+		// sorts them on open as well.
+		sort.SliceStable(f.records, f.less)
+	}
+
+	// Whatever no record covers is kept so it can be written back.
+	byPos := make([]Record, len(f.records), len(f.records)+1)
+	copy(byPos, f.records)
+	sort.Slice(byPos, func(i, j int) bool { return byPos[i].pos < byPos[j].pos })
+	next := tableEnd
+	for _, r := range append(byPos, Record{pos: uint32(len(data))}) {
+		if start := int(r.pos); start > next {
+			f.free = append(f.free, span{off: next, data: append([]byte(nil), data[next:start]...)})
+		}
+		next = max(next, int(r.pos)+len(r.Data))
+	}
+	return f, nil
+}
+
+// Records returns the records in table order. The slice must not be
+// modified; use Put and Delete instead.
+func (f *File) Records() []Record { return f.records }
+
+func (f *File) less(i, j int) bool {
+	a, b := f.records[i], f.records[j]
+	return a.Type < b.Type || (a.Type == b.Type && a.ID < b.ID)
+}
+
+func (f *File) find(typ, id uint32) (int, bool) {
+	i := sort.Search(len(f.records), func(i int) bool {
+		r := f.records[i]
+		return r.Type > typ || (r.Type == typ && r.ID >= id)
+	})
+	return i, i < len(f.records) && f.records[i].Type == typ && f.records[i].ID == id
+}
+
+// Get returns the data of the record with the given type and ID.
+func (f *File) Get(typ, id uint32) ([]byte, bool) {
+	if i, ok := f.find(typ, id); ok {
+		return f.records[i].Data, true
+	}
+	return nil, false
+}
+
+// IDs returns the IDs of all records of typ in ascending order.
+func (f *File) IDs(typ uint32) []uint32 {
+	var ids []uint32
+	for _, r := range f.records {
+		if r.Type == typ {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// Put adds a record or replaces the data of an existing one.
+func (f *File) Put(typ, id uint32, data []byte) {
+	r := Record{Type: typ, ID: id, Data: append([]byte(nil), data...)}
+	i, ok := f.find(typ, id)
+	if ok {
+		f.records[i] = r
+		return
+	}
+	f.records = append(f.records, Record{})
+	copy(f.records[i+1:], f.records[i:])
+	f.records[i] = r
+}
+
+// Delete removes a record and reports whether it existed.
+func (f *File) Delete(typ, id uint32) bool {
+	i, ok := f.find(typ, id)
+	if ok {
+		f.records = append(f.records[:i], f.records[i+1:]...)
+	}
+	return ok
+}
+
+// Compact forgets the parsed layout so the next Bytes packs records
+// back to back in table order.
+func (f *File) Compact() {
+	for i := range f.records {
+		f.records[i].pos = 0
+	}
+	f.free = nil
+	f.size = 0
+}
+
+// Bytes encodes the keyfile. Records that are unchanged since Parse keep
+// their offsets and unused space keeps its old contents; new or changed
+// records, and any that the table would now overlap, are appended in table
+// order.
+func (f *File) Bytes() []byte {
+	tableEnd := headerSize + len(f.records)*entrySize
+	end := max(f.size, tableEnd)
+	offsets := make([]int, len(f.records))
+	for i, r := range f.records {
+		if r.pos != 0 && int(r.pos) >= tableEnd {
+			offsets[i] = int(r.pos)
+		} else {
+			offsets[i] = -1
+		}
+	}
+	for i, r := range f.records {
+		if offsets[i] < 0 {
+			offsets[i] = end
+			end += len(r.Data)
+		}
+	}
+
+	out := make([]byte, end)
+	for _, s := range f.free {
+		lo := max(s.off, tableEnd)
+		if hi := s.off + len(s.data); lo < hi {
+			copy(out[lo:hi], s.data[lo-s.off:])
+		}
+	}
+	binary.BigEndian.PutUint16(out[0:], uint16(f.Version))
+	binary.BigEndian.PutUint32(out[2:], uint32(len(f.records)))
+	binary.BigEndian.PutUint32(out[6:], uint32(f.NotUsed))
+	binary.BigEndian.PutUint16(out[10:], uint16(f.Version2))
+	for i, r := range f.records {
+		e := out[headerSize+i*entrySize:]
+		binary.BigEndian.PutUint32(e[0:], uint32(offsets[i]))
+		binary.BigEndian.PutUint32(e[4:], uint32(len(r.Data)))
+		binary.BigEndian.PutUint32(e[8:], r.Type)
+		binary.BigEndian.PutUint32(e[12:], r.ID)
+		copy(out[offsets[i]:], r.Data)
+	}
+	return out
+}
+
+// WriteFile encodes the keyfile to path.
+func (f *File) WriteFile(path string) error {
+	return os.WriteFile(path, f.Bytes(), 0644)
+}
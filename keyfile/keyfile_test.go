@@ -0,0 +1,130 @@
+package keyfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// rawKeyfile builds a keyfile by hand with the given table entries and a
+// data area, so tests can control layout and leftover bytes.
+func rawKeyfile(entries [][4]uint32, area []byte) []byte {
+	buf := make([]byte, headerSize+len(entries)*entrySize)
+	binary.BigEndian.PutUint16(buf[0:], 0xffff)
+	binary.BigEndian.PutUint32(buf[2:], uint32(len(entries)))
+	binary.BigEndian.PutUint32(buf[6:], 0xdeadbeef)
+	binary.BigEndian.PutUint16(buf[10:], CurrentVersion2)
+	for i, e := range entries {
+		for j, v := range e {
+			binary.BigEndian.PutUint32(buf[headerSize+i*entrySize+4*j:], v)
+		}
+	}
+	return append(buf, area...)
+}
+
+func TestRoundTripPreservesLayout(t *testing.T) {
+	const base = headerSize + 2*entrySize
+	// Records out of position order, with stale bytes before, between and
+	// after them.
+	area := []byte("xxBBBBzzAAAyy")
+	data := rawKeyfile([][4]uint32{
+		{base + 8, 3, 1, 5},
+		{base + 2, 4, 2, 1},
+	}, area)
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, _ := f.Get(1, 5); string(got) != "AAA" {
+		t.Errorf("Get(1,5) = %q", got)
+	}
+	if got := f.Bytes(); !bytes.Equal(got, data) {
+		t.Errorf("round trip differs:\n got %q\nwant %q", got, data)
+	}
+}
+
+func TestPutKeepsOtherRecords(t *testing.T) {
+	f := New()
+	f.Put(2, 1, []byte("two"))
+	f.Put(1, 9, []byte("nine"))
+	f.Put(1, 3, []byte("three"))
+	f2, err := Parse(f.Bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var order []uint32
+	for _, r := range f2.Records() {
+		order = append(order, r.Type<<8|r.ID)
+	}
+	if want := []uint32{1<<8 | 3, 1<<8 | 9, 2<<8 | 1}; !slices.Equal(order, want) {
+		t.Errorf("table order = %x, want %x", order, want)
+	}
+
+	before := f2.Bytes()
+	f2.Put(1, 9, []byte("NINE!"))
+	after := f2.Bytes()
+	if !bytes.HasPrefix(after[len(before):], []byte("NINE!")) {
+		t.Errorf("changed record not appended: %q", after[len(before):])
+	}
+	f3, err := Parse(after)
+	if err != nil {
+		t.Fatalf("Parse after Put: %v", err)
+	}
+	for _, r := range f3.Records() {
+		if r.ID == 3 && r.pos != f2.records[0].pos {
+			t.Errorf("unchanged record moved from %d to %d", f2.records[0].pos, r.pos)
+		}
+	}
+	if got, _ := f3.Get(1, 9); string(got) != "NINE!" {
+		t.Errorf("Get(1,9) = %q", got)
+	}
+
+	if !f3.Delete(2, 1) || f3.Delete(2, 1) {
+		t.Error("Delete did not report existence correctly")
+	}
+	f3.Compact()
+	f4, err := Parse(f3.Bytes())
+	if err != nil {
+		t.Fatalf("Parse after Compact: %v", err)
+	}
+	if n := len(f4.Bytes()); n != headerSize+2*entrySize+len("three")+len("NINE!") {
+		t.Errorf("compacted size = %d", n)
+	}
+	if ids := f4.IDs(1); !slices.Equal(ids, []uint32{3, 9}) {
+		t.Errorf("IDs(1) = %v", ids)
+	}
+}
+
+func TestTableGrowthMovesOverlappedRecords(t *testing.T) {
+	f := New()
+	f.Put(1, 1, []byte("first"))
+	parsed, err := Parse(f.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second entry makes the table cover where "first" was stored.
+	parsed.Put(1, 2, []byte("second"))
+	out, err := Parse(parsed.Bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for id, want := range map[uint32]string{1: "first", 2: "second"} {
+		if got, _ := out.Get(1, id); string(got) != want {
+			t.Errorf("Get(1,%d) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestParseRejectsBadFiles(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short":    {0xff, 0xff},
+		"version":  append([]byte{0, 0}, rawKeyfile(nil, nil)[2:]...),
+		"table":    rawKeyfile([][4]uint32{{0, 0, 1, 1}}, nil)[:headerSize+4],
+		"overflow": rawKeyfile([][4]uint32{{headerSize + entrySize, 10, 1, 1}}, []byte("abc")),
+	} {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
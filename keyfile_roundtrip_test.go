@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gothoom/climg"
+	"gothoom/clsnd"
+)
+
+// TestShippedKeyfilesRoundTrip rewrites the real data files through the
+// writers and expects identical bytes, then rebuilds each picture definition
+// and item from its decoded form. It skips when the files are not present.
+func TestShippedKeyfilesRoundTrip(t *testing.T) {
+	t.Run("CL_Images", func(t *testing.T) {
+		path := filepath.Join(dataDirPath, CL_ImagesFile)
+		orig, err := os.ReadFile(path)
+		if err != nil {
+			t.Skipf("CL_Images not available: %v", err)
+		}
+		imgs, err := climg.Load(path)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		w, err := imgs.Writer()
+		if err != nil {
+			t.Fatalf("writer: %v", err)
+		}
+		if !bytes.Equal(w.Bytes(), orig) {
+			t.Error("rewritten CL_Images differs from the original")
+		}
+	})
+	t.Run("CL_Sounds", func(t *testing.T) {
+		path := filepath.Join(dataDirPath, CL_SoundsFile)
+		orig, err := os.ReadFile(path)
+		if err != nil {
+			t.Skipf("CL_Sounds not available: %v", err)
+		}
+		snds, err := clsnd.Load(path)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		w, err := snds.Writer()
+		if err != nil {
+			t.Fatalf("writer: %v", err)
+		}
+		if !bytes.Equal(w.Bytes(), orig) {
+			t.Error("rewritten CL_Sounds differs from the original")
+		}
+	})
+	t.Run("CL_Images records", func(t *testing.T) {
+		path := filepath.Join(dataDirPath, CL_ImagesFile)
+		if _, err := os.Stat(path); err != nil {
+			t.Skipf("CL_Images not available: %v", err)
+		}
+		imgs, err := climg.Load(path)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		checkRecordsRebuild(t, imgs)
+		checkCompactRebuild(t, imgs)
+	})
+}
+
+// fixtureImages is a small CL_Images written by
+// scripts/make_keyfile_fixture.py, independently of the climg writers.
+var fixtureImages = filepath.Join("testdata", "keyfile", "CL_Images")
+
+// TestKeyfileFixtureRoundTrip runs the CL_Images checks against the
+// committed fixture, so they do not depend on the shipped data files.
+func TestKeyfileFixtureRoundTrip(t *testing.T) {
+	orig, err := os.ReadFile(fixtureImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgs, err := climg.Load(fixtureImages)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	w, err := imgs.Writer()
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if !bytes.Equal(w.Bytes(), orig) {
+		t.Error("rewritten fixture differs from the original")
+	}
+	for _, typ := range []uint32{climg.TYPE_IDREF, climg.TYPE_IMAGE, climg.TYPE_COLOR, climg.TYPE_LIGHT, climg.TYPE_CLIENT_ITEM} {
+		if len(w.Keyfile().IDs(typ)) == 0 {
+			t.Errorf("fixture has no %08x records", typ)
+		}
+	}
+	checkRecordsRebuild(t, imgs)
+	checkCompactRebuild(t, imgs)
+}
+
+// checkCompactRebuild builds a new CL_Images from nothing but the decoded,
+// exported values of every image, color, lighting, picture definition and
+// item record of imgs, and compares it with imgs compacted.
+func checkCompactRebuild(t *testing.T, imgs *climg.CLImages) {
+	t.Helper()
+	orig, err := imgs.Writer()
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	kf := orig.Keyfile()
+	w := climg.NewWriter()
+	for _, id := range kf.IDs(climg.TYPE_IMAGE) {
+		b, err := imgs.ImageBits(id)
+		if err != nil {
+			t.Errorf("image %d: %v", id, err)
+			continue
+		}
+		if err := w.PutBits(id, b); err != nil {
+			t.Errorf("image %d: %v", id, err)
+		}
+	}
+	for _, id := range kf.IDs(climg.TYPE_COLOR) {
+		colors, ok := imgs.Colors(id)
+		if !ok {
+			t.Errorf("colors %d not loaded", id)
+			continue
+		}
+		w.PutColors(id, colors)
+	}
+	for _, id := range kf.IDs(climg.TYPE_LIGHT) {
+		light, ok := imgs.Light(id)
+		if !ok {
+			t.Errorf("lighting %d not loaded", id)
+			continue
+		}
+		w.PutLight(id, light)
+	}
+	for _, id := range kf.IDs(climg.TYPE_IDREF) {
+		d, ok := imgs.PictDef(id)
+		if !ok {
+			t.Errorf("pict %d not loaded", id)
+			continue
+		}
+		err := w.PutPictDef(id, climg.PictDef{
+			Version:      d.Version,
+			ImageID:      d.ImageID,
+			ColorID:      d.ColorID,
+			Checksum:     d.Checksum,
+			Flags:        d.Flags,
+			UnusedFlags:  d.UnusedFlags,
+			UnusedFlags2: d.UnusedFlags2,
+			LightingID:   d.LightingID,
+			Plane:        d.Plane,
+			NumFrames:    d.NumFrames,
+			AnimFrames:   d.AnimFrames,
+		})
+		if err != nil {
+			t.Errorf("pict %d: %v", id, err)
+		}
+	}
+	for _, id := range kf.IDs(climg.TYPE_CLIENT_ITEM) {
+		it, ok := imgs.Item(id)
+		if !ok {
+			t.Errorf("item %d not loaded", id)
+			continue
+		}
+		w.PutItem(id, climg.ClientItem{
+			Flags:           it.Flags,
+			Slot:            it.Slot,
+			RightHandPictID: it.RightHandPictID,
+			LeftHandPictID:  it.LeftHandPictID,
+			WornPictID:      it.WornPictID,
+			Name:            it.Name,
+		})
+	}
+
+	kf.Compact()
+	if bytes.Equal(w.Bytes(), orig.Bytes()) {
+		return
+	}
+	for _, r := range kf.Records() {
+		got, ok := w.Keyfile().Get(r.Type, r.ID)
+		if !ok {
+			t.Errorf("%08x %d: not rebuilt", r.Type, r.ID)
+		} else if !bytes.Equal(got, r.Data) {
+			t.Errorf("%08x %d: rebuilt % x, want % x", r.Type, r.ID, got, r.Data)
+		}
+	}
+	if n, want := len(w.Keyfile().Records()), len(kf.Records()); n != want {
+		t.Errorf("rebuilt %d records, want %d", n, want)
+	}
+	t.Error("rebuilt CL_Images differs from the compacted original")
+}
+
+// checkRecordsRebuild rebuilds every picture definition of imgs through
+// PutPictDef and every item through PutItem, and compares each with the
+// record it came from, checksum included.
+func checkRecordsRebuild(t *testing.T, imgs *climg.CLImages) {
+	t.Helper()
+	orig, err := imgs.Writer()
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	w, err := imgs.Writer()
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	kf := orig.Keyfile()
+	for _, id := range kf.IDs(climg.TYPE_IDREF) {
+		want, _ := kf.Get(climg.TYPE_IDREF, id)
+		d, ok := imgs.PictDef(id)
+		if !ok {
+			t.Errorf("pict %d not loaded", id)
+			continue
+		}
+		if err := w.PutPictDef(id, d); err != nil {
+			t.Errorf("pict %d: %v", id, err)
+			continue
+		}
+		if got, _ := w.Keyfile().Get(climg.TYPE_IDREF, id); !bytes.Equal(got, want) {
+			t.Errorf("pict %d: rebuilt % x, want % x", id, got, want)
+		}
+	}
+	for _, id := range kf.IDs(climg.TYPE_CLIENT_ITEM) {
+		want, _ := kf.Get(climg.TYPE_CLIENT_ITEM, id)
+		it, ok := imgs.Item(id)
+		if !ok {
+			t.Errorf("item %d not loaded", id)
+			continue
+		}
+		w.PutItem(id, it)
+		if got, _ := w.Keyfile().Get(climg.TYPE_CLIENT_ITEM, id); !bytes.Equal(got, want) {
+			t.Errorf("item %d: rebuilt % x, want % x", id, got, want)
+		}
+	}
+}
+
+func TestImagesWriterPictDef(t *testing.T) {
+	w := climg.NewWriter()
+	w.PutImage(20, []byte{0, 4, 0, 4, 0, 0, 1, 2, 3})
+	w.PutColors(30, []byte{0, 1, 2, 3})
+	if err := w.PutPictDef(10, climg.PictDef{ImageID: 20, ColorID: 99}); err == nil {
+		t.Error("missing colors accepted")
+	}
+	want := climg.PictDef{
+		Version:    climg.PictDefVersion,
+		ImageID:    20,
+		ColorID:    30,
+		Flags:      0x8000,
+		Plane:      -3,
+		NumFrames:  2,
+		AnimFrames: []int16{0, 1, 1},
+	}
+	if err := w.PutPictDef(10, want); err != nil {
+		t.Fatal(err)
+	}
+	w.PutItem(5, climg.ClientItem{Name: "Wooden Shield", Slot: 3, WornPictID: 10})
+
+	path := filepath.Join(t.TempDir(), "CL_Images")
+	if err := w.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	imgs, err := climg.Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	got, ok := imgs.PictDef(10)
+	if !ok {
+		t.Fatal("pict 10 missing")
+	}
+	if got.Checksum == 0 {
+		t.Error("checksum not filled in")
+	}
+	want.Checksum = got.Checksum
+	if got.ImageID != want.ImageID || got.ColorID != want.ColorID || got.Flags != want.Flags ||
+		got.Plane != want.Plane || got.NumFrames != want.NumFrames || !slices.Equal(got.AnimFrames, want.AnimFrames) {
+		t.Errorf("PictDef = %+v, want %+v", got, want)
+	}
+	if it, ok := imgs.Item(5); !ok || it.Name != "Wooden Shield" || it.Slot != 3 || it.WornPictID != 10 {
+		t.Errorf("Item(5) = %+v, %v", it, ok)
+	}
+
+	// The checksum covers the image bits.
+	w.PutImage(20, []byte{0, 4, 0, 4, 0, 0, 1, 2, 4})
+	if err := w.PutPictDef(10, want); err != nil {
+		t.Fatal(err)
+	}
+	imgs2, err := climg.Load(writeTemp(t, w.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := imgs2.PictDef(10); d.Checksum == got.Checksum {
+		t.Error("checksum unchanged after editing the bits")
+	}
+}
+
+// pictDefNoChecksum is the PictDef flag that turns off checksum checks.
+const pictDefNoChecksum = 0x0400
+
+// TestRecordsRebuildKeepsStoredFields rebuilds records that store more than
+// the writer would: a full animation table and a padded item name.
+func TestRecordsRebuildKeepsStoredFields(t *testing.T) {
+	w := climg.NewWriter()
+	w.PutImage(20, []byte{0, 4, 0, 4, 0, 0, 1, 2, 3})
+	w.PutColors(30, []byte{0, 1, 2, 3})
+	if err := w.PutPictDef(10, climg.PictDef{Version: climg.PictDefVersion, ImageID: 20, ColorID: 30, NumFrames: 2, AnimFrames: []int16{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.PutPictDef(11, climg.PictDef{Version: climg.PictDefVersion, ImageID: 20, ColorID: 30}); err != nil {
+		t.Fatal(err)
+	}
+	// Pad pict 10 to the full 16-entry table, with leftovers past the
+	// used entries.
+	rec, _ := w.Keyfile().Get(climg.TYPE_IDREF, 10)
+	rec = append(slices.Clone(rec), make([]byte, 2*14)...)
+	rec[len(rec)-1] = 7
+	w.Keyfile().Put(climg.TYPE_IDREF, 10, rec)
+	// Pict 11 turns the checksum off and stores none.
+	rec, _ = w.Keyfile().Get(climg.TYPE_IDREF, 11)
+	rec = slices.Clone(rec)
+	binary.BigEndian.PutUint32(rec[12:], 0)
+	binary.BigEndian.PutUint32(rec[16:], pictDefNoChecksum)
+	w.Keyfile().Put(climg.TYPE_IDREF, 11, rec)
+	w.PutItem(5, climg.ClientItem{Name: "Wooden Shield", Slot: 3, WornPictID: 10})
+	// Item 6 stores the whole 256-byte name field, with a longer name's
+	// leftovers after the terminator.
+	item := make([]byte, 20+256)
+	copy(item[20:], "Axe\x00Battle Axe")
+	w.Keyfile().Put(climg.TYPE_CLIENT_ITEM, 6, item)
+
+	imgs, err := climg.Load(writeTemp(t, w.Bytes()))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if d, _ := imgs.PictDef(10); !slices.Equal(d.AnimFrames, []int16{0, 1}) {
+		t.Errorf("AnimFrames = %v", d.AnimFrames)
+	}
+	if it, _ := imgs.Item(6); it.Name != "Axe" {
+		t.Errorf("item name = %q", it.Name)
+	}
+	checkRecordsRebuild(t, imgs)
+
+	// Edits still land in the stored fields.
+	w2, err := imgs.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, _ := imgs.Item(6)
+	it.Name = "Battle Axe Deluxe"
+	w2.PutItem(6, it)
+	d, _ := imgs.PictDef(10)
+	d.AnimFrames = []int16{1, 0, 1}
+	if err := w2.PutPictDef(10, d); err != nil {
+		t.Fatal(err)
+	}
+	imgs2, err := climg.Load(writeTemp(t, w2.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := imgs2.Item(6); got.Name != it.Name {
+		t.Errorf("edited name = %q", got.Name)
+	}
+	if got, _ := w2.Keyfile().Get(climg.TYPE_CLIENT_ITEM, 6); len(got) != len(item) {
+		t.Errorf("edited item is %d bytes, want %d", len(got), len(item))
+	}
+	if got, _ := imgs2.PictDef(10); !slices.Equal(got.AnimFrames, d.AnimFrames) {
+		t.Errorf("edited AnimFrames = %v", got.AnimFrames)
+	}
+	if got, _ := w2.Keyfile().Get(climg.TYPE_IDREF, 10); len(got) != 38+2*16 || got[len(got)-1] != 7 {
+		t.Errorf("edited pict record = % x", got)
+	}
+}
+
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keyfile")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -39,6 +39,13 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "extract" {
+		os.Exit(runExtract(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runKeyDiff(os.Args[2:]))
+	}
+
 	flag.StringVar(&clmov, "clmov", "", "play back a .clMov file")
 	flag.StringVar(&pcapPath, "pcap", "", "replay network frames from a .pcap/.pcapng file")
 	clientVer := flag.Int("client-version", 1445, "client version number (for testing)")
@@ -76,6 +83,7 @@ func main() {
 
 	loadStats()
 	defer saveStats()
+	defer closeTextLogs()
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 	if *genPGO {
@@ -106,6 +114,7 @@ func main() {
 		clImages.Denoise = gs.DenoiseImages
 		clImages.DenoiseSharpness = gs.DenoiseSharpness
 		clImages.DenoisePercent = gs.DenoisePercent
+		attachSpriteOverrides(clImages)
 	}
 
 	clSounds, err = clsnd.Load(filepath.Join("data/CL_Sounds"))
@@ -118,6 +127,9 @@ func main() {
 		go precacheAssets()
 	}
 
+	loadAutoMap()
+	loadHUD()
+
 	consoleMessage("Starting...")
 
 	go func() {
@@ -219,7 +231,7 @@ func playerFromDrawState(data []byte) string {
 		typ := data[p+1]
 		p += 4
 		if off := bytes.IndexByte(data[p:], 0); off >= 0 {
-			name := string(data[p : p+off])
+			name := decodeMacRoman(data[p : p+off])
 			p += off + 1
 			if p >= len(data) {
 				return ""
@@ -309,7 +321,7 @@ func firstDescriptorName(data []byte) string {
 	}
 	p += 4
 	if idx := bytes.IndexByte(data[p:], 0); idx >= 0 {
-		return string(data[p : p+idx])
+		return decodeMacRoman(data[p : p+idx])
 	}
 	return ""
 }
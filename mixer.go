@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// soundCategory groups sounds that share a volume setting. Higher
+// categories win when voices are stolen.
+type soundCategory int
+
+const (
+	soundGame soundCategory = iota
+	soundMusic
+	soundAlert
+	numSoundCategories
+)
+
+const (
+	maxVoices      = 32
+	stealFadeSecs  = 0.005
+	duckGain       = 0.35 // about -9 dB under alerts
+	duckAttackSecs = 0.05
+	duckReleaseSec = 0.4
+	limiterCeiling = 0.89 // about -1 dBFS
+	limiterRelease = 0.15 // seconds to recover from full reduction
+)
+
+// mixVoice is one sound playing in the mixer. Its PCM is 16-bit stereo
+// frames as returned by loadSound.
+type mixVoice struct {
+	pcm  []byte
+	pos  int
+	cat  soundCategory
+	seq  uint64
+	fade int // frames left while fading out a stolen voice
+	done bool
+}
+
+// audioMixer mixes every sound into one stream so a single player runs for
+// the life of the client. It implements io.Reader for a float32 stereo
+// player.
+type audioMixer struct {
+	mu      sync.Mutex
+	rate    int
+	voices  []*mixVoice
+	gains   [numSoundCategories]float32
+	ducking bool
+	duck    float32 // current gain on ducked categories
+	env     float32 // current limiter gain
+	seq     uint64
+}
+
+var gMixer *audioMixer
+
+func newAudioMixer(rate int) *audioMixer {
+	m := &audioMixer{rate: rate, duck: 1, env: 1, ducking: true}
+	for i := range m.gains {
+		m.gains[i] = 1
+	}
+	return m
+}
+
+// setGains sets the master volume and the volume of each category.
+func (m *audioMixer) setGains(master float64, cats [numSoundCategories]float64, ducking bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, v := range cats {
+		m.gains[i] = float32(master * v)
+	}
+	m.ducking = ducking
+}
+
+// play starts the sounds together and returns their voices. When the mixer
+// is full, the oldest voice of the lowest category gives way; if every
+// playing voice outranks a sound, that sound is dropped and its voice is
+// nil.
+func (m *audioMixer) play(cat soundCategory, pcms ...[]byte) []*mixVoice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	voices := make([]*mixVoice, len(pcms))
+	for i, pcm := range pcms {
+		if len(pcm) < 4 {
+			continue
+		}
+		if m.activeLocked() >= maxVoices && !m.stealLocked(cat) {
+			logDebug("mixer full, dropping sound")
+			continue
+		}
+		m.seq++
+		v := &mixVoice{pcm: pcm, cat: cat, seq: m.seq}
+		m.voices = append(m.voices, v)
+		voices[i] = v
+	}
+	return voices
+}
+
+// activeLocked counts voices that are not fading out.
+func (m *audioMixer) activeLocked() int {
+	n := 0
+	for _, v := range m.voices {
+		if v.fade == 0 && !v.done {
+			n++
+		}
+	}
+	return n
+}
+
+// stealLocked fades out a voice to make room for a sound of cat.
+func (m *audioMixer) stealLocked(cat soundCategory) bool {
+	var victim *mixVoice
+	for _, v := range m.voices {
+		if v.fade != 0 || v.done || v.cat > cat {
+			continue
+		}
+		if victim == nil || v.cat < victim.cat || (v.cat == victim.cat && v.seq < victim.seq) {
+			victim = v
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	victim.fade = m.fadeFrames()
+	return true
+}
+
+func (m *audioMixer) fadeFrames() int {
+	return max(int(stealFadeSecs*float64(m.rate)), 1)
+}
+
+// stop fades out the given voices.
+func (m *audioMixer) stop(voices ...*mixVoice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range voices {
+		if v != nil && v.fade == 0 {
+			v.fade = m.fadeFrames()
+		}
+	}
+}
+
+// stopAll fades out every voice.
+func (m *audioMixer) stopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.voices {
+		if v.fade == 0 {
+			v.fade = m.fadeFrames()
+		}
+	}
+}
+
+// playing reports whether v is still sounding.
+func (m *audioMixer) playing(v *mixVoice) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return v != nil && !v.done
+}
+
+// active returns the number of voices sounding.
+func (m *audioMixer) active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.activeLocked()
+}
+
+// Read fills p with float32 little-endian stereo frames.
+func (m *audioMixer) Read(p []byte) (int, error) {
+	frames := len(p) / 8
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rate := float32(m.rate)
+	attack := 1 - float32(math.Exp(-1/(duckAttackSecs*float64(rate))))
+	release := 1 - float32(math.Exp(-1/(duckReleaseSec*float64(rate))))
+	limRelease := 1 - float32(math.Exp(-1/(limiterRelease*float64(rate))))
+	fadeLen := float32(m.fadeFrames())
+
+	alert := false
+	for _, v := range m.voices {
+		if v.cat == soundAlert && v.fade == 0 && v.pos+4 <= len(v.pcm) {
+			alert = true
+		}
+	}
+	target := float32(1)
+	if alert && m.ducking {
+		target = duckGain
+	}
+
+	for f := 0; f < frames; f++ {
+		if target < m.duck {
+			m.duck += (target - m.duck) * attack
+		} else {
+			m.duck += (target - m.duck) * release
+		}
+		var l, r float32
+		for _, v := range m.voices {
+			if v.done {
+				continue
+			}
+			if v.pos+4 > len(v.pcm) {
+				v.done = true
+				continue
+			}
+			g := m.gains[v.cat]
+			if v.cat == soundGame || v.cat == soundMusic {
+				g *= m.duck
+			}
+			if v.fade > 0 {
+				g *= float32(v.fade) / fadeLen
+				if v.fade--; v.fade == 0 {
+					v.done = true
+				}
+			}
+			l += float32(int16(binary.LittleEndian.Uint16(v.pcm[v.pos:]))) / 32768 * g
+			r += float32(int16(binary.LittleEndian.Uint16(v.pcm[v.pos+2:]))) / 32768 * g
+			v.pos += 4
+		}
+		l, r = m.limit(l, r, limRelease)
+		binary.LittleEndian.PutUint32(p[8*f:], math.Float32bits(l))
+		binary.LittleEndian.PutUint32(p[8*f+4:], math.Float32bits(r))
+	}
+
+	live := m.voices[:0]
+	for _, v := range m.voices {
+		if !v.done {
+			live = append(live, v)
+		}
+	}
+	clear(m.voices[len(live):])
+	m.voices = live
+	return frames * 8, nil
+}
+
+// limit is a peak limiter: gain drops at once to keep the frame under the
+// ceiling and recovers smoothly, so loud mixes compress instead of clip.
+func (m *audioMixer) limit(l, r, release float32) (float32, float32) {
+	m.env += (1 - m.env) * release
+	if peak := max(l, -l, r, -r); peak*m.env > limiterCeiling {
+		m.env = limiterCeiling / peak
+	}
+	return l * m.env, r * m.env
+}
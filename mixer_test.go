@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// constPCM returns frames of 16-bit stereo at a constant level.
+func constPCM(frames int, level int16) []byte {
+	pcm := make([]byte, frames*4)
+	for i := 0; i < frames*2; i++ {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(level))
+	}
+	return pcm
+}
+
+// readFrames mixes n frames and returns the left channel.
+func readFrames(t *testing.T, m *audioMixer, n int) []float32 {
+	t.Helper()
+	buf := make([]byte, n*8)
+	if got, _ := m.Read(buf); got != len(buf) {
+		t.Fatalf("read %d bytes, want %d", got, len(buf))
+	}
+	out := make([]float32, n)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[8*i:]))
+	}
+	return out
+}
+
+func TestMixerGains(t *testing.T) {
+	m := newAudioMixer(8000)
+	m.setGains(0.5, [numSoundCategories]float64{soundGame: 0.5, soundMusic: 1}, true)
+	m.play(soundGame, constPCM(10, 16384))
+	out := readFrames(t, m, 4)
+	if math.Abs(float64(out[0])-0.125) > 1e-6 {
+		t.Errorf("game level = %v, want 0.125", out[0])
+	}
+	readFrames(t, m, 10)
+	if n := m.active(); n != 0 {
+		t.Errorf("%d voices left after the sound ended", n)
+	}
+}
+
+func TestMixerLimiter(t *testing.T) {
+	m := newAudioMixer(8000)
+	for range 8 {
+		m.play(soundGame, constPCM(800, 30000))
+	}
+	for i, v := range readFrames(t, m, 800) {
+		if v > limiterCeiling+1e-6 || v < 0 {
+			t.Fatalf("frame %d = %v, want within (0, %v]", i, v, limiterCeiling)
+		}
+	}
+	// The limiter recovers once the mix is quiet again.
+	m.play(soundGame, constPCM(8000, 3277))
+	out := readFrames(t, m, 8000)
+	if v := out[len(out)-1]; math.Abs(float64(v)-0.1) > 1e-3 {
+		t.Errorf("quiet level after recovery = %v, want 0.1", v)
+	}
+}
+
+func TestMixerVoiceStealing(t *testing.T) {
+	m := newAudioMixer(8000)
+	var first *mixVoice
+	for i := 0; i < maxVoices; i++ {
+		v := m.play(soundGame, constPCM(1000, 100))[0]
+		if i == 0 {
+			first = v
+		}
+	}
+	if v := m.play(soundMusic, constPCM(1000, 100))[0]; v == nil {
+		t.Fatal("music dropped from a mixer full of game sounds")
+	}
+	if first.fade == 0 {
+		t.Error("oldest game sound not stolen")
+	}
+	readFrames(t, m, m.fadeFrames())
+	if m.playing(first) || m.active() != maxVoices {
+		t.Errorf("after the fade: stolen playing %v, %d active", m.playing(first), m.active())
+	}
+
+	full := newAudioMixer(8000)
+	for range maxVoices {
+		full.play(soundAlert, constPCM(1000, 100))
+	}
+	if v := full.play(soundGame, constPCM(1000, 100))[0]; v != nil {
+		t.Error("game sound stole an alert")
+	}
+}
+
+func TestMixerDucking(t *testing.T) {
+	m := newAudioMixer(8000)
+	m.play(soundMusic, constPCM(20000, 3277))
+	m.play(soundAlert, constPCM(4000, 0))
+	out := readFrames(t, m, 4000)
+	if v := out[len(out)-1]; math.Abs(float64(v)-0.1*duckGain) > 1e-3 {
+		t.Errorf("ducked music = %v, want %v", v, 0.1*duckGain)
+	}
+	// Music comes back over the release time.
+	out = readFrames(t, m, 12000)
+	if v := out[len(out)-1]; math.Abs(float64(v)-0.1) > 2e-3 {
+		t.Errorf("music after the alert = %v, want 0.1", v)
+	}
+
+	m = newAudioMixer(8000)
+	m.setGains(1, [numSoundCategories]float64{1, 1, 1}, false)
+	m.play(soundMusic, constPCM(4000, 3277))
+	m.play(soundAlert, constPCM(4000, 0))
+	if v := readFrames(t, m, 100)[99]; math.Abs(float64(v)-0.1) > 1e-3 {
+		t.Errorf("music with ducking off = %v", v)
+	}
+}
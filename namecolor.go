@@ -30,5 +30,5 @@ func mobileNameColors(code uint8) (text, bg, frame color.RGBA) {
 	if t >= len(nameTextColors) {
 		t = 0
 	}
-	return nameTextColors[t], nameBackColors[b], color.RGBA{0, 0, 0, 0xff}
+	return cbSceneRGBA(nameTextColors[t]), cbSceneRGBA(nameBackColors[b]), color.RGBA{0, 0, 0, 0xff}
 }
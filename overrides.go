@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gothoom/climg"
+)
+
+// Sprite override packs replace CL_Images artwork with PNGs dropped into
+// spriteOverrideDir. See climg.Overrides for the file and manifest format.
+
+var spriteOverrideDir = filepath.Join(dataDirPath, "overrides", "images")
+
+// overrideCheckInterval is how often the override directory is polled for
+// changes while the client runs.
+const overrideCheckInterval = time.Second
+
+// spriteOverridesChanged is set by watchSpriteOverrides when the pack on disk
+// changed and cleared by checkSpriteOverrides once the caches are dropped.
+var spriteOverridesChanged atomic.Bool
+
+// attachSpriteOverrides loads the override pack into c.
+func attachSpriteOverrides(c *climg.CLImages) {
+	o, err := climg.NewOverrides(spriteOverrideDir)
+	if err != nil {
+		logError("sprite overrides: %v", err)
+	}
+	c.SetOverrides(o)
+	if n := len(o.IDs()); n > 0 {
+		log.Printf("loaded %d sprite overrides from %s", n, spriteOverrideDir)
+	}
+}
+
+// watchSpriteOverrides rescans the override directory every
+// overrideCheckInterval. It runs in its own goroutine so the scan never
+// stalls a frame, and only flags changes for checkSpriteOverrides.
+func watchSpriteOverrides() {
+	for {
+		time.Sleep(overrideCheckInterval)
+		img := clImages
+		if img == nil {
+			continue
+		}
+		o := img.Overrides()
+		if o == nil {
+			continue
+		}
+		changed, err := o.Reload()
+		if err != nil {
+			logError("sprite overrides: %v", err)
+		}
+		if changed {
+			spriteOverridesChanged.Store(true)
+		}
+	}
+}
+
+// checkSpriteOverrides drops cached sprites after watchSpriteOverrides saw the
+// pack change. It runs from Update so textures are never released mid-draw.
+func checkSpriteOverrides() {
+	if !spriteOverridesChanged.Swap(false) {
+		return
+	}
+	clearCaches()
+	n := 0
+	if clImages != nil {
+		if o := clImages.Overrides(); o != nil {
+			n = len(o.IDs())
+		}
+	}
+	consoleMessage(fmt.Sprintf("Reloaded sprite overrides (%d pictures)", n))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gothoom/climg"
+)
+
+func writeOverridePNG(t *testing.T, path string, w, h int, clr func(x, y int) color.NRGBA) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, clr(x, y))
+		}
+	}
+	if err := writePNG(path, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpriteOverrideLayout(t *testing.T) {
+	dir := t.TempDir()
+	// Four 2x2 frames in a 2x2 grid, each frame a different red level.
+	writeOverridePNG(t, filepath.Join(dir, "7.png"), 4, 4, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: uint8(1 + x/2 + 2*(y/2)), A: 255}
+	})
+	manifest := `{"frames": 4, "columns": 2, "scale": 2}`
+	if err := os.WriteFile(filepath.Join(dir, "7.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o, err := climg.NewOverrides(dir)
+	if err != nil {
+		t.Fatalf("NewOverrides: %v", err)
+	}
+	c := &climg.CLImages{}
+	c.SetOverrides(o)
+
+	if c.OverrideRevision(7) == 0 || c.OverrideRevision(8) != 0 {
+		t.Fatalf("revisions = %d, %d", c.OverrideRevision(7), c.OverrideRevision(8))
+	}
+	if got := c.NumFrames(7); got != 4 {
+		t.Errorf("NumFrames = %d, want 4", got)
+	}
+	if got := c.Scale(7); got != 2 {
+		t.Errorf("Scale = %v, want 2", got)
+	}
+	if w, h := c.Size(7); w != 1 || h != 4 {
+		t.Errorf("Size = %dx%d, want 1x4 game pixels", w, h)
+	}
+	if got := c.FrameIndex(7, 5); got != 1 {
+		t.Errorf("FrameIndex(5) = %d, want 1", got)
+	}
+
+	img := c.GetRGBA(7, []byte{1, 2}, true)
+	if img == nil {
+		t.Fatal("GetRGBA returned nil")
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 10 {
+		t.Fatalf("sheet = %v, want 4x10 with border", b)
+	}
+	if got := img.RGBAAt(0, 0); got.A != 0 {
+		t.Errorf("border = %v, want transparent", got)
+	}
+	for f := 0; f < 4; f++ {
+		r := spriteFrameRect(img.Bounds(), 4, f)
+		if got := img.RGBAAt(r.Min.X, r.Min.Y).R; got != uint8(f+1) {
+			t.Errorf("frame %d red = %d, want %d", f, got, f+1)
+		}
+	}
+}
+
+func TestSpriteOverrideReload(t *testing.T) {
+	dir := t.TempDir()
+	o, err := climg.NewOverrides(filepath.Join(dir, "missing"))
+	if err != nil || len(o.IDs()) != 0 {
+		t.Fatalf("missing dir: ids %v, err %v", o.IDs(), err)
+	}
+
+	o, _ = climg.NewOverrides(dir)
+	c := &climg.CLImages{}
+	c.SetOverrides(o)
+	if changed, _ := o.Reload(); changed {
+		t.Error("empty reload reported a change")
+	}
+
+	path := filepath.Join(dir, "12.png")
+	solid := func(x, y int) color.NRGBA { return color.NRGBA{G: 200, A: 255} }
+	writeOverridePNG(t, path, 3, 3, solid)
+	if changed, err := o.Reload(); !changed || err != nil {
+		t.Fatalf("add: changed %v, err %v", changed, err)
+	}
+	rev := c.OverrideRevision(12)
+	if rev == 0 {
+		t.Fatal("override not picked up")
+	}
+	if changed, _ := o.Reload(); changed {
+		t.Error("unchanged reload reported a change")
+	}
+
+	writeOverridePNG(t, path, 5, 5, solid)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := o.Reload(); !changed || c.OverrideRevision(12) == rev {
+		t.Errorf("edit: changed %v, revision %d (was %d)", changed, c.OverrideRevision(12), rev)
+	}
+	if w, _ := c.Size(12); w != 5 {
+		t.Errorf("width after edit = %d, want 5", w)
+	}
+
+	// A broken file is reported once and then left alone until it changes.
+	if err := os.WriteFile(filepath.Join(dir, "13.png"), []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Reload(); err == nil {
+		t.Error("broken png: no error")
+	}
+	if _, err := o.Reload(); err != nil {
+		t.Errorf("broken png retried: %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := o.Reload(); !changed || c.OverrideRevision(12) != 0 {
+		t.Errorf("remove: changed %v, revision %d", changed, c.OverrideRevision(12))
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sync"
+
+	"gothoom/climg"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Custom-colored mobiles normally get a fully decoded sheet per color set.
+// The palette shader path keeps one indexed sheet per picture (the color
+// table index lives in the red channel) plus a 256 entry palette row per
+// color set, and lets the GPU resolve the final colors while drawing. It
+// also denoises like climg does on the CPU: each pixel is mixed in turn with
+// its left, right, upper and lower neighbours, more strongly the closer
+// their colors are. The neighbours are read from the whole sheet, as the
+// CPU pass sees it. With BlendMobiles it mixes in the previous frame the way
+// mobileBlendFrame does, so blending needs no recolored frames either.
+//
+// Index sheets are packed into indexAtlas and palettes share palette pages.
+// Every draw samples whole pages and passes the frame, palette row and
+// previous frame per vertex, so consecutive mobiles on the same pages have
+// the same source images and uniforms and Ebiten batches them into one draw
+// call.
+
+const paletteShaderSrc = `//kage:unit pixels
+
+package main
+
+// Denoise is the most a neighbour is mixed in; 0 turns denoising off.
+var Denoise float
+var Sharpness float
+
+// Mix is how far blended frames are from the previous frame to the current.
+var Mix float
+
+func dark(c vec4) bool {
+	return c.r*255 < 14.5 && c.g*255 < 14.5 && c.b*255 < 14.5
+}
+
+func blend(c, n vec4) vec4 {
+	if c.a < 1 || n.a < 1 || dark(c) || dark(n) {
+		return c
+	}
+	d := (c.rgb - n.rgb) * 255
+	nd := dot(d, d) / 195075
+	if nd >= 1 {
+		return c
+	}
+	p := Denoise * pow(1-nd, Sharpness)
+	return vec4(floor((c.rgb*(1-p)+n.rgb*p)*255)/255, 1)
+}
+
+// entry is the position of palette entry idx of row, relative to image 0.
+func entry(idx vec4, row float) vec2 {
+	return imageSrc0Origin() + vec2(floor(idx.r*255+0.5)+0.5, row+0.5)
+}
+
+// lookup colors pos of the index page in image 0 with the palette row of
+// image 1.
+func lookup(pos vec2, row float) vec4 {
+	c := imageSrc0UnsafeAt(pos)
+	if c.a == 0 {
+		return vec4(0)
+	}
+	return imageSrc1UnsafeAt(entry(c, row))
+}
+
+// lookupPrev is lookup for the previous frame, in images 2 and 3.
+func lookupPrev(pos vec2, row float) vec4 {
+	c := imageSrc2UnsafeAt(pos)
+	if c.a == 0 {
+		return vec4(0)
+	}
+	return imageSrc3UnsafeAt(entry(c, row))
+}
+
+func current(pos vec2, row float) vec4 {
+	c := lookup(pos, row)
+	if c.a == 0 || Denoise == 0 {
+		return c
+	}
+	c = blend(c, lookup(pos+vec2(-1, 0), row))
+	c = blend(c, lookup(pos+vec2(1, 0), row))
+	c = blend(c, lookup(pos+vec2(0, -1), row))
+	return blend(c, lookup(pos+vec2(0, 1), row))
+}
+
+func previous(pos vec2, row float) vec4 {
+	c := lookupPrev(pos, row)
+	if c.a == 0 || Denoise == 0 {
+		return c
+	}
+	c = blend(c, lookupPrev(pos+vec2(-1, 0), row))
+	c = blend(c, lookupPrev(pos+vec2(1, 0), row))
+	c = blend(c, lookupPrev(pos+vec2(0, -1), row))
+	return blend(c, lookupPrev(pos+vec2(0, 1), row))
+}
+
+// custom holds the palette row, the position of the previous frame on its
+// page and its palette row, or -1 when there is nothing to blend.
+func Fragment(dstPos vec4, srcPos vec2, color vec4, custom vec4) vec4 {
+	c := current(srcPos, custom.x)
+	if custom.w >= 0 {
+		p := previous(imageSrc0Origin()+custom.yz, custom.w)
+		c = p*(1-Mix) + c*Mix
+	}
+	return c * color
+}
+`
+
+// palettePageRows is the number of palettes on one palette page.
+const palettePageRows = 256
+
+type indexedSheet struct {
+	img  *ebiten.Image // the sheet, on page
+	page *ebiten.Image // the index page, or img when it was too large to pack
+	ix   *climg.Indexed
+}
+
+// paletteRow locates a palette on its palette page.
+type paletteRow struct {
+	page *ebiten.Image
+	row  int
+}
+
+// paletteFrame is a mobile frame ready for drawPaletted.
+type paletteFrame struct {
+	img  *ebiten.Image // the frame, a sub-image of page
+	page *ebiten.Image
+	pal  paletteRow
+}
+
+var (
+	paletteShader     *ebiten.Shader
+	paletteShaderOnce sync.Once
+
+	// Guarded by imageMu.
+	indexedSheetCache = make(map[uint16]*indexedSheet)
+	paletteCache      = make(map[sheetKey]paletteRow)
+	indexAtlas        = spriteAtlas{where: make(map[sheetKey]*atlasPage), drop: dropIndexedSheetLocked}
+	palettePage       *ebiten.Image // page new palettes are added to
+	palettePageUsed   int
+)
+
+func loadPaletteShader() *ebiten.Shader {
+	paletteShaderOnce.Do(func() {
+		s, err := ebiten.NewShader([]byte(paletteShaderSrc))
+		if err != nil {
+			logError("palette shader: %v", err)
+			return
+		}
+		paletteShader = s
+	})
+	return paletteShader
+}
+
+// usePaletteShader reports whether a mobile with the given colors should be
+// drawn through the palette shader instead of a recolored sheet.
+func usePaletteShader(colors []byte) bool {
+	if !gs.PaletteShader || gs.NoCaching || len(colors) == 0 {
+		return false
+	}
+	if clImages == nil {
+		return false
+	}
+	return loadPaletteShader() != nil
+}
+
+// dropIndexedSheetLocked forgets an index sheet whose page was evicted.
+func dropIndexedSheetLocked(k sheetKey) {
+	delete(indexedSheetCache, k.id)
+}
+
+// resetPalettesLocked forgets all index sheets and palettes. imageMu must
+// be held.
+func resetPalettesLocked() {
+	indexedSheetCache = make(map[uint16]*indexedSheet)
+	paletteCache = make(map[sheetKey]paletteRow)
+	indexAtlas.reset()
+	palettePage = nil
+	palettePageUsed = 0
+}
+
+// loadIndexedSheet returns the index sheet for id with a 1 pixel transparent
+// border, matching the layout of loadSheet. Overridden pictures have no
+// color indexes, so nil sends them down the recolored sheet path.
+func loadIndexedSheet(id uint16) *indexedSheet {
+	if overrideRev(id) != 0 {
+		return nil
+	}
+	imageMu.Lock()
+	if s, ok := indexedSheetCache[id]; ok {
+		indexAtlas.touch(sheetKey{id: id})
+		imageMu.Unlock()
+		return s
+	}
+	imageMu.Unlock()
+
+	ix := clImages.GetIndexed(uint32(id))
+	imageMu.Lock()
+	defer imageMu.Unlock()
+	if s, ok := indexedSheetCache[id]; ok {
+		return s
+	}
+	if ix == nil {
+		indexedSheetCache[id] = nil
+		return nil
+	}
+	rgba := indexedRGBA(ix)
+	// Palette only needs the color table, so drop the pixel data.
+	ix.Pix = nil
+	key := sheetKey{id: id}
+	s := &indexedSheet{ix: ix}
+	if s.img = indexAtlas.insert(key, rgba); s.img != nil {
+		s.page = indexAtlas.pageImage(key)
+	} else {
+		s.img = newImageFromImage(rgba)
+		s.page = s.img
+	}
+	indexedSheetCache[id] = s
+	return s
+}
+
+// indexedRGBA lays out the color table indexes of ix for the shader: the
+// index in red, opaque, inside a 1 pixel transparent border.
+func indexedRGBA(ix *climg.Indexed) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, ix.Width+2, ix.Height+2))
+	for i, v := range ix.Pix {
+		off := (i/ix.Width+1)*rgba.Stride + (i%ix.Width+1)*4
+		rgba.Pix[off+0] = v
+		rgba.Pix[off+3] = 0xff
+	}
+	return rgba
+}
+
+// paletteRGBA lays out pal as one row of a palette page.
+func paletteRGBA(pal [256]color.RGBA) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, len(pal), 1))
+	for i, c := range pal {
+		rgba.Pix[i*4+0] = c.R
+		rgba.Pix[i*4+1] = c.G
+		rgba.Pix[i*4+2] = c.B
+		rgba.Pix[i*4+3] = c.A
+	}
+	return rgba
+}
+
+// loadMobilePaletteFrame returns the frame for state of id, cut from its
+// index sheet, with the palette for colors. ok is false if the picture is
+// missing or overridden.
+func loadMobilePaletteFrame(id uint16, state uint8, colors []byte) (f paletteFrame, ok bool) {
+	s := loadIndexedSheet(id)
+	if s == nil {
+		return f, false
+	}
+	b := s.img.Bounds()
+	innerSize := (b.Dx() - 2) / 16
+	x := b.Min.X + 1 + int(state&0x0F)*innerSize
+	y := b.Min.Y + 1 + int(state>>4)*innerSize
+	if x+innerSize > b.Max.X-1 || y+innerSize > b.Max.Y-1 {
+		return f, false
+	}
+	f.img = s.img.SubImage(image.Rect(x, y, x+innerSize, y+innerSize)).(*ebiten.Image)
+	f.page = s.page
+	f.pal = loadMobilePalette(id, s.ix, colors)
+	return f, true
+}
+
+// loadMobilePalette returns the palette row for id recolored with colors,
+// adding it to the current palette page if it is new.
+func loadMobilePalette(id uint16, ix *climg.Indexed, colors []byte) paletteRow {
+	key := makeSheetKey(id, colors, true)
+	imageMu.Lock()
+	defer imageMu.Unlock()
+	if p, ok := paletteCache[key]; ok {
+		return p
+	}
+	if palettePage == nil || palettePageUsed == palettePageRows {
+		palettePage = newImage(256, palettePageRows)
+		palettePageUsed = 0
+	}
+	p := paletteRow{page: palettePage, row: palettePageUsed}
+	palettePageUsed++
+	row := palettePage.SubImage(image.Rect(0, p.row, 256, p.row+1)).(*ebiten.Image)
+	row.WritePixels(paletteRGBA(clImages.Palette(ix, colors, true)).Pix)
+	paletteCache[key] = p
+	return p
+}
+
+// drawPaletted draws f onto dst through its palette using geoM, denoised as
+// clImages would denoise the recolored sheet. With prev, which must be the
+// same size, it draws the blend mobileBlendFrame would make at mix instead.
+// mix should be the same for every mobile in a frame so the draws batch.
+func drawPaletted(dst *ebiten.Image, f paletteFrame, prev *paletteFrame, mix float32, geoM ebiten.GeoM) {
+	vs, op := palettedTriangles(f, prev, mix, geoM)
+	dst.DrawTrianglesShader(vs[:], []uint16{0, 1, 2, 1, 3, 2}, loadPaletteShader(), op)
+}
+
+// palettedTriangles builds the quad and options drawPaletted draws. Only the
+// vertices depend on which frames are drawn; the source images and uniforms
+// depend only on their pages.
+func palettedTriangles(f paletteFrame, prev *paletteFrame, mix float32, geoM ebiten.GeoM) ([4]ebiten.Vertex, *ebiten.DrawTrianglesShaderOptions) {
+	b := f.img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	corners := [4][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}}
+	op := &ebiten.DrawTrianglesShaderOptions{}
+	op.Images[0] = f.page
+	op.Images[1] = f.pal.page
+	op.Images[2] = f.page
+	op.Images[3] = f.pal.page
+	prevRow := float32(-1)
+	var pb image.Rectangle
+	if prev != nil {
+		op.Images[2] = prev.page
+		op.Images[3] = prev.pal.page
+		prevRow = float32(prev.pal.row)
+		pb = prev.img.Bounds()
+	}
+	var vs [4]ebiten.Vertex
+	for i, c := range corners {
+		x, y := geoM.Apply(c[0], c[1])
+		vs[i] = ebiten.Vertex{
+			DstX: float32(x), DstY: float32(y),
+			SrcX: float32(b.Min.X) + float32(c[0]), SrcY: float32(b.Min.Y) + float32(c[1]),
+			ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1,
+			Custom0: float32(f.pal.row),
+			Custom1: float32(pb.Min.X) + float32(c[0]), Custom2: float32(pb.Min.Y) + float32(c[1]),
+			Custom3: prevRow,
+		}
+	}
+	op.Uniforms = map[string]any{"Mix": mix}
+	if clImages != nil && clImages.Denoise {
+		op.Uniforms["Denoise"] = float32(clImages.DenoisePercent)
+		op.Uniforms["Sharpness"] = float32(clImages.DenoiseSharpness)
+	}
+	return vs, op
+}
+
+// paletteCacheStats reports the number of cached index sheets and palettes.
+// imageMu must be held.
+func paletteCacheStats() (sheets, palettes int) {
+	return len(indexedSheetCache), len(paletteCache)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"gothoom/climg"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	customPict = 200 // custom colors in color table slots 1 and 3
+	bakedPict  = 201 // the same picture with customColors baked in
+	noisyPict  = 202 // 128x128 mobile sheet of similar colors, for denoise
+)
+
+var customColors = []byte{0x40, 0x80}
+
+// customColorImages builds a CL_Images with a custom-colored picture and a
+// copy whose color table already holds customColors.
+func customColorImages(t *testing.T) *climg.CLImages {
+	t.Helper()
+	w := climg.NewWriter()
+	// The first row of a custom-colored picture maps each custom color to
+	// the color table slot it replaces.
+	w.PutImage(1, encodeTestBits(4, 5, []byte{
+		1, 3, 0, 0,
+		0, 1, 2, 3,
+		4, 3, 2, 1,
+		1, 1, 3, 3,
+		0, 4, 0, 2,
+	}))
+	w.PutImage(2, encodeTestBits(4, 4, []byte{
+		0, 1, 2, 3,
+		4, 3, 2, 1,
+		1, 1, 3, 3,
+		0, 4, 0, 2,
+	}))
+	w.PutColors(1, []byte{0, 0x23, 0x05, 0xd7, 0x9f})
+	w.PutColors(2, []byte{0, customColors[0], 0x05, customColors[1], 0x9f})
+	if err := w.PutPictDef(customPict, climg.PictDef{Version: climg.PictDefVersion, ImageID: 1, ColorID: 1, Flags: 0x8000 | 0x2000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.PutPictDef(bakedPict, climg.PictDef{Version: climg.PictDefVersion, ImageID: 2, ColorID: 2, Flags: 0x8000}); err != nil {
+		t.Fatal(err)
+	}
+	// Neighbouring entries of the color cube, which denoise blends. The
+	// first row maps custom colors to slots 2 and 4.
+	noisy := make([]byte, 128*129)
+	noisy[0], noisy[1] = 2, 4
+	for i := 128; i < len(noisy); i++ {
+		noisy[i] = byte((i*7 + i/13) % 6)
+	}
+	w.PutImage(3, encodeTestBits(128, 129, noisy))
+	w.PutColors(3, []byte{0, 0x20, 0x21, 0x22, 0x27, 0x2c})
+	if err := w.PutPictDef(noisyPict, climg.PictDef{Version: climg.PictDefVersion, ImageID: 3, ColorID: 3, Flags: 0x8000 | 0x2000}); err != nil {
+		t.Fatal(err)
+	}
+	imgs, err := climg.Load(writeTemp(t, w.Bytes()))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return imgs
+}
+
+// applyPaletteCPU does the palette shader's lookup on the CPU: the red
+// channel of idx selects an entry of pal; transparent pixels stay clear.
+func applyPaletteCPU(idx, pal *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(idx.Bounds())
+	for i := 0; i < len(idx.Pix); i += 4 {
+		if idx.Pix[i+3] == 0 {
+			continue
+		}
+		copy(out.Pix[i:i+4], pal.Pix[int(idx.Pix[i])*4:])
+	}
+	return out
+}
+
+func TestIndexedPaletteMatchesRGBA(t *testing.T) {
+	imgs := customColorImages(t)
+	ix := imgs.GetIndexed(customPict)
+	if ix == nil || ix.Width != 4 || ix.Height != 4 {
+		t.Fatalf("GetIndexed = %+v, want 4x4 without the mapping row", ix)
+	}
+	for _, custom := range [][]byte{nil, customColors[:1], customColors} {
+		for _, force := range []bool{false, true} {
+			want := imgs.GetRGBA(customPict, custom, force)
+			pal := imgs.Palette(ix, custom, force)
+			for i, v := range ix.Pix {
+				c := pal[v]
+				got := want.RGBAAt(i%ix.Width+1, i/ix.Width+1)
+				if got != c {
+					t.Errorf("custom %x force %v: pixel %d = %v, palette gives %v", custom, force, i, got, c)
+				}
+			}
+		}
+	}
+
+	// The recolored picture matches one with the colors in its table.
+	got := imgs.GetRGBA(customPict, customColors, true)
+	want := imgs.GetRGBA(bakedPict, nil, true)
+	if bad, _ := compareImages(got, want, 0); bad != 0 {
+		t.Errorf("custom colors: %d pixels differ from the baked picture", bad)
+	}
+	if bad, _ := compareImages(imgs.GetRGBA(customPict, nil, true), want, 0); bad == 0 {
+		t.Error("custom colors had no effect")
+	}
+
+	opaque, zero := imgs.OpaquePalette(ix, customColors)
+	for i := 0; i < 5; i++ {
+		if opaque[i].A != 0xff || zero[i] != (i == 0) {
+			t.Errorf("OpaquePalette[%d] = %v, zero %v", i, opaque[i], zero[i])
+		}
+	}
+}
+
+func TestPaletteTexturesMatchRGBA(t *testing.T) {
+	imgs := customColorImages(t)
+	for _, custom := range [][]byte{nil, customColors} {
+		ix := imgs.GetIndexed(customPict)
+		got := applyPaletteCPU(indexedRGBA(ix), paletteRGBA(imgs.Palette(ix, custom, true)))
+		want := imgs.GetRGBA(customPict, custom, true)
+		if bad, _ := compareImages(got, want, 0); bad != 0 {
+			t.Errorf("custom %x: %d pixels differ", custom, bad)
+		}
+	}
+}
+
+// TestPaletteShaderMatchesSheet draws through the shader on the GPU, so it
+// runs with the golden tests. Every preset uses the shader, denoising with it
+// from Standard up.
+func TestPaletteShaderMatchesSheet(t *testing.T) {
+	requireGolden(t)
+	prev := clImages
+	clImages = customColorImages(t)
+	defer func() { clImages = prev }()
+	defer clearCaches()
+
+	for _, preset := range []string{"Low", "Standard", "High", "Ultimate"} {
+		applyQualityPreset(preset)
+		gs.PaletteShader = true
+		if !usePaletteShader(customColors) {
+			t.Fatalf("%s: palette shader not used", preset)
+		}
+		for _, id := range []uint16{customPict, noisyPict} {
+			s := loadIndexedSheet(id)
+			if s == nil {
+				t.Fatalf("%d: no index sheet", id)
+			}
+			for _, custom := range [][]byte{nil, customColors} {
+				pal := loadMobilePalette(id, s.ix, custom)
+				if loadMobilePalette(id, s.ix, custom) != pal {
+					t.Fatalf("%s %d custom %x: palette not cached", preset, id, custom)
+				}
+				b := s.img.Bounds()
+				dst := ebiten.NewImage(b.Dx(), b.Dy())
+				drawPaletted(dst, paletteFrame{img: s.img, page: s.page, pal: pal}, nil, 1, ebiten.GeoM{})
+				got := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+				dst.ReadPixels(got.Pix)
+				want := clImages.GetRGBA(uint32(id), custom, true)
+				if bad, _ := compareImages(got, want, 2); bad != 0 {
+					t.Errorf("%s %d custom %x: %d pixels differ from the recolored sheet", preset, id, custom, bad)
+				}
+			}
+		}
+		ix := loadIndexedSheet(customPict).ix
+		if loadMobilePalette(customPict, ix, nil) == loadMobilePalette(customPict, ix, customColors) {
+			t.Errorf("%s: color sets share a palette", preset)
+		}
+	}
+	if !clImages.Denoise {
+		t.Error("Ultimate preset did not denoise")
+	}
+}
+
+// TestPaletteShaderBlendMatchesCPU checks a blend frame drawn by the shader
+// against mobileBlendFrame on the recolored frames.
+func TestPaletteShaderBlendMatchesCPU(t *testing.T) {
+	requireGolden(t)
+	prev := clImages
+	clImages = customColorImages(t)
+	defer func() { clImages = prev }()
+	defer clearCaches()
+	applyQualityPreset("Ultimate")
+
+	const step, steps = 3, 10
+	from, ok1 := loadMobilePaletteFrame(noisyPict, 0, customColors)
+	to, ok2 := loadMobilePaletteFrame(noisyPict, 0x11, nil)
+	if !ok1 || !ok2 {
+		t.Fatal("no paletted frames")
+	}
+	size := to.img.Bounds().Dx()
+	dst := ebiten.NewImage(size, size)
+	drawPaletted(dst, to, &from, float32(step)/steps, ebiten.GeoM{})
+	got := image.NewRGBA(image.Rect(0, 0, size, size))
+	dst.ReadPixels(got.Pix)
+
+	cpu := mobileBlendFrame(makeMobileKey(noisyPict, 0, customColors), makeMobileKey(noisyPict, 0x11, nil),
+		loadMobileFrame(noisyPict, 0, customColors), loadMobileFrame(noisyPict, 0x11, nil), step, steps)
+	want := image.NewRGBA(image.Rect(0, 0, size, size))
+	cpu.ReadPixels(want.Pix)
+	if bad, _ := compareImages(got, want, 2); bad != 0 {
+		t.Errorf("%d pixels differ from mobileBlendFrame", bad)
+	}
+}
+
+// TestPaletteShaderBatches checks that mobiles of different pictures and
+// colors on the same pages draw with the same source images and uniforms,
+// which is what Ebiten needs to merge consecutive draws into one call.
+func TestPaletteShaderBatches(t *testing.T) {
+	requireGolden(t)
+	prev := clImages
+	clImages = customColorImages(t)
+	defer func() { clImages = prev }()
+	defer clearCaches()
+	applyQualityPreset("Ultimate")
+
+	a, ok1 := loadMobilePaletteFrame(noisyPict, 2, customColors)
+	b, ok2 := loadMobilePaletteFrame(noisyPict, 0x23, nil)
+	if !ok1 || !ok2 {
+		t.Fatal("no paletted frames")
+	}
+	if a.page != b.page || a.pal.page != b.pal.page || a.pal.row == b.pal.row {
+		t.Fatalf("frames not on shared pages: %+v %+v", a, b)
+	}
+	var geoM ebiten.GeoM
+	geoM.Translate(40, 8)
+	vsA, opA := palettedTriangles(a, nil, 0.5, ebiten.GeoM{})
+	vsB, opB := palettedTriangles(b, &a, 0.5, geoM)
+	if opA.Images != opB.Images {
+		t.Error("source images differ between mobiles")
+	}
+	if !reflect.DeepEqual(opA.Uniforms, opB.Uniforms) {
+		t.Errorf("uniforms differ: %v and %v", opA.Uniforms, opB.Uniforms)
+	}
+	if vsA == vsB {
+		t.Error("both mobiles have the same vertices")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sync/atomic"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+)
+
+// The frame profiler times the phases of each Draw call and keeps a short
+// history so stutter can be traced back to the phase that caused it. Timing
+// only runs while the overlay is enabled from the debug window.
+
+const (
+	profSnapshot = iota
+	profPicsNeg
+	profPlaneZero
+	profPicsPos
+	profBubbles
+	profNight
+	profUI
+	profParse
+	profOther
+	profPhaseCount
+)
+
+var profPhaseNames = [profPhaseCount]string{
+	"Snapshot", "Pictures <0", "Plane 0", "Pictures >0", "Bubbles", "Night", "UI", "Net parse", "Other",
+}
+
+var profPhaseColors = [profPhaseCount]color.RGBA{
+	{0xe6, 0x9f, 0x00, 0xff},
+	{0x56, 0xb4, 0xe9, 0xff},
+	{0x00, 0x9e, 0x73, 0xff},
+	{0x00, 0x72, 0xb2, 0xff},
+	{0xf0, 0xe4, 0x42, 0xff},
+	{0x80, 0x60, 0xc0, 0xff},
+	{0xd5, 0x5e, 0x00, 0xff},
+	{0xcc, 0x79, 0xa7, 0xff},
+	{0x80, 0x80, 0x80, 0xff},
+}
+
+// profHistory is the number of frames kept for the rolling graph.
+const profHistory = 240
+
+type frameProfile struct {
+	Phases [profPhaseCount]time.Duration
+	Total  time.Duration
+}
+
+type frameProfiler struct {
+	cur   frameProfile
+	start time.Time
+	hist  [profHistory]frameProfile
+	next  int
+	count int
+}
+
+var (
+	profiler frameProfiler
+	// profParseNanos accumulates parseDrawState time from the network
+	// goroutine until the next frame picks it up.
+	profParseNanos atomic.Int64
+)
+
+// profStart returns the start time of a phase, or the zero time when the
+// profiler is off.
+func profStart() time.Time {
+	if !gs.frameProfiler {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// profEnd adds the time since start to phase of the current frame.
+func profEnd(phase int, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	profiler.cur.Phases[phase] += time.Since(start)
+}
+
+// profParseDone records time spent decoding a draw state.
+func profParseDone(start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	profParseNanos.Add(int64(time.Since(start)))
+}
+
+func (p *frameProfiler) begin(now time.Time) {
+	p.cur = frameProfile{}
+	p.start = now
+}
+
+// end closes the current frame, attributing untimed work to profOther.
+func (p *frameProfiler) end(now time.Time, parse time.Duration) {
+	if p.start.IsZero() {
+		return
+	}
+	p.cur.Phases[profParse] = parse
+	p.cur.Total = now.Sub(p.start)
+	var timed time.Duration
+	for i, d := range p.cur.Phases {
+		if i != profParse && i != profOther {
+			timed += d
+		}
+	}
+	if other := p.cur.Total - timed; other > 0 {
+		p.cur.Phases[profOther] = other
+	}
+	p.push(p.cur)
+	p.start = time.Time{}
+}
+
+func (p *frameProfiler) push(f frameProfile) {
+	p.hist[p.next] = f
+	p.next = (p.next + 1) % profHistory
+	if p.count < profHistory {
+		p.count++
+	}
+}
+
+// frame returns the i-th recorded frame, oldest first.
+func (p *frameProfiler) frame(i int) frameProfile {
+	return p.hist[(p.next-p.count+i+profHistory)%profHistory]
+}
+
+// stats returns the average and maximum duration of each phase and of whole
+// frames over the recorded history.
+func (p *frameProfiler) stats() (avg, max frameProfile) {
+	if p.count == 0 {
+		return
+	}
+	for i := 0; i < p.count; i++ {
+		f := p.frame(i)
+		for j, d := range f.Phases {
+			avg.Phases[j] += d
+			if d > max.Phases[j] {
+				max.Phases[j] = d
+			}
+		}
+		avg.Total += f.Total
+		if f.Total > max.Total {
+			max.Total = f.Total
+		}
+	}
+	for j := range avg.Phases {
+		avg.Phases[j] /= time.Duration(p.count)
+	}
+	avg.Total /= time.Duration(p.count)
+	return
+}
+
+func profBeginFrame() {
+	if !gs.frameProfiler {
+		profiler.start = time.Time{}
+		return
+	}
+	profiler.begin(time.Now())
+}
+
+func profEndFrame() {
+	profiler.end(time.Now(), time.Duration(profParseNanos.Swap(0)))
+}
+
+// drawProfilerOverlay draws the rolling frame graph and the per-phase legend
+// in the bottom left corner of screen.
+func drawProfilerOverlay(screen *ebiten.Image) {
+	if !gs.frameProfiler || profiler.count == 0 {
+		return
+	}
+	const (
+		barW      = 2
+		graphH    = 100
+		msHeight  = graphH / 33.3 // pixels per millisecond
+		pad       = 4
+		legendGap = 8
+	)
+	metrics := mainFont.Metrics()
+	lineH := metrics.HAscent + metrics.HDescent + metrics.HLineGap
+	legendH := lineH * float64(profPhaseCount+1)
+	boxW := float64(profHistory*barW) + 2*pad
+	boxH := graphH + legendGap + legendH + 2*pad
+	x0 := float64(pad)
+	y0 := float64(screen.Bounds().Dy()) - boxH - pad
+
+	rect := func(x, y, w, h float64, c color.RGBA) {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(w, h)
+		op.GeoM.Translate(x, y)
+		op.ColorScale.ScaleWithColor(c)
+		screen.DrawImage(whiteImage, op)
+	}
+	rect(x0, y0, boxW, boxH, color.RGBA{0, 0, 0, 192})
+
+	base := y0 + pad + graphH
+	for i := 0; i < profiler.count; i++ {
+		f := profiler.frame(i)
+		x := x0 + pad + float64(i*barW)
+		y := base
+		for j, d := range f.Phases {
+			if j == profParse {
+				// Parsing runs on the network goroutine, not inside Draw.
+				continue
+			}
+			h := float64(d) / float64(time.Millisecond) * msHeight
+			if y-h < base-graphH {
+				h = y - (base - graphH)
+			}
+			if h <= 0 {
+				continue
+			}
+			y -= h
+			rect(x, y, barW, h, profPhaseColors[j])
+		}
+		if d := f.Phases[profParse]; d > 0 {
+			// Mark parse time with a tick at its height on the graph.
+			h := float64(d) / float64(time.Millisecond) * msHeight
+			if h > graphH {
+				h = graphH
+			}
+			rect(x, base-h, barW, 1, profPhaseColors[profParse])
+		}
+	}
+	for _, ms := range []float64{1000.0 / 60, 1000.0 / 30} {
+		y := base - ms*msHeight
+		rect(x0+pad, y, float64(profHistory*barW), 1, color.RGBA{0xff, 0xff, 0xff, 0x80})
+	}
+
+	avg, max := profiler.stats()
+	ty := base + legendGap
+	line := func(msg string, c color.RGBA) {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(x0+pad, ty)
+		op.ColorScale.ScaleWithColor(c)
+		text.Draw(screen, msg, mainFont, op)
+		ty += lineH
+	}
+	line(fmt.Sprintf("Frame  avg %5.2fms  max %5.2fms", msDur(avg.Total), msDur(max.Total)), color.RGBA{0xff, 0xff, 0xff, 0xff})
+	for j := 0; j < profPhaseCount; j++ {
+		line(fmt.Sprintf("%-12s avg %5.2fms  max %5.2fms", profPhaseNames[j], msDur(avg.Phases[j]), msDur(max.Phases[j])), profPhaseColors[j])
+	}
+}
+
+func msDur(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
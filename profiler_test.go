@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameProfilerOther(t *testing.T) {
+	var p frameProfiler
+	start := time.Unix(0, 0)
+	p.begin(start)
+	p.cur.Phases[profPicsNeg] = 3 * time.Millisecond
+	p.cur.Phases[profUI] = 2 * time.Millisecond
+	p.end(start.Add(10*time.Millisecond), 4*time.Millisecond)
+
+	f := p.frame(0)
+	if f.Total != 10*time.Millisecond {
+		t.Fatalf("total = %v, want 10ms", f.Total)
+	}
+	// Parse time happens off the render goroutine and is not subtracted.
+	if f.Phases[profOther] != 5*time.Millisecond {
+		t.Fatalf("other = %v, want 5ms", f.Phases[profOther])
+	}
+	if f.Phases[profParse] != 4*time.Millisecond {
+		t.Fatalf("parse = %v, want 4ms", f.Phases[profParse])
+	}
+}
+
+func TestFrameProfilerHistoryWraps(t *testing.T) {
+	var p frameProfiler
+	for i := 1; i <= profHistory+10; i++ {
+		p.push(frameProfile{Total: time.Duration(i)})
+	}
+	if p.count != profHistory {
+		t.Fatalf("count = %d, want %d", p.count, profHistory)
+	}
+	if got := p.frame(0).Total; got != 11 {
+		t.Fatalf("oldest = %v, want 11", got)
+	}
+	if got := p.frame(profHistory - 1).Total; got != profHistory+10 {
+		t.Fatalf("newest = %v, want %d", got, profHistory+10)
+	}
+	avg, max := p.stats()
+	if max.Total != profHistory+10 {
+		t.Fatalf("max = %v", max.Total)
+	}
+	if want := time.Duration((11 + profHistory + 10) / 2); avg.Total != want {
+		t.Fatalf("avg = %v, want %v", avg.Total, want)
+	}
+}
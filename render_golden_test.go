@@ -0,0 +1,622 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gothoom/climg"
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Golden image tests need a real graphics context, so they only run when
+// requested:
+//
+//	go test -run Golden -golden          compare against testdata/golden
+//	go test -run Golden -update-golden   rewrite the golden PNGs
+var (
+	goldenFlag       = flag.Bool("golden", false, "run golden image render tests (needs a display)")
+	updateGoldenFlag = flag.Bool("update-golden", false, "rewrite golden images instead of comparing")
+)
+
+const (
+	goldenDir = "testdata/golden"
+	// goldenFailDir holds the output of failed comparisons; it is ignored
+	// by git and kept after the test ends.
+	goldenFailDir = goldenDir + "/failures"
+
+	// goldenChannelTolerance is the per-channel difference ignored when
+	// comparing pixels; GPU drivers round blends slightly differently.
+	goldenChannelTolerance = 8
+	// goldenMaxBadFraction is the fraction of pixels allowed to exceed the
+	// channel tolerance before a comparison fails.
+	goldenMaxBadFraction = 0.001
+)
+
+// goldenRunning is true while tests execute inside the ebiten game loop.
+var goldenRunning bool
+
+type goldenTestGame struct {
+	m    *testing.M
+	code int
+	done bool
+}
+
+func (g *goldenTestGame) Update() error {
+	if !g.done {
+		g.done = true
+		goldenRunning = true
+		g.code = g.m.Run()
+	}
+	return ebiten.Termination
+}
+
+func (g *goldenTestGame) Draw(screen *ebiten.Image) {}
+
+func (g *goldenTestGame) Layout(w, h int) (int, int) { return w, h }
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !*goldenFlag && !*updateGoldenFlag {
+		os.Exit(m.Run())
+	}
+	g := &goldenTestGame{m: m}
+	ebiten.SetWindowSize(320, 240)
+	ebiten.SetWindowTitle("goThoom golden tests")
+	if err := ebiten.RunGame(g); err != nil {
+		fmt.Fprintf(os.Stderr, "ebiten: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(g.code)
+}
+
+// requireGolden skips t unless the golden render harness is active and
+// resets render settings so output does not depend on the user's config.
+func requireGolden(t *testing.T) {
+	t.Helper()
+	if !goldenRunning {
+		t.Skip("golden render tests disabled; run with -golden")
+	}
+	prev := gs
+	gs = gsdef
+	gs.MotionSmoothing = false
+	gs.BlendMobiles = false
+	gs.BlendPicts = false
+	gs.DenoiseImages = false
+	gs.NoCaching = true
+	initFont()
+	t.Cleanup(func() {
+		gs = prev
+		initFont()
+	})
+}
+
+// checkGolden compares img against testdata/golden/<name>.png, or rewrites
+// the golden when -update-golden is set. A missing golden is a failure so a
+// forgotten PNG cannot pass unnoticed. On mismatch the rendered image and a
+// difference mask are written to goldenFailDir for inspection.
+func checkGolden(t *testing.T, name string, img *ebiten.Image) {
+	t.Helper()
+	b := img.Bounds()
+	got := readRGBA(img)
+
+	path := filepath.Join(goldenDir, name+".png")
+	if *updateGoldenFlag {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := writePNG(path, got); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden %s missing; create it with go test -run %s -update-golden and commit it", path, t.Name())
+	}
+	if err != nil {
+		t.Fatalf("open golden: %v", err)
+	}
+	want, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("decode golden: %v", err)
+	}
+
+	bad, diff := compareImages(got, want, goldenChannelTolerance)
+	total := b.Dx() * b.Dy()
+	if diff == nil && float64(bad) <= goldenMaxBadFraction*float64(total) {
+		return
+	}
+	dir := goldenFailDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := writePNG(filepath.Join(dir, name+"-got.png"), got); err != nil {
+		t.Errorf("write output: %v", err)
+	}
+	if diff != nil {
+		if err := writePNG(filepath.Join(dir, name+"-diff.png"), diff); err != nil {
+			t.Errorf("write diff: %v", err)
+		}
+	}
+	if want.Bounds().Size() != got.Bounds().Size() {
+		t.Fatalf("%s: size %v, golden %v (output in %s)", name, got.Bounds().Size(), want.Bounds().Size(), dir)
+	}
+	t.Fatalf("%s: %d of %d pixels differ beyond tolerance (output in %s)", name, bad, total, dir)
+}
+
+// readRGBA copies the pixels of img back from the GPU.
+func readRGBA(img *ebiten.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	img.ReadPixels(out.Pix)
+	return out
+}
+
+// compareImages counts pixels in got that differ from want by more than tol
+// in any channel and returns a mask highlighting them. A nil mask means the
+// images matched exactly within tolerance.
+func compareImages(got *image.RGBA, want image.Image, tol uint8) (int, *image.RGBA) {
+	if want.Bounds().Size() != got.Bounds().Size() {
+		return got.Bounds().Dx() * got.Bounds().Dy(), nil
+	}
+	wb := want.Bounds()
+	var diff *image.RGBA
+	bad := 0
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			g := got.RGBAAt(x, y)
+			w := color.RGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.RGBA)
+			if absDiff8(g.R, w.R) > tol || absDiff8(g.G, w.G) > tol ||
+				absDiff8(g.B, w.B) > tol || absDiff8(g.A, w.A) > tol {
+				if diff == nil {
+					diff = image.NewRGBA(got.Bounds())
+				}
+				diff.SetRGBA(x, y, color.RGBA{0xff, 0x00, 0xff, 0xff})
+				bad++
+			}
+		}
+	}
+	return bad, diff
+}
+
+func absDiff8(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestCompareImagesTolerance(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	b.SetRGBA(0, 0, color.RGBA{4, 0, 0, 0})
+	if bad, diff := compareImages(a, b, 8); bad != 0 || diff != nil {
+		t.Fatalf("within tolerance: bad=%d", bad)
+	}
+	b.SetRGBA(1, 1, color.RGBA{0, 0, 200, 0xff})
+	if bad, diff := compareImages(a, b, 8); bad != 1 || diff == nil {
+		t.Fatalf("expected one bad pixel, got %d", bad)
+	}
+	c := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	if bad, _ := compareImages(a, c, 8); bad != 4 {
+		t.Fatalf("size mismatch should fail every pixel, got %d", bad)
+	}
+}
+
+// liveBubble stamps b the way a received bubble is, so it is fully visible
+// now.
+func liveBubble(b bubble) bubble {
+	b.Created = bubbleClock()
+	b.Life = bubbleLife(b.Text)
+	return b
+}
+
+// fixedSnapshot is a hand-built frame with status bars and bubbles that does
+// not depend on CL_Images being present.
+func fixedSnapshot() drawSnapshot {
+	now := time.Unix(0, 0)
+	return drawSnapshot{
+		descriptors: map[uint8]frameDescriptor{},
+		prevTime:    now,
+		curTime:     now,
+		hp:          60, hpMax: 100, prevHP: 60, prevHPMax: 100,
+		sp: 25, spMax: 50, prevSP: 25, prevSPMax: 50,
+		balance: 90, balanceMax: 100, prevBalance: 90, prevBalanceMax: 100,
+		bubbles: []bubble{
+			liveBubble(bubble{Index: 1, H: -60, V: -40, Far: true, Text: "Hello from the golden test", Type: kBubbleNormal}),
+			liveBubble(bubble{Index: 2, H: 60, V: 30, Far: true, Text: "Yelling!", Type: kBubbleYell}),
+		},
+	}
+}
+
+func TestGoldenStatusBarsAndBubbles(t *testing.T) {
+	requireGolden(t)
+	gs.nightEffect = false
+	img := renderOffscreen(fixedSnapshot(), 2, 1, 1, 1)
+	checkGolden(t, "bars-bubbles-2x", img)
+}
+
+func TestGoldenNightOverlay(t *testing.T) {
+	requireGolden(t)
+	gs.nightEffect = true
+	gNight.mu.Lock()
+	prevBase, prevLevel, prevAz, prevCloudy, prevFlags := gNight.BaseLevel, gNight.Level, gNight.Azimuth, gNight.Cloudy, gNight.Flags
+	gNight.BaseLevel, gNight.Level, gNight.Azimuth, gNight.Cloudy, gNight.Flags = 60, 60, 90, false, 0
+	gNight.calcCurLevel()
+	gNight.calcRedshift()
+	gNight.mu.Unlock()
+	defer func() {
+		gNight.mu.Lock()
+		gNight.BaseLevel, gNight.Level, gNight.Azimuth, gNight.Cloudy, gNight.Flags = prevBase, prevLevel, prevAz, prevCloudy, prevFlags
+		gNight.calcCurLevel()
+		gNight.calcRedshift()
+		gNight.mu.Unlock()
+	}()
+	img := renderOffscreen(fixedSnapshot(), 1, 1, 1, 1)
+	checkGolden(t, "night-60-1x", img)
+}
+
+func TestGoldenUIWindow(t *testing.T) {
+	requireGolden(t)
+	eui.Layout(320, 240)
+	win := eui.NewWindow()
+	win.Title = "Golden"
+	win.AutoSize = true
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	txt, _ := eui.NewText()
+	txt.Text = "Offscreen UI"
+	txt.Size = eui.Point{X: 160, Y: 24}
+	flow.AddItem(txt)
+	cb, _ := eui.NewCheckbox()
+	cb.Text = "Checked"
+	cb.Checked = true
+	cb.Size = eui.Point{X: 160, Y: 24}
+	flow.AddItem(cb)
+	win.AddItem(flow)
+	win.AddWindow(false)
+	win.MarkOpen()
+	defer win.Close()
+
+	img := renderUIOffscreen(320, 240)
+	checkGolden(t, "ui-window", img)
+}
+
+// TestGoldenMovieFrames replays clMov recordings and renders selected frames.
+// It needs the real CL_Images archive in data/ and skips without it.
+func TestGoldenMovieFrames(t *testing.T) {
+	requireGolden(t)
+	imgs, err := climg.Load(filepath.Join(dataDirPath, CL_ImagesFile))
+	if err != nil {
+		t.Skipf("CL_Images not available: %v", err)
+	}
+	prevImages := clImages
+	clImages = imgs
+	defer func() { clImages = prevImages }()
+	prevEnc := drawStateEncrypted
+	drawStateEncrypted = false
+	defer func() { drawStateEncrypted = prevEnc }()
+	gs.nightEffect = false
+
+	cases := []struct {
+		file  string
+		frame int
+	}{
+		{"2004.clMov", 200},
+		{"chain.clMov", 100},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			frames, err := parseMovie(filepath.Join("clmovFiles", c.file), 1445)
+			if err != nil {
+				t.Skipf("parse movie: %v", err)
+			}
+			idx := c.frame
+			if idx >= len(frames) {
+				idx = len(frames) - 1
+			}
+			snap, err := movieFrameSnapshot(frames, idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img := renderOffscreen(snap, 2, 1, 1, 1)
+			checkGolden(t, fmt.Sprintf("%s-%d", c.file, idx), img)
+		})
+	}
+}
+
+// encodeTestBits encodes a w×h picture of color table indexes in the
+// CL_Images bit format, as 8-bit values in literal runs of up to 16.
+func encodeTestBits(w, h int, pix []byte) []byte {
+	out := []byte{byte(h >> 8), byte(h), byte(w >> 8), byte(w), 0, 0, 0, 0, 8, 4}
+	var cur, n byte
+	put := func(v, bits int) {
+		for i := bits - 1; i >= 0; i-- {
+			cur = cur<<1 | byte(v>>i&1)
+			if n++; n == 8 {
+				out = append(out, cur)
+				cur, n = 0, 0
+			}
+		}
+	}
+	for i := 0; i < len(pix); i += 16 {
+		run := pix[i:min(i+16, len(pix))]
+		put(1, 1)
+		put(len(run)-1, 4)
+		for _, v := range run {
+			put(int(v), 8)
+		}
+	}
+	if n > 0 {
+		out = append(out, cur<<(8-n))
+	}
+	return out
+}
+
+// Pictures in the synthetic CL_Images built by goldenTestImages.
+const (
+	goldenPictGround = 100 // 48x32 background tile
+	goldenPictAnim   = 101 // 16x16, two frames
+	goldenPictMobile = 102 // 16x16 sheet of 8x8 mobile states
+)
+
+// goldenTestImages builds a small CL_Images with a background tile, an
+// animated picture and a mobile sheet, so scene tests do not need the real
+// data files.
+func goldenTestImages(t *testing.T) *climg.CLImages {
+	t.Helper()
+	w := climg.NewWriter()
+	w.PutColors(1, []byte{0, 0x23, 0x05, 0xd7, 0x9f, 0x6b, 0xe3, 0xff})
+
+	ground := make([]byte, 48*32)
+	for i := range ground {
+		x, y := i%48, i/48
+		ground[i] = byte(1 + (x/8+y/8)%4)
+	}
+	w.PutImage(1, encodeTestBits(48, 32, ground))
+
+	anim := make([]byte, 16*32)
+	for i := range anim {
+		x, y := i%16, i/16
+		if y < 16 && x >= 4 && x < 12 {
+			anim[i] = 5 // frame 0: vertical bar
+		} else if y >= 16 && y-16 >= 4 && y-16 < 12 {
+			anim[i] = 6 // frame 1: horizontal bar
+		}
+	}
+	w.PutImage(2, encodeTestBits(16, 32, anim))
+
+	mobile := make([]byte, 16*16*8*8)
+	for i := range mobile {
+		x, y := i%128, i/128
+		state := (y/8)*16 + x/8
+		if ix, iy := x%8, y%8; ix >= 1 && ix < 7 && iy >= 1 && iy < 7 {
+			mobile[i] = byte(1 + state%7)
+		}
+	}
+	w.PutImage(3, encodeTestBits(128, 128, mobile))
+
+	defs := []struct {
+		id, image uint32
+		frames    uint16
+		anims     []int16
+	}{
+		{goldenPictGround, 1, 1, nil},
+		{goldenPictAnim, 2, 2, []int16{0, 1}},
+		{goldenPictMobile, 3, 1, nil},
+	}
+	for _, d := range defs {
+		def := climg.PictDef{
+			Version:    climg.PictDefVersion,
+			ImageID:    d.image,
+			ColorID:    1,
+			Flags:      0x8000, // index 0 is transparent
+			NumFrames:  d.frames,
+			AnimFrames: d.anims,
+		}
+		if err := w.PutPictDef(d.id, def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imgs, err := climg.Load(writeTemp(t, w.Bytes()))
+	if err != nil {
+		t.Fatalf("load test images: %v", err)
+	}
+	return imgs
+}
+
+// useGoldenTestImages installs goldenTestImages as clImages for the test.
+func useGoldenTestImages(t *testing.T) {
+	t.Helper()
+	prev := clImages
+	clImages = goldenTestImages(t)
+	t.Cleanup(func() { clImages = prev })
+}
+
+// sceneSnapshot loads pictures and mobiles into the draw state the way a
+// received frame would and returns its snapshot. The draw state is reset
+// when the test ends.
+func sceneSnapshot(t *testing.T, pics []framePicture, mobs []frameMobile, prevMobs []frameMobile, descs []frameDescriptor, shiftX, shiftY int) drawSnapshot {
+	t.Helper()
+	t.Cleanup(resetDrawState)
+	now := time.Unix(0, 0)
+	stateMu.Lock()
+	state = cloneDrawState(initialState)
+	state.pictures = pics
+	state.picShiftX, state.picShiftY = shiftX, shiftY
+	state.mobiles = make(map[uint8]frameMobile)
+	for _, m := range mobs {
+		state.mobiles[m.Index] = m
+	}
+	state.prevMobiles = make(map[uint8]frameMobile)
+	for _, m := range prevMobs {
+		state.prevMobiles[m.Index] = m
+	}
+	state.descriptors = make(map[uint8]frameDescriptor)
+	for _, d := range descs {
+		state.descriptors[d.Index] = d
+	}
+	state.prevDescs = make(map[uint8]frameDescriptor)
+	state.prevTime, state.curTime = now, now
+	prepareRenderCacheLocked()
+	stateMu.Unlock()
+	return captureDrawSnapshot()
+}
+
+// TestGoldenPictureShift pans the background by the offset pictureShift
+// finds and draws halfway between the two frames, with a mobile walking
+// along.
+func TestGoldenPictureShift(t *testing.T) {
+	requireGolden(t)
+	useGoldenTestImages(t)
+	gs.nightEffect = false
+	gs.MotionSmoothing = true
+
+	prev := []framePicture{
+		{PictID: goldenPictGround, H: -40, V: -20, Plane: -1},
+		{PictID: goldenPictGround, H: 8, V: -20, Plane: -1},
+		{PictID: goldenPictAnim, H: 30, V: 40},
+	}
+	cur := []framePicture{
+		{PictID: goldenPictGround, H: -34, V: -24, Plane: -1},
+		{PictID: goldenPictGround, H: 14, V: -24, Plane: -1},
+		{PictID: goldenPictAnim, H: 30, V: 40},
+	}
+	dx, dy, _, ok := pictureShift(prev, cur)
+	if !ok || dx != 6 || dy != -4 {
+		t.Fatalf("pictureShift = %d, %d, %v; want 6, -4", dx, dy, ok)
+	}
+	for i := range cur {
+		cur[i].PrevH = int16(int(cur[i].H) - dx)
+		cur[i].PrevV = int16(int(cur[i].V) - dy)
+		cur[i].Moving = cur[i].Plane < 0
+	}
+	mob := frameMobile{Index: 1, State: 3, H: 6, V: 10}
+	prevMob := frameMobile{Index: 1, State: 3, H: -4, V: 14}
+	desc := frameDescriptor{Index: 1, PictID: goldenPictMobile}
+	snap := sceneSnapshot(t, cur, []frameMobile{mob}, []frameMobile{prevMob}, []frameDescriptor{desc}, dx, dy)
+	img := renderOffscreen(snap, 2, 0.5, 1, 1)
+	checkGolden(t, "picture-shift-2x", img)
+}
+
+// TestGoldenMobileBlend draws a mobile halfway through the cross-fade
+// between two poses.
+func TestGoldenMobileBlend(t *testing.T) {
+	requireGolden(t)
+	useGoldenTestImages(t)
+	gs.nightEffect = false
+	gs.BlendMobiles = true
+	gs.MobileBlendFrames = 10
+
+	mob := frameMobile{Index: 1, State: 5, H: 0, V: 0}
+	prevMob := frameMobile{Index: 1, State: 2, H: 0, V: 0}
+	desc := frameDescriptor{Index: 1, PictID: goldenPictMobile}
+	snap := sceneSnapshot(t, nil, []frameMobile{mob}, []frameMobile{prevMob}, []frameDescriptor{desc}, 0, 0)
+	img := renderOffscreen(snap, 4, 1, 0.5, 1)
+	checkGolden(t, "mobile-blend-4x", img)
+
+	prevImg := loadMobileFrame(goldenPictMobile, 2, nil)
+	curImg := loadMobileFrame(goldenPictMobile, 5, nil)
+	checkGolden(t, "mobile-blend-frame", mobileBlendFrame(
+		makeMobileKey(goldenPictMobile, 2, nil), makeMobileKey(goldenPictMobile, 5, nil),
+		prevImg, curImg, 5, 10))
+}
+
+// TestGoldenPictBlend draws an animated picture halfway through the
+// cross-fade between its two frames.
+func TestGoldenPictBlend(t *testing.T) {
+	requireGolden(t)
+	useGoldenTestImages(t)
+	gs.nightEffect = false
+	gs.BlendPicts = true
+	gs.PictBlendFrames = 10
+	prevCounter := frameCounter
+	frameCounter = 1
+	defer func() { frameCounter = prevCounter }()
+
+	pics := []framePicture{
+		{PictID: goldenPictGround, H: 0, V: 0, Plane: -1},
+		{PictID: goldenPictAnim, H: 0, V: 0},
+	}
+	snap := sceneSnapshot(t, pics, nil, nil, nil, 0, 0)
+	img := renderOffscreen(snap, 4, 1, 1, 0.5)
+	checkGolden(t, "pict-blend-4x", img)
+
+	checkGolden(t, "pict-blend-frame", pictBlendFrame(goldenPictAnim, 0, 1,
+		loadImageFrame(goldenPictAnim, 0), loadImageFrame(goldenPictAnim, 1), 5, 10))
+}
+
+// TestGoldenUpscaleBubble draws a named mobile under a bubble with the
+// Scale2x filter on. Names and bubbles are drawn after upscaling, so a frame
+// with only a bubble must match the same frame drawn without the filter.
+func TestGoldenUpscaleBubble(t *testing.T) {
+	requireGolden(t)
+	useGoldenTestImages(t)
+	gs.nightEffect = false
+
+	bubbles := fixedSnapshot()
+	plain := renderOffscreen(bubbles, 2, 1, 1, 1)
+	gs.UpscaleFilter = upscaleScale2x
+	if !upscaleActive(2) {
+		t.Fatal("scale2x upscaler not available")
+	}
+	up := renderOffscreen(bubbles, 2, 1, 1, 1)
+	if bad, _ := compareImages(readRGBA(up), readRGBA(plain), 0); bad != 0 {
+		t.Fatalf("upscaled bubbles differ from plain bubbles in %d pixels", bad)
+	}
+
+	mob := frameMobile{Index: 1, State: 3, H: 0, V: 0}
+	desc := frameDescriptor{Index: 1, PictID: goldenPictMobile, Name: "Golden"}
+	snap := sceneSnapshot(t, nil, []frameMobile{mob}, nil, []frameDescriptor{desc}, 0, 0)
+	snap.bubbles = []bubble{
+		liveBubble(bubble{Index: 1, H: 0, V: 0, Text: "Upscaled hello", Type: kBubbleNormal}),
+	}
+	img := renderOffscreen(snap, 2, 1, 1, 1)
+	checkGolden(t, "upscale-bubble-2x", img)
+}
+
+// TestGoldenUpscaleShadersMatchCPU runs every upscale shader on the GPU and
+// compares the result with upscaleRGBA.
+func TestGoldenUpscaleShadersMatchCPU(t *testing.T) {
+	requireGolden(t)
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case x == y, x == y+1:
+				src.SetRGBA(x, y, color.RGBA{0xf0, 0xd0, 0x40, 0xff})
+			case x+y == 9:
+				src.SetRGBA(x, y, color.RGBA{0x20, 0x40, 0xa0, 0xff})
+			case x < 2:
+				src.SetRGBA(x, y, color.RGBA{0x30, 0x18, 0x08, 0x80})
+			default:
+				src.SetRGBA(x, y, color.RGBA{0x60, 0x80, 0x30, 0xff})
+			}
+		}
+	}
+	img := ebiten.NewImageFromImage(src)
+	for _, f := range upscaleFilters {
+		if f.name == upscaleNone {
+			continue
+		}
+		gs.UpscaleFilter = f.name
+		for _, scale := range []int{2, 3} {
+			dst := ebiten.NewImage(8*scale, 8*scale)
+			drawUpscaled(dst, img, scale)
+			want := upscaleRGBA(src, scale, f.name, nil)
+			if bad, _ := compareImages(readRGBA(dst), want, 2); bad != 0 {
+				t.Errorf("%s at %dx: %d pixels differ from the CPU version", f.label, scale, bad)
+			}
+		}
+	}
+}
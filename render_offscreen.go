@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// withGameScale runs fn with gs.GameScale temporarily set to scale so the
+// draw helpers lay out the world for an offscreen integer render target.
+func withGameScale(scale int, fn func()) {
+	prev := gs.GameScale
+	gs.GameScale = float64(scale)
+	fn()
+	gs.GameScale = prev
+}
+
+// sceneLayer selects which parts of the scene drawScene draws.
+type sceneLayer uint8
+
+const (
+	// layerSprites covers the pictures and mobile sprites.
+	layerSprites sceneLayer = 1 << iota
+	// layerLabels covers name tags, debug labels and bubbles.
+	layerLabels
+
+	layerAll = layerSprites | layerLabels
+)
+
+// drawLayers is the set of layers drawScene currently draws.
+var drawLayers = layerAll
+
+// withSceneLayers runs fn with drawLayers temporarily set to layers.
+func withSceneLayers(layers sceneLayer, fn func()) {
+	prev := drawLayers
+	drawLayers = layers
+	fn()
+	drawLayers = prev
+}
+
+// renderWorld draws the world for snap and the night overlay into dst at the
+// integer scale. With an upscaler active only the sprites are drawn at 1x and
+// enlarged by the filter; labels, bubbles and the night overlay are then drawn
+// over them at full scale so their text is not enlarged twice.
+func renderWorld(dst *ebiten.Image, snap drawSnapshot, scale int, alpha float64, mobileFade, pictFade float32) {
+	if !upscaleActive(scale) {
+		withGameScale(scale, func() {
+			renderWorldScene(dst, snap, alpha, mobileFade, pictFade)
+		})
+		return
+	}
+	b := dst.Bounds()
+	base := ensureUpscaleBaseRT(b.Dx()/scale, b.Dy()/scale)
+	withGameScale(1, func() {
+		withSceneLayers(layerSprites, func() {
+			drawScene(base, 0, 0, snap, alpha, mobileFade, pictFade)
+		})
+	})
+	drawUpscaled(dst, base, scale)
+	withGameScale(scale, func() {
+		withSceneLayers(layerLabels, func() {
+			renderWorldScene(dst, snap, alpha, mobileFade, pictFade)
+		})
+	})
+}
+
+// renderWorldScene draws the world for snap followed by the night overlay.
+// The caller is responsible for setting gs.GameScale.
+func renderWorldScene(dst *ebiten.Image, snap drawSnapshot, alpha float64, mobileFade, pictFade float32) {
+	drawScene(dst, 0, 0, snap, alpha, mobileFade, pictFade)
+	if gs.nightEffect {
+		t := profStart()
+		drawNightOverlay(dst, 0, 0)
+		profEnd(profNight, t)
+	}
+}
+
+// renderOffscreen renders a complete world frame (scene, night overlay and
+// status bars) for snap into a new image at the given integer scale, through
+// the upscaler when one is on. It does not touch worldRT or gameImage, so it
+// is safe to use for captures and tests.
+func renderOffscreen(snap drawSnapshot, scale int, alpha float64, mobileFade, pictFade float32) *ebiten.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	dst := ebiten.NewImageWithOptions(image.Rect(0, 0, gameAreaSizeX*scale, gameAreaSizeY*scale), &ebiten.NewImageOptions{Unmanaged: true})
+	renderWorld(dst, snap, scale, alpha, mobileFade, pictFade)
+	withGameScale(scale, func() {
+		drawStatusBars(dst, 0, 0, snap, alpha)
+	})
+	return dst
+}
+
+// renderUIOffscreen draws all open eui windows into a new w×h image using
+// the current eui layout.
+func renderUIOffscreen(w, h int) *ebiten.Image {
+	dst := ebiten.NewImageWithOptions(image.Rect(0, 0, w, h), &ebiten.NewImageOptions{Unmanaged: true})
+	eui.Draw(dst)
+	return dst
+}
+
+// movieFrameSnapshot replays frames[0:idx+1] of a parsed clMov through the
+// normal draw-state path and returns the snapshot for frame idx. Interpolation
+// state is cleared so the result does not depend on wall-clock timing.
+func movieFrameSnapshot(frames [][]byte, idx int) (drawSnapshot, error) {
+	if idx < 0 || idx >= len(frames) {
+		return drawSnapshot{}, fmt.Errorf("frame %d out of range (0-%d)", idx, len(frames)-1)
+	}
+	resetDrawState()
+	frameCounter = 0
+	for _, m := range frames[:idx+1] {
+		if len(m) >= 2 && binary.BigEndian.Uint16(m[:2]) == 2 {
+			handleDrawState(m)
+		} else {
+			frameCounter++
+		}
+	}
+	resetInterpolation()
+	return captureDrawSnapshot(), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// Sound resampling qualities, stored in gs.SoundQuality.
+const (
+	resampleFast = "fast" // linear interpolation
+	resampleGood = "good" // 8 zero crossings of windowed sinc
+	resampleBest = "best" // 32 zero crossings of windowed sinc
+)
+
+// resampleQualities lists the selectable qualities in menu order.
+var resampleQualities = []struct {
+	name  string
+	label string
+}{
+	{resampleFast, "Fast (linear)"},
+	{resampleGood, "Good (sinc)"},
+	{resampleBest, "Best (long sinc)"},
+}
+
+// sincParams describes a Kaiser-windowed sinc kernel: zero crossings on
+// each side, table phases between input samples, and the window's beta.
+type sincParams struct {
+	taps   int
+	phases int
+	beta   float64
+}
+
+var sincQualities = map[string]sincParams{
+	resampleGood: {taps: 8, phases: 128, beta: 6},
+	resampleBest: {taps: 32, phases: 512, beta: 9},
+}
+
+// resampleSound converts src from srcRate to dstRate at the given quality.
+// Unknown qualities fall back to linear interpolation.
+func resampleSound(src []int16, srcRate, dstRate int, quality string) []int16 {
+	p, ok := sincQualities[quality]
+	if !ok || srcRate == dstRate || len(src) == 0 {
+		return resampleLinear(src, srcRate, dstRate)
+	}
+	return resampleSinc(src, srcRate, dstRate, p)
+}
+
+// sincKernel is a polyphase table: row i holds the coefficients for an
+// output falling i/phases of the way between two input samples.
+type sincKernel struct {
+	half   int // input samples on each side of the output
+	phases int
+	rows   []float32 // (phases+1) rows of 2*half coefficients
+}
+
+type sincKey struct {
+	p      sincParams
+	cutoff float64
+}
+
+var (
+	sincMu      sync.Mutex
+	sincKernels = make(map[sincKey]*sincKernel)
+)
+
+// getSincKernel returns the table for p with the passband ending at cutoff
+// times the input Nyquist frequency, building it on first use.
+func getSincKernel(p sincParams, cutoff float64) *sincKernel {
+	key := sincKey{p, cutoff}
+	sincMu.Lock()
+	defer sincMu.Unlock()
+	if k, ok := sincKernels[key]; ok {
+		return k
+	}
+	// Lowering the cutoff widens the sinc; keep the same number of zero
+	// crossings under the window.
+	half := int(math.Ceil(float64(p.taps) / cutoff))
+	k := &sincKernel{half: half, phases: p.phases, rows: make([]float32, (p.phases+1)*2*half)}
+	i0beta := besselI0(p.beta)
+	for ph := 0; ph <= p.phases; ph++ {
+		frac := float64(ph) / float64(p.phases)
+		row := k.rows[ph*2*half : (ph+1)*2*half]
+		sum := 0.0
+		coef := make([]float64, 2*half)
+		for j := range coef {
+			x := float64(j-half+1) - frac
+			u := x / float64(half)
+			if u <= -1 || u >= 1 {
+				continue
+			}
+			w := besselI0(p.beta*math.Sqrt(1-u*u)) / i0beta
+			coef[j] = cutoff * sinc(cutoff*x) * w
+			sum += coef[j]
+		}
+		// Normalize each phase so flat signals stay flat.
+		for j, c := range coef {
+			row[j] = float32(c / sum)
+		}
+	}
+	sincKernels[key] = k
+	return k
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+// resampleSinc band-limits src while converting it, so upsampling leaves
+// no images above the original Nyquist frequency and downsampling does not
+// fold high frequencies back into the passband.
+func resampleSinc(src []int16, srcRate, dstRate int, p sincParams) []int16 {
+	n := int(math.Round(float64(len(src)) * float64(dstRate) / float64(srcRate)))
+	dst := make([]int16, n)
+	cutoff := 1.0
+	if dstRate < srcRate {
+		// Leave a little room for the transition band.
+		cutoff = float64(dstRate) / float64(srcRate) * 0.95
+	}
+	k := getSincKernel(p, cutoff)
+	in := make([]float32, len(src))
+	for i, s := range src {
+		in[i] = float32(s)
+	}
+	width := 2 * k.half
+	for i := range dst {
+		num := int64(i) * int64(srcRate)
+		center := int(num / int64(dstRate))
+		phase := float64(num%int64(dstRate)) / float64(dstRate) * float64(k.phases)
+		ph := int(phase)
+		w := float32(phase - float64(ph))
+		r0 := k.rows[ph*width : (ph+1)*width]
+		r1 := k.rows[(ph+1)*width : (ph+2)*width]
+		first := center - k.half + 1
+		var acc float32
+		if first >= 0 && first+width <= len(in) {
+			win := in[first : first+width]
+			for j, s := range win {
+				acc += s * (r0[j] + w*(r1[j]-r0[j]))
+			}
+		} else {
+			for j := 0; j < width; j++ {
+				if idx := first + j; idx >= 0 && idx < len(in) {
+					acc += in[idx] * (r0[j] + w*(r1[j]-r0[j]))
+				}
+			}
+		}
+		dst[i] = int16(max(min(math.Round(float64(acc)), math.MaxInt16), math.MinInt16))
+	}
+	return dst
+}
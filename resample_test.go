@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func sineS16(n, rate int, freq, amp float64) []int16 {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(math.Round(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))))
+	}
+	return s
+}
+
+// toneLevel measures the amplitude of freq in s with the Goertzel
+// algorithm, skipping the edges.
+func toneLevel(s []int16, rate int, freq float64) float64 {
+	s = s[len(s)/8 : len(s)*7/8]
+	w := 2 * math.Pi * freq / float64(rate)
+	c := 2 * math.Cos(w)
+	var s1, s2 float64
+	for _, v := range s {
+		s1, s2 = float64(v)+c*s1-s2, s1
+	}
+	return math.Sqrt(s1*s1+s2*s2-c*s1*s2) * 2 / float64(len(s))
+}
+
+func TestResampleSoundLength(t *testing.T) {
+	src := sineS16(1000, 11025, 440, 8000)
+	for _, q := range resampleQualities {
+		for _, rate := range []int{22050, 44100, 8000} {
+			got := resampleSound(src, 11025, rate, q.name)
+			if want := len(resampleLinear(src, 11025, rate)); len(got) != want {
+				t.Errorf("%s to %d: %d samples, want %d", q.name, rate, len(got), want)
+			}
+		}
+	}
+	if got := resampleSound(src, 11025, 44100, resampleFast); !slices.Equal(got, resampleLinear(src, 11025, 44100)) {
+		t.Error("fast quality differs from linear interpolation")
+	}
+}
+
+func TestResampleSincFlat(t *testing.T) {
+	src := make([]int16, 500)
+	for i := range src {
+		src[i] = 1000
+	}
+	for _, q := range []string{resampleGood, resampleBest} {
+		out := resampleSound(src, 11025, 44100, q)
+		for i := 200; i < len(out)-200; i++ {
+			if d := out[i] - 1000; d < -1 || d > 1 {
+				t.Fatalf("%s: sample %d = %d, want 1000", q, i, out[i])
+			}
+		}
+	}
+}
+
+func TestResampleSincImages(t *testing.T) {
+	// A 4 kHz tone at 11025 Hz leaves an image at 7025 Hz when upsampled
+	// without a proper low-pass filter.
+	src := sineS16(11025, 11025, 4000, 16000)
+	image := 11025.0 - 4000
+	lin := resampleSound(src, 11025, 44100, resampleFast)
+	linImage := toneLevel(lin, 44100, image)
+	for _, q := range []string{resampleGood, resampleBest} {
+		out := resampleSound(src, 11025, 44100, q)
+		if tone := toneLevel(out, 44100, 4000); math.Abs(tone-16000) > 300 {
+			t.Errorf("%s: tone level %.0f, want 16000", q, tone)
+		}
+		if img := toneLevel(out, 44100, image); img > linImage/20 {
+			t.Errorf("%s: image level %.0f, linear %.0f", q, img, linImage)
+		}
+	}
+}
+
+func TestResampleSincAliasing(t *testing.T) {
+	// Downsampling a 15 kHz tone to 22050 Hz folds it to 7050 Hz unless it
+	// is filtered out first.
+	src := sineS16(44100, 44100, 15000, 16000)
+	alias := 22050.0 - 15000
+	lin := toneLevel(resampleSound(src, 44100, 22050, resampleFast), 22050, alias)
+	for _, q := range []string{resampleGood, resampleBest} {
+		out := resampleSound(src, 44100, 22050, q)
+		if a := toneLevel(out, 22050, alias); a > lin/20 {
+			t.Errorf("%s: alias level %.0f, linear %.0f", q, a, lin)
+		}
+	}
+}
+
+func benchmarkResample(b *testing.B, quality string) {
+	src := sineS16(11025, 11025, 440, 8000)
+	b.SetBytes(int64(len(src) * 2))
+	for b.Loop() {
+		resampleSound(src, 11025, 44100, quality)
+	}
+}
+
+func BenchmarkResampleLinear(b *testing.B) { benchmarkResample(b, resampleFast) }
+func BenchmarkResampleGood(b *testing.B)   { benchmarkResample(b, resampleGood) }
+func BenchmarkResampleBest(b *testing.B)   { benchmarkResample(b, resampleBest) }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const screenshotDir = "screenshots"
+
+// screenshotRequested is set by the hotkey or /screenshot command and
+// consumed by the next Draw call, which owns the GPU images.
+var screenshotRequested atomic.Bool
+
+// requestScreenshot asks the renderer to capture the next frame.
+func requestScreenshot() {
+	screenshotRequested.Store(true)
+}
+
+// screenshotMeta describes the frame a screenshot was taken from.
+type screenshotMeta struct {
+	Character  string
+	Time       time.Time
+	NightLevel int
+	Frame      int
+}
+
+func currentScreenshotMeta() screenshotMeta {
+	gNight.mu.Lock()
+	lvl := gNight.Level
+	gNight.mu.Unlock()
+	return screenshotMeta{
+		Character:  playerName,
+		Time:       time.Now(),
+		NightLevel: lvl,
+		Frame:      frameCounter,
+	}
+}
+
+// captureScreenshot copies rect from src into CPU memory and saves it on a
+// background goroutine so the frame does not hitch while encoding.
+func captureScreenshot(src *ebiten.Image, rect image.Rectangle) {
+	rect = rect.Intersect(src.Bounds())
+	if rect.Empty() {
+		logError("screenshot: empty capture area")
+		return
+	}
+	img := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	src.SubImage(rect).(*ebiten.Image).ReadPixels(img.Pix)
+	meta := currentScreenshotMeta()
+	go func() {
+		path, err := saveScreenshot(img, meta)
+		if err != nil {
+			logError("screenshot: %v", err)
+			return
+		}
+		consoleMessage("Screenshot saved: " + path)
+	}()
+}
+
+func saveScreenshot(img *image.RGBA, meta screenshotMeta) (string, error) {
+	if err := os.MkdirAll(screenshotDir, 0755); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	data, err := insertPNGText(buf.Bytes(), meta.textChunks())
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("gothoom-%s-%d.png", meta.Time.Format("20060102-150405"), meta.Frame)
+	path := filepath.Join(screenshotDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// textChunks returns the key/value pairs stored as PNG tEXt chunks.
+func (m screenshotMeta) textChunks() [][2]string {
+	chunks := [][2]string{
+		{"Software", "goThoom " + strconv.Itoa(clientVersion)},
+		{"Creation Time", m.Time.Format(time.RFC1123Z)},
+		{"Night Level", strconv.Itoa(m.NightLevel)},
+		{"Frame", strconv.Itoa(m.Frame)},
+	}
+	if m.Character != "" {
+		chunks = append(chunks, [2]string{"Character", m.Character})
+	}
+	return chunks
+}
+
+// insertPNGText inserts tEXt chunks directly after the IHDR chunk of an
+// encoded PNG. image/png has no way to write ancillary chunks itself.
+func insertPNGText(data []byte, texts [][2]string) ([]byte, error) {
+	const sigLen = 8
+	if len(data) < sigLen+8 {
+		return nil, fmt.Errorf("png too short")
+	}
+	ihdrLen := int(binary.BigEndian.Uint32(data[sigLen:]))
+	end := sigLen + 8 + ihdrLen + 4 // length, type, data, crc
+	if end > len(data) || string(data[sigLen+4:sigLen+8]) != "IHDR" {
+		return nil, fmt.Errorf("png missing IHDR")
+	}
+	out := make([]byte, 0, len(data)+64*len(texts))
+	out = append(out, data[:end]...)
+	for _, kv := range texts {
+		out = appendPNGChunk(out, "tEXt", []byte(kv[0]+"\x00"+kv[1]))
+	}
+	out = append(out, data[end:]...)
+	return out, nil
+}
+
+func appendPNGChunk(out []byte, typ string, payload []byte) []byte {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload)))
+	copy(hdr[4:], typ)
+	out = append(out, hdr[:]...)
+	out = append(out, payload...)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(payload)
+	return binary.BigEndian.AppendUint32(out, crc.Sum32())
+}
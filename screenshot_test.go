@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestInsertPNGText(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data, err := insertPNGText(buf.Bytes(), [][2]string{{"Character", "Tester"}, {"Frame", "42"}})
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if !bytes.Contains(data, []byte("tEXtCharacter\x00Tester")) {
+		t.Fatalf("character chunk missing")
+	}
+	if !bytes.Contains(data, []byte("tEXtFrame\x0042")) {
+		t.Fatalf("frame chunk missing")
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+}
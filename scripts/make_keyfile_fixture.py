@@ -0,0 +1,195 @@
+#!/usr/bin/env python3
+"""Build testdata/keyfile/CL_Images, the small CL_Images the keyfile writer
+tests rebuild.
+
+The file is written here, independently of the Go writers, so the tests
+compare them against a second implementation of the format. Records are
+stored in the form the writers produce (animation tables trimmed to the
+used entries, item names ending at their terminator, images packed with the
+same run rule), but laid out like the shipped files: out of table order,
+with unused bytes between them.
+
+Usage: scripts/make_keyfile_fixture.py [output]
+"""
+
+import os
+import struct
+import sys
+
+TYPE_IDREF = 0x50446635
+TYPE_IMAGE = 0x42697432
+TYPE_COLOR = 0x436C7273
+TYPE_LIGHT = 0x4C697431
+TYPE_CLIENT_ITEM = 0x43496D34
+
+FLAG_TRANSPARENT = 0x8000
+FLAG_CUSTOM_COLORS = 0x2000
+FLAG_NO_CHECKSUM = 0x0400
+
+
+class Bits:
+    def __init__(self):
+        self.buf = bytearray()
+        self.n = 0
+
+    def put(self, v, nbits):
+        for i in range(nbits - 1, -1, -1):
+            if self.n == 0:
+                self.buf.append(0)
+            if (v >> i) & 1:
+                self.buf[-1] |= 0x80 >> self.n
+            self.n = (self.n + 1) % 8
+
+
+def encode_image(width, height, pix, value_bits, run_bits, reserved=0):
+    """Pack pix: repeats of two or more become repeat runs, the rest literal
+    runs that stop where a repeat starts, all at most 1<<run_bits long."""
+    assert len(pix) == width * height
+    out = Bits()
+    out.buf += struct.pack(">HHIBB", height, width, reserved, value_bits, run_bits)
+    max_run = 1 << run_bits
+    i = 0
+    while i < len(pix):
+        run = 1
+        while i + run < len(pix) and run < max_run and pix[i + run] == pix[i]:
+            run += 1
+        if run >= 2:
+            out.put(0, 1)
+            out.put(run - 1, run_bits)
+            out.put(pix[i], value_bits)
+            i += run
+            continue
+        j = i + 1
+        while j < len(pix) and j - i < max_run and not (j + 1 < len(pix) and pix[j + 1] == pix[j]):
+            j += 1
+        out.put(1, 1)
+        out.put(j - i - 1, run_bits)
+        for v in pix[i:j]:
+            out.put(v, value_bits)
+        i = j
+    return bytes(out.buf)
+
+
+def adler(data, s1, s2):
+    for b in data:
+        s1 = (s1 + b) % 65521
+        s2 = (s2 + s1) % 65521
+    return s1, s2
+
+
+def checksum(pict_id, d, bits, colors, light):
+    s1, s2 = adler(bits, 1, 0)
+    s1, s2 = adler(colors, s1, s2)
+    if light is not None:
+        s1, s2 = adler(light, s1, s2)
+    anims = d["anims"]
+    head = struct.pack(
+        ">IIIIIIIihHh",
+        d["version"], d["image"], d["color"], 0, d["flags"],
+        d.get("unused", 0), d.get("unused2", 0), d.get("light", 0),
+        d["plane"], d["frames"], len(anims),
+    ) + b"".join(struct.pack(">h", a) for a in anims)
+    s1, s2 = adler(head, s1, s2)
+    s1, s2 = adler(struct.pack(">I", pict_id), s1, s2)
+    key = (0x3C, 0x5A, 0x69, 0x93, 0xA5, 0xC6)
+    raw = struct.pack(">I", ((s2 << 16) + (s1 & 0xFFFF)) & 0xFFFFFFFF)
+    return struct.unpack(">I", bytes(b ^ key[i] for i, b in enumerate(raw)))[0]
+
+
+def pict_def(d, sum_):
+    anims = d["anims"]
+    return struct.pack(
+        ">IIIIIIIihHh",
+        d["version"], d["image"], d["color"], sum_, d["flags"],
+        d.get("unused", 0), d.get("unused2", 0), d.get("light", 0),
+        d["plane"], d["frames"], len(anims),
+    ) + b"".join(struct.pack(">h", a) for a in anims)
+
+
+def item(flags, slot, right, left, worn, name):
+    return struct.pack(">IiIII", flags, slot, right, left, worn) + name.encode("mac_roman") + b"\0"
+
+
+def build():
+    images = {}
+    # 12x8: long repeats cut at the 16 pixel run limit and literal runs
+    # longer than one run.
+    pix = []
+    for y in range(8):
+        for x in range(12):
+            pix.append(2 if y < 2 or y == 7 else (x * 3 + y) % 8)
+    images[1] = encode_image(12, 8, pix, 3, 4)
+    # 16x32, two 16x16 frames with 8-bit indexes.
+    pix = []
+    for y in range(32):
+        for x in range(16):
+            if y < 16:
+                pix.append(5 if 4 <= x < 12 else 0)
+            else:
+                pix.append(x + (y - 16) * 16 if (x + y) % 3 else 6)
+    images[2] = encode_image(16, 32, pix, 8, 5)
+    # 8x5 with a custom color row on top and a non-zero reserved word.
+    pix = [0, 1, 2, 3, 4, 5, 6, 7]
+    for y in range(4):
+        pix += [(x + y) % 3 + 8 * (x % 2) for x in range(8)]
+    images[3] = encode_image(8, 5, pix, 4, 3, reserved=0x00010002)
+
+    colors = {
+        1: bytes([0, 0x23, 0x05, 0xD7, 0x9F, 0x6B, 0xE3, 0xFF]),
+        2: bytes(range(0x10, 0x10 + 16)),
+    }
+    lights = {7: bytes([0, 1, 0, 2, 0x40, 0x40, 0x80, 0x10, 0xFF, 0, 0x33, 0x44])}
+
+    defs = {
+        100: dict(version=0x100, image=1, color=1, flags=FLAG_TRANSPARENT, plane=-1, frames=1, anims=[]),
+        101: dict(version=0x100, image=2, color=1, flags=0x0002, unused=5, light=7, plane=3,
+                  frames=2, anims=[0, 1, 1, 0]),
+        102: dict(version=0x100, image=3, color=2, flags=FLAG_CUSTOM_COLORS | FLAG_NO_CHECKSUM,
+                  plane=0, frames=1, anims=[], stored=0),
+        103: dict(version=0x100, image=1, color=2, flags=FLAG_NO_CHECKSUM, plane=2, frames=1,
+                  anims=[0], stored=0xDEADBEEF),
+    }
+    picts = {}
+    for pict_id, d in defs.items():
+        light = lights[d["light"]] if d.get("light") else None
+        sum_ = d["stored"] if "stored" in d else checksum(pict_id, d, images[d["image"]], colors[d["color"]], light)
+        picts[pict_id] = pict_def(d, sum_)
+
+    items = {
+        5: item(1, 3, 101, 0, 100, "Wooden Shield"),
+        6: item(0, -1, 0, 102, 0, "Épée"),
+    }
+
+    records = []
+    for typ, recs in ((TYPE_IDREF, picts), (TYPE_IMAGE, images), (TYPE_COLOR, colors),
+                      (TYPE_LIGHT, lights), (TYPE_CLIENT_ITEM, items)):
+        for rid, data in recs.items():
+            records.append((typ, rid, data))
+    records.sort(key=lambda r: (r[0], r[1]))
+
+    table_end = 12 + 16 * len(records)
+    body = bytearray(b"\xa5" * 6)  # unused bytes after the table
+    offsets = {}
+    # Data goes in reverse table order, with a gap after the second record.
+    for n, (typ, rid, data) in enumerate(reversed(records)):
+        offsets[(typ, rid)] = table_end + len(body)
+        body += data
+        if n == 1:
+            body += b"gap!"
+
+    out = bytearray(struct.pack(">hIih", -1, len(records), -1, 2))
+    for typ, rid, data in records:
+        out += struct.pack(">IIII", offsets[(typ, rid)], len(data), typ, rid)
+    return bytes(out + body)
+
+
+def main():
+    root = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
+    path = sys.argv[1] if len(sys.argv) > 1 else os.path.join(root, "testdata", "keyfile", "CL_Images")
+    os.makedirs(os.path.dirname(path), exist_ok=True)
+    with open(path, "wb") as f:
+        f.write(build())
+
+
+if __name__ == "__main__":
+    main()
@@ -32,30 +32,56 @@ var gsdef settings = settings{
 	NameBgOpacity:     0.7,
 	SpeechBubbles:     true,
 
-	MotionSmoothing:   true,
-	BlendMobiles:      false,
-	BlendPicts:        false,
-	BlendAmount:       1.0,
-	MobileBlendAmount: 0.33,
-	MobileBlendFrames: 10,
-	PictBlendFrames:   10,
-	DenoiseImages:     false,
-	DenoiseSharpness:  4.0,
-	DenoisePercent:    0.2,
-	ShowFPS:           true,
-	UIScale:           1.0,
-	Fullscreen:        false,
-	Volume:            0.125,
-	Mute:              false,
-	GameScale:         2,
-	Theme:             "",
-	MessagesToConsole: false,
-	WindowTiling:      false,
-	WindowSnapping:    false,
-	AnyGameWindowSize: true,
-	IntegerScaling:    false,
-	NoCaching:         false,
-	PotatoComputer:    false,
+	MotionSmoothing:    true,
+	BlendMobiles:       false,
+	BlendPicts:         false,
+	BlendAmount:        1.0,
+	MobileBlendAmount:  0.33,
+	MobileBlendFrames:  10,
+	PictBlendFrames:    10,
+	DenoiseImages:      false,
+	DenoiseSharpness:   4.0,
+	DenoisePercent:     0.2,
+	ShowFPS:            true,
+	UIScale:            1.0,
+	Fullscreen:         false,
+	Volume:             0.125,
+	Mute:               false,
+	GameVolume:         1,
+	MusicVolume:        1,
+	AlertVolume:        1,
+	DuckForAlerts:      true,
+	SpeechEnabled:      false,
+	SpeechCommand:      "",
+	SpeechRate:         175,
+	SpeakThinksToYou:   true,
+	SpeakThinks:        false,
+	SpeakYells:         false,
+	SpeakSpeech:        false,
+	SpeakMentions:      true,
+	TextLogs:           true,
+	TextLogMaxKB:       1024,
+	GameScale:          2,
+	Theme:              "",
+	MessagesToConsole:  false,
+	WindowTiling:       false,
+	WindowSnapping:     false,
+	AnyGameWindowSize:  true,
+	IntegerScaling:     false,
+	NoCaching:          false,
+	PotatoComputer:     false,
+	ScreenshotHideUI:   false,
+	AutoMap:            false,
+	AutoMapZoom:        3,
+	SpriteAtlas:        true,
+	PaletteShader:      true,
+	UpscaleFilter:      "",
+	SoundQuality:       resampleGood,
+	ColorblindMode:     "",
+	DaltonizeScene:     false,
+	BubbleReadingSpeed: 180,
+	BubblesPerSpeaker:  1,
+	HoverInfo:          true,
 
 	GameWindow:      WindowState{Open: true},
 	InventoryWindow: WindowState{Open: true},
@@ -67,6 +93,7 @@ var gsdef settings = settings{
 	smoothingDebug:      false,
 	pictAgainDebug:      false,
 	pictIDDebug:         false,
+	frameProfiler:       false,
 	hideMoving:          false,
 	hideMobiles:         false,
 	vsync:               true,
@@ -97,28 +124,54 @@ type settings struct {
 	NameBgOpacity     float64
 	SpeechBubbles     bool
 
-	MotionSmoothing   bool
-	BlendMobiles      bool
-	BlendPicts        bool
-	BlendAmount       float64
-	MobileBlendAmount float64
-	MobileBlendFrames int
-	PictBlendFrames   int
-	DenoiseImages     bool
-	DenoiseSharpness  float64
-	DenoisePercent    float64
-	ShowFPS           bool
-	UIScale           float64
-	Fullscreen        bool
-	Volume            float64
-	Mute              bool
-	AnyGameWindowSize bool // allow arbitrary game window sizes
-	GameScale         float64
-	Theme             string
-	MessagesToConsole bool
-	WindowTiling      bool
-	WindowSnapping    bool
-	IntegerScaling    bool
+	MotionSmoothing    bool
+	BlendMobiles       bool
+	BlendPicts         bool
+	BlendAmount        float64
+	MobileBlendAmount  float64
+	MobileBlendFrames  int
+	PictBlendFrames    int
+	DenoiseImages      bool
+	DenoiseSharpness   float64
+	DenoisePercent     float64
+	ShowFPS            bool
+	UIScale            float64
+	Fullscreen         bool
+	Volume             float64
+	Mute               bool
+	GameVolume         float64 // per-category volumes, scaled by Volume
+	MusicVolume        float64
+	AlertVolume        float64
+	DuckForAlerts      bool // lower game sounds and music under alerts
+	SpeechEnabled      bool
+	SpeechCommand      string // espeak-ng compatible synthesizer; "" for espeak-ng
+	SpeechRate         int    // words per minute
+	SpeakThinksToYou   bool
+	SpeakThinks        bool
+	SpeakYells         bool
+	SpeakSpeech        bool // says and whispers
+	SpeakMentions      bool // any message with the player's name
+	TextLogs           bool // write chat and console to logs/text
+	TextLogMaxKB       int  // start a new log file past this size; 0 for no limit
+	AnyGameWindowSize  bool // allow arbitrary game window sizes
+	GameScale          float64
+	Theme              string
+	MessagesToConsole  bool
+	WindowTiling       bool
+	WindowSnapping     bool
+	IntegerScaling     bool
+	UpscaleFilter      string
+	SoundQuality       string // resampler for sounds below the device rate
+	ColorblindMode     string
+	DaltonizeScene     bool
+	BubbleReadingSpeed int // words per minute used for bubble lifetimes
+	BubblesPerSpeaker  int
+	HoverInfo          bool // tooltip for the mobile under the cursor
+	ScreenshotHideUI   bool // capture only the world scene, without windows or bars
+	AutoMap            bool // stitch background pictures into a world map
+	AutoMapZoom        int  // index into autoMapZooms
+	SpriteAtlas        bool // pack sprite sheets into shared textures with PotatoComputer
+	PaletteShader      bool // recolor custom-colored mobiles on the GPU
 
 	GameWindow      WindowState
 	InventoryWindow WindowState
@@ -130,6 +183,7 @@ type settings struct {
 	smoothingDebug      bool
 	pictAgainDebug      bool
 	pictIDDebug         bool
+	frameProfiler       bool
 	hideMoving          bool
 	hideMobiles         bool
 	vsync               bool
@@ -204,6 +258,7 @@ func applySettings() {
 	ebiten.SetWindowFloating(gs.Fullscreen)
 	initFont()
 	updateSoundVolume()
+	updateSpeech()
 }
 
 func saveSettings() {
@@ -309,6 +364,7 @@ type qualityPreset struct {
 	BlendMobiles    bool
 	BlendPicts      bool
 	NoCaching       bool
+	SoundQuality    string
 }
 
 var (
@@ -318,6 +374,7 @@ var (
 		BlendMobiles:    false,
 		BlendPicts:      false,
 		NoCaching:       true,
+		SoundQuality:    resampleFast,
 	}
 	lowPreset = qualityPreset{
 		DenoiseImages:   false,
@@ -325,6 +382,7 @@ var (
 		BlendMobiles:    false,
 		BlendPicts:      false,
 		NoCaching:       false,
+		SoundQuality:    resampleFast,
 	}
 	standardPreset = qualityPreset{
 		DenoiseImages:   true,
@@ -332,6 +390,7 @@ var (
 		BlendMobiles:    false,
 		BlendPicts:      false,
 		NoCaching:       false,
+		SoundQuality:    resampleGood,
 	}
 	highPreset = qualityPreset{
 		DenoiseImages:   true,
@@ -339,6 +398,7 @@ var (
 		BlendMobiles:    false,
 		BlendPicts:      true,
 		NoCaching:       false,
+		SoundQuality:    resampleGood,
 	}
 	ultimatePreset = qualityPreset{
 		DenoiseImages:   true,
@@ -346,6 +406,7 @@ var (
 		BlendMobiles:    true,
 		BlendPicts:      true,
 		NoCaching:       false,
+		SoundQuality:    resampleBest,
 	}
 )
 
@@ -371,6 +432,7 @@ func applyQualityPreset(name string) {
 	gs.BlendMobiles = p.BlendMobiles
 	gs.BlendPicts = p.BlendPicts
 	gs.NoCaching = p.NoCaching
+	gs.SoundQuality = p.SoundQuality
 	if gs.NoCaching {
 		gs.precacheSounds = false
 		gs.precacheImages = false
@@ -403,6 +465,13 @@ func applyQualityPreset(name string) {
 	if noCacheCB != nil {
 		noCacheCB.Checked = gs.NoCaching
 	}
+	if soundQualityDD != nil {
+		for i, q := range resampleQualities {
+			if q.name == gs.SoundQuality {
+				soundQualityDD.Selected = i
+			}
+		}
+	}
 
 	applySettings()
 	clearCaches()
@@ -423,7 +492,8 @@ func matchesPreset(p qualityPreset) bool {
 		gs.MotionSmoothing == p.MotionSmoothing &&
 		gs.BlendMobiles == p.BlendMobiles &&
 		gs.BlendPicts == p.BlendPicts &&
-		gs.NoCaching == p.NoCaching
+		gs.NoCaching == p.NoCaching &&
+		gs.SoundQuality == p.SoundQuality
 }
 
 func detectQualityPreset() int {
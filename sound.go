@@ -5,39 +5,43 @@ import (
 	"log"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2/audio"
 
 	"gothoom/clsnd"
 )
 
-const (
-	maxSounds = 64
-)
-
 var (
 	soundMu  sync.Mutex
 	clSounds *clsnd.CLSounds
 	pcmCache = make(map[uint16][]byte)
 
 	audioContext *audio.Context
-	soundPlayers = make(map[*audio.Player]struct{})
+	mixerPlayer  *audio.Player
 )
 
-// stopAllSounds halts and disposes all currently playing audio players.
+// stopAllSounds silences every sound and song.
 func stopAllSounds() {
-	soundMu.Lock()
-	defer soundMu.Unlock()
-	for sp := range soundPlayers {
-		_ = sp.Close()
-		delete(soundPlayers, sp)
+	if gMixer != nil {
+		gMixer.stopAll()
 	}
+	gTunes.stop(0)
 }
 
-// playSound mixes the provided sound IDs and plays the result asynchronously.
-// Each ID is loaded, mixed with simple clipping and then played at the current
-// global volume. The function returns immediately after scheduling playback.
+// thinkToSound is the chime the classic client plays for a think to you,
+// your group or your clan (GameWin_cl.cp, kSndThinkTo).
+const thinkToSound = 58
+
+// playSound plays the provided game sound IDs asynchronously.
 func playSound(ids ...uint16) {
+	playCategorySound(soundGame, ids...)
+}
+
+// playCategorySound loads the provided sound IDs and starts them together in
+// the mixer under cat's volume. The function returns immediately after
+// scheduling playback.
+func playCategorySound(cat soundCategory, ids ...uint16) {
 	if len(ids) == 0 {
 		return
 	}
@@ -47,7 +51,7 @@ func playSound(ids ...uint16) {
 			logDebug("playSound blocked by blockSound")
 			return
 		}
-		if audioContext == nil {
+		if audioContext == nil || gMixer == nil {
 			logDebug("playSound no audio context")
 			return
 		}
@@ -65,7 +69,6 @@ func playSound(ids ...uint16) {
 		}
 
 		sounds := make([][]byte, 0, len(ids))
-		maxSamples := 0
 		for _, id := range ids {
 			if valid != nil {
 				if _, ok := valid[id]; !ok {
@@ -78,115 +81,51 @@ func playSound(ids ...uint16) {
 				continue
 			}
 			sounds = append(sounds, pcm)
-			if n := len(pcm) / 2; n > maxSamples {
-				maxSamples = n
-			}
 		}
 		if len(sounds) == 0 {
 			logDebug("playSound no pcm returned")
 			return
 		}
 
-		mixed := make([]int32, maxSamples)
-		for _, pcm := range sounds {
-			n := len(pcm) / 2
-			for i := 0; i < n; i++ {
-				sample := int16(binary.LittleEndian.Uint16(pcm[2*i:]))
-				mixed[i] += int32(sample)
-			}
-		}
-
-		// Find the peak amplitude to normalize the mix
-		maxVal := int32(0)
-		for _, v := range mixed {
-			if v < 0 {
-				v = -v
-			}
-			if v > maxVal {
-				maxVal = v
-			}
-		}
-		// Apply peak normalization and reduce volume for overlapping sounds
-		scale := 1 / float64(len(sounds))
-		if maxVal > 0 {
-			scale *= math.Min(1.0, 32767.0/float64(maxVal))
-		}
-
-		out := make([]byte, len(mixed)*2)
-		for i, v := range mixed {
-			v = int32(float64(v) * scale)
-			if v > 32767 {
-				v = 32767
-			} else if v < -32768 {
-				v = -32768
-			}
-			binary.LittleEndian.PutUint16(out[2*i:], uint16(int16(v)))
-		}
-
-		p := audioContext.NewPlayerFromBytes(out)
-		vol := gs.Volume
-		if gs.Mute {
-			vol = 0
-		}
-		p.SetVolume(vol)
-
-		soundMu.Lock()
-		for sp := range soundPlayers {
-			if !sp.IsPlaying() {
-				sp.Close()
-				delete(soundPlayers, sp)
-			}
-		}
-		if maxSounds > 0 && len(soundPlayers) >= maxSounds {
-			soundMu.Unlock()
-			logDebug("playSound too many sound players (%d)", len(soundPlayers))
-			p.Close()
-			return
-		}
-		soundPlayers[p] = struct{}{}
-		soundMu.Unlock()
-
 		logDebug("playSound playing")
-		p.Play()
+		gMixer.play(cat, sounds...)
 	}(append([]uint16(nil), ids...))
 }
 
-// initSoundContext initializes the global audio context.
+// mixerBufferSize keeps the latency of new sounds low.
+const mixerBufferSize = 60 * time.Millisecond
+
+// initSoundContext initializes the global audio context and starts the
+// mixer.
 func initSoundContext() {
 	rate := 44100
 	audioContext = audio.NewContext(rate)
+	gMixer = newAudioMixer(rate)
+	p, err := audioContext.NewPlayerF32(gMixer)
+	if err != nil {
+		logError("start audio mixer: %v", err)
+		return
+	}
+	p.SetBufferSize(mixerBufferSize)
+	p.Play()
+	mixerPlayer = p
+	updateSoundVolume()
 }
 
+// updateSoundVolume applies the volume settings to the mixer.
 func updateSoundVolume() {
+	if gMixer == nil {
+		return
+	}
 	vol := gs.Volume
 	if gs.Mute {
 		vol = 0
 	}
-
-	soundMu.Lock()
-	players := make([]*audio.Player, 0, len(soundPlayers))
-	for sp := range soundPlayers {
-		players = append(players, sp)
-	}
-	soundMu.Unlock()
-
-	stopped := make([]*audio.Player, 0)
-	for _, sp := range players {
-		if sp.IsPlaying() {
-			sp.SetVolume(vol)
-		} else {
-			stopped = append(stopped, sp)
-		}
-	}
-
-	if len(stopped) > 0 {
-		soundMu.Lock()
-		defer soundMu.Unlock()
-		for _, sp := range stopped {
-			delete(soundPlayers, sp)
-			sp.Close()
-		}
-	}
+	gMixer.setGains(vol, [numSoundCategories]float64{
+		soundGame:  gs.GameVolume,
+		soundMusic: gs.MusicVolume,
+		soundAlert: gs.AlertVolume,
+	}, gs.DuckForAlerts)
 }
 
 func resampleLinear(src []int16, srcRate, dstRate int) []int16 {
@@ -275,8 +214,10 @@ func applyFadeInOut(samples []int16, rate int) {
 }
 
 // loadSound retrieves a sound by ID, resamples it to match the audio context's
-// sample rate, and caches the resulting PCM bytes. The CL_Sounds archive is
-// opened on first use and individual sounds are parsed lazily.
+// sample rate, and caches the resulting PCM bytes. A replacement from the
+// sound pack is preferred over CL_Sounds, and any manifest trim is applied.
+// The CL_Sounds archive is opened on first use and individual sounds are
+// parsed lazily.
 func loadSound(id uint16) []byte {
 	logDebug("loadSound(%d) called", id)
 	if audioContext == nil {
@@ -299,6 +240,40 @@ func loadSound(id uint16) []byte {
 	c := clSounds
 	soundMu.Unlock()
 
+	dstRate := audioContext.SampleRate()
+	samples, ok := loadSoundOverride(id, dstRate)
+	if !ok {
+		samples = decodeArchiveSound(c, id, dstRate)
+		if samples == nil {
+			return nil
+		}
+	}
+	applyGain(samples, soundTrim(id))
+
+	applyFadeInOut(samples, dstRate)
+
+	pcm := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		pcm[2*i] = byte(v)
+		pcm[2*i+1] = byte(v >> 8)
+	}
+
+	if gs.NoCaching {
+		if c != nil {
+			c.ClearCache()
+		}
+	} else {
+		soundMu.Lock()
+		pcmCache[id] = pcm
+		soundMu.Unlock()
+		logDebug("loadSound(%d) cached %d bytes", id, len(pcm))
+	}
+	return pcm
+}
+
+// decodeArchiveSound decodes id from CL_Sounds into 16-bit samples at dstRate.
+// Missing sounds are cached as nil.
+func decodeArchiveSound(c *clsnd.CLSounds, id uint16, dstRate int) []int16 {
 	if c == nil {
 		logDebug("loadSound(%d) CL sounds not loaded", id)
 		return nil
@@ -317,7 +292,7 @@ func loadSound(id uint16) []byte {
 			pcmCache[id] = nil
 			soundMu.Unlock()
 		} else {
-			clSounds.ClearCache()
+			c.ClearCache()
 		}
 		return nil
 	}
@@ -325,7 +300,6 @@ func loadSound(id uint16) []byte {
 	logDebug("loadSound(%d) loaded %d Hz %d-bit %d bytes", id, s.SampleRate, s.Bits, len(s.Data))
 
 	srcRate := int(s.SampleRate / 2)
-	dstRate := audioContext.SampleRate()
 
 	// Decode the sound data into 16-bit samples.
 	var samples []int16
@@ -346,26 +320,10 @@ func loadSound(id uint16) []byte {
 
 	if srcRate != dstRate {
 		logDebug("loadSound(%d) resampling from %d to %d", id, srcRate, dstRate)
-		samples = resampleLinear(samples, srcRate, dstRate)
+		samples = resampleSound(samples, srcRate, dstRate, gs.SoundQuality)
 	}
 
-	applyFadeInOut(samples, dstRate)
-
-	pcm := make([]byte, len(samples)*2)
-	for i, v := range samples {
-		pcm[2*i] = byte(v)
-		pcm[2*i+1] = byte(v >> 8)
-	}
-
-	if gs.NoCaching {
-		clSounds.ClearCache()
-	} else {
-		soundMu.Lock()
-		pcmCache[id] = pcm
-		soundMu.Unlock()
-		logDebug("loadSound(%d) cached %d bytes", id, len(pcm))
-	}
-	return pcm
+	return samples
 }
 
 // soundCacheStats returns the number of cached sounds and total bytes used.
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gothoom/clsnd"
+)
+
+// Helpers for the sound browser: metadata, waveform peaks and WAV export.
+// The window itself lives in sound_browser_ui.go.
+
+// soundFrames returns the number of sample frames in s.
+func soundFrames(s *clsnd.Sound) int {
+	bytesPer := int(s.Bits) / 8
+	if bytesPer <= 0 || s.Channels == 0 {
+		return 0
+	}
+	return len(s.Data) / (bytesPer * int(s.Channels))
+}
+
+// soundDuration returns the playing time of s at its native rate.
+func soundDuration(s *clsnd.Sound) time.Duration {
+	if s.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(soundFrames(s)) * time.Second / time.Duration(s.SampleRate)
+}
+
+// soundSample returns sample i of s in -1..1. Eight bit data is unsigned and
+// sixteen bit data big-endian signed, as stored in CL_Sounds.
+func soundSample(s *clsnd.Sound, i int) float32 {
+	switch s.Bits {
+	case 8:
+		return (float32(s.Data[i]) - 128) / 128
+	case 16:
+		return float32(int16(binary.BigEndian.Uint16(s.Data[2*i:]))) / 32768
+	}
+	return 0
+}
+
+// soundPeaks splits s into columns and returns the minimum and maximum
+// sample of each, across all channels.
+func soundPeaks(s *clsnd.Sound, columns int) [][2]float32 {
+	frames := soundFrames(s)
+	if frames == 0 || columns <= 0 {
+		return nil
+	}
+	chans := int(s.Channels)
+	peaks := make([][2]float32, columns)
+	for c := range peaks {
+		start := c * frames / columns
+		end := (c + 1) * frames / columns
+		if end <= start {
+			end = start + 1
+		}
+		if end > frames {
+			end = frames
+		}
+		lo, hi := float32(1), float32(-1)
+		for f := start; f < end; f++ {
+			for ch := 0; ch < chans; ch++ {
+				v := soundSample(s, f*chans+ch)
+				lo = min(lo, v)
+				hi = max(hi, v)
+			}
+		}
+		if lo > hi {
+			lo, hi = 0, 0
+		}
+		peaks[c] = [2]float32{lo, hi}
+	}
+	return peaks
+}
+
+// writeWAV encodes s as a PCM WAV file.
+func writeWAV(w io.Writer, s *clsnd.Sound) error {
+	if s.Bits != 8 && s.Bits != 16 {
+		return fmt.Errorf("unsupported sample size %d", s.Bits)
+	}
+	bytesPer := uint32(s.Bits) / 8
+	dataLen := uint32(soundFrames(s)) * bytesPer * s.Channels
+	bw := bufio.NewWriter(w)
+	hdr := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + dataLen),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(1), // PCM
+		uint16(s.Channels),
+		s.SampleRate,
+		s.SampleRate * s.Channels * bytesPer,
+		uint16(s.Channels * bytesPer),
+		s.Bits,
+		[4]byte{'d', 'a', 't', 'a'},
+		dataLen,
+	}
+	for _, v := range hdr {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	data := s.Data[:dataLen]
+	if s.Bits == 16 {
+		// WAV stores 16 bit samples little-endian.
+		swapped := make([]byte, len(data))
+		for i := 0; i+1 < len(data); i += 2 {
+			swapped[i], swapped[i+1] = data[i+1], data[i]
+		}
+		data = swapped
+	}
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exportSoundWAV writes sound id to exportDir and returns the file path.
+func exportSoundWAV(id uint32) (string, error) {
+	soundMu.Lock()
+	c := clSounds
+	soundMu.Unlock()
+	if c == nil {
+		return "", fmt.Errorf("CL_Sounds not loaded")
+	}
+	s, err := c.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", fmt.Errorf("sound %d not found", id)
+	}
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(exportDir, fmt.Sprintf("sound-%d.wav", id))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := writeWAV(f, s); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// filterSoundIDs returns the sorted IDs whose decimal form contains query.
+func filterSoundIDs(ids []uint32, query string) []uint32 {
+	query = strings.TrimSpace(query)
+	var out []uint32
+	for _, id := range ids {
+		if query == "" || strings.Contains(strconv.FormatUint(uint64(id), 10), query) {
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
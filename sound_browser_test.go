@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"gothoom/clsnd"
+)
+
+func TestWriteWAV16(t *testing.T) {
+	s := &clsnd.Sound{
+		Data:       []byte{0x12, 0x34, 0xff, 0xfe},
+		SampleRate: 22050,
+		Channels:   1,
+		Bits:       16,
+	}
+	var buf bytes.Buffer
+	if err := writeWAV(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) != 44+4 {
+		t.Fatalf("len = %d, want 48", len(b))
+	}
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" || string(b[36:40]) != "data" {
+		t.Fatalf("bad header: %q", b[:44])
+	}
+	if rate := binary.LittleEndian.Uint32(b[24:]); rate != 22050 {
+		t.Fatalf("rate = %d", rate)
+	}
+	// Samples are swapped from big to little endian.
+	if want := []byte{0x34, 0x12, 0xfe, 0xff}; !bytes.Equal(b[44:], want) {
+		t.Fatalf("data = % x, want % x", b[44:], want)
+	}
+}
+
+func TestSoundPeaksAndDuration(t *testing.T) {
+	s := &clsnd.Sound{
+		Data:       []byte{128, 255, 128, 0},
+		SampleRate: 4,
+		Channels:   1,
+		Bits:       8,
+	}
+	if d := soundDuration(s); d != time.Second {
+		t.Fatalf("duration = %v, want 1s", d)
+	}
+	peaks := soundPeaks(s, 2)
+	if len(peaks) != 2 {
+		t.Fatalf("len = %d", len(peaks))
+	}
+	if peaks[0][0] != 0 || peaks[0][1] < 0.99 {
+		t.Errorf("first column = %v, want [0 ~1]", peaks[0])
+	}
+	if peaks[1][0] != -1 || peaks[1][1] != 0 {
+		t.Errorf("second column = %v, want [-1 0]", peaks[1])
+	}
+}
+
+func TestFilterSoundIDs(t *testing.T) {
+	got := filterSoundIDs([]uint32{30, 1, 13, 200}, "3")
+	if len(got) != 2 || got[0] != 13 || got[1] != 30 {
+		t.Fatalf("got %v, want [13 30]", got)
+	}
+}
@@ -0,0 +1,282 @@
+//go:build !test
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	soundListCols = 5
+	soundListRows = 6
+	waveformW     = 300
+	waveformH     = 80
+)
+
+var (
+	soundWin         *eui.WindowData
+	soundQuery       string
+	soundIDs         []uint32
+	soundPage        int
+	soundSelected    uint32
+	soundHasSel      bool
+	soundCountText   *eui.ItemData
+	soundInfoText    *eui.ItemData
+	soundButtons     [soundListCols * soundListRows]*eui.ItemData
+	waveformItem     *eui.ItemData
+	waveformImg      *ebiten.Image
+	waveformNeedDraw bool
+)
+
+func makeSoundBrowserWindow() {
+	if soundWin != nil {
+		return
+	}
+	const width = waveformW
+	soundWin = eui.NewWindow()
+	soundWin.Title = "Sound Browser"
+	soundWin.Closable = true
+	soundWin.Resizable = false
+	soundWin.AutoSize = true
+	soundWin.Movable = true
+	soundWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+
+	filter, filterEvents := eui.NewInput()
+	filter.Label = "Filter"
+	filter.TextPtr = &soundQuery
+	filter.Tooltip = "Show IDs containing these digits"
+	filter.Size = eui.Point{X: width, Y: 24}
+	filterEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventInputChanged {
+			soundQuery = ev.Text
+			applySoundFilter()
+		}
+	}
+	flow.AddItem(filter)
+
+	nav := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	prev, prevEvents := eui.NewButton()
+	prev.Text = "<"
+	prev.Size = eui.Point{X: 32, Y: 24}
+	prevEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setSoundPage(soundPage - 1)
+		}
+	}
+	nav.AddItem(prev)
+	next, nextEvents := eui.NewButton()
+	next.Text = ">"
+	next.Size = eui.Point{X: 32, Y: 24}
+	nextEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			setSoundPage(soundPage + 1)
+		}
+	}
+	nav.AddItem(next)
+	soundCountText, _ = eui.NewText()
+	soundCountText.Size = eui.Point{X: width - 64, Y: 24}
+	soundCountText.FontSize = 10
+	nav.AddItem(soundCountText)
+	flow.AddItem(nav)
+
+	for r := 0; r < soundListRows; r++ {
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		for c := 0; c < soundListCols; c++ {
+			slot := r*soundListCols + c
+			btn, events := eui.NewButton()
+			btn.Size = eui.Point{X: width/soundListCols - 4, Y: 22}
+			btn.Margin = 2
+			btn.FontSize = 10
+			events.Handle = func(ev eui.UIEvent) {
+				if ev.Type == eui.EventClick {
+					idx := soundPage*len(soundButtons) + slot
+					if idx < len(soundIDs) {
+						selectSound(soundIDs[idx])
+						playSound(uint16(soundIDs[idx]))
+					}
+				}
+			}
+			soundButtons[slot] = btn
+			row.AddItem(btn)
+		}
+		flow.AddItem(row)
+	}
+
+	waveformItem, waveformImg = eui.NewImageItem(waveformW, waveformH)
+	flow.AddItem(waveformItem)
+
+	soundInfoText, _ = eui.NewText()
+	soundInfoText.Size = eui.Point{X: width, Y: 24}
+	soundInfoText.FontSize = 10
+	flow.AddItem(soundInfoText)
+
+	actions := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	playBtn, playEvents := eui.NewButton()
+	playBtn.Text = "Play"
+	playBtn.Size = eui.Point{X: width/3 - 4, Y: 24}
+	playEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick && soundHasSel {
+			playSound(uint16(soundSelected))
+		}
+	}
+	actions.AddItem(playBtn)
+	stopBtn, stopEvents := eui.NewButton()
+	stopBtn.Text = "Stop"
+	stopBtn.Size = eui.Point{X: width/3 - 4, Y: 24}
+	stopEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			stopAllSounds()
+		}
+	}
+	actions.AddItem(stopBtn)
+	exportBtn, exportEvents := eui.NewButton()
+	exportBtn.Text = "Export WAV"
+	exportBtn.Size = eui.Point{X: width/3 - 4, Y: 24}
+	exportBtn.Tooltip = "Save the sound at its native rate to the exports folder"
+	exportEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type != eui.EventClick || !soundHasSel {
+			return
+		}
+		path, err := exportSoundWAV(soundSelected)
+		if err != nil {
+			logError("export sound %d: %v", soundSelected, err)
+			return
+		}
+		consoleMessage("Exported " + path)
+	}
+	actions.AddItem(exportBtn)
+	flow.AddItem(actions)
+
+	soundWin.AddItem(flow)
+	soundWin.AddWindow(false)
+}
+
+// openSoundBrowser (re)loads the sound list and shows the window near anchor.
+func openSoundBrowser(anchor *eui.ItemData) {
+	makeSoundBrowserWindow()
+	if soundWin.IsOpen() {
+		soundWin.Close()
+		return
+	}
+	applySoundFilter()
+	soundWin.MarkOpenNear(anchor)
+}
+
+func applySoundFilter() {
+	soundMu.Lock()
+	c := clSounds
+	soundMu.Unlock()
+	var all []uint32
+	if c != nil {
+		all = c.IDs()
+	}
+	soundIDs = filterSoundIDs(all, soundQuery)
+	setSoundPage(0)
+	var first uint32
+	if len(soundIDs) > 0 {
+		first = soundIDs[0]
+	}
+	selectSound(first)
+}
+
+func setSoundPage(page int) {
+	pages := (len(soundIDs) + len(soundButtons) - 1) / len(soundButtons)
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	soundPage = page
+	for slot, btn := range soundButtons {
+		idx := page*len(soundButtons) + slot
+		if idx < len(soundIDs) {
+			btn.Text = strconv.FormatUint(uint64(soundIDs[idx]), 10)
+			btn.Invisible = false
+		} else {
+			btn.Text = ""
+			btn.Invisible = true
+		}
+		btn.Dirty = true
+	}
+	if soundCountText != nil {
+		soundCountText.Text = fmt.Sprintf("%d sounds, page %d/%d", len(soundIDs), soundPage+1, max(pages, 1))
+		soundCountText.Dirty = true
+	}
+	if soundWin != nil {
+		soundWin.Refresh()
+	}
+}
+
+func selectSound(id uint32) {
+	soundSelected = id
+	soundHasSel = len(soundIDs) > 0
+	waveformNeedDraw = true
+	if soundInfoText == nil {
+		return
+	}
+	soundInfoText.Text = "No sound selected"
+	if soundHasSel {
+		soundInfoText.Text = fmt.Sprintf("Sound %d", id)
+		soundMu.Lock()
+		c := clSounds
+		soundMu.Unlock()
+		if c != nil {
+			if s, err := c.Get(id); s != nil {
+				soundInfoText.Text = fmt.Sprintf("Sound %d  %d Hz  %d-bit  %d ch  %.2fs",
+					id, s.SampleRate, s.Bits, s.Channels, soundDuration(s).Seconds())
+			} else if err != nil {
+				soundInfoText.Text = fmt.Sprintf("Sound %d: %v", id, err)
+			}
+		}
+	}
+	soundInfoText.Dirty = true
+}
+
+// updateSoundBrowser redraws the waveform after the selection changes. It is
+// called from Draw so GPU work stays on the render thread.
+func updateSoundBrowser() {
+	if !waveformNeedDraw || soundWin == nil || !soundWin.IsOpen() || waveformImg == nil {
+		return
+	}
+	waveformNeedDraw = false
+	waveformImg.Fill(color.RGBA{0x10, 0x10, 0x10, 0xff})
+	defer func() { waveformItem.Dirty = true }()
+
+	mid := float64(waveformH) / 2
+	rect := func(x, y, w, h float64, c color.RGBA) {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(w, h)
+		op.GeoM.Translate(x, y)
+		op.ColorScale.ScaleWithColor(c)
+		waveformImg.DrawImage(whiteImage, op)
+	}
+	rect(0, mid, waveformW, 1, color.RGBA{0x40, 0x40, 0x40, 0xff})
+	if !soundHasSel {
+		return
+	}
+	soundMu.Lock()
+	c := clSounds
+	soundMu.Unlock()
+	if c == nil {
+		return
+	}
+	s, _ := c.Get(soundSelected)
+	if s == nil {
+		return
+	}
+	wave := color.RGBA{0x56, 0xb4, 0xe9, 0xff}
+	for x, p := range soundPeaks(s, waveformW) {
+		top := mid - float64(p[1])*mid
+		bottom := mid - float64(p[0])*mid
+		rect(float64(x), top, 1, max(bottom-top, 1), wave)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+)
+
+// Sound packs replace CL_Sounds entries with <id>.wav or <id>.ogg files in
+// soundOverrideDir. A manifest.json in the same directory can trim the
+// volume of any sound, replaced or not:
+//
+//	{"trim": {"58": -6, "1012": 3.5}}
+//
+// Trims are in decibels. Decoded sounds are cached like archive sounds; the
+// cache is dropped when anything in the directory changes.
+
+var soundOverrideDir = filepath.Join(dataDirPath, "overrides", "sounds")
+
+const soundManifestFile = "manifest.json"
+
+type soundManifest struct {
+	Trim map[string]float64 `json:"trim"`
+}
+
+var (
+	soundTrimMu  sync.Mutex
+	soundTrims   map[uint16]float64
+	soundTrimMod time.Time
+
+	soundPackSig     string
+	soundPackChecked bool
+)
+
+// parseSoundManifest decodes a sound pack manifest into per-ID trims in dB.
+func parseSoundManifest(data []byte) (map[uint16]float64, error) {
+	var m soundManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	trims := make(map[uint16]float64, len(m.Trim))
+	for k, db := range m.Trim {
+		id, err := strconv.ParseUint(k, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("trim: bad sound ID %q", k)
+		}
+		trims[uint16(id)] = db
+	}
+	return trims, nil
+}
+
+// soundTrim returns the volume trim for id in dB. The manifest is reread
+// whenever it changes on disk.
+func soundTrim(id uint16) float64 {
+	path := filepath.Join(soundOverrideDir, soundManifestFile)
+	soundTrimMu.Lock()
+	defer soundTrimMu.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		soundTrims, soundTrimMod = nil, time.Time{}
+		return 0
+	}
+	if !info.ModTime().Equal(soundTrimMod) {
+		soundTrimMod = info.ModTime()
+		soundTrims = nil
+		data, err := os.ReadFile(path)
+		if err == nil {
+			soundTrims, err = parseSoundManifest(data)
+		}
+		if err != nil {
+			logError("sound manifest %s: %v", path, err)
+		}
+	}
+	return soundTrims[id]
+}
+
+// applyGain scales samples by db decibels, clipping at full scale.
+func applyGain(samples []int16, db float64) {
+	if db == 0 {
+		return
+	}
+	g := math.Pow(10, db/20)
+	for i, v := range samples {
+		s := math.Round(float64(v) * g)
+		samples[i] = int16(max(math.MinInt16, min(math.MaxInt16, s)))
+	}
+}
+
+// soundDecoder decodes a file to 16-bit little endian stereo at rate.
+type soundDecoder func(rate int, src io.Reader) (io.Reader, error)
+
+var soundDecoders = []struct {
+	ext    string
+	decode soundDecoder
+}{
+	{".wav", func(rate int, src io.Reader) (io.Reader, error) { return wav.DecodeWithSampleRate(rate, src) }},
+	{".ogg", func(rate int, src io.Reader) (io.Reader, error) { return vorbis.DecodeWithSampleRate(rate, src) }},
+}
+
+// loadSoundOverride decodes the replacement for id from the sound pack, if
+// there is one. The result is interleaved stereo at rate, which the player
+// consumes the same way as the doubled-rate mono produced for archive sounds.
+func loadSoundOverride(id uint16, rate int) ([]int16, bool) {
+	for _, d := range soundDecoders {
+		path := filepath.Join(soundOverrideDir, fmt.Sprintf("%d%s", id, d.ext))
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		samples, err := decodeSoundFile(f, rate, d.decode)
+		f.Close()
+		if err != nil {
+			logError("sound override %s: %v", path, err)
+			continue
+		}
+		logDebug("loadSound(%d) using %s", id, path)
+		return samples, true
+	}
+	return nil, false
+}
+
+func decodeSoundFile(f io.Reader, rate int, decode soundDecoder) ([]int16, error) {
+	stream, err := decode(rate, f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	// Both decoders produce 16-bit little endian stereo; drop any partial
+	// frame at the end.
+	data = data[:len(data)/4*4]
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples, nil
+}
+
+// soundPackSignature summarises the files in dir so edits can be detected
+// without decoding anything.
+func soundPackSignature(dir string) string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || f.IsDir() {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", f.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String()
+}
+
+// watchSoundOverrides polls the sound pack at the same rate as sprite
+// overrides, off the game thread.
+func watchSoundOverrides() {
+	for {
+		checkSoundOverrides()
+		time.Sleep(overrideCheckInterval)
+	}
+}
+
+// checkSoundOverrides drops decoded sounds when the sound pack changed since
+// the last check.
+func checkSoundOverrides() {
+	sig := soundPackSignature(soundOverrideDir)
+	if soundPackChecked && sig == soundPackSig {
+		return
+	}
+	first := !soundPackChecked
+	soundPackSig, soundPackChecked = sig, true
+	if first {
+		return
+	}
+	clearSoundCache()
+	consoleMessage("Reloaded sound pack")
+}
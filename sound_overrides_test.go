@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"gothoom/clsnd"
+)
+
+func TestParseSoundManifest(t *testing.T) {
+	trims, err := parseSoundManifest([]byte(`{"trim": {"58": -6, "1012": 3.5}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if trims[58] != -6 || trims[1012] != 3.5 || len(trims) != 2 {
+		t.Errorf("trims = %v", trims)
+	}
+	if _, err := parseSoundManifest([]byte(`{"trim": {"loud": -6}}`)); err == nil {
+		t.Error("non-numeric ID accepted")
+	}
+	if _, err := parseSoundManifest([]byte(`{"trim": {"70000": 1}}`)); err == nil {
+		t.Error("out of range ID accepted")
+	}
+}
+
+func TestApplyGain(t *testing.T) {
+	s := []int16{1000, -1000, 30000, -30000}
+	applyGain(s, -6)
+	want := int16(math.Round(1000 * math.Pow(10, -6.0/20)))
+	if s[0] != want || s[1] != -want {
+		t.Errorf("-6dB = %v, want ±%d", s[:2], want)
+	}
+	s = []int16{30000, -30000}
+	applyGain(s, 6)
+	if s[0] != math.MaxInt16 || s[1] != math.MinInt16 {
+		t.Errorf("+6dB did not clip: %v", s)
+	}
+}
+
+func TestDecodeSoundFileWAV(t *testing.T) {
+	// 16-bit mono at 22050 Hz, stored big endian as in CL_Sounds.
+	src := &clsnd.Sound{Channels: 1, Bits: 16, SampleRate: 22050}
+	for _, v := range []int16{0, 8000, -8000, 16000} {
+		src.Data = append(src.Data, byte(uint16(v)>>8), byte(v))
+	}
+	var buf bytes.Buffer
+	if err := writeWAV(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := decodeSoundFile(&buf, 22050, soundDecoders[0].decode)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// Mono is expanded to interleaved stereo.
+	want := []int16{0, 0, 8000, 8000, -8000, -8000, 16000, 16000}
+	if len(samples) != len(want) {
+		t.Fatalf("samples = %v, want %v", samples, want)
+	}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Fatalf("samples = %v, want %v", samples, want)
+		}
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/hajimehoshi/ebiten/v2/audio"
-
 	"gothoom/clsnd"
 )
 
@@ -67,21 +65,18 @@ func TestPlaySoundIDs(t *testing.T) {
 	initSoundContext()
 	gs.Volume = 1
 
-	messages = nil
-	soundMu.Lock()
-	soundPlayers = make(map[*audio.Player]struct{})
-	soundMu.Unlock()
+	// Hold the mixer so the short test sound stays queued.
+	mixerPlayer.Pause()
+	gMixer.stopAll()
 
+	messages = nil
 	playSound(1)
 	time.Sleep(50 * time.Millisecond)
 	if len(messages) != 0 {
 		t.Fatalf("unexpected messages for valid id: %v", messages)
 	}
-	soundMu.Lock()
-	have := len(soundPlayers) > 0
-	soundMu.Unlock()
-	if !have {
-		t.Fatalf("sound player not created for valid id")
+	if gMixer.active() == 0 {
+		t.Fatalf("no voice started for valid id")
 	}
 
 	messages = nil
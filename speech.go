@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+)
+
+// speechClass is a kind of chat message that can be read aloud.
+type speechClass int
+
+const (
+	speechThinkToYou speechClass = iota
+	speechThink                  // thinks to the clan, a group or everyone
+	speechYell
+	speechSay     // normal speech and whispers
+	speechMention // the player's name in any of the above
+)
+
+const (
+	defaultSpeechCommand = "espeak-ng"
+	speechQueueLen       = 16
+)
+
+// speechBackend turns text into speech.
+type speechBackend interface {
+	// Speak says text and returns once it has been said or stopped.
+	Speak(text string) error
+	// Stop interrupts the text being said.
+	Stop()
+}
+
+// nullSpeech records what it is asked to say instead of saying it.
+type nullSpeech struct {
+	mu   sync.Mutex
+	said []string
+}
+
+func (n *nullSpeech) Speak(text string) error {
+	n.mu.Lock()
+	n.said = append(n.said, text)
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullSpeech) Stop() {}
+
+func (n *nullSpeech) spoken() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.said...)
+}
+
+// commandSpeech runs a command-line synthesizer compatible with espeak-ng.
+// The text goes in on standard input so it is never taken for an option.
+// With the mixer running the synthesizer writes a WAV that plays as an
+// alert, so game sounds duck under it; otherwise it plays the speech
+// itself.
+type commandSpeech struct {
+	command string
+	rate    int // words per minute
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	voice  *mixVoice
+}
+
+// args returns the synthesizer arguments; toStdout asks for a WAV.
+func (c *commandSpeech) args(toStdout bool) []string {
+	var args []string
+	if toStdout {
+		args = append(args, "--stdout")
+	}
+	if c.rate > 0 {
+		args = append(args, "-s", strconv.Itoa(c.rate))
+	}
+	return args
+}
+
+func (c *commandSpeech) Speak(text string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	defer c.Stop()
+
+	mixed := gMixer != nil && audioContext != nil
+	cmd := exec.CommandContext(ctx, c.command, c.args(mixed)...)
+	cmd.Stdin = strings.NewReader(text)
+	hideCommandWindow(cmd)
+	if !mixed {
+		return cmd.Run()
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	stream, err := wav.DecodeWithSampleRate(audioContext.SampleRate(), bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+	pcm, err := io.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	v := gMixer.play(soundAlert, pcm)[0]
+	c.mu.Lock()
+	c.voice = v
+	c.mu.Unlock()
+	for gMixer.playing(v) && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+func (c *commandSpeech) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	if c.voice != nil {
+		gMixer.stop(c.voice)
+		c.voice = nil
+	}
+}
+
+// speechQueue says messages one at a time in the order they arrive.
+type speechQueue struct {
+	mu      sync.Mutex
+	backend speechBackend
+	queue   chan string
+}
+
+var gSpeech = newSpeechQueue()
+
+func newSpeechQueue() *speechQueue {
+	q := &speechQueue{queue: make(chan string, speechQueueLen)}
+	go q.run()
+	return q
+}
+
+func (q *speechQueue) run() {
+	for text := range q.queue {
+		q.mu.Lock()
+		b := q.backend
+		q.mu.Unlock()
+		if b == nil {
+			continue
+		}
+		if err := b.Speak(text); err != nil {
+			logError("speech: %v", err)
+		}
+	}
+}
+
+// setBackend replaces the backend, stopping anything being said.
+func (q *speechQueue) setBackend(b speechBackend) {
+	q.mu.Lock()
+	old := q.backend
+	q.backend = b
+	q.mu.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// say queues text, dropping it when the queue is full so speech never
+// falls far behind the conversation.
+func (q *speechQueue) say(text string) {
+	select {
+	case q.queue <- text:
+	default:
+		logDebug("speech queue full, dropping %q", text)
+	}
+}
+
+// stop interrupts the current message and forgets the queued ones.
+func (q *speechQueue) stop() {
+	for {
+		select {
+		case <-q.queue:
+			continue
+		default:
+		}
+		break
+	}
+	q.mu.Lock()
+	b := q.backend
+	q.mu.Unlock()
+	if b != nil {
+		b.Stop()
+	}
+}
+
+// speechSettings are the settings the speech backend is built from.
+type speechSettings struct {
+	enabled bool
+	command string
+	rate    int
+}
+
+// speechApplied is what updateSpeech last set up; applying other settings
+// leaves the backend, and whatever it is saying, alone.
+var (
+	speechApplied   speechSettings
+	speechAppliedOK bool
+)
+
+// updateSpeech applies the speech settings, replacing the backend only when
+// they changed.
+func updateSpeech() {
+	cur := speechSettings{enabled: gs.SpeechEnabled, command: gs.SpeechCommand, rate: gs.SpeechRate}
+	if speechAppliedOK && cur == speechApplied {
+		return
+	}
+	speechApplied, speechAppliedOK = cur, true
+	if !cur.enabled {
+		gSpeech.setBackend(nil)
+		gSpeech.stop()
+		return
+	}
+	command := cur.command
+	if command == "" {
+		command = defaultSpeechCommand
+	}
+	gSpeech.setBackend(&commandSpeech{command: command, rate: cur.rate})
+}
+
+// speechClassFor classifies a bubble for speech.
+func speechClassFor(typ int, verb string, target thinkTarget) (speechClass, bool) {
+	switch {
+	case verb == "thinks" && target == thinkToYou:
+		return speechThinkToYou, true
+	case verb == "thinks":
+		return speechThink, true
+	}
+	switch typ & kBubbleTypeMask {
+	case kBubbleYell:
+		return speechYell, true
+	case kBubbleNormal, kBubbleWhisper:
+		return speechSay, true
+	}
+	return 0, false
+}
+
+// speechClassEnabled reports whether messages of class are read aloud.
+func speechClassEnabled(class speechClass) bool {
+	switch class {
+	case speechThinkToYou:
+		return gs.SpeakThinksToYou
+	case speechThink:
+		return gs.SpeakThinks
+	case speechYell:
+		return gs.SpeakYells
+	case speechSay:
+		return gs.SpeakSpeech
+	case speechMention:
+		return gs.SpeakMentions
+	}
+	return false
+}
+
+// mentionsName reports whether text contains name as a whole word.
+func mentionsName(text, name string) bool {
+	if name == "" {
+		return false
+	}
+	lt, ln := strings.ToLower(text), strings.ToLower(name)
+	for i := 0; ; {
+		j := strings.Index(lt[i:], ln)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(ln)
+		if !wordRuneBefore(lt, start) && !wordRuneAfter(lt, end) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func wordRuneBefore(s string, i int) bool {
+	r, n := utf8.DecodeLastRuneInString(s[:i])
+	return n > 0 && isWordRune(r)
+}
+
+func wordRuneAfter(s string, i int) bool {
+	r, n := utf8.DecodeRuneInString(s[i:])
+	return n > 0 && isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// speakBubble reads a chat line aloud when its class, or a mention of the
+// player's name, is selected. The player's own messages are not read.
+func speakBubble(typ int, verb string, target thinkTarget, name, text, msg string) {
+	if !gs.SpeechEnabled || msg == "" || (name != "" && name == playerName) {
+		return
+	}
+	class, ok := speechClassFor(typ, verb, target)
+	if (ok && speechClassEnabled(class)) ||
+		(speechClassEnabled(speechMention) && mentionsName(text, playerName)) {
+		gSpeech.say(msg)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSpeechClassFor(t *testing.T) {
+	cases := []struct {
+		typ    int
+		verb   string
+		target thinkTarget
+		want   speechClass
+		ok     bool
+	}{
+		{kBubbleThought, "thinks", thinkToYou, speechThinkToYou, true},
+		{kBubbleThought, "thinks", thinkToClan, speechThink, true},
+		{kBubbleYell | kBubbleFar, "yells", thinkNone, speechYell, true},
+		{kBubbleNormal, "says", thinkNone, speechSay, true},
+		{kBubbleWhisper, "whispers", thinkNone, speechSay, true},
+		{kBubbleNarrate, "", thinkNone, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := speechClassFor(c.typ, c.verb, c.target)
+		if got != c.want || ok != c.ok {
+			t.Errorf("speechClassFor(%d, %q, %d) = %d, %v", c.typ, c.verb, c.target, got, ok)
+		}
+	}
+}
+
+func TestMentionsName(t *testing.T) {
+	cases := []struct {
+		text string
+		want bool
+	}{
+		{"hello Torvald", true},
+		{"torvald, over here", true},
+		{"Torvalds are coming", false},
+		{"ask Torvald's friend", true},
+		{"nothing here", false},
+		{"Ötorvald", false},
+	}
+	for _, c := range cases {
+		if got := mentionsName(c.text, "Torvald"); got != c.want {
+			t.Errorf("mentionsName(%q) = %v", c.text, got)
+		}
+	}
+	if mentionsName("anything", "") {
+		t.Error("empty name matched")
+	}
+}
+
+func TestSpeakBubble(t *testing.T) {
+	saved, savedName := gs, playerName
+	defer func() { gs, playerName = saved, savedName; gSpeech.setBackend(nil) }()
+	gs.SpeechEnabled = true
+	gs.SpeakThinksToYou, gs.SpeakThinks, gs.SpeakYells, gs.SpeakSpeech, gs.SpeakMentions = true, false, false, false, true
+	playerName = "Torvald"
+	null := &nullSpeech{}
+	gSpeech.setBackend(null)
+
+	speakBubble(kBubbleThought, "thinks", thinkToYou, "Ann", "hi", "Ann thinks to you, hi")
+	speakBubble(kBubbleNormal, "says", thinkNone, "Ann", "hello all", "Ann says, hello all")
+	speakBubble(kBubbleNormal, "says", thinkNone, "Ann", "hi Torvald", "Ann says, hi Torvald")
+	speakBubble(kBubbleThought, "thinks", thinkToYou, "Torvald", "echo", "Torvald thinks to you, echo")
+	gs.SpeechEnabled = false
+	speakBubble(kBubbleThought, "thinks", thinkToYou, "Ann", "off", "Ann thinks to you, off")
+
+	want := []string{"Ann thinks to you, hi", "Ann says, hi Torvald"}
+	deadline := time.Now().Add(time.Second)
+	for len(null.spoken()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := null.spoken(); !slices.Equal(got, want) {
+		t.Errorf("spoken = %q, want %q", got, want)
+	}
+}
+
+func TestCommandSpeechArgs(t *testing.T) {
+	c := &commandSpeech{command: defaultSpeechCommand, rate: 200}
+	if got := c.args(true); !slices.Equal(got, []string{"--stdout", "-s", "200"}) {
+		t.Errorf("args = %q", got)
+	}
+	c.rate = 0
+	if got := c.args(false); len(got) != 0 {
+		t.Errorf("args = %q", got)
+	}
+}
+
+func TestUpdateSpeechKeepsBackend(t *testing.T) {
+	saved := gs
+	defer func() {
+		gs = saved
+		speechAppliedOK = false
+		gSpeech.setBackend(nil)
+	}()
+	backend := func() speechBackend {
+		gSpeech.mu.Lock()
+		defer gSpeech.mu.Unlock()
+		return gSpeech.backend
+	}
+	gs.SpeechEnabled, gs.SpeechCommand, gs.SpeechRate = true, "", 175
+	updateSpeech()
+	first := backend()
+	if first == nil {
+		t.Fatal("no backend")
+	}
+	gs.Volume /= 2
+	gs.SpeakYells = !gs.SpeakYells
+	updateSpeech()
+	if backend() != first {
+		t.Error("backend replaced when other settings changed")
+	}
+	gs.SpeechRate = 200
+	updateSpeech()
+	if b, ok := backend().(*commandSpeech); !ok || b == first || b.rate != 200 {
+		t.Errorf("backend after a rate change = %#v", backend())
+	}
+	gs.SpeechEnabled = false
+	updateSpeech()
+	if backend() != nil {
+		t.Error("backend kept after turning speech off")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	textLogTimeFormat = "20060102-150405"
+	textLogStamp      = "[15:04:05] "
+	// textLogNoCharacter names the folder for text logged before a
+	// character has logged in.
+	textLogNoCharacter = "client"
+)
+
+var textLogDir = filepath.Join("logs", "text")
+
+var (
+	chatLog    = &textLog{kind: "chat"}
+	consoleLog = &textLog{kind: "console"}
+)
+
+// textLog writes one kind of window text to per-character session files
+// under textLogDir/<character>/<kind>-<start>.log. A new file is started
+// for each character, each day and whenever the current file would grow
+// past TextLogMaxKB. Errors are reported with the standard logger only:
+// logError writes to the console, which would log again.
+type textLog struct {
+	kind string
+	dir  string           // textLogDir when empty
+	now  func() time.Time // time.Now when nil
+
+	mu        sync.Mutex
+	f         *os.File
+	character string
+	day       string
+	size      int64
+	failed    bool
+}
+
+// write appends msg with a timestamp, as it appears in the window.
+func (l *textLog) write(msg string) {
+	if !gs.TextLogs || playingMovie || msg == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	character := playerName
+	if character == "" {
+		character = textLogNoCharacter
+	}
+	line := now.Format(textLogStamp) + msg + "\n"
+	maxSize := int64(gs.TextLogMaxKB) * 1024
+	switch {
+	case character != l.character:
+		l.closeLocked()
+		l.character = character
+		l.failed = false
+	case now.Format("20060102") != l.day:
+		l.closeLocked()
+	case l.f != nil && maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > maxSize:
+		l.closeLocked()
+	}
+	if l.f == nil {
+		if l.failed {
+			return
+		}
+		if err := l.openLocked(now); err != nil {
+			log.Printf("text log: %v", err)
+			l.failed = true
+			return
+		}
+	}
+	n, err := l.f.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("text log: %v", err)
+		l.closeLocked()
+		l.failed = true
+	}
+}
+
+// openLocked starts a new session file for l.character.
+func (l *textLog) openLocked(now time.Time) error {
+	dir := filepath.Join(l.root(), textLogFolder(l.character))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := l.kind + "-" + now.Format(textLogTimeFormat)
+	name := base + ".log"
+	for part := 2; ; part++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			l.f = f
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		name = fmt.Sprintf("%s_%d.log", base, part)
+	}
+	l.day = now.Format("20060102")
+	l.size = 0
+	return nil
+}
+
+func (l *textLog) closeLocked() {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	l.day = ""
+	l.size = 0
+}
+
+// close finishes the current session file.
+func (l *textLog) close() {
+	l.mu.Lock()
+	l.closeLocked()
+	l.mu.Unlock()
+}
+
+func (l *textLog) root() string {
+	if l.dir != "" {
+		return l.dir
+	}
+	return textLogDir
+}
+
+// closeTextLogs finishes the current chat and console session files.
+func closeTextLogs() {
+	chatLog.close()
+	consoleLog.close()
+}
+
+// textLogFolder returns a folder name for character that is safe on every
+// platform.
+func textLogFolder(character string) string {
+	folder := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, character)
+	folder = strings.Trim(folder, ". ")
+	if folder == "" {
+		return "_"
+	}
+	return folder
+}
+
+// logSession is one file written by a textLog.
+type logSession struct {
+	kind  string
+	start time.Time
+	part  int // 1 for the first file of a session, then 2, 3...
+	path  string
+}
+
+func (s logSession) label() string {
+	label := s.start.Format("2006-01-02 15:04:05") + " " + s.kind
+	if s.part > 1 {
+		label += fmt.Sprintf(" (%d)", s.part)
+	}
+	return label
+}
+
+// parseLogSession parses a file name written by textLog.
+func parseLogSession(name string) (logSession, bool) {
+	base, ok := strings.CutSuffix(name, ".log")
+	if !ok {
+		return logSession{}, false
+	}
+	s := logSession{part: 1}
+	if i := strings.LastIndexByte(base, '_'); i >= 0 {
+		n, err := strconv.Atoi(base[i+1:])
+		if err != nil || n < 2 {
+			return logSession{}, false
+		}
+		s.part, base = n, base[:i]
+	}
+	kind, stamp, ok := strings.Cut(base, "-")
+	if !ok || kind == "" {
+		return logSession{}, false
+	}
+	start, err := time.ParseInLocation(textLogTimeFormat, stamp, time.Local)
+	if err != nil {
+		return logSession{}, false
+	}
+	s.kind, s.start = kind, start
+	return s, true
+}
+
+// listLogCharacters returns the characters with logs in dir, sorted by name.
+func listLogCharacters(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return names, nil
+}
+
+// listLogSessions returns the log files of a character, newest first.
+func listLogSessions(dir, character string) ([]logSession, error) {
+	folder := filepath.Join(dir, character)
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sessions []logSession
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		s, ok := parseLogSession(e.Name())
+		if !ok {
+			continue
+		}
+		s.path = filepath.Join(folder, e.Name())
+		sessions = append(sessions, s)
+	}
+	slices.SortFunc(sessions, func(a, b logSession) int {
+		if c := b.start.Compare(a.start); c != 0 {
+			return c
+		}
+		if a.kind != b.kind {
+			return strings.Compare(a.kind, b.kind)
+		}
+		return b.part - a.part
+	})
+	return sessions, nil
+}
+
+// readLogFile returns the lines of a log file.
+func readLogFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeLogClock returns a clock for a textLog that reads *t.
+func fakeLogClock(t *time.Time) func() time.Time {
+	return func() time.Time { return *t }
+}
+
+func withTextLogSettings(t *testing.T, maxKB int) {
+	saved, savedName := gs, playerName
+	t.Cleanup(func() { gs, playerName = saved, savedName })
+	gs.TextLogs = true
+	gs.TextLogMaxKB = maxKB
+}
+
+func sessionNames(t *testing.T, dir, character string) []string {
+	t.Helper()
+	sessions, err := listLogSessions(dir, character)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range sessions {
+		names = append(names, filepath.Base(s.path))
+	}
+	return names
+}
+
+func TestTextLogWrite(t *testing.T) {
+	withTextLogSettings(t, 0)
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 9, 21, 5, 7, 0, time.Local)
+	l := &textLog{kind: "chat", dir: dir, now: fakeLogClock(&now)}
+	defer l.close()
+
+	l.write("before login")
+	playerName = "Torvald"
+	l.write("Ann says, hi")
+	now = now.Add(2 * time.Second)
+	l.write("Ann yells, bye")
+
+	lines, err := readLogFile(filepath.Join(dir, "Torvald", "chat-20240309-210507.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"[21:05:07] Ann says, hi", "[21:05:09] Ann yells, bye"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if got := sessionNames(t, dir, textLogNoCharacter); !slices.Equal(got, []string{"chat-20240309-210507.log"}) {
+		t.Errorf("client sessions = %q", got)
+	}
+}
+
+func TestTextLogDailyRotation(t *testing.T) {
+	withTextLogSettings(t, 0)
+	playerName = "Torvald"
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 9, 23, 59, 58, 0, time.Local)
+	l := &textLog{kind: "console", dir: dir, now: fakeLogClock(&now)}
+	defer l.close()
+
+	l.write("late")
+	now = now.Add(time.Second)
+	l.write("later")
+	now = now.Add(2 * time.Second)
+	l.write("morning")
+
+	want := []string{"console-20240310-000001.log", "console-20240309-235958.log"}
+	if got := sessionNames(t, dir, "Torvald"); !slices.Equal(got, want) {
+		t.Errorf("sessions = %q, want %q", got, want)
+	}
+}
+
+func TestTextLogSizeRotation(t *testing.T) {
+	withTextLogSettings(t, 1)
+	playerName = "Torvald"
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.Local)
+	l := &textLog{kind: "chat", dir: dir, now: fakeLogClock(&now)}
+	defer l.close()
+
+	msg := string(make([]byte, 400))
+	for range 5 {
+		l.write(msg)
+	}
+
+	sessions, err := listLogSessions(dir, "Torvald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("%d files, want 3", len(sessions))
+	}
+	for i, s := range sessions {
+		if want := 3 - i; s.part != want {
+			t.Errorf("session %d part %d, want %d", i, s.part, want)
+		}
+		fi, err := os.Stat(s.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > 1024 {
+			t.Errorf("%s is %d bytes", s.path, fi.Size())
+		}
+	}
+	if got := sessions[2].label(); got != "2024-03-09 12:00:00 chat" {
+		t.Errorf("label = %q", got)
+	}
+	if got := sessions[0].label(); got != "2024-03-09 12:00:00 chat (3)" {
+		t.Errorf("label = %q", got)
+	}
+}
+
+func TestTextLogCharacterChange(t *testing.T) {
+	withTextLogSettings(t, 0)
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.Local)
+	l := &textLog{kind: "chat", dir: dir, now: fakeLogClock(&now)}
+	defer l.close()
+
+	playerName = "Torvald"
+	l.write("one")
+	playerName = "A/B"
+	l.write("two")
+	gs.TextLogs = false
+	l.write("off")
+
+	chars, err := listLogCharacters(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A_B", "Torvald"}; !slices.Equal(chars, want) {
+		t.Errorf("characters = %q, want %q", chars, want)
+	}
+	lines, err := readLogFile(filepath.Join(dir, "A_B", "chat-20240309-120000.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"[12:00:00] two"}; !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestParseLogSession(t *testing.T) {
+	cases := []struct {
+		name string
+		kind string
+		part int
+		ok   bool
+	}{
+		{"chat-20240309-120000.log", "chat", 1, true},
+		{"console-20240309-120000_4.log", "console", 4, true},
+		{"chat-20240309-120000_x.log", "", 0, false},
+		{"chat-20240309.log", "", 0, false},
+		{"notes.txt", "", 0, false},
+	}
+	for _, c := range cases {
+		s, ok := parseLogSession(c.name)
+		if ok != c.ok || s.kind != c.kind || (ok && s.part != c.part) {
+			t.Errorf("parseLogSession(%q) = %+v, %v", c.name, s, ok)
+		}
+	}
+	if names, err := listLogCharacters(filepath.Join(t.TempDir(), "missing")); err != nil || names != nil {
+		t.Errorf("missing dir: %q, %v", names, err)
+	}
+}
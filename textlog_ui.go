@@ -0,0 +1,141 @@
+//go:build !test
+
+package main
+
+import "gothoom/eui"
+
+var (
+	logsWin       *eui.WindowData
+	logsList      *eui.ItemData
+	logsHeader    *eui.ItemData
+	logsCharDD    *eui.ItemData
+	logsSessionDD *eui.ItemData
+
+	logsCharacters []string
+	logsSessions   []logSession
+	logsLines      []string
+)
+
+func makeLogsWindow() {
+	if logsWin != nil {
+		return
+	}
+	logsWin, logsList, _ = makeTextWindow("Logs", eui.HZoneCenter, eui.VZoneMiddleTop, false)
+	logsWin.Size = eui.Point{X: 560, Y: 450}
+
+	logsHeader = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	logsHeader.Size = eui.Point{X: 540, Y: 28}
+
+	charDD, charEvents := eui.NewDropdown()
+	logsCharDD = charDD
+	logsCharDD.Size = eui.Point{X: 180, Y: 24}
+	logsCharDD.FontSize = 12
+	charEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			selectLogCharacter(ev.Index)
+		}
+	}
+	logsHeader.AddItem(logsCharDD)
+
+	sessionDD, sessionEvents := eui.NewDropdown()
+	logsSessionDD = sessionDD
+	logsSessionDD.Size = eui.Point{X: 260, Y: 24}
+	logsSessionDD.FontSize = 12
+	sessionEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			selectLogSession(ev.Index)
+		}
+	}
+	logsHeader.AddItem(logsSessionDD)
+
+	logsList.Parent.PrependItem(logsHeader)
+
+	logsWin.OnResize = func() {
+		updateLogsWindow()
+		if logsWin != nil {
+			logsWin.Refresh()
+		}
+	}
+	refreshLogsWindow()
+}
+
+// openLogsWindow rescans the log folder and shows the logs window.
+func openLogsWindow(anchor *eui.ItemData) {
+	if logsWin == nil {
+		makeLogsWindow()
+	}
+	refreshLogsWindow()
+	logsWin.MarkOpenNear(anchor)
+}
+
+// refreshLogsWindow lists the characters with logs, preferring the one
+// playing now, and shows its newest session.
+func refreshLogsWindow() {
+	if logsCharDD == nil {
+		return
+	}
+	chars, err := listLogCharacters(textLogDir)
+	if err != nil {
+		logError("list text logs: %v", err)
+	}
+	logsCharacters = chars
+	logsCharDD.Options = append([]string(nil), chars...)
+	sel := 0
+	for i, c := range chars {
+		if playerName != "" && c == textLogFolder(playerName) {
+			sel = i
+		}
+	}
+	selectLogCharacter(sel)
+}
+
+func selectLogCharacter(i int) {
+	logsSessions, logsLines = nil, nil
+	logsSessionDD.Options = nil
+	if i >= 0 && i < len(logsCharacters) {
+		logsCharDD.Selected = i
+		sessions, err := listLogSessions(textLogDir, logsCharacters[i])
+		if err != nil {
+			logError("list text logs: %v", err)
+		}
+		logsSessions = sessions
+		for _, s := range sessions {
+			logsSessionDD.Options = append(logsSessionDD.Options, s.label())
+		}
+	}
+	selectLogSession(0)
+}
+
+func selectLogSession(i int) {
+	logsLines = nil
+	if i >= 0 && i < len(logsSessions) {
+		logsSessionDD.Selected = i
+		lines, err := readLogFile(logsSessions[i].path)
+		if err != nil {
+			logError("read text log: %v", err)
+		}
+		logsLines = lines
+	} else if len(logsCharacters) == 0 {
+		logsLines = []string{"No logs yet."}
+	}
+	updateLogsWindow()
+	if logsList != nil {
+		logsList.Scroll.Y = 0
+	}
+	if logsWin != nil {
+		logsWin.Refresh()
+	}
+}
+
+func updateLogsWindow() {
+	if logsWin == nil {
+		return
+	}
+	updateTextWindow(logsWin, logsList, nil, logsLines, gs.ChatFontSize, "")
+	// Leave room for the character and session pickers above the list.
+	logsHeader.Size.X = logsList.Size.X
+	logsList.Size.Y -= logsHeader.Size.Y
+	if logsList.Size.Y < 0 {
+		logsList.Size.Y = 0
+	}
+}
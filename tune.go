@@ -1,70 +1,948 @@
 package main
 
-import (
-	"math"
-	"strconv"
-	"strings"
+// Bard music, ported from the classic client's TuneHelper_cl.cp.
+//
+// Notation: a-g are quarter notes and A-G half notes, each optionally
+// followed by # (sharp), . (flat), _ (tied) and a duration 1-9 in eighths.
+// p is a rest, [..] a chord (followed by a duration or $ for a held chord),
+// + - = / \ change octave, @ sets the tempo (@+n, @-n, @=n or @n), % { }
+// set the volume, (..)n repeats n times with |n and ! marking numbered and
+// default endings, and <..> is a comment.
+
+const (
+	tuneNumOctaves           = 3
+	tuneOctave               = 12
+	tuneMiddleC              = 60
+	tuneDefaultVelocity      = 100
+	tuneMinTempo             = 60
+	tuneDefaultTempo         = 120
+	tuneMaxTempo             = 180
+	tuneTicksPerSecond       = 600 // QuickTime music time units
+	tuneDurationBlack        = 2
+	tuneDurationWhite        = 4
+	tuneNoteRestRatio        = 90 // a note sounds for 90% of its slot
+	tuneMaxChordNotes        = 12
+	tuneMaxMarks             = 6
+	tuneMaxEndings           = 10
+	tuneDefaultChordDuration = 4
+	tuneStartPause           = 300 // ticks, so duets start together
+	tuneEndPause             = 8   // beats, to let the last note ring
 )
 
-// playTuneSimple parses a space-separated list of note names and plays them as a
-// sequence of sine waves. Each note is assumed to be a quarter note at a
-// fixed tempo and octave if not specified (default octave 4).
-func playTuneSimple(tune string) {
-	if audioContext == nil {
-		return
+// tuneError is a notation error. The values and messages match the classic
+// client so bards see the errors they know.
+type tuneError int
+
+const (
+	tuneErrNone tuneError = iota
+	tuneErrInvalidNote
+	tuneErrInvalidModifier
+	tuneErrToneOverflow
+	tuneErrPolyphonyOverflow
+	tuneErrInvalidOctave
+	tuneErrInvalidChord
+	tuneErrUnsupportedInstrument
+	tuneErrOutOfMemory
+	tuneErrTooManyMarks
+	tuneErrUnmatchedMark
+	tuneErrUnmatchedComment
+	tuneErrInvalidTempo
+	tuneErrInvalidTempoChange
+	tuneErrModifierNeedValue
+	tuneErrDuplicateEnding
+	tuneErrDuplicateDefEnding
+	tuneErrEndingInChord
+	tuneErrEndingOutsideLoop
+	tuneErrDefaultEndingError
+	tuneErrInvalidEndingIndex
+	tuneErrUnterminatedLoop
+	tuneErrUnterminatedChord
+	tuneErrAlreadyPlaying
+)
+
+var tuneErrorMessages = [...]string{
+	tuneErrNone:                  "No Error",
+	tuneErrInvalidNote:           "The music contains an invalid character",
+	tuneErrInvalidModifier:       "The music contains an invalid note modifier",
+	tuneErrToneOverflow:          "A note is out of the allowed octaves",
+	tuneErrPolyphonyOverflow:     "Too many chord notes are playing for this instrument",
+	tuneErrInvalidOctave:         "A note is out of the allowed octaves",
+	tuneErrInvalidChord:          "Too many chord notes are playing for this instrument",
+	tuneErrUnsupportedInstrument: "Long chords are not supported on this instrument",
+	tuneErrOutOfMemory:           "Ran out of memory while building tune",
+	tuneErrTooManyMarks:          "Loops are nested too deeply",
+	tuneErrUnmatchedMark:         "There is an end loop mark without a start",
+	tuneErrUnmatchedComment:      "Invalid comment termination",
+	tuneErrInvalidTempo:          "A tempo is outside the allowed values",
+	tuneErrInvalidTempoChange:    "The tempo cannot change while chords are playing",
+	tuneErrModifierNeedValue:     "A tempo modifier is missing its value",
+	tuneErrDuplicateEnding:       "An ending number is defined more than once",
+	tuneErrDuplicateDefEnding:    "A default ending is defined more than once",
+	tuneErrEndingInChord:         "Ending marks cannot be specified in chords",
+	tuneErrEndingOutsideLoop:     "Ending marks cannot be specified outside loops",
+	tuneErrDefaultEndingError:    "Default endings cannot have an index",
+	tuneErrInvalidEndingIndex:    "An ending index is not valid",
+	tuneErrUnterminatedLoop:      "A loop is missing its end mark",
+	tuneErrUnterminatedChord:     "A chord is missing its end mark",
+	tuneErrAlreadyPlaying:        "You are already playing",
+}
+
+func (e tuneError) Error() string {
+	if e >= 0 && int(e) < len(tuneErrorMessages) {
+		return tuneErrorMessages[e]
 	}
-	notes := strings.Fields(tune)
-	if len(notes) == 0 {
-		return
+	return "Unknown tune error"
+}
+
+// Instrument flags.
+const (
+	instNoChords  = 0x01
+	instNoMelody  = 0x02
+	instLongChord = 0x04
+)
+
+// tuneVoice selects how an instrument is synthesized when it has no sample.
+type tuneVoice int
+
+const (
+	voicePluck tuneVoice = iota
+	voiceMallet
+	voiceFlute
+	voiceOrgan
+	voiceReed
+	voiceBrass
+	voiceBowed
+	voiceDrum
+)
+
+// tuneInstrument is a bard instrument, as in the classic client's 'clIn'
+// resource.
+type tuneInstrument struct {
+	Name string
+	// Program is the General MIDI program (1-128) the classic client
+	// played the instrument with; Voice is derived from it.
+	Program   int
+	Voice     tuneVoice
+	Octave    int // octave offset of the instrument's middle C
+	Polyphony int // chord notes that can sound at once
+	Flags     int
+	// ChordVelocity and MelodyVelocity are in percent.
+	ChordVelocity  int
+	MelodyVelocity int
+	// Restrict marks unplayable notes, one bit per semitone from the
+	// lowest note of the range down from bit 31 of the first word.
+	Restrict [2]uint32
+	// Sound is a CL_Sounds sample to pitch for each note, sounding at
+	// SoundNote, or 0 for the synthesized voice.
+	Sound     uint16
+	SoundNote int
+}
+
+// orgaDrumNotes leaves only G and B playable, to match the drum sample.
+var orgaDrumNotes = [2]uint32{0xFEEFEEFE, 0xE0000000}
+
+// orgaDrumSound is the CL_Sounds drum of the Orga Drum, the only instrument
+// the classic list gives a sample. The others name only a General MIDI
+// program, which the classic client left to QuickTime's synthesizer; there
+// is no CL_Sounds sample for them, so they are synthesized in the voice of
+// their program's family unless instruments.json maps them to one. The drum
+// sounds at its recorded pitch on g (SoundNote 55) and is pitched from
+// there, so b plays a major third higher.
+const orgaDrumSound = 49
+
+// tuneInstruments is the instrument list, indexed by the /inst number the
+// server sends. It follows 'clIn' 128 in ClanLord.r.
+var tuneInstruments = []tuneInstrument{
+	{Name: "Lucky Lyra", Program: 47, Octave: 1, Polyphony: 6},                           // Orchestral Harp
+	{Name: "Bone Flute", Program: 73, Octave: 1, Flags: instNoChords},                    // Piccolo
+	{Name: "Starbuck Harp", Program: 47, Octave: 0, Polyphony: 10},                       // Orchestral Harp
+	{Name: "Torjo", Program: 106, Octave: 0, Polyphony: 6},                               // Banjo
+	{Name: "Xylo", Program: 13, Octave: 0, Polyphony: 6},                                 // Marimba
+	{Name: "Gitor", Program: 25, Octave: 0, Polyphony: 6},                                // Acoustic Nylon Guitar
+	{Name: "Reed Flute", Program: 76, Octave: 1, Flags: instNoChords},                    // Pan Flute
+	{Name: "Temple Organ", Program: 17, Octave: -1, Polyphony: 10, Flags: instLongChord}, // Drawbar Organ
+	{Name: "Conch", Program: 94, Octave: -1, Polyphony: 1, Flags: instLongChord},         // Metal pad
+	{Name: "Ocarina", Program: 80, Octave: 1, Flags: instNoChords},
+	{Name: "Centaur Organ", Program: 77, Octave: 1, Polyphony: 6, Flags: instLongChord}, // Bottle Blow
+	{Name: "Vibra", Program: 12, Octave: 0, Polyphony: 6},                               // Vibraphone
+	{Name: "Tuborn", Program: 59, Octave: -1, Flags: instNoChords},                      // Tuba
+	{Name: "Bagpipe", Program: 110, Octave: 0, Polyphony: 3, Flags: instLongChord},
+	// Taiko Drum
+	{Name: "Orga Drum", Program: 117, Octave: -1, Flags: instNoChords, Restrict: orgaDrumNotes, Sound: orgaDrumSound, SoundNote: 55},
+	{Name: "Casserole", Program: 115, Octave: 0, Polyphony: 4},                      // Steel Drums
+	{Name: "Violène", Program: 41, Octave: 1, Polyphony: 2},                         // Violin
+	{Name: "Pine Flute", Program: 78, Octave: 1, Flags: instNoChords},               // Shakuhachi
+	{Name: "Groanbox", Program: 22, Octave: -1, Polyphony: 6, Flags: instLongChord}, // Accordion
+	{Name: "Gho-To", Program: 108, Octave: -1, Polyphony: 3},                        // Koto
+	{Name: "Mammoth Violène", Program: 44, Octave: -2, Polyphony: 2},                // Contrabass
+	{Name: "Gutbucket Bass", Program: 33, Octave: -2, Flags: instNoChords},          // Acoustic Fretless Bass
+	{Name: "Glass Jug", Program: 77, Octave: 0, Polyphony: 1, Flags: instNoChords},  // Bottle Blow
+}
+
+func init() {
+	for i := range tuneInstruments {
+		in := &tuneInstruments[i]
+		in.Voice = voiceForProgram(in.Program)
+		in.ChordVelocity = 100
+		in.MelodyVelocity = 100
 	}
-	rate := audioContext.SampleRate()
-	const durMS = 200
-	buf := make([]byte, 0, len(notes)*rate*durMS/1000*2)
-	for _, n := range notes {
-		freq := parseNote(n)
-		if freq == 0 {
-			continue
+}
+
+// voiceForProgram picks the synthesized voice closest to General MIDI
+// program p, by the program's family.
+func voiceForProgram(p int) tuneVoice {
+	switch {
+	case p >= 9 && p <= 16: // chromatic percussion
+		return voiceMallet
+	case p >= 17 && p <= 20: // organs
+		return voiceOrgan
+	case p >= 21 && p <= 24: // accordion and harmonica
+		return voiceReed
+	case p >= 25 && p <= 40, p == 46, p == 47: // guitars, basses, pizzicato, harp
+		return voicePluck
+	case p == 48, p >= 116 && p <= 119: // timpani and drums
+		return voiceDrum
+	case p >= 41 && p <= 56, p == 111: // strings and ensembles, fiddle
+		return voiceBowed
+	case p >= 57 && p <= 64, p >= 89 && p <= 96: // brass; slow swelling pads
+		return voiceBrass
+	case p >= 65 && p <= 72, p == 110, p == 112: // reeds, bag pipe, shanai
+		return voiceReed
+	case p >= 73 && p <= 80: // pipes
+		return voiceFlute
+	case p >= 105 && p <= 109: // plucked ethnic instruments
+		return voicePluck
+	case p >= 113 && p <= 115: // bells and steel drums
+		return voiceMallet
+	}
+	return voicePluck
+}
+
+func (in *tuneInstrument) hasMelody() bool { return in.Flags&instNoMelody == 0 }
+func (in *tuneInstrument) hasChords() bool { return in.Flags&instNoChords == 0 }
+
+func (in *tuneInstrument) polyphony() int {
+	if !in.hasChords() {
+		return 0
+	}
+	return min(in.Polyphony, tuneMaxChordNotes)
+}
+
+// restricted reports whether the instrument cannot play MIDI note n.
+func (in *tuneInstrument) restricted(n int) bool {
+	off := n - (tuneMiddleC - tuneOctave + in.Octave*tuneOctave)
+	if off < 0 || off >= 64 {
+		return true
+	}
+	return in.Restrict[off/32]>>(31-off%32)&1 != 0
+}
+
+// tuneNote is one sounding note. Times are in 1/600 s.
+type tuneNote struct {
+	Start    int
+	Duration int
+	Note     int // MIDI note number
+	Velocity int // 0-127
+	Chord    bool
+}
+
+// tune is compiled music, ready to render.
+type tune struct {
+	Notes     []tuneNote
+	Length    int // in 1/600 s, including the leading and trailing rests
+	NumNotes  int
+	NumChords int
+}
+
+type tuneStatus int
+
+const (
+	statusPickNote tuneStatus = iota
+	statusHasNote
+	statusPickModifiers
+	statusHasModifiers
+	statusPickTempo
+	statusHasTempo
+	statusPickVolume
+	statusHasChord
+	statusHasPause
+	statusHasMark
+	statusHasEndMark
+	statusHasEnding
+	statusHasDefEnding
+	statusStuffNote
+	statusStuffPause
+	statusStuffChord
+)
+
+// tuneMark is an open loop. Positions are offsets into the music, -1 when
+// unset.
+type tuneMark struct {
+	pos           int
+	count         int
+	end           int
+	index         int
+	ending        [tuneMaxEndings]int
+	endingDefault int
+	endingCurrent int
+	silentState   bool
+}
+
+// chordSlot is a chord note still sounding, aged by beats.
+type chordSlot struct {
+	note      int
+	duration  int // beats left, -1 for a held ($) note
+	startBeat int
+	event     int // index in tune.Notes
+}
+
+// tuneBuilder turns notation into a tune. It is a port of CTuneBuilder and
+// keeps its state machine so odd songs play the way they always have.
+type tuneBuilder struct {
+	inst           tuneInstrument
+	baseNote       int
+	minNote        int
+	maxNote        int
+	tempo          int
+	noteLength     int
+	pauseLength    int
+	velocity       int
+	chordVelocity  int
+	melodyVelocity int
+	chordVolume    int // 1-10
+	melodyVolume   int
+
+	out    *tune
+	now    int
+	beat   int
+	status tuneStatus
+	cmd    byte
+
+	octave   int
+	note     int
+	duration int
+	linked   bool
+
+	chord         []int
+	chordDuration int
+	buildingChord bool
+	current       [tuneMaxChordNotes]chordSlot
+	currentNum    int
+
+	pauseDuration int
+	silent        bool
+	marks         [tuneMaxMarks]tuneMark
+	markNum       int
+	comment       int
+	newTempo      int
+}
+
+func newTuneBuilder(inst tuneInstrument, tempo, velocity int) *tuneBuilder {
+	b := &tuneBuilder{}
+	b.setParameters(inst, tempo, velocity)
+	for i := range b.current {
+		b.current[i].note = -1
+	}
+	return b
+}
+
+func (b *tuneBuilder) setParameters(inst tuneInstrument, tempo, velocity int) {
+	b.inst = inst
+	b.baseNote = tuneMiddleC + inst.Octave*tuneOctave
+	b.minNote = b.baseNote - tuneOctave
+	b.maxNote = b.baseNote + (tuneNumOctaves-1)*tuneOctave
+	b.setTempo(tempo)
+	b.velocity = velocity
+	b.chordVelocity = velocity * inst.ChordVelocity / 100
+	b.melodyVelocity = velocity * inst.MelodyVelocity / 100
+}
+
+func (b *tuneBuilder) setTempo(tempo int) {
+	b.tempo = tempo
+	b.pauseLength = int(float32(tuneTicksPerSecond)/(float32(tempo)/60)) / 4
+	b.noteLength = b.pauseLength * tuneNoteRestRatio / 100
+}
+
+func isTuneSkip(c byte) bool     { return c == ' ' || c == '\r' || c == '\n' || c == '\t' }
+func isTuneDuration(c byte) bool { return c >= '1' && c <= '9' }
+func isTuneNote(c byte) bool     { return c >= 'a' && c <= 'g' || c >= 'A' && c <= 'G' }
+func isTuneOctave(c byte) bool {
+	return c == '+' || c == '-' || c == '=' || c == '/' || c == '\\'
+}
+func isTuneModifier(c byte) bool {
+	return c == '#' || c == '.' || c == '_' || isTuneDuration(c)
+}
+
+func (b *tuneBuilder) setOctave(c byte) tuneError {
+	switch c {
+	case '-':
+		if b.octave > -1 {
+			b.octave--
 		}
-		samples := synthSine(freq, rate, durMS)
-		for _, v := range samples {
-			buf = append(buf, byte(v), byte(v>>8))
+	case '+':
+		if b.octave < 1 {
+			b.octave++
 		}
+	case '=':
+		b.octave = 0
+	case '/':
+		b.octave = 1
+	case '\\':
+		b.octave = -1
+	default:
+		return tuneErrInvalidModifier
 	}
-	p := audioContext.NewPlayerFromBytes(buf)
-	p.SetVolume(0.2)
-	p.Play()
+	return tuneErrNone
 }
 
-// parseNote converts a note string like "C4" into a frequency in Hz.
-// If the octave is omitted, octave 4 is assumed. Only natural notes A-G
-// are recognised.
-func parseNote(s string) float64 {
-	if s == "" {
-		return 0
+func (b *tuneBuilder) setNote(c byte) {
+	midi := [...]int{69, 71, 60, 62, 64, 65, 67} // A-G
+	if c >= 'a' && c <= 'g' {
+		b.note = midi[c-'a'] + b.octave*tuneOctave
+		b.duration = tuneDurationBlack
+	} else {
+		b.note = midi[c-'A'] + b.octave*tuneOctave
+		b.duration = tuneDurationWhite
+	}
+	b.note -= tuneMiddleC - b.baseNote
+}
+
+func (b *tuneBuilder) setModifier(c byte) tuneError {
+	switch c {
+	case '#':
+		if b.note+1 > b.maxNote || b.note+1 >= tuneMiddleC+3*tuneOctave {
+			return tuneErrToneOverflow
+		}
+		b.note++
+	case '.':
+		if b.note-1 < b.minNote {
+			return tuneErrToneOverflow
+		}
+		b.note--
+	case '_':
+		b.linked = true
+	default:
+		if !isTuneDuration(c) {
+			return tuneErrInvalidModifier
+		}
+		b.duration = int(c - '0')
 	}
-	noteOffsets := map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
-	up := strings.ToUpper(s)
-	base, ok := noteOffsets[up[0]]
-	if !ok {
+	return tuneErrNone
+}
+
+// build compiles music. On error it returns the error and the offset in
+// music where it was found.
+func (b *tuneBuilder) build(music []byte) (*tune, tuneError, int) {
+	b.out = &tune{}
+	b.now, b.beat, b.octave = 0, 0, 0
+	b.chordVolume, b.melodyVolume = 10, 10
+	b.currentNum = 0
+	b.chord = b.chord[:0]
+	for i := range b.current {
+		b.current[i].duration = 0
+	}
+	b.markNum, b.comment, b.newTempo = 0, 0, 0
+	b.buildingChord, b.silent = false, false
+	b.status = statusPickNote
+
+	at := func(i int) byte {
+		if i >= 0 && i < len(music) {
+			return music[i]
+		}
 		return 0
 	}
-	octave := 4
-	if len(up) > 1 {
-		if o, err := strconv.Atoi(up[1:]); err == nil {
-			octave = o
+	err := b.stuffPause(-tuneStartPause)
+	last := statusPickNote
+	pos := 0
+	for (at(pos) != 0 || b.status != statusPickNote) && err == tuneErrNone {
+		c := at(pos)
+		next := false
+
+		// Comments nest.
+		if c == '>' {
+			if b.comment <= 0 {
+				err = tuneErrUnmatchedComment
+			} else {
+				b.comment--
+				if b.comment <= 0 {
+					next = true
+				}
+			}
+		}
+		if c == '<' {
+			b.comment++
 		}
+
+		switch {
+		case b.comment > 0 && c == 0:
+			// The music ended inside a comment.
+			err = tuneErrUnmatchedComment
+		case b.comment > 0:
+			next = true
+		case isTuneSkip(c):
+			next = true
+		case err != tuneErrNone || next:
+		default:
+			switch b.status {
+			case statusPickNote:
+				switch {
+				case isTuneNote(c):
+					b.status = statusHasNote
+				case !b.buildingChord && c == '[':
+					next = true
+					b.buildingChord = true
+					b.chord = b.chord[:0]
+				case b.buildingChord && c == ']':
+					next = true
+					b.status = statusHasChord
+				case !b.buildingChord && c == 'p':
+					next = true
+					b.status = statusHasPause
+				case isTuneOctave(c):
+					next = true
+					// Octaves don't change while skipping an ending.
+					if !b.silent {
+						err = b.setOctave(c)
+					}
+				case !b.buildingChord && c == '(':
+					if b.markNum+1 > tuneMaxMarks {
+						err = tuneErrTooManyMarks
+					} else {
+						b.status = statusHasMark
+						next = true
+					}
+				case !b.buildingChord && c == ')':
+					if b.markNum <= 0 {
+						err = tuneErrUnmatchedMark
+					} else {
+						b.status = statusHasEndMark
+						next = true
+					}
+				case c == '@':
+					// Silent passes over other endings may see chords
+					// still held there; the real pass checks again.
+					if (b.buildingChord || b.currentNum > 0) && !b.silent {
+						err = tuneErrInvalidTempoChange
+					} else {
+						b.newTempo = 0
+						b.cmd = 0
+						b.status = statusPickTempo
+						next = true
+					}
+				case c == '%' || c == '{' || c == '}':
+					b.cmd = c
+					next = true
+					b.status = statusPickVolume
+				case c == '|' || c == '!':
+					switch {
+					case b.buildingChord:
+						err = tuneErrEndingInChord
+					case b.markNum <= 0:
+						err = tuneErrEndingOutsideLoop
+					default:
+						b.cmd = c
+						if c == '!' {
+							b.status = statusHasDefEnding
+						} else {
+							b.status = statusHasEnding
+							next = true
+						}
+					}
+				default:
+					err = tuneErrInvalidNote
+				}
+
+			case statusHasDefEnding:
+				next = true
+				b.silent = true
+				mk := &b.marks[b.markNum-1]
+				// The first pass through a loop only records where the
+				// endings are.
+				if mk.count == 0 {
+					if mk.endingDefault >= 0 {
+						err = tuneErrDuplicateDefEnding
+					} else {
+						mk.endingDefault = pos + 1
+					}
+					b.status = statusPickNote
+				} else {
+					pos = mk.end
+					next = false
+					b.status = statusHasEndMark
+				}
+
+			case statusHasEnding:
+				b.silent = true
+				if !isTuneDuration(c) {
+					err = tuneErrInvalidEndingIndex
+					break
+				}
+				index := int(c - '0')
+				next = true
+				mk := &b.marks[b.markNum-1]
+				if mk.count == 0 {
+					if mk.ending[index] >= 0 {
+						err = tuneErrDuplicateEnding
+					} else {
+						mk.ending[index] = pos + 1
+					}
+					b.status = statusPickNote
+				} else {
+					pos = mk.end
+					next = false
+					b.status = statusHasEndMark
+				}
+
+			case statusPickVolume:
+				d := 0
+				if isTuneDuration(c) {
+					d = int(c - '0')
+					next = true
+				}
+				b.status = statusPickNote
+				if b.silent {
+					break
+				}
+				vol := &b.melodyVolume
+				if b.buildingChord {
+					vol = &b.chordVolume
+				}
+				switch b.cmd {
+				case '%':
+					if d == 0 {
+						d = 10
+					}
+					*vol = d
+				case '{':
+					*vol -= max(d, 1)
+				case '}':
+					*vol += max(d, 1)
+				}
+				*vol = min(max(*vol, 1), 10)
+
+			case statusPickTempo:
+				switch {
+				case b.newTempo == 0 && (c == '+' || c == '-' || c == '='):
+					b.cmd = c
+					next = true
+				case c >= '0' && c <= '9':
+					b.newTempo = b.newTempo*10 + int(c-'0')
+					next = true
+					if b.newTempo > tuneMaxTempo {
+						err = tuneErrInvalidTempo
+					}
+				default:
+					b.status = statusHasTempo
+					if b.silent {
+						// Checked when this part is played for real.
+						err = tuneErrNone
+						b.status = statusPickNote
+					}
+				}
+
+			case statusHasTempo:
+				if b.newTempo == 0 {
+					if b.cmd != 0 {
+						err = tuneErrModifierNeedValue
+					} else {
+						b.newTempo = tuneDefaultTempo
+					}
+				}
+				switch b.cmd {
+				case '+':
+					b.newTempo = min(b.tempo+b.newTempo, tuneMaxTempo)
+				case '-':
+					b.newTempo = max(b.tempo-b.newTempo, tuneMinTempo)
+				}
+				if b.newTempo < tuneMinTempo || b.newTempo > tuneMaxTempo {
+					err = tuneErrInvalidTempo
+				} else {
+					b.setTempo(b.newTempo)
+				}
+				b.status = statusPickNote
+
+			case statusHasMark:
+				mk := &b.marks[b.markNum]
+				*mk = tuneMark{pos: pos, endingDefault: -1, silentState: b.silent}
+				for i := range mk.ending {
+					mk.ending[i] = -1
+				}
+				b.markNum++
+				b.status = statusPickNote
+
+			case statusHasEndMark:
+				mk := &b.marks[b.markNum-1]
+				b.silent = mk.silentState
+				b.status = statusPickNote
+				if mk.count == 0 {
+					// End of the first pass: the endings are known, so
+					// go back and play the loop for real.
+					mk.count, mk.index, mk.end = 1, 1, pos
+					if isTuneDuration(c) {
+						mk.count = int(c - '0')
+					}
+				}
+				if mk.endingCurrent == 0 {
+					end := mk.ending[mk.index]
+					if end < 0 {
+						end = mk.endingDefault
+					}
+					mk.endingCurrent = mk.index
+					if end >= 0 {
+						pos = end
+						break
+					}
+				}
+				mk.endingCurrent = 0
+				if mk.count == 1 {
+					if isTuneDuration(c) {
+						next = true
+					}
+					b.markNum--
+				} else {
+					mk.count--
+					mk.index++
+					pos = mk.pos
+				}
+
+			case statusHasNote:
+				b.setNote(c)
+				b.status = statusPickModifiers
+				b.linked = false
+				next = true
+
+			case statusPickModifiers:
+				if isTuneModifier(c) {
+					b.status = statusHasModifiers
+				} else {
+					b.status = statusStuffNote
+				}
+
+			case statusHasModifiers:
+				if err = b.setModifier(c); err == tuneErrNone {
+					b.status = statusPickModifiers
+					next = true
+				}
+
+			case statusHasChord:
+				b.chordDuration = tuneDefaultChordDuration
+				if isTuneDuration(c) {
+					b.chordDuration = int(c - '0')
+					next = true
+				} else if c == '$' {
+					if b.inst.Flags&instLongChord != 0 {
+						b.chordDuration = 0
+						next = true
+					} else {
+						err = tuneErrUnsupportedInstrument
+					}
+				}
+				b.status = statusStuffChord
+
+			case statusHasPause:
+				b.pauseDuration = tuneDurationBlack
+				if isTuneDuration(c) {
+					b.pauseDuration = int(c - '0')
+					next = true
+				}
+				b.status = statusStuffPause
+
+			case statusStuffNote:
+				last = statusStuffNote
+				b.status = statusPickNote
+				if b.buildingChord {
+					if len(b.chord)+1 > b.inst.polyphony() {
+						err = tuneErrInvalidChord
+					}
+					b.chord = append(b.chord, b.note)
+				} else {
+					if b.silent {
+						break
+					}
+					b.stuffNote(b.note, b.linked, b.duration)
+				}
+				b.out.NumNotes++
+
+			case statusStuffChord:
+				last = statusStuffChord
+				b.buildingChord = false
+				b.status = statusPickNote
+				if b.silent {
+					break
+				}
+				err = b.stuffChord(b.chord, b.chordDuration)
+				b.out.NumChords++
+
+			case statusStuffPause:
+				last = statusStuffPause
+				b.status = statusPickNote
+				if b.silent {
+					break
+				}
+				err = b.stuffPause(b.pauseDuration)
+			}
+		}
+		if next && err == tuneErrNone {
+			pos++
+		}
+	}
+
+	if err == tuneErrNone && b.markNum > 0 {
+		err = tuneErrUnterminatedLoop
+	}
+	if err == tuneErrNone && b.buildingChord {
+		err = tuneErrUnterminatedChord
+	}
+	if err != tuneErrNone {
+		return nil, err, pos
+	}
+	b.finishLongChords()
+	if b.out.NumNotes > 0 && last != statusStuffPause {
+		b.stuffPause(tuneEndPause)
+	}
+	b.out.Length = b.now
+	return b.out, tuneErrNone, 0
+}
+
+// noteDuration is how long a note of d beats sounds; untied notes leave a
+// small gap before the next.
+func (b *tuneBuilder) noteDuration(linked bool, d int) int {
+	switch {
+	case linked:
+		return d * b.pauseLength
+	case d > 1:
+		return (d-1)*b.pauseLength + b.noteLength
+	default:
+		return b.noteLength
+	}
+}
+
+func (b *tuneBuilder) stuffNote(note int, linked bool, d int) {
+	if b.melodyVelocity != 0 && b.inst.hasMelody() && !b.inst.restricted(note) {
+		b.out.Notes = append(b.out.Notes, tuneNote{
+			Start:    b.now,
+			Duration: b.noteDuration(linked, d),
+			Note:     note,
+			Velocity: b.melodyVelocity * b.melodyVolume * 10 / 100,
+		})
+	}
+	b.now += d * b.pauseLength
+	b.incrementBeat(d)
+}
+
+func (b *tuneBuilder) stuffChord(chord []int, d int) tuneError {
+	if b.chordVelocity == 0 || !b.inst.hasChords() {
+		return tuneErrNone
+	}
+	poly := b.inst.polyphony()
+	dur := b.noteDuration(false, d)
+	for _, note := range chord {
+		if b.inst.restricted(note) {
+			continue
+		}
+		stuff := true
+		room := -1
+		for n := 0; n < poly; n++ {
+			cs := &b.current[n]
+			if cs.note != note {
+				continue
+			}
+			// Already sounding: a held note ends here and a timed one
+			// is replaced.
+			room = n
+			if cs.duration == -1 {
+				b.finishLongChord(n)
+				stuff = d != 0
+			} else if cs.duration > 0 {
+				cs.duration = 0
+				if b.currentNum > 0 {
+					b.currentNum--
+				}
+			}
+			break
+		}
+		if !stuff {
+			continue
+		}
+		if room == -1 {
+			if b.currentNum >= poly {
+				return tuneErrPolyphonyOverflow
+			}
+			for n := 0; n < poly; n++ {
+				if b.current[n].duration == 0 {
+					room = n
+					break
+				}
+			}
+			if room == -1 {
+				return tuneErrPolyphonyOverflow
+			}
+		}
+		cs := &b.current[room]
+		cs.note = note
+		cs.startBeat = b.beat
+		cs.event = len(b.out.Notes)
+		cs.duration = d
+		if d == 0 {
+			cs.duration = -1 // held until it is played again or the song ends
+		}
+		b.out.Notes = append(b.out.Notes, tuneNote{
+			Start:    b.now,
+			Duration: dur,
+			Note:     note,
+			Velocity: b.chordVelocity * b.chordVolume * 10 / 100,
+			Chord:    true,
+		})
+		b.currentNum++
+	}
+	return tuneErrNone
+}
+
+// stuffPause rests for d beats, or for -d ticks when d is negative.
+func (b *tuneBuilder) stuffPause(d int) tuneError {
+	if d < 0 {
+		b.now += -d
+		return tuneErrNone
+	}
+	b.now += d * b.pauseLength
+	b.incrementBeat(d)
+	return tuneErrNone
+}
+
+// incrementBeat advances the beat and ages the sounding chord notes.
+func (b *tuneBuilder) incrementBeat(d int) {
+	b.beat += d
+	for i := range b.current {
+		cs := &b.current[i]
+		if cs.duration <= 0 {
+			continue
+		}
+		if cs.duration-d <= 0 {
+			cs.duration = 0
+			if b.currentNum > 0 {
+				b.currentNum--
+			}
+		} else {
+			cs.duration -= d
+		}
+	}
+}
+
+// finishLongChord ends held note i now that its length is known.
+func (b *tuneBuilder) finishLongChord(i int) {
+	cs := &b.current[i]
+	if cs.duration != -1 {
+		return
+	}
+	b.out.Notes[cs.event].Duration = (b.beat - cs.startBeat) * b.pauseLength
+	cs.duration = 0
+	if b.currentNum > 0 {
+		b.currentNum--
 	}
-	midi := base + (octave+1)*12
-	return 440 * math.Pow(2, float64(midi-69)/12)
 }
 
-// synthSine generates a sine wave for the given frequency and duration.
-func synthSine(freq float64, rate, durMS int) []int16 {
-	n := rate * durMS / 1000
-	samples := make([]int16, n)
-	for i := 0; i < n; i++ {
-		v := math.Sin(2 * math.Pi * freq * float64(i) / float64(rate))
-		samples[i] = int16(v * math.MaxInt16)
+func (b *tuneBuilder) finishLongChords() {
+	for i := range b.current {
+		b.finishLongChord(i)
 	}
-	return samples
 }
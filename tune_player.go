@@ -0,0 +1,686 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tune queue limits, from the classic client's CTunePlayer and CTuneQueue.
+const (
+	tuneMaxPlayers  = 6 // slot 0 is the anonymous system queue
+	tuneMaxParts    = 5
+	tuneMaxSync     = 3 // performers in one ensemble
+	tunePartTimeout = 20 * time.Second
+)
+
+// tuneInstrumentFile optionally maps instruments to CL_Sounds samples,
+// replacing the defaults in tuneInstruments: {"21": {"sound": 49, "note": 36}}.
+// A sound of 0 synthesizes the instrument.
+const tuneInstrumentFile = "instruments.json"
+
+// tunePlayer holds one performer's song while its parts arrive and while
+// it plays.
+type tunePlayer struct {
+	id       uint32
+	touched  time.Time
+	inst     int
+	tempo    int
+	velocity int // percent
+	music    []byte
+	parts    int
+	played   bool
+	until    time.Time // when playback ends
+	voice    *mixVoice
+}
+
+func (tp *tunePlayer) playing(now time.Time) bool {
+	return tp.played && now.Before(tp.until)
+}
+
+// purgeable reports whether the slot can be reused: it finished playing or
+// gave up waiting for its remaining parts.
+func (tp *tunePlayer) purgeable(now time.Time) bool {
+	return !tp.playing(now) && (tp.played || now.Sub(tp.touched) > tunePartTimeout)
+}
+
+func (tp *tunePlayer) stop() {
+	if tp.voice != nil {
+		gMixer.stop(tp.voice)
+		tp.voice = nil
+	}
+	tp.until = time.Time{}
+}
+
+// tuneSync tracks the performers of a duet or trio so they start together
+// once everyone's song has arrived.
+type tuneSync struct {
+	want, got uint8
+	ids       [tuneMaxSync]uint32
+}
+
+func (s *tuneSync) wantID(id uint32) bool {
+	if id == 0 {
+		return false
+	}
+	for i := range s.ids {
+		if s.want&(1<<i) != 0 && s.ids[i] == id {
+			return true
+		}
+	}
+	for i := range s.ids {
+		if s.want&(1<<i) == 0 {
+			s.want |= 1 << i
+			s.ids[i] = id
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tuneSync) gotID(id uint32) {
+	for i := range s.ids {
+		if id != 0 && s.want&(1<<i) != 0 && s.ids[i] == id {
+			s.got |= 1 << i
+			return
+		}
+	}
+}
+
+func (s *tuneSync) have(id uint32) bool {
+	for i := range s.ids {
+		if id != 0 && s.got&(1<<i) != 0 && s.ids[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tuneSync) ready() bool { return s.want != 0 && s.want == s.got }
+func (s *tuneSync) reset()      { s.want, s.got = 0, 0 }
+
+// tuneQueue interprets the /music commands bard instruments send and plays
+// the songs. It is a port of CTuneQueue.
+type tuneQueue struct {
+	mu      sync.Mutex
+	players [tuneMaxPlayers]*tunePlayer
+	sync    tuneSync
+	now     func() time.Time
+	// start plays compiled songs together; tests replace it.
+	start func(tps []*tunePlayer, tunes []*tune)
+	// report shows errors for the performer's own songs.
+	report func(string)
+}
+
+var gTunes = newTuneQueue()
+
+func newTuneQueue() *tuneQueue {
+	q := &tuneQueue{now: time.Now, report: consoleMessage}
+	q.start = q.startTunes
+	return q
+}
+
+const (
+	tuneCmdBad = iota
+	tuneCmdMusic
+	tuneCmdPlay
+	tuneCmdStop
+	tuneCmdWho
+	tuneCmdTempo
+	tuneCmdInstrument
+	tuneCmdVolume
+	tuneCmdPart
+	tuneCmdWith
+	tuneCmdMe
+	tuneCmdNotes
+)
+
+// tuneCommands lists the long forms before the terse ones so "/part" is
+// not taken for "/P".
+var tuneCommands = []struct {
+	text string
+	cmd  int
+}{
+	{"/music", tuneCmdMusic},
+	{"/play", tuneCmdPlay},
+	{"/stop", tuneCmdStop},
+	{"/who", tuneCmdWho},
+	{"/tempo", tuneCmdTempo},
+	{"/inst", tuneCmdInstrument},
+	{"/vol", tuneCmdVolume},
+	{"/notes", tuneCmdNotes},
+	{"/part", tuneCmdPart},
+	{"/with", tuneCmdWith},
+	{"/me", tuneCmdMe},
+	{"/P", tuneCmdPlay},
+	{"/S", tuneCmdStop},
+	{"/W", tuneCmdWho},
+	{"/T", tuneCmdTempo},
+	{"/I", tuneCmdInstrument},
+	{"/V", tuneCmdVolume},
+	{"/N", tuneCmdNotes},
+	{"/M", tuneCmdPart},
+	{"/H", tuneCmdWith},
+	{"/E", tuneCmdMe},
+}
+
+// lookupTuneCommand matches a command at the start of s and returns it with
+// the rest of s.
+func lookupTuneCommand(s string) (int, string) {
+	for _, c := range tuneCommands {
+		if strings.HasPrefix(s, c.text) {
+			return c.cmd, s[len(c.text):]
+		}
+	}
+	return tuneCmdBad, s
+}
+
+// tuneAtoi reads leading decimal digits from s.
+func tuneAtoi(s string) (int, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
+
+// handleMusicCommand plays songs sent as "/music/..." info text and
+// reports whether s was one.
+func handleMusicCommand(s string) bool { return gTunes.handle(s) }
+
+func (q *tuneQueue) handle(s string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.idle()
+	s = strings.TrimPrefix(s, "\r")
+	cmd, p := lookupTuneCommand(s)
+	if cmd != tuneCmdMusic {
+		return false
+	}
+	handled := false
+	var who uint32
+	me := false
+	for {
+		cmd, p = lookupTuneCommand(p)
+		switch cmd {
+		case tuneCmdWho:
+			var n int
+			n, p = tuneAtoi(p)
+			who = uint32(n)
+		case tuneCmdMe:
+			me = true
+		case tuneCmdPlay:
+			q.queue(who, p, me)
+			return true
+		case tuneCmdStop:
+			handled = true
+			q.stopLocked(who)
+		default:
+			return handled
+		}
+		if !strings.HasPrefix(p, "/") {
+			return handled
+		}
+	}
+}
+
+// queue handles the rest of a /play command for performer who (0 for the
+// anonymous queue). showErrors is set for the performer's own songs.
+func (q *tuneQueue) queue(who uint32, s string, showErrors bool) {
+	inst, tempo, velocity := 0, tuneDefaultTempo, tuneDefaultVelocity
+	part := false
+	var with []uint32
+	cmd := tuneCmdBad
+	for done := false; !done; {
+		var n int
+		cmd, s = lookupTuneCommand(s)
+		switch cmd {
+		case tuneCmdTempo:
+			if tempo, s = tuneAtoi(s); tempo < tuneMinTempo || tempo > tuneMaxTempo {
+				tempo = tuneDefaultTempo
+			}
+		case tuneCmdInstrument:
+			if inst, s = tuneAtoi(s); inst < 0 || inst >= len(tuneInstruments) {
+				inst = 0
+			}
+		case tuneCmdVolume:
+			if velocity, s = tuneAtoi(s); velocity < 0 || velocity > 100 {
+				velocity = 100
+			}
+		case tuneCmdWith:
+			n, s = tuneAtoi(s)
+			if len(with) < tuneMaxSync {
+				with = append(with, uint32(n))
+			}
+		case tuneCmdPart:
+			part = true
+		default:
+			done = true
+		}
+	}
+	if cmd != tuneCmdNotes {
+		return
+	}
+	slot, ok := q.slot(who)
+	if !ok {
+		return
+	}
+	now := q.now()
+	if tp := q.players[slot]; tp != nil {
+		// A different instrument means something went wrong; dropping the
+		// old song lets the performers notice.
+		if tp.inst != inst {
+			tp.stop()
+			q.players[slot] = nil
+		}
+		if tempo == tuneDefaultTempo {
+			tempo = tp.tempo
+		}
+	}
+
+	err := tuneErrNone
+	if tp := q.players[slot]; tp != nil {
+		if tp.playing(now) {
+			err = tuneErrAlreadyPlaying
+			if showErrors {
+				q.report("* " + err.Error() + ".")
+			}
+		} else if !tp.queuePart(s, now) {
+			err = tuneErrOutOfMemory
+		}
+	} else {
+		tp = &tunePlayer{id: who, inst: inst, tempo: tempo, velocity: velocity}
+		q.players[slot] = tp
+		tp.queuePart(s, now)
+		q.sync.wantID(who)
+		for _, id := range with {
+			q.sync.wantID(id)
+		}
+	}
+	if !part {
+		q.sync.gotID(who)
+	}
+
+	if err == tuneErrNone && !part && (slot == 0 || q.sync.ready()) {
+		var tps []*tunePlayer
+		var tunes []*tune
+		for i, tp := range q.players {
+			if tp == nil || (i == 0) != (slot == 0) || (i > 0 && !q.sync.have(tp.id)) {
+				continue
+			}
+			if i == 0 {
+				// The anonymous queue uses this command's settings.
+				tp.inst, tp.tempo, tp.velocity = inst, tempo, velocity
+			}
+			b := newTuneBuilder(tuneInstrumentFor(tp.inst), tp.tempo, tuneDefaultVelocity*tp.velocity/100)
+			t, terr, _ := b.build(tp.music)
+			if terr != tuneErrNone {
+				if showErrors {
+					q.report("* " + terr.Error() + ".")
+				}
+				err = terr
+				break
+			}
+			tps = append(tps, tp)
+			tunes = append(tunes, t)
+		}
+		if err == tuneErrNone {
+			for i, tp := range tps {
+				tp.played = true
+				tp.until = now.Add(time.Duration(tunes[i].Length) * time.Second / tuneTicksPerSecond)
+			}
+			if q.start != nil {
+				q.start(tps, tunes)
+			}
+			if slot != 0 {
+				q.sync.reset()
+			}
+		}
+	}
+	if err != tuneErrNone && err != tuneErrAlreadyPlaying {
+		if tp := q.players[slot]; tp != nil {
+			tp.stop()
+		}
+		q.players[slot] = nil
+	}
+}
+
+// queuePart appends one part of a song.
+func (tp *tunePlayer) queuePart(s string, now time.Time) bool {
+	if tp.parts == tuneMaxParts {
+		return false
+	}
+	tp.music = append(tp.music, s...)
+	tp.parts++
+	tp.touched = now
+	return true
+}
+
+// slot finds the slot of performer id, or a free one.
+func (q *tuneQueue) slot(id uint32) (int, bool) {
+	if id == 0 {
+		return 0, true
+	}
+	for i := 1; i < tuneMaxPlayers; i++ {
+		if tp := q.players[i]; tp != nil && tp.id == id {
+			return i, true
+		}
+	}
+	for i := 1; i < tuneMaxPlayers; i++ {
+		if q.players[i] == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// idle drops finished and abandoned songs.
+func (q *tuneQueue) idle() {
+	now := q.now()
+	for i, tp := range q.players {
+		if tp != nil && tp.purgeable(now) {
+			tp.stop()
+			q.players[i] = nil
+			q.sync.reset()
+		}
+	}
+}
+
+// stop silences performer id, or everyone for 0.
+func (q *tuneQueue) stop(id uint32) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopLocked(id)
+}
+
+func (q *tuneQueue) stopLocked(id uint32) {
+	for i, tp := range q.players {
+		if tp != nil && (id == 0 || tp.id == id) {
+			tp.stop()
+			q.players[i] = nil
+		}
+	}
+	q.sync.reset()
+}
+
+// playLocalTune previews a song typed with /play. Plain notes may be given,
+// or the full form with /inst, /tempo and /notes.
+func playLocalTune(args string) {
+	if !strings.HasPrefix(args, "/") {
+		args = "/notes" + args
+	}
+	gTunes.handle("/music/me/play" + args)
+}
+
+var (
+	tuneSamplesOnce sync.Once
+	tuneSamples     map[int]struct {
+		Sound uint16 `json:"sound"`
+		Note  int    `json:"note"`
+	}
+)
+
+// tuneInstrumentFor returns instrument i with any sample mapping from
+// data/instruments.json applied over the default one.
+func tuneInstrumentFor(i int) tuneInstrument {
+	if i < 0 || i >= len(tuneInstruments) {
+		i = 0
+	}
+	tuneSamplesOnce.Do(func() {
+		data, err := os.ReadFile(filepath.Join(dataDirPath, tuneInstrumentFile))
+		if err != nil {
+			return
+		}
+		if err := json.Unmarshal(data, &tuneSamples); err != nil {
+			logError("%s: %v", tuneInstrumentFile, err)
+		}
+	})
+	in := tuneInstruments[i]
+	if m, ok := tuneSamples[i]; ok {
+		in.Sound = m.Sound
+		in.SoundNote = m.Note
+		if in.SoundNote == 0 {
+			in.SoundNote = tuneMiddleC
+		}
+	}
+	return in
+}
+
+// startTunes renders songs and starts them together in the mixer. It is
+// called with q.mu held, so rendering runs in its own goroutine; songs stopped
+// before they finish rendering are not started.
+func (q *tuneQueue) startTunes(tps []*tunePlayer, tunes []*tune) {
+	if audioContext == nil || gMixer == nil || blockSound {
+		return
+	}
+	insts := make([]tuneInstrument, len(tps))
+	for i, tp := range tps {
+		insts[i] = tuneInstrumentFor(tp.inst)
+	}
+	go func() {
+		rate := audioContext.SampleRate()
+		pcms := make([][]byte, len(tps))
+		for i, inst := range insts {
+			sample, sampleRate := tuneSample(inst)
+			pcms[i] = renderTune(tunes[i], inst, sample, sampleRate, rate)
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		var live []*tunePlayer
+		var livePCMs [][]byte
+		for i, tp := range tps {
+			// stop clears until.
+			if !tp.until.IsZero() {
+				live = append(live, tp)
+				livePCMs = append(livePCMs, pcms[i])
+			}
+		}
+		for i, v := range gMixer.play(soundMusic, livePCMs...) {
+			live[i].voice = v
+		}
+	}()
+}
+
+// tuneRelease is how long notes take to fade after they end.
+const tuneRelease = 0.12
+
+// renderTune mixes t into 16-bit stereo PCM at rate, pitching the
+// instrument's sample, which sounds at inst.SoundNote. Without a sample the
+// instrument's voice is synthesized.
+func renderTune(t *tune, inst tuneInstrument, sample []int16, sampleRate, rate int) []byte {
+	tail := int(tuneRelease*float64(rate)) + rate/2
+	mix := make([]float32, t.Length*rate/tuneTicksPerSecond+tail)
+	for _, n := range t.Notes {
+		start := n.Start * rate / tuneTicksPerSecond
+		dur := max(n.Duration*rate/tuneTicksPerSecond, 1)
+		amp := float32(n.Velocity) / 127 * 0.5
+		var v []float32
+		if sample != nil {
+			ratio := math.Pow(2, float64(n.Note-inst.SoundNote)/12)
+			v = pitchSample(sample, float64(sampleRate)/float64(rate)*ratio, dur, rate)
+		} else {
+			v = synthVoice(inst.Voice, midiFreq(n.Note), dur, rate)
+		}
+		for i, s := range v {
+			if j := start + i; j < len(mix) {
+				mix[j] += s * amp
+			}
+		}
+	}
+	peak := float32(1)
+	for _, s := range mix {
+		peak = max(peak, s, -s)
+	}
+	out := make([]byte, len(mix)*4)
+	for i, s := range mix {
+		v := uint16(int16(s / peak * math.MaxInt16))
+		binary.LittleEndian.PutUint16(out[4*i:], v)
+		binary.LittleEndian.PutUint16(out[4*i+2:], v)
+	}
+	return out
+}
+
+func midiFreq(note int) float64 {
+	return 440 * math.Pow(2, float64(note-69)/12)
+}
+
+// tuneSample returns the instrument's CL_Sounds sample as mono samples and
+// their rate, or nil when it has none or the sound is missing. loadSound
+// packs mono sounds as stereo frames, so the mono rate is twice the context
+// rate.
+func tuneSample(inst tuneInstrument) ([]int16, int) {
+	if inst.Sound == 0 || audioContext == nil {
+		return nil, 0
+	}
+	pcm := loadSound(inst.Sound)
+	if pcm == nil {
+		return nil, 0
+	}
+	s := make([]int16, len(pcm)/2)
+	for i := range s {
+		s[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	return s, 2 * audioContext.SampleRate()
+}
+
+// pitchSample plays src faster by step for dur samples, then fades it out
+// over the release.
+func pitchSample(src []int16, step float64, dur, rate int) []float32 {
+	rel := int(tuneRelease * float64(rate))
+	n := min(dur+rel, int(float64(len(src))/step))
+	out := make([]float32, max(n, 0))
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		frac := float32(pos - float64(j))
+		s0 := float32(src[j])
+		s1 := s0
+		if j+1 < len(src) {
+			s1 = float32(src[j+1])
+		}
+		v := (s0 + (s1-s0)*frac) / math.MaxInt16
+		if i >= dur {
+			v *= 1 - float32(i-dur)/float32(rel)
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// voiceShape describes a synthesized voice: harmonic amplitudes and an
+// envelope in seconds. Decay with zero sustain makes percussive voices.
+type voiceShape struct {
+	harmonics []float64
+	attack    float64
+	decay     float64
+	sustain   float64
+	vibrato   float64 // depth in semitones
+}
+
+var voiceShapes = map[tuneVoice]voiceShape{
+	voiceMallet: {harmonics: []float64{1, 0, 0, 0.3, 0, 0, 0, 0, 0, 0.1}, attack: 0.002, decay: 0.6},
+	voiceFlute:  {harmonics: []float64{1, 0.25, 0.1, 0.05}, attack: 0.05, decay: 0.2, sustain: 0.8, vibrato: 0.08},
+	voiceOrgan:  {harmonics: []float64{1, 0.8, 0.6, 0.5, 0.3, 0.2, 0.15, 0.1}, attack: 0.01, decay: 0.05, sustain: 0.9},
+	voiceReed:   {harmonics: []float64{1, 0.9, 0.8, 0.7, 0.6, 0.5, 0.4, 0.3, 0.2}, attack: 0.03, decay: 0.1, sustain: 0.85},
+	voiceBrass:  {harmonics: []float64{1, 0.7, 0.5, 0.4, 0.3, 0.2}, attack: 0.06, decay: 0.15, sustain: 0.8, vibrato: 0.05},
+	voiceBowed:  {harmonics: []float64{1, 0.5, 0.33, 0.25, 0.2, 0.16, 0.14, 0.12}, attack: 0.08, decay: 0.1, sustain: 0.85, vibrato: 0.12},
+}
+
+// synthVoice renders one note of dur samples, plus its release.
+func synthVoice(v tuneVoice, freq float64, dur, rate int) []float32 {
+	switch v {
+	case voicePluck:
+		return pluck(freq, dur, rate)
+	case voiceDrum:
+		return drum(freq, rate)
+	}
+	sh := voiceShapes[v]
+	rel := int(tuneRelease * float64(rate))
+	out := make([]float32, dur+rel)
+	norm := 0.0
+	for _, a := range sh.harmonics {
+		norm += a
+	}
+	phase := 0.0
+	level := 0.0
+	for i := range out {
+		t := float64(i) / float64(rate)
+		switch {
+		case i >= dur:
+			// release from wherever the envelope was
+		case t < sh.attack:
+			level = t / sh.attack
+		case sh.sustain == 0:
+			level = math.Exp(-(t - sh.attack) / sh.decay * 3)
+		case t < sh.attack+sh.decay:
+			level = 1 - (1-sh.sustain)*(t-sh.attack)/sh.decay
+		default:
+			level = sh.sustain
+		}
+		env := level
+		if i >= dur {
+			env = level * (1 - float64(i-dur)/float64(rel))
+		}
+		f := freq
+		if sh.vibrato != 0 && t > 0.15 {
+			f *= math.Pow(2, sh.vibrato*math.Sin(2*math.Pi*5.5*t)/12)
+		}
+		phase += 2 * math.Pi * f / float64(rate)
+		s := 0.0
+		for h, a := range sh.harmonics {
+			if a != 0 && f*float64(h+1) < float64(rate)/2 {
+				s += a * math.Sin(phase*float64(h+1))
+			}
+		}
+		out[i] = float32(s / norm * env)
+	}
+	return out
+}
+
+// pluck is a Karplus-Strong plucked string.
+func pluck(freq float64, dur, rate int) []float32 {
+	n := max(int(float64(rate)/freq), 2)
+	buf := make([]float64, n)
+	r := rnd32(uint32(freq*1000) | 1)
+	for i := range buf {
+		buf[i] = r.next()*2 - 1
+	}
+	rel := int(tuneRelease * float64(rate))
+	// Strings ring past the note; let them for a while.
+	total := dur + rel + rate/4
+	out := make([]float32, total)
+	for i := range out {
+		j := i % n
+		k := (i + 1) % n
+		v := buf[j]
+		buf[j] = 0.996 * 0.5 * (buf[j] + buf[k])
+		if i >= total-rel {
+			v *= 1 - float64(i-(total-rel))/float64(rel)
+		}
+		out[i] = float32(v)
+	}
+	return out
+}
+
+// drum is a pitched membrane: a falling sine with a burst of noise.
+func drum(freq float64, rate int) []float32 {
+	out := make([]float32, rate*2/5)
+	r := rnd32(0xD2D2)
+	phase := 0.0
+	for i := range out {
+		t := float64(i) / float64(rate)
+		f := freq * (1 + math.Exp(-t*30))
+		phase += 2 * math.Pi * f / float64(rate)
+		tone := math.Sin(phase) * math.Exp(-t*9)
+		noise := (r.next()*2 - 1) * math.Exp(-t*60) * 0.4
+		out[i] = float32(tone + noise)
+	}
+	return out
+}
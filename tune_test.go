@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func buildTune(t *testing.T, inst int, music string) *tune {
+	t.Helper()
+	b := newTuneBuilder(tuneInstruments[inst], tuneDefaultTempo, tuneDefaultVelocity)
+	tn, err, pos := b.build([]byte(music))
+	if err != tuneErrNone {
+		t.Fatalf("%q: %v at %d", music, err, pos)
+	}
+	return tn
+}
+
+func tuneNotes(tn *tune) []int {
+	var notes []int
+	for _, n := range tn.Notes {
+		notes = append(notes, n.Note)
+	}
+	return notes
+}
+
+func TestTuneTiming(t *testing.T) {
+	// At 120 bpm a beat is 75 ticks and an untied note sounds for 90% of
+	// its last beat.
+	tn := buildTune(t, 0, "c C c1 c_d")
+	want := []tuneNote{
+		{Start: 300, Duration: 142, Note: 72, Velocity: 100},
+		{Start: 450, Duration: 292, Note: 72, Velocity: 100},
+		{Start: 750, Duration: 67, Note: 72, Velocity: 100},
+		{Start: 825, Duration: 150, Note: 72, Velocity: 100},
+		{Start: 975, Duration: 142, Note: 74, Velocity: 100},
+	}
+	if len(tn.Notes) != len(want) {
+		t.Fatalf("notes = %+v", tn.Notes)
+	}
+	for i, n := range tn.Notes {
+		if n != want[i] {
+			t.Errorf("note %d = %+v, want %+v", i, n, want[i])
+		}
+	}
+	if want := 1125 + tuneEndPause*75; tn.Length != want {
+		t.Errorf("length = %d, want %d", tn.Length, want)
+	}
+}
+
+func TestTunePitch(t *testing.T) {
+	cases := []struct {
+		music string
+		want  []int
+	}{
+		{"c d e f g a b", []int{72, 74, 76, 77, 79, 81, 83}},
+		{"c# c. c#.", []int{73, 71, 72}},
+		{"-c =c +c", []int{60, 72, 84}},
+		{"\\c /c c", []int{60, 84, 84}},
+	}
+	for _, c := range cases {
+		got := tuneNotes(buildTune(t, 0, c.music))
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%q = %v, want %v", c.music, got, c.want)
+		}
+	}
+	// Instruments shift the scale by their octave.
+	if got := tuneNotes(buildTune(t, 7, "c")); !slices.Equal(got, []int{48}) {
+		t.Errorf("organ c = %v", got)
+	}
+}
+
+func TestTuneStructure(t *testing.T) {
+	cases := []struct {
+		music string
+		want  []int
+	}{
+		{"(cd)2 e", []int{72, 74, 72, 74, 76}},
+		{"(c|1d|2e)2", []int{72, 74, 72, 76}},
+		{"c <d <e> f> g", []int{72, 79}},
+		{"[ceg] c", []int{72, 76, 79, 72}},
+	}
+	for _, c := range cases {
+		got := tuneNotes(buildTune(t, 0, c.music))
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%q = %v, want %v", c.music, got, c.want)
+		}
+	}
+	tn := buildTune(t, 0, "[ceg]4 c")
+	if n := tn.Notes[0]; !n.Chord || n.Start != 300 || n.Duration != 292 {
+		t.Errorf("chord note = %+v", n)
+	}
+	if n := tn.Notes[3]; n.Chord || n.Start != 300 {
+		t.Errorf("melody note = %+v", n)
+	}
+	if tn := buildTune(t, 0, "@=60c"); tn.Notes[0].Duration != 285 {
+		t.Errorf("tempo 60 note = %+v", tn.Notes[0])
+	}
+	// The drum only sounds its G and B.
+	if got := tuneNotes(buildTune(t, 14, "c g b")); len(got) != 2 {
+		t.Errorf("drum = %v", got)
+	}
+}
+
+func TestTuneErrors(t *testing.T) {
+	cases := []struct {
+		inst  int
+		music string
+		err   tuneError
+	}{
+		{0, "z", tuneErrInvalidNote},
+		{0, "(cd", tuneErrUnterminatedLoop},
+		{0, "cd)", tuneErrUnmatchedMark},
+		{0, "[ce", tuneErrUnterminatedChord},
+		{0, "c<", tuneErrUnmatchedComment},
+		{0, "c>", tuneErrUnmatchedComment},
+		{0, "[cdefgab]", tuneErrInvalidChord},
+		{1, "[ceg] d", tuneErrInvalidChord}, // flutes play no chords
+	}
+	for _, c := range cases {
+		b := newTuneBuilder(tuneInstruments[c.inst], tuneDefaultTempo, tuneDefaultVelocity)
+		if _, err, _ := b.build([]byte(c.music)); err != c.err {
+			t.Errorf("%q: err = %v, want %v", c.music, err, c.err)
+		}
+	}
+}
+
+// testTuneQueue returns a queue on a fake clock that records what it
+// starts.
+func testTuneQueue() (*tuneQueue, *time.Time, *[][]*tune, *[]string) {
+	now := time.Unix(1000, 0)
+	var started [][]*tune
+	var reports []string
+	q := &tuneQueue{
+		now:    func() time.Time { return now },
+		start:  func(_ []*tunePlayer, tunes []*tune) { started = append(started, tunes) },
+		report: func(s string) { reports = append(reports, s) },
+	}
+	return q, &now, &started, &reports
+}
+
+func TestTuneQueue(t *testing.T) {
+	q, now, started, reports := testTuneQueue()
+	if q.handle("hello") {
+		t.Error("plain text handled as music")
+	}
+	if !q.handle("/music/play/inst4/notes cde") || len(*started) != 1 || len((*started)[0][0].Notes) != 3 {
+		t.Fatalf("anonymous song: started %v", *started)
+	}
+
+	// Parts are joined until the last one arrives.
+	q.handle("/music/who5/play/part/notes cd")
+	if len(*started) != 1 {
+		t.Fatal("started before the last part")
+	}
+	q.handle("/music/who5/play/notes e")
+	if len(*started) != 2 || !slices.Equal(tuneNotes((*started)[1][0]), []int{72, 74, 76}) {
+		t.Fatalf("parts: started %v", *started)
+	}
+
+	// A repeat while playing is ignored, and reported for our own songs.
+	q.handle("/music/who5/play/notes e")
+	q.handle("/music/who5/me/play/notes e")
+	if len(*started) != 2 || len(*reports) != 1 {
+		t.Errorf("repeat: started %d, reports %v", len(*started), *reports)
+	}
+	q.handle("/music/who5/stop")
+	if q.players[1] != nil {
+		t.Error("stop left the song queued")
+	}
+
+	// Duets start when both performers' songs are in.
+	*now = now.Add(time.Minute)
+	q.handle("/music/who6/play/with7/notes c")
+	if len(*started) != 2 {
+		t.Fatal("duet started early")
+	}
+	q.handle("/music/who7/play/with6/notes d")
+	if len(*started) != 3 || len((*started)[2]) != 2 {
+		t.Fatalf("duet: started %v", *started)
+	}
+
+	// Errors in our own songs are reported.
+	*now = now.Add(time.Minute)
+	q.handle("/music/who8/me/play/notes z")
+	if len(*reports) != 2 || q.players[1] != nil {
+		t.Errorf("bad song: reports %v", *reports)
+	}
+
+	// Songs whose parts stop arriving are dropped.
+	q.handle("/music/who9/play/part/notes c")
+	*now = now.Add(tunePartTimeout + time.Second)
+	q.idle()
+	for _, tp := range q.players {
+		if tp != nil {
+			t.Errorf("abandoned song kept: %+v", tp)
+		}
+	}
+}
+
+func TestRenderTune(t *testing.T) {
+	for i, inst := range tuneInstruments {
+		tn := buildTune(t, i, "g b")
+		pcm := renderTune(tn, inst, nil, 0, 8000)
+		if len(pcm)%4 != 0 || len(pcm) < tn.Length*8000/tuneTicksPerSecond*4 {
+			t.Errorf("%s: %d bytes", inst.Name, len(pcm))
+		}
+	}
+	for v := voicePluck; v <= voiceDrum; v++ {
+		for _, s := range synthVoice(v, 440, 1000, 8000) {
+			if math.IsNaN(float64(s)) || s > 2 || s < -2 {
+				t.Fatalf("voice %d sample %v", v, s)
+			}
+		}
+	}
+}
+
+func TestRenderSampledTune(t *testing.T) {
+	const orgaDrum = 14
+	inst := tuneInstruments[orgaDrum]
+	if inst.Sound != orgaDrumSound {
+		t.Fatalf("Orga Drum sound = %d, want %d", inst.Sound, orgaDrumSound)
+	}
+	// An 800 Hz square wave at twice the output rate, as tuneSample returns.
+	const rate = 8000
+	sample := make([]int16, 2*rate)
+	for i := range sample {
+		sample[i] = 20000
+		if i%20 >= 10 {
+			sample[i] = -20000
+		}
+	}
+	tn := buildTune(t, orgaDrum, "g +g")
+	pcm := renderTune(tn, inst, sample, 2*rate, rate)
+	// Its own g plays the sample as recorded, an octave up twice as fast.
+	for i, want := range []int{800, 1600} {
+		n := tn.Notes[i]
+		if n.Note != inst.SoundNote+12*i {
+			t.Fatalf("note %d = %d", i, n.Note)
+		}
+		start := n.Start * rate / tuneTicksPerSecond
+		dur := n.Duration * rate / tuneTicksPerSecond
+		crossings := 0
+		prev := int16(0)
+		for j := start; j < start+dur; j++ {
+			v := int16(binary.LittleEndian.Uint16(pcm[4*j:]))
+			if v != 0 && prev != 0 && (v < 0) != (prev < 0) {
+				crossings++
+			}
+			if v != 0 {
+				prev = v
+			}
+		}
+		if got := crossings * rate / (2 * dur); got < want*95/100 || got > want*105/100 {
+			t.Errorf("note %d sounds at %d Hz, want %d", i, got, want)
+		}
+	}
+
+	// A missing sound falls back to the synthesized drum.
+	synth := inst
+	synth.Sound = 0
+	if !slices.Equal(renderTune(tn, inst, nil, 0, rate), renderTune(tn, synth, nil, 0, rate)) {
+		t.Error("missing sample did not fall back to the synthesized voice")
+	}
+	if slices.Equal(pcm, renderTune(tn, inst, nil, 0, rate)) {
+		t.Error("sample not used")
+	}
+}
+
+func TestTuneInstrumentVoices(t *testing.T) {
+	want := map[string]tuneVoice{
+		"Lucky Lyra":      voicePluck,
+		"Xylo":            voiceMallet,
+		"Temple Organ":    voiceOrgan,
+		"Conch":           voiceBrass,
+		"Centaur Organ":   voiceFlute, // Bottle Blow in 'clIn'
+		"Bagpipe":         voiceReed,
+		"Orga Drum":       voiceDrum,
+		"Casserole":       voiceMallet,
+		"Mammoth Violène": voiceBowed,
+		"Groanbox":        voiceReed,
+	}
+	for _, in := range tuneInstruments {
+		if in.Program < 1 || in.Program > 128 {
+			t.Errorf("%s: program %d", in.Name, in.Program)
+		}
+		if v, ok := want[in.Name]; ok && in.Voice != v {
+			t.Errorf("%s: voice %d, want %d", in.Name, in.Voice, v)
+		}
+	}
+}
@@ -54,6 +54,8 @@ var windowsPlayersCB *eui.ItemData
 var windowsInventoryCB *eui.ItemData
 var windowsChatCB *eui.ItemData
 var windowsConsoleCB *eui.ItemData
+var windowsMapCB *eui.ItemData
+var windowsLogsCB *eui.ItemData
 var toolbarWin *eui.WindowData
 var hudWin *eui.WindowData
 var rightHandImg *eui.ItemData
@@ -66,6 +68,8 @@ var (
 	soundCacheLabel  *eui.ItemData
 	mobileBlendLabel *eui.ItemData
 	pictBlendLabel   *eui.ItemData
+	atlasLabel       *eui.ItemData
+	paletteLabel     *eui.ItemData
 	totalCacheLabel  *eui.ItemData
 
 	soundTestLabel  *eui.ItemData
@@ -80,6 +84,7 @@ var (
 	pictBlendCB     *eui.ItemData
 	precacheSoundCB *eui.ItemData
 	precacheImageCB *eui.ItemData
+	soundQualityDD  *eui.ItemData
 	noCacheCB       *eui.ItemData
 	potatoCB        *eui.ItemData
 )
@@ -107,6 +112,14 @@ func init() {
 			windowsConsoleCB.Checked = consoleWin != nil && consoleWin.IsOpen()
 			windowsConsoleCB.Dirty = true
 		}
+		if windowsMapCB != nil {
+			windowsMapCB.Checked = mapWin != nil && mapWin.IsOpen()
+			windowsMapCB.Dirty = true
+		}
+		if windowsLogsCB != nil {
+			windowsLogsCB.Checked = logsWin != nil && logsWin.IsOpen()
+			windowsLogsCB.Dirty = true
+		}
 		if windowsWin != nil {
 			windowsWin.Refresh()
 		}
@@ -142,6 +155,9 @@ func initUI() {
 	makeWindowsWindow()
 	makeInventoryWindow()
 	makePlayersWindow()
+	makeMapWindow()
+	makeLogsWindow()
+	makeHUDEditorWindow()
 	makeHelpWindow()
 	makeToolbar()
 
@@ -550,6 +566,7 @@ func makeDownloadsWindow() {
 				img.Denoise = gs.DenoiseImages
 				img.DenoiseSharpness = gs.DenoiseSharpness
 				img.DenoisePercent = gs.DenoisePercent
+				attachSpriteOverrides(img)
 				clImages = img
 			}
 
@@ -1315,6 +1332,37 @@ func makeSettingsWindow() {
 	}
 	left.AddItem(bubbleOpSlider)
 
+	readSlider, readEvents := eui.NewSlider()
+	readSlider.Label = "Bubble Reading Speed (wpm)"
+	readSlider.MinValue = 60
+	readSlider.MaxValue = 600
+	readSlider.IntOnly = true
+	readSlider.Value = float32(gs.BubbleReadingSpeed)
+	readSlider.Size = eui.Point{X: leftW - 10, Y: 24}
+	readSlider.Tooltip = "Longer messages stay up longer; lower values keep bubbles on screen longer"
+	readEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventSliderChanged {
+			gs.BubbleReadingSpeed = int(ev.Value)
+			settingsDirty = true
+		}
+	}
+	left.AddItem(readSlider)
+
+	perSpeakerSlider, perSpeakerEvents := eui.NewSlider()
+	perSpeakerSlider.Label = "Bubbles Per Speaker"
+	perSpeakerSlider.MinValue = 1
+	perSpeakerSlider.MaxValue = 5
+	perSpeakerSlider.IntOnly = true
+	perSpeakerSlider.Value = float32(gs.BubblesPerSpeaker)
+	perSpeakerSlider.Size = eui.Point{X: leftW - 10, Y: 24}
+	perSpeakerEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventSliderChanged {
+			gs.BubblesPerSpeaker = int(ev.Value)
+			settingsDirty = true
+		}
+	}
+	left.AddItem(perSpeakerSlider)
+
 	nameBgSlider, nameBgEvents := eui.NewSlider()
 	nameBgSlider.Label = "Name Background Opacity"
 	nameBgSlider.MinValue = 0
@@ -1329,6 +1377,162 @@ func makeSettingsWindow() {
 	}
 	left.AddItem(nameBgSlider)
 
+	label, _ = eui.NewText()
+	label.Text = "\nScreenshots (F12):"
+	label.FontSize = 15
+	label.Size = eui.Point{X: leftW, Y: 30}
+	left.AddItem(label)
+
+	shotCB, shotEvents := eui.NewCheckbox()
+	shotCB.Text = "Hide UI in screenshots"
+	shotCB.Size = eui.Point{X: leftW, Y: 24}
+	shotCB.Checked = gs.ScreenshotHideUI
+	shotCB.Tooltip = "Save only the game scene, without windows or status bars"
+	shotEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.ScreenshotHideUI = ev.Checked
+			settingsDirty = true
+		}
+	}
+	left.AddItem(shotCB)
+
+	label, _ = eui.NewText()
+	label.Text = "\nSound:"
+	label.FontSize = 15
+	label.Size = eui.Point{X: leftW, Y: 30}
+	left.AddItem(label)
+
+	for _, c := range []struct {
+		label string
+		value *float64
+	}{
+		{"Game Sounds Volume", &gs.GameVolume},
+		{"Music Volume", &gs.MusicVolume},
+		{"Alerts Volume", &gs.AlertVolume},
+	} {
+		volSlider, volEvents := eui.NewSlider()
+		volSlider.Label = c.label
+		volSlider.MinValue = 0
+		volSlider.MaxValue = 1
+		volSlider.Value = float32(*c.value)
+		volSlider.Size = eui.Point{X: leftW - 10, Y: 24}
+		value := c.value
+		volEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventSliderChanged {
+				*value = float64(ev.Value)
+				settingsDirty = true
+				updateSoundVolume()
+			}
+		}
+		left.AddItem(volSlider)
+	}
+
+	duckCB, duckEvents := eui.NewCheckbox()
+	duckCB.Text = "Lower sounds during alerts"
+	duckCB.Size = eui.Point{X: leftW, Y: 24}
+	duckCB.Checked = gs.DuckForAlerts
+	duckCB.Tooltip = "Quiet game sounds and music while an alert plays"
+	duckEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.DuckForAlerts = ev.Checked
+			settingsDirty = true
+			updateSoundVolume()
+		}
+	}
+	left.AddItem(duckCB)
+
+	label, _ = eui.NewText()
+	label.Text = "\nSpeech:"
+	label.FontSize = 15
+	label.Size = eui.Point{X: leftW, Y: 30}
+	left.AddItem(label)
+
+	speechCB, speechEvents := eui.NewCheckbox()
+	speechCB.Text = "Read messages aloud"
+	speechCB.Size = eui.Point{X: leftW, Y: 24}
+	speechCB.Checked = gs.SpeechEnabled
+	speechCB.Tooltip = "Speak the selected messages with espeak-ng, or the synthesizer in SpeechCommand"
+	speechEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.SpeechEnabled = ev.Checked
+			settingsDirty = true
+			updateSpeech()
+		}
+	}
+	left.AddItem(speechCB)
+
+	for _, c := range []struct {
+		label string
+		value *bool
+	}{
+		{"Thinks to you", &gs.SpeakThinksToYou},
+		{"Other thinks", &gs.SpeakThinks},
+		{"Yells", &gs.SpeakYells},
+		{"Speech and whispers", &gs.SpeakSpeech},
+		{"Your name mentioned", &gs.SpeakMentions},
+	} {
+		classCB, classEvents := eui.NewCheckbox()
+		classCB.Text = c.label
+		classCB.Size = eui.Point{X: leftW, Y: 24}
+		classCB.Checked = *c.value
+		value := c.value
+		classEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventCheckboxChanged {
+				*value = ev.Checked
+				settingsDirty = true
+			}
+		}
+		left.AddItem(classCB)
+	}
+
+	speechRateSlider, speechRateEvents := eui.NewSlider()
+	speechRateSlider.Label = "Speech Rate (wpm)"
+	speechRateSlider.MinValue = 80
+	speechRateSlider.MaxValue = 450
+	speechRateSlider.IntOnly = true
+	speechRateSlider.Value = float32(gs.SpeechRate)
+	speechRateSlider.Size = eui.Point{X: leftW - 10, Y: 24}
+	speechRateEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventSliderChanged {
+			gs.SpeechRate = int(ev.Value)
+			settingsDirty = true
+			updateSpeech()
+		}
+	}
+	left.AddItem(speechRateSlider)
+
+	label, _ = eui.NewText()
+	label.Text = "\nText Logs:"
+	label.FontSize = 15
+	label.Size = eui.Point{X: leftW, Y: 30}
+	left.AddItem(label)
+
+	textLogsCB, textLogsEvents := eui.NewCheckbox()
+	textLogsCB.Text = "Save chat and console"
+	textLogsCB.Size = eui.Point{X: leftW, Y: 24}
+	textLogsCB.Checked = gs.TextLogs
+	textLogsCB.Tooltip = "Write each character's chat and console to logs/text, a new file each session and day"
+	textLogsEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.TextLogs = ev.Checked
+			settingsDirty = true
+			if !ev.Checked {
+				closeTextLogs()
+			}
+		}
+	}
+	left.AddItem(textLogsCB)
+
+	logsBtn, logsEvents := eui.NewButton()
+	logsBtn.Text = "View Logs"
+	logsBtn.Size = eui.Point{X: leftW, Y: 24}
+	logsEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			openLogsWindow(ev.Item)
+		}
+	}
+	left.AddItem(logsBtn)
+
 	label, _ = eui.NewText()
 	label.Text = "\nQuality Settings:"
 	label.FontSize = 15
@@ -1369,6 +1573,17 @@ func makeSettingsWindow() {
 	}
 	right.AddItem(qualityBtn)
 
+	hudBtn, hudEvents := eui.NewButton()
+	hudBtn.Text = "HUD Layout"
+	hudBtn.Size = eui.Point{X: rightW, Y: 24}
+	hudEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			refreshHUDEditor()
+			hudEditWin.ToggleNear(ev.Item)
+		}
+	}
+	right.AddItem(hudBtn)
+
 	label, _ = eui.NewText()
 	label.Text = ""
 	label.Size = eui.Point{X: rightW, Y: 15}
@@ -1682,6 +1897,55 @@ func makeGraphicsWindow() {
 	}
 	advanced.AddItem(intCB)
 
+	upscaleDD, upscaleEvents := eui.NewDropdown()
+	upscaleDD.Label = "Pixel-art upscaler"
+	for i, f := range upscaleFilters {
+		upscaleDD.Options = append(upscaleDD.Options, f.label)
+		if f.name == gs.UpscaleFilter {
+			upscaleDD.Selected = i
+		}
+	}
+	upscaleDD.Size = eui.Point{X: rightW, Y: 24}
+	upscaleDD.Tooltip = "Enlarge the world with an edge-smoothing filter instead of plain scaling. Off with Potato GPU."
+	upscaleEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			gs.UpscaleFilter = upscaleFilters[ev.Index].name
+			settingsDirty = true
+		}
+	}
+	advanced.AddItem(upscaleDD)
+
+	cbDD, cbEvents := eui.NewDropdown()
+	cbDD.Label = "Colorblind mode"
+	for i, m := range colorblindModes {
+		cbDD.Options = append(cbDD.Options, m.label)
+		if m.name == gs.ColorblindMode {
+			cbDD.Selected = i
+		}
+	}
+	cbDD.Size = eui.Point{X: rightW, Y: 24}
+	cbDD.Tooltip = "Remap name tag, bubble and status bar colors"
+	cbEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			gs.ColorblindMode = colorblindModes[ev.Index].name
+			settingsDirty = true
+		}
+	}
+	advanced.AddItem(cbDD)
+
+	daltonCB, daltonEvents := eui.NewCheckbox()
+	daltonCB.Text = "Daltonize whole scene"
+	daltonCB.Tooltip = "Also apply the colorblind mode to the game world"
+	daltonCB.Size = eui.Point{X: rightW, Y: 24}
+	daltonCB.Checked = gs.DaltonizeScene
+	daltonEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.DaltonizeScene = ev.Checked
+			settingsDirty = true
+		}
+	}
+	advanced.AddItem(daltonCB)
+
 	outer.AddItem(simple)
 	outer.AddItem(advanced)
 	graphicsWin.AddItem(outer)
@@ -1892,6 +2156,26 @@ func makeQualityWindow() {
 	}
 	flow.AddItem(showFPSCB)
 
+	sqDD, soundQualityEvents := eui.NewDropdown()
+	soundQualityDD = sqDD
+	soundQualityDD.Label = "Sound resampling"
+	for i, q := range resampleQualities {
+		soundQualityDD.Options = append(soundQualityDD.Options, q.label)
+		if q.name == gs.SoundQuality {
+			soundQualityDD.Selected = i
+		}
+	}
+	soundQualityDD.Size = eui.Point{X: width, Y: 24}
+	soundQualityDD.Tooltip = "Sinc resampling removes the harsh aliasing of low-rate sounds but takes longer to load them"
+	soundQualityEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected {
+			gs.SoundQuality = resampleQualities[ev.Index].name
+			clearSoundCache()
+			settingsDirty = true
+		}
+	}
+	flow.AddItem(soundQualityDD)
+
 	psCB, precacheSoundEvents := eui.NewCheckbox()
 	precacheSoundCB = psCB
 	precacheSoundCB.Text = "Precache Sounds"
@@ -1989,6 +2273,34 @@ func makeQualityWindow() {
 	}
 	flow.AddItem(noCacheCB)
 
+	atlasCB, atlasEvents := eui.NewCheckbox()
+	atlasCB.Text = "Sprite atlas (fewer draw calls)"
+	atlasCB.Tooltip = "Pack sprites into shared textures so crowded scenes draw faster. Only used with Potato GPU; otherwise Ebiten packs them itself."
+	atlasCB.Size = eui.Point{X: width, Y: 24}
+	atlasCB.Checked = gs.SpriteAtlas
+	atlasEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.SpriteAtlas = ev.Checked
+			clearCaches()
+			settingsDirty = true
+		}
+	}
+	flow.AddItem(atlasCB)
+
+	paletteCB, paletteEvents := eui.NewCheckbox()
+	paletteCB.Text = "GPU palette recoloring"
+	paletteCB.Tooltip = "Recolor custom-colored mobiles with a shader instead of caching a copy per color set"
+	paletteCB.Size = eui.Point{X: width, Y: 24}
+	paletteCB.Checked = gs.PaletteShader
+	paletteEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.PaletteShader = ev.Checked
+			clearCaches()
+			settingsDirty = true
+		}
+	}
+	flow.AddItem(paletteCB)
+
 	pcCB, potatoEvents := eui.NewCheckbox()
 	potatoCB = pcCB
 	potatoCB.Text = "Potato GPU (low VRAM)"
@@ -1999,9 +2311,7 @@ func makeQualityWindow() {
 		if ev.Type == eui.EventCheckboxChanged {
 			gs.PotatoComputer = ev.Checked
 			applySettings()
-			if ev.Checked {
-				clearCaches()
-			}
+			clearCaches()
 			settingsDirty = true
 			if qualityPresetDD != nil {
 				qualityPresetDD.Selected = detectQualityPreset()
@@ -2057,6 +2367,19 @@ func makeDebugWindow() {
 	}
 	debugFlow.AddItem(bubbleCB)
 
+	hoverCB, hoverEvents := eui.NewCheckbox()
+	hoverCB.Text = "Hover Info"
+	hoverCB.Size = eui.Point{X: width, Y: 24}
+	hoverCB.Checked = gs.HoverInfo
+	hoverCB.Tooltip = "Describe the mobile under the cursor; with picture IDs shown, also list pictures"
+	hoverEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.HoverInfo = ev.Checked
+			settingsDirty = true
+		}
+	}
+	debugFlow.AddItem(hoverCB)
+
 	nightCB, nightEvents := eui.NewCheckbox()
 	nightCB.Text = "Night Effect"
 	nightCB.Size = eui.Point{X: width, Y: 24}
@@ -2161,6 +2484,19 @@ func makeDebugWindow() {
 	}
 	debugFlow.AddItem(pictIDCB)
 
+	profilerCB, profilerEvents := eui.NewCheckbox()
+	profilerCB.Text = "Frame profiler"
+	profilerCB.Tooltip = "Graph per-phase render timings over the last few seconds"
+	profilerCB.Size = eui.Point{X: width, Y: 24}
+	profilerCB.Checked = gs.frameProfiler
+	profilerEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			gs.frameProfiler = ev.Checked
+			settingsDirty = true
+		}
+	}
+	debugFlow.AddItem(profilerCB)
+
 	smoothinCB, smoothinEvents := eui.NewCheckbox()
 	smoothinCB.Text = "Tint moving objects red"
 	smoothinCB.Size = eui.Point{X: width, Y: 24}
@@ -2194,6 +2530,28 @@ func makeDebugWindow() {
 		}
 	}
 	debugFlow.AddItem(shiftSpriteCB)
+
+	assetBtn, assetEvents := eui.NewButton()
+	assetBtn.Text = "Image Browser"
+	assetBtn.Size = eui.Point{X: width, Y: 24}
+	assetBtn.Tooltip = "Browse and export pictures from CL_Images"
+	assetEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			openAssetBrowser(ev.Item)
+		}
+	}
+	debugFlow.AddItem(assetBtn)
+
+	soundBtn, soundEvents := eui.NewButton()
+	soundBtn.Text = "Sound Browser"
+	soundBtn.Size = eui.Point{X: width, Y: 24}
+	soundBtn.Tooltip = "Browse, play and export sounds from CL_Sounds"
+	soundEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			openSoundBrowser(ev.Item)
+		}
+	}
+	debugFlow.AddItem(soundBtn)
 	cacheLabel, _ := eui.NewText()
 	cacheLabel.Text = "Caches:"
 	cacheLabel.Size = eui.Point{X: width, Y: 24}
@@ -2236,6 +2594,18 @@ func makeDebugWindow() {
 	pictBlendLabel.FontSize = 10
 	debugFlow.AddItem(pictBlendLabel)
 
+	atlasLabel, _ = eui.NewText()
+	atlasLabel.Text = ""
+	atlasLabel.Size = eui.Point{X: width, Y: 24}
+	atlasLabel.FontSize = 10
+	debugFlow.AddItem(atlasLabel)
+
+	paletteLabel, _ = eui.NewText()
+	paletteLabel.Text = ""
+	paletteLabel.Size = eui.Point{X: width, Y: 24}
+	paletteLabel.FontSize = 10
+	debugFlow.AddItem(paletteLabel)
+
 	clearCacheBtn, clearCacheEvents := eui.NewButton()
 	clearCacheBtn.Text = "Clear All Caches"
 	clearCacheBtn.Size = eui.Point{X: width, Y: 24}
@@ -2287,6 +2657,20 @@ func updateDebugStats() {
 		pictBlendLabel.Text = fmt.Sprintf("World Blend Frames: %d (%s)", pictBlendCount, humanize.Bytes(uint64(pictBlendBytes)))
 		pictBlendLabel.Dirty = true
 	}
+	if atlasLabel != nil {
+		imageMu.Lock()
+		pages, bytes, evictions := sheetAtlas.stats()
+		imageMu.Unlock()
+		atlasLabel.Text = fmt.Sprintf("Atlas Pages: %d (%s), %d evicted", pages, humanize.Bytes(uint64(bytes)), evictions)
+		atlasLabel.Dirty = true
+	}
+	if paletteLabel != nil {
+		imageMu.Lock()
+		sheets, palettes := paletteCacheStats()
+		imageMu.Unlock()
+		paletteLabel.Text = fmt.Sprintf("Index Sheets: %d, Palettes: %d", sheets, palettes)
+		paletteLabel.Dirty = true
+	}
 	if soundCacheLabel != nil {
 		soundCacheLabel.Text = fmt.Sprintf("Sounds: %d (%s)", soundCount, humanize.Bytes(uint64(soundBytes)))
 		soundCacheLabel.Dirty = true
@@ -2382,6 +2766,39 @@ func makeWindowsWindow() {
 	}
 	flow.AddItem(consoleBox)
 
+	mapBox, mapBoxEvents := eui.NewCheckbox()
+	windowsMapCB = mapBox
+	mapBox.Text = "Map"
+	mapBox.Size = eui.Point{X: 128, Y: 24}
+	mapBox.Checked = mapWin != nil && mapWin.IsOpen()
+	mapBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				mapWin.MarkOpenNear(ev.Item)
+				setMapZoom(gs.AutoMapZoom)
+			} else {
+				mapWin.Close()
+			}
+		}
+	}
+	flow.AddItem(mapBox)
+
+	logsBox, logsBoxEvents := eui.NewCheckbox()
+	windowsLogsCB = logsBox
+	logsBox.Text = "Logs"
+	logsBox.Size = eui.Point{X: 128, Y: 24}
+	logsBox.Checked = logsWin != nil && logsWin.IsOpen()
+	logsBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				openLogsWindow(ev.Item)
+			} else {
+				logsWin.Close()
+			}
+		}
+	}
+	flow.AddItem(logsBox)
+
 	windowsWin.AddItem(flow)
 	windowsWin.AddWindow(false)
 
@@ -2425,6 +2842,7 @@ func makeHelpWindow() {
 		"Click-to-Toggle Walk - Left click toggles walking",
 		"Enter - Start typing / send command",
 		"Escape - Cancel typing",
+		"F12 or /screenshot - Save a screenshot",
 	}
 	for _, line := range helpTexts {
 		t, _ := eui.NewText()
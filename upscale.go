@@ -0,0 +1,209 @@
+package main
+
+import (
+	"image"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Pixel-art upscalers render the world at 1x and enlarge it to the
+// offscreen scale with an edge-aware filter instead of plain nearest or
+// linear scaling. Each filter is a Kage shader evaluated per output pixel,
+// so it works for any integer scale. They are off with PotatoComputer:
+// running them on the CPU would mean reading every frame back from the GPU.
+// upscale_test.go holds a CPU version of each that the shaders are checked
+// against.
+//
+// Both mirror the source neighbourhood so the output pixel always lies
+// in the bottom-right quadrant of its source pixel; E is the source pixel,
+// F the neighbour towards the output pixel horizontally, H vertically and I
+// diagonally.
+
+const (
+	upscaleNone    = ""
+	upscaleScale2x = "scale2x"
+	upscaleXBR     = "xbr"
+)
+
+// upscaleFilters lists the selectable filters in menu order.
+var upscaleFilters = []struct {
+	name  string
+	label string
+}{
+	{upscaleNone, "None"},
+	{upscaleScale2x, "Scale2x (EPX)"},
+	{upscaleXBR, "xBR"},
+}
+
+const upscaleShaderHeader = `//kage:unit pixels
+
+package main
+
+var Scale float
+
+func at(p vec2) vec4 {
+	return imageSrc0At(p)
+}
+
+// mirrored returns the source pixel centre and the sign that mirrors the
+// neighbourhood towards the output pixel, plus the mirrored position of the
+// output pixel inside its source pixel (always >= 0.5).
+func mirrored(srcPos vec2) (vec2, vec2, vec2) {
+	c := floor(srcPos) + 0.5
+	f := srcPos - floor(srcPos)
+	s := vec2(1)
+	if f.x < 0.5 {
+		s.x = -1
+		f.x = 1 - f.x
+	}
+	if f.y < 0.5 {
+		s.y = -1
+		f.y = 1 - f.y
+	}
+	return c, s, f
+}
+
+// corner is how much of the output pixel lies past the corner diagonal.
+func corner(f vec2) float {
+	return clamp((f.x+f.y-1.5)*Scale+1, 0, 1)
+}
+
+func yuv(c vec4) vec4 {
+	y := dot(c.rgb, vec3(0.299, 0.587, 0.114))
+	u := dot(c.rgb, vec3(-0.169, -0.331, 0.5))
+	v := dot(c.rgb, vec3(0.5, -0.419, -0.081))
+	return vec4(y, u, v, c.a)
+}
+`
+
+const scale2xShaderSrc = upscaleShaderHeader + `
+func same(a, b vec4) bool {
+	return length(a-b) < 0.002
+}
+
+func Fragment(dstPos vec4, srcPos vec2, color vec4) vec4 {
+	c, s, _ := mirrored(srcPos)
+	e := at(c)
+	f := at(c + s*vec2(1, 0))
+	h := at(c + s*vec2(0, 1))
+	d := at(c + s*vec2(-1, 0))
+	b := at(c + s*vec2(0, -1))
+	if same(f, h) && !same(f, d) && !same(h, b) {
+		return f * color
+	}
+	return e * color
+}
+`
+
+const xbrShaderSrc = upscaleShaderHeader + `
+func dist(a, b vec4) float {
+	d := abs(yuv(a) - yuv(b))
+	return 48*d.x + 7*d.y + 6*d.z + 48*d.w
+}
+
+func Fragment(dstPos vec4, srcPos vec2, color vec4) vec4 {
+	c, s, f := mirrored(srcPos)
+	e := at(c)
+	pf := at(c + s*vec2(1, 0))
+	h := at(c + s*vec2(0, 1))
+	i := at(c + s*vec2(1, 1))
+	b := at(c + s*vec2(0, -1))
+	d := at(c + s*vec2(-1, 0))
+	pc := at(c + s*vec2(1, -1))
+	g := at(c + s*vec2(-1, 1))
+	f4 := at(c + s*vec2(2, 0))
+	i4 := at(c + s*vec2(2, 1))
+	h5 := at(c + s*vec2(0, 2))
+	i5 := at(c + s*vec2(1, 2))
+
+	wd1 := dist(e, pc) + dist(e, g) + dist(i, f4) + dist(i, h5) + 4*dist(h, pf)
+	wd2 := dist(h, d) + dist(h, i5) + dist(pf, i4) + dist(pf, b) + 4*dist(e, i)
+	if wd1 < wd2 && dist(e, pf) > 0 && dist(e, h) > 0 {
+		px := h
+		if dist(e, pf) <= dist(e, h) {
+			px = pf
+		}
+		return mix(e, px, corner(f)) * color
+	}
+	return e * color
+}
+`
+
+var (
+	upscaleMu      sync.Mutex
+	upscaleShaders = map[string]*ebiten.Shader{}
+	upscaleFailed  = map[string]bool{}
+
+	upscaleBaseRT *ebiten.Image // world rendered at 1x
+)
+
+// upscaleShaderSource returns the Kage source of filter, or "" when filter
+// is not one of upscaleFilters, e.g. a name saved by an older version.
+func upscaleShaderSource(filter string) string {
+	switch filter {
+	case upscaleScale2x:
+		return scale2xShaderSrc
+	case upscaleXBR:
+		return xbrShaderSrc
+	}
+	return ""
+}
+
+func upscaleShader(filter string) *ebiten.Shader {
+	upscaleMu.Lock()
+	defer upscaleMu.Unlock()
+	if s, ok := upscaleShaders[filter]; ok || upscaleFailed[filter] {
+		return s
+	}
+	src := upscaleShaderSource(filter)
+	if src == "" {
+		return nil
+	}
+	s, err := ebiten.NewShader([]byte(src))
+	if err != nil {
+		logError("upscale shader %s: %v", filter, err)
+		upscaleFailed[filter] = true
+		return nil
+	}
+	upscaleShaders[filter] = s
+	return s
+}
+
+// upscaleActive reports whether the world should be rendered at 1x and
+// enlarged with gs.UpscaleFilter at the given offscreen scale.
+func upscaleActive(scale int) bool {
+	if gs.UpscaleFilter == upscaleNone || scale < 2 || gs.PotatoComputer {
+		return false
+	}
+	return upscaleShader(gs.UpscaleFilter) != nil
+}
+
+// ensureUpscaleBaseRT returns a cleared w×h image to render the 1x world into.
+func ensureUpscaleBaseRT(w, h int) *ebiten.Image {
+	if upscaleBaseRT == nil || upscaleBaseRT.Bounds().Dx() != w || upscaleBaseRT.Bounds().Dy() != h {
+		upscaleBaseRT = ebiten.NewImageWithOptions(image.Rect(0, 0, w, h), &ebiten.NewImageOptions{Unmanaged: true})
+	}
+	upscaleBaseRT.Clear()
+	return upscaleBaseRT
+}
+
+// drawUpscaled enlarges src by scale into dst using gs.UpscaleFilter.
+func drawUpscaled(dst, src *ebiten.Image, scale int) {
+	b := src.Bounds()
+	w, h := float32(b.Dx()*scale), float32(b.Dy()*scale)
+	sx0, sy0 := float32(b.Min.X), float32(b.Min.Y)
+	sx1, sy1 := float32(b.Max.X), float32(b.Max.Y)
+	vs := []ebiten.Vertex{
+		{DstX: 0, DstY: 0, SrcX: sx0, SrcY: sy0, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: w, DstY: 0, SrcX: sx1, SrcY: sy0, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: 0, DstY: h, SrcX: sx0, SrcY: sy1, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: w, DstY: h, SrcX: sx1, SrcY: sy1, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+	}
+	op := &ebiten.DrawTrianglesShaderOptions{
+		Uniforms: map[string]any{"Scale": float32(scale)},
+		Blend:    ebiten.BlendCopy,
+	}
+	op.Images[0] = src
+	dst.DrawTrianglesShader(vs, []uint16{0, 1, 2, 1, 3, 2}, upscaleShader(gs.UpscaleFilter), op)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestUpscaleScale2xDiagonal(t *testing.T) {
+	// A single-pixel diagonal staircase: Scale2x should fill the inner
+	// corners so the step becomes a smooth 45 degree edge.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+	src.SetRGBA(0, 0, white)
+	src.SetRGBA(1, 0, black)
+	src.SetRGBA(0, 1, black)
+	src.SetRGBA(1, 1, white)
+
+	out := upscaleRGBA(src, 2, upscaleScale2x, nil)
+	if out.Rect.Dx() != 4 || out.Rect.Dy() != 4 {
+		t.Fatalf("size = %v, want 4x4", out.Rect)
+	}
+	// Where the white pixels touch diagonally, their inner quadrants take
+	// the matching black neighbours and vice versa.
+	cases := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 1, black}, {2, 2, black}, {1, 2, white}, {2, 1, white},
+	}
+	for _, c := range cases {
+		if got := out.RGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("(%d,%d) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestUpscaleFlatImageUnchanged(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	c := color.RGBA{40, 80, 120, 255}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			src.SetRGBA(x, y, c)
+		}
+	}
+	for _, f := range upscaleFilters {
+		out := upscaleRGBA(src, 3, f.name, nil)
+		// Skip the outer ring, which blends with the transparent border.
+		for y := 3; y < 6; y++ {
+			for x := 3; x < 6; x++ {
+				if got := out.RGBAAt(x, y); got != c {
+					t.Fatalf("%s: (%d,%d) = %v, want %v", f.label, x, y, got, c)
+				}
+			}
+		}
+	}
+}
+
+func TestUpscaleUnknownFilterInactive(t *testing.T) {
+	prev := gs
+	defer func() { gs = prev }()
+	gs.UpscaleFilter = "hqx"
+	if upscaleActive(2) {
+		t.Error("filter dropped from upscaleFilters is still active")
+	}
+	gs.UpscaleFilter = upscaleScale2x
+	gs.PotatoComputer = true
+	if upscaleActive(2) {
+		t.Error("upscaler active with PotatoComputer")
+	}
+}
+
+// upscaleRGBA is the CPU version of the upscale shaders, the reference they
+// are checked against. It enlarges src by scale with filter, reusing out
+// when it has the right size.
+func upscaleRGBA(src *image.RGBA, scale int, filter string, out *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if out == nil || out.Rect.Dx() != w*scale || out.Rect.Dy() != h*scale {
+		out = image.NewRGBA(image.Rect(0, 0, w*scale, h*scale))
+	}
+	at := func(x, y int) upx {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return upx{}
+		}
+		o := y*src.Stride + x*4
+		p := src.Pix[o : o+4 : o+4]
+		return upx{float32(p[0]) / 255, float32(p[1]) / 255, float32(p[2]) / 255, float32(p[3]) / 255}
+	}
+	inv := 1 / float32(scale)
+	for oy := 0; oy < h*scale; oy++ {
+		for ox := 0; ox < w*scale; ox++ {
+			x, y := ox/scale, oy/scale
+			fx := (float32(ox%scale) + 0.5) * inv
+			fy := (float32(oy%scale) + 0.5) * inv
+			sx, sy := 1, 1
+			if fx < 0.5 {
+				sx, fx = -1, 1-fx
+			}
+			if fy < 0.5 {
+				sy, fy = -1, 1-fy
+			}
+			n := func(dx, dy int) upx { return at(x+sx*dx, y+sy*dy) }
+			var c upx
+			switch filter {
+			case upscaleScale2x:
+				c = scale2xPixel(n)
+			case upscaleXBR:
+				c = xbrPixel(n, upscaleCorner(fx, fy, scale))
+			default:
+				c = n(0, 0)
+			}
+			o := oy*out.Stride + ox*4
+			out.Pix[o+0] = uint8(c[0]*255 + 0.5)
+			out.Pix[o+1] = uint8(c[1]*255 + 0.5)
+			out.Pix[o+2] = uint8(c[2]*255 + 0.5)
+			out.Pix[o+3] = uint8(c[3]*255 + 0.5)
+		}
+	}
+	return out
+}
+
+// upx is a premultiplied color with components in 0..1.
+type upx [4]float32
+
+func (a upx) mix(b upx, t float32) upx {
+	for i := range a {
+		a[i] += (b[i] - a[i]) * t
+	}
+	return a
+}
+
+func (a upx) yuv() upx {
+	return upx{
+		0.299*a[0] + 0.587*a[1] + 0.114*a[2],
+		-0.169*a[0] - 0.331*a[1] + 0.5*a[2],
+		0.5*a[0] - 0.419*a[1] - 0.081*a[2],
+		a[3],
+	}
+}
+
+func upscaleCorner(fx, fy float32, scale int) float32 {
+	v := (fx+fy-1.5)*float32(scale) + 1
+	return float32(math.Max(0, math.Min(1, float64(v))))
+}
+
+func scale2xPixel(n func(dx, dy int) upx) upx {
+	e, f, h, d, b := n(0, 0), n(1, 0), n(0, 1), n(-1, 0), n(0, -1)
+	if f == h && f != d && h != b {
+		return f
+	}
+	return e
+}
+
+func xbrDist(a, b upx) float32 {
+	ya, yb := a.yuv(), b.yuv()
+	abs := func(v float32) float32 { return float32(math.Abs(float64(v))) }
+	return 48*abs(ya[0]-yb[0]) + 7*abs(ya[1]-yb[1]) + 6*abs(ya[2]-yb[2]) + 48*abs(ya[3]-yb[3])
+}
+
+func xbrPixel(n func(dx, dy int) upx, t float32) upx {
+	e, f, h, i := n(0, 0), n(1, 0), n(0, 1), n(1, 1)
+	b, d, c, g := n(0, -1), n(-1, 0), n(1, -1), n(-1, 1)
+	f4, i4, h5, i5 := n(2, 0), n(2, 1), n(0, 2), n(1, 2)
+	wd1 := xbrDist(e, c) + xbrDist(e, g) + xbrDist(i, f4) + xbrDist(i, h5) + 4*xbrDist(h, f)
+	wd2 := xbrDist(h, d) + xbrDist(h, i5) + xbrDist(f, i4) + xbrDist(f, b) + 4*xbrDist(e, i)
+	ef, eh := xbrDist(e, f), xbrDist(e, h)
+	if wd1 < wd2 && ef > 0 && eh > 0 {
+		px := h
+		if ef <= eh {
+			px = f
+		}
+		return e.mix(px, t)
+	}
+	return e
+}
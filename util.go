@@ -14,6 +14,7 @@ import (
 	"strconv"
 
 	"golang.org/x/crypto/twofish"
+	"golang.org/x/text/encoding/charmap"
 )
 
 func simpleEncrypt(data []byte) {
@@ -28,7 +29,23 @@ func simpleEncrypt(data []byte) {
 	}
 }
 
-func encodeMacRoman(s string) []byte { return []byte(s) }
+// encodeMacRoman converts s to Mac OS Roman for the server. Characters
+// MacRoman lacks become '?'.
+func encodeMacRoman(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		if b, ok := charmap.Macintosh.EncodeRune(r); ok {
+			out = append(out, b)
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
 
 func encodeFullVersion(v int) uint32 { return uint32(v) << 8 }
 